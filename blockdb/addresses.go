@@ -0,0 +1,547 @@
+package blockdb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+)
+
+const (
+	// address key + 0x00 + tx hash + AddressTxOut/AddressTxIn + big-endian index -> AddressTxRow
+	BucketAddressIndex = "AddressIndex"
+
+	// SpentTxOutKey -> the value of the output and the address keys it pays to.  This lets us find the
+	// addresses that an input spends from without loading the previous transaction.
+	BucketTxOutAddresses = "TxOutAddresses"
+
+	// SpentTxOutKey -> pendingSpendRow, for inputs whose previous output hasn't been indexed yet
+	BucketPendingAddressSpends = "PendingAddressSpends"
+
+	BucketAddressesIndexedBlocks = "AddressesIndexedBlocks"
+)
+
+const (
+	AddressTxOut byte = 0 // the address was funded by the given output
+	AddressTxIn  byte = 1 // the address was spent from by the given input
+)
+
+// AddressKeysForScript returns the keys that the address index uses for an output script: the encoded
+// address(es) it pays to, decoded the same way as Tx.GetTxOutAddresses, or, for scripts that don't decode to
+// an address (including segwit outputs, which btcutil can't encode), the hex SHA256 of the script.
+func AddressKeysForScript(pkScript []byte) []string {
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, &chaincfg.MainNetParams)
+	if err == nil && len(addrs) > 0 {
+		keys := make([]string, len(addrs))
+		for i, addr := range addrs {
+			keys[i] = addr.EncodeAddress()
+		}
+		return keys
+	}
+
+	return []string{ScriptHashKey(pkScript)}
+}
+
+// AddressIndexKey returns the address index key for an address given by the user.  Segwit and taproot
+// addresses (bc1...) are indexed under the ScriptHashKey of the script they pay to, since btcutil can't
+// encode them; any other address is its own key.
+func AddressIndexKey(addr string) string {
+	if strings.HasPrefix(strings.ToLower(addr), "bc1") {
+		if pkScript, err := utils.DecodeSegwitAddress(addr); err == nil {
+			return ScriptHashKey(pkScript)
+		}
+	}
+	return addr
+}
+
+// ScriptHashKey is the address index key for a script that doesn't decode to an address.
+func ScriptHashKey(pkScript []byte) string {
+	hash := sha256.Sum256(pkScript)
+	return hex.EncodeToString(hash[:])
+}
+
+type AddressTxRow struct {
+	Value     Satoshis
+	Timestamp int64
+}
+
+func newAddressTxRowFromBytes(bs []byte) (AddressTxRow, error) {
+	row := AddressTxRow{}
+	err := binary.Read(bytes.NewReader(bs), binary.LittleEndian, &row)
+	if err != nil {
+		return AddressTxRow{}, err
+	}
+	return row, nil
+}
+
+func (r AddressTxRow) ToBytes() ([]byte, error) {
+	data := &bytes.Buffer{}
+	err := binary.Write(data, binary.LittleEndian, r)
+	if err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+// AddressTx is one funding or spending event from the address index.
+type AddressTx struct {
+	TxHash chainhash.Hash
+	Kind   byte // AddressTxOut or AddressTxIn
+	Index  uint32
+	AddressTxRow
+}
+
+func addressIndexPrefix(addrKey string) []byte {
+	return append([]byte(addrKey), 0)
+}
+
+func addressIndexKey(addrKey string, txHash chainhash.Hash, kind byte, index uint32) []byte {
+	key := addressIndexPrefix(addrKey)
+	key = append(key, txHash[:]...)
+	key = append(key, kind)
+	idx := make([]byte, 4)
+	binary.BigEndian.PutUint32(idx, index)
+	return append(key, idx...)
+}
+
+func parseAddressIndexKey(prefixLen int, key []byte) (chainhash.Hash, byte, uint32) {
+	var txHash chainhash.Hash
+	copy(txHash[:], key[prefixLen:prefixLen+chainhash.HashSize])
+	kind := key[prefixLen+chainhash.HashSize]
+	index := binary.BigEndian.Uint32(key[prefixLen+chainhash.HashSize+1:])
+	return txHash, kind, index
+}
+
+// txOutAddressesRow is stored in BucketTxOutAddresses as the value, followed by the address keys separated
+// by 0x00 bytes.
+type txOutAddressesRow struct {
+	value    Satoshis
+	addrKeys []string
+}
+
+func (r txOutAddressesRow) ToBytes() []byte {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, uint64(r.value))
+	return append(data, []byte(strings.Join(r.addrKeys, "\x00"))...)
+}
+
+func newTxOutAddressesRowFromBytes(bs []byte) (txOutAddressesRow, error) {
+	if len(bs) < 8 {
+		return txOutAddressesRow{}, fmt.Errorf("txout addresses row is too short (%v bytes)", len(bs))
+	}
+	return txOutAddressesRow{
+		value:    Satoshis(binary.LittleEndian.Uint64(bs[:8])),
+		addrKeys: strings.Split(string(bs[8:]), "\x00"),
+	}, nil
+}
+
+type pendingSpendRow struct {
+	InputTxHash chainhash.Hash
+	TxInIndex   uint32
+	Timestamp   int64
+}
+
+func (r pendingSpendRow) ToBytes() ([]byte, error) {
+	data := &bytes.Buffer{}
+	err := binary.Write(data, binary.LittleEndian, r)
+	if err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+func newPendingSpendRowFromBytes(bs []byte) (pendingSpendRow, error) {
+	row := pendingSpendRow{}
+	err := binary.Read(bytes.NewReader(bs), binary.LittleEndian, &row)
+	if err != nil {
+		return pendingSpendRow{}, err
+	}
+	return row, nil
+}
+
+// blockAddressRows holds what the address index needs from a block.  It's computed from the parsed block
+// (which can happen on any goroutine) and then written with put.
+type blockAddressRows struct {
+	timestamp int64
+	txOuts    []addressTxOut
+	txIns     []addressTxIn
+}
+
+type addressTxOut struct {
+	outpoint SpentTxOutKey
+	txOutAddressesRow
+}
+
+type addressTxIn struct {
+	outpoint SpentTxOutKey
+	spender  SpentTxOutRow
+}
+
+func newBlockAddressRows(bl *btcutil.Block) blockAddressRows {
+	rows := blockAddressRows{timestamp: bl.MsgBlock().Header.Timestamp.Unix()}
+
+	for _, tx := range bl.Transactions() {
+		for txoutIdx, txout := range tx.MsgTx().TxOut {
+			rows.txOuts = append(rows.txOuts, addressTxOut{
+				outpoint:          SpentTxOutKey{TxHash: *tx.Hash(), TxOutIndex: uint32(txoutIdx)},
+				txOutAddressesRow: txOutAddressesRow{value: Satoshis(txout.Value), addrKeys: AddressKeysForScript(txout.PkScript)},
+			})
+		}
+
+		if IsCoinbaseTx(tx.MsgTx()) {
+			continue
+		}
+
+		for txinIdx, txin := range tx.MsgTx().TxIn {
+			rows.txIns = append(rows.txIns, addressTxIn{
+				outpoint: SpentTxOutKey{TxHash: txin.PreviousOutPoint.Hash, TxOutIndex: txin.PreviousOutPoint.Index},
+				spender:  SpentTxOutRow{InputTxHash: *tx.Hash(), TxInIndex: uint32(txinIdx)},
+			})
+		}
+	}
+
+	return rows
+}
+
+func (r blockAddressRows) numRows() int {
+	return len(r.txOuts) + len(r.txIns)
+}
+
+// put writes the block's funding rows, and a spending row for every input whose previous output is
+// already in the index.  The other inputs are parked in BucketPendingAddressSpends until the output they
+// spend gets indexed, so .dat files can be indexed in any order.
+func (r blockAddressRows) put(boltTx *bolt.Tx) error {
+	addrBucket, err := boltTx.CreateBucketIfNotExists([]byte(BucketAddressIndex))
+	if err != nil {
+		return fmt.Errorf("create bucket: %s", err)
+	}
+	txoutBucket, err := boltTx.CreateBucketIfNotExists([]byte(BucketTxOutAddresses))
+	if err != nil {
+		return fmt.Errorf("create bucket: %s", err)
+	}
+	pendingBucket, err := boltTx.CreateBucketIfNotExists([]byte(BucketPendingAddressSpends))
+	if err != nil {
+		return fmt.Errorf("create bucket: %s", err)
+	}
+
+	putRows := func(addrKeys []string, txHash chainhash.Hash, kind byte, index uint32, row AddressTxRow) error {
+		rowBytes, err := row.ToBytes()
+		if err != nil {
+			return err
+		}
+		for _, addrKey := range addrKeys {
+			err = addrBucket.Put(addressIndexKey(addrKey, txHash, kind, index), rowBytes)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, txout := range r.txOuts {
+		err := putRows(txout.addrKeys, txout.outpoint.TxHash, AddressTxOut, txout.outpoint.TxOutIndex, AddressTxRow{Value: txout.value, Timestamp: r.timestamp})
+		if err != nil {
+			return err
+		}
+
+		outpointBytes, err := txout.outpoint.ToBytes()
+		if err != nil {
+			return err
+		}
+
+		err = txoutBucket.Put(outpointBytes, txout.txOutAddressesRow.ToBytes())
+		if err != nil {
+			return err
+		}
+
+		pendingBytes := pendingBucket.Get(outpointBytes)
+		if pendingBytes == nil {
+			continue
+		}
+
+		pending, err := newPendingSpendRowFromBytes(pendingBytes)
+		if err != nil {
+			return err
+		}
+
+		err = putRows(txout.addrKeys, pending.InputTxHash, AddressTxIn, pending.TxInIndex, AddressTxRow{Value: txout.value, Timestamp: pending.Timestamp})
+		if err != nil {
+			return err
+		}
+
+		err = pendingBucket.Delete(outpointBytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, txin := range r.txIns {
+		outpointBytes, err := txin.outpoint.ToBytes()
+		if err != nil {
+			return err
+		}
+
+		txoutBytes := txoutBucket.Get(outpointBytes)
+		if txoutBytes == nil {
+			pendingBytes, err := pendingSpendRow{InputTxHash: txin.spender.InputTxHash, TxInIndex: txin.spender.TxInIndex, Timestamp: r.timestamp}.ToBytes()
+			if err != nil {
+				return err
+			}
+
+			err = pendingBucket.Put(outpointBytes, pendingBytes)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		txout, err := newTxOutAddressesRowFromBytes(txoutBytes)
+		if err != nil {
+			return err
+		}
+
+		err = putRows(txout.addrKeys, txin.spender.InputTxHash, AddressTxIn, txin.spender.TxInIndex, AddressTxRow{Value: txout.value, Timestamp: r.timestamp})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *BlockDB) IndexDATFileAddresses(startBlock, endBlock uint64, force bool) error {
+	const blocksPerBoltTx = 100
+
+	for i := int(startBlock); i < int(endBlock)+1; i++ {
+		datFilename := fmt.Sprintf("blk%05d.dat", i)
+		datFilepath := filepath.Join(db.datFileDir, datFilename)
+
+		if !force {
+			isIndexed, err := db.CheckIfAddressesIndexed(datFilename)
+			if err != nil {
+				return err
+			} else if isIndexed {
+				fmt.Println(datFilename, "already indexed, skipping")
+				continue
+			}
+		}
+
+		fmt.Println("parsing block file", datFilepath)
+
+		blocks, err := utils.LoadBlocksFromDAT(datFilepath)
+		if err != nil {
+			return err
+		}
+
+		for start := 0; start < len(blocks); start += blocksPerBoltTx {
+			end := start + blocksPerBoltTx
+			if end > len(blocks) {
+				end = len(blocks)
+			}
+
+			err := db.store.Update(func(boltTx *bolt.Tx) error {
+				for _, bl := range blocks[start:end] {
+					err := newBlockAddressRows(bl).put(boltTx)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		err = db.SetAddressesIndexed(datFilename)
+		if err != nil {
+			return err
+		}
+	}
+
+	numPending, err := db.countPendingAddressSpends()
+	if err != nil {
+		return err
+	}
+	if numPending > 0 {
+		fmt.Printf("%v inputs spend outputs that haven't been indexed yet.  They'll be added to the index once the .dat files containing those outputs are indexed.\n", numPending)
+	}
+
+	return nil
+}
+
+func (db *BlockDB) countPendingAddressSpends() (int, error) {
+	var n int
+	err := db.store.View(func(boltTx *bolt.Tx) error {
+		bucket := boltTx.Bucket([]byte(BucketPendingAddressSpends))
+		if bucket == nil {
+			return nil
+		}
+		n = bucket.Stats().KeyN
+		return nil
+	})
+	return n, err
+}
+
+func (db *BlockDB) CheckIfAddressesIndexed(filename string) (bool, error) {
+	var indexed bool
+	err := db.store.View(func(boltTx *bolt.Tx) error {
+		bucket := boltTx.Bucket([]byte(BucketAddressesIndexedBlocks))
+		if bucket == nil {
+			return nil
+		}
+
+		indexed = bucket.Get([]byte(filepath.Base(filename))) != nil
+		return nil
+	})
+	return indexed, err
+}
+
+func (db *BlockDB) SetAddressesIndexed(filename string) error {
+	return db.store.Update(func(boltTx *bolt.Tx) error {
+		bucket, err := boltTx.CreateBucketIfNotExists([]byte(BucketAddressesIndexedBlocks))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(filepath.Base(filename)), []byte{1})
+	})
+}
+
+// HasAddressIndex returns true once "builddb addresses" (or "builddb all") has indexed at least one .dat file.
+func (db *BlockDB) HasAddressIndex() (bool, error) {
+	var exists bool
+	err := db.store.View(func(boltTx *bolt.Tx) error {
+		exists = boltTx.Bucket([]byte(BucketAddressIndex)) != nil
+		return nil
+	})
+	return exists, err
+}
+
+// GetAddressTxs returns every funding and spending event in the local address index for the given address
+// (or script hash key), oldest first.
+func (db *BlockDB) GetAddressTxs(addrKey string) ([]AddressTx, error) {
+	addrKey = AddressIndexKey(addrKey)
+	txs := []AddressTx{}
+
+	err := db.store.View(func(boltTx *bolt.Tx) error {
+		bucket := boltTx.Bucket([]byte(BucketAddressIndex))
+		if bucket == nil {
+			return DataNotIndexedError{Index: "addresses"}
+		}
+
+		prefix := addressIndexPrefix(addrKey)
+		c := bucket.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			row, err := newAddressTxRowFromBytes(v)
+			if err != nil {
+				return err
+			}
+
+			txHash, kind, index := parseAddressIndexKey(len(prefix), k)
+			txs = append(txs, AddressTx{TxHash: txHash, Kind: kind, Index: index, AddressTxRow: row})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Stable(addressTxsByTime(txs))
+	return txs, nil
+}
+
+type addressTxsByTime []AddressTx
+
+func (a addressTxsByTime) Len() int           { return len(a) }
+func (a addressTxsByTime) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a addressTxsByTime) Less(i, j int) bool { return a[i].Timestamp < a[j].Timestamp }
+
+type AddressSummary struct {
+	Address       string
+	NumTxs        int
+	NumFunded     int
+	NumSpent      int
+	TotalReceived Satoshis
+	TotalSent     Satoshis
+	FirstSeen     time.Time
+	LastSeen      time.Time
+}
+
+func (s AddressSummary) Balance() Satoshis {
+	return s.TotalReceived - s.TotalSent
+}
+
+// GetAddressSummary totals up the address index for the given address.  Note that the balance is only
+// accurate if the .dat files containing every transaction that spends from the address have been indexed.
+func (db *BlockDB) GetAddressSummary(addrKey string) (AddressSummary, error) {
+	txs, err := db.GetAddressTxs(addrKey)
+	if err != nil {
+		return AddressSummary{}, err
+	}
+
+	summary := AddressSummary{Address: addrKey}
+	txHashes := map[chainhash.Hash]bool{}
+	for i, tx := range txs {
+		txHashes[tx.TxHash] = true
+
+		if tx.Kind == AddressTxOut {
+			summary.NumFunded++
+			summary.TotalReceived += tx.Value
+		} else {
+			summary.NumSpent++
+			summary.TotalSent += tx.Value
+		}
+
+		if i == 0 {
+			summary.FirstSeen = time.Unix(tx.Timestamp, 0)
+		}
+		summary.LastSeen = time.Unix(tx.Timestamp, 0)
+	}
+	summary.NumTxs = len(txHashes)
+
+	return summary, nil
+}
+
+// GetAddressTxHashes returns the hashes of every transaction involving the given address, oldest first.
+// It reads the local address index, and only asks the lookup backend if the index hasn't been built.
+func (db *BlockDB) GetAddressTxHashes(addr string) ([]chainhash.Hash, error) {
+	hasIndex, err := db.HasAddressIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasIndex {
+		if db.IsOffline() {
+			return nil, DataNotIndexedError{Index: "addresses"}
+		}
+		return db.backend.GetAddressTxHashes(addr)
+	}
+
+	txs, err := db.GetAddressTxs(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[chainhash.Hash]bool{}
+	txHashes := []chainhash.Hash{}
+	for _, tx := range txs {
+		if !seen[tx.TxHash] {
+			seen[tx.TxHash] = true
+			txHashes = append(txHashes, tx.TxHash)
+		}
+	}
+	return txHashes, nil
+}
@@ -0,0 +1,198 @@
+package blockdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+)
+
+// BitcoindRPC is a LookupBackend that queries a Bitcoin Core node over JSON-RPC.  GetBlockHashForTx
+// requires the node to run with -txindex.
+type BitcoindRPC struct {
+	URL      string
+	User     string
+	Password string
+
+	// bitcoind has no spent-output index, so GetSpentTxOut walks forward from the block containing the
+	// transaction, looking for the spending input.  This limits how many blocks it will walk.
+	MaxSpendScanBlocks int
+
+	Client *http.Client
+
+	nextID uint64
+}
+
+const defaultMaxSpendScanBlocks = 1000
+
+// ensure that BitcoindRPC conforms to LookupBackend
+var _ LookupBackend = &BitcoindRPC{}
+
+func NewBitcoindRPC(url, user, password string) *BitcoindRPC {
+	return &BitcoindRPC{
+		URL:                url,
+		User:               user,
+		Password:           password,
+		MaxSpendScanBlocks: defaultMaxSpendScanBlocks,
+		Client:             http.DefaultClient,
+	}
+}
+
+// BitcoindRPCError is an error returned by bitcoind itself (as opposed to a transport error).
+type BitcoindRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e BitcoindRPCError) Error() string {
+	return fmt.Sprintf("bitcoind RPC error %v: %v", e.Code, e.Message)
+}
+
+// bitcoind's RPC_INVALID_ADDRESS_OR_KEY, which it returns for unknown txs and blocks
+const rpcErrInvalidAddressOrKey = -5
+
+func (api *BitcoindRPC) GetBlockHashForTx(txHash chainhash.Hash) (chainhash.Hash, error) {
+	var resp struct {
+		BlockHash string `json:"blockhash"`
+	}
+
+	err := api.call("getrawtransaction", []interface{}{txHash.String(), true}, &resp)
+	if err != nil {
+		return chainhash.Hash{}, err
+	} else if resp.BlockHash == "" {
+		// the tx is in the mempool, not in a block
+		return chainhash.Hash{}, ErrRemoteNotFound
+	}
+
+	return utils.HashFromString(resp.BlockHash)
+}
+
+func (api *BitcoindRPC) GetSpentTxOut(tx *Tx, txoutIdx uint32) (SpentTxOutRow, error) {
+	// gettxout only knows about unspent outputs, so a non-null result means nobody has spent it yet
+	var txout *struct {
+		Value float64 `json:"value"`
+	}
+	err := api.call("gettxout", []interface{}{tx.Hash().String(), txoutIdx, false}, &txout)
+	if err != nil {
+		return SpentTxOutRow{}, err
+	} else if txout != nil {
+		return SpentTxOutRow{}, ErrRemoteUnspent
+	}
+
+	blockHash := tx.BlockHash
+	if blockHash == emptyHash {
+		blockHash, err = api.GetBlockHashForTx(*tx.Hash())
+		if err != nil {
+			return SpentTxOutRow{}, err
+		}
+	}
+
+	type rpcBlock struct {
+		NextBlockHash string `json:"nextblockhash"`
+		Txs           []struct {
+			TxID string `json:"txid"`
+			Vin  []struct {
+				TxID string `json:"txid"`
+				Vout uint32 `json:"vout"`
+			} `json:"vin"`
+		} `json:"tx"`
+	}
+
+	txHashStr := tx.Hash().String()
+	blockHashStr := blockHash.String()
+	for i := 0; i < api.MaxSpendScanBlocks && blockHashStr != ""; i++ {
+		var block rpcBlock
+		err := api.call("getblock", []interface{}{blockHashStr, 2}, &block)
+		if err != nil {
+			return SpentTxOutRow{}, err
+		}
+
+		for _, blockTx := range block.Txs {
+			for txinIdx, txin := range blockTx.Vin {
+				if txin.TxID == txHashStr && txin.Vout == txoutIdx {
+					inputTxHash, err := utils.HashFromString(blockTx.TxID)
+					if err != nil {
+						return SpentTxOutRow{}, err
+					}
+					return SpentTxOutRow{InputTxHash: inputTxHash, TxInIndex: uint32(txinIdx)}, nil
+				}
+			}
+		}
+
+		blockHashStr = block.NextBlockHash
+	}
+
+	return SpentTxOutRow{}, ErrRemoteNotFound
+}
+
+func (api *BitcoindRPC) GetAddressTxHashes(addr string) ([]chainhash.Hash, error) {
+	// bitcoind doesn't maintain an address index
+	return nil, ErrRemoteUnsupported
+}
+
+func (api *BitcoindRPC) call(method string, params []interface{}, result interface{}) error {
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "1.0",
+		"id":      atomic.AddUint64(&api.nextID, 1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", api.URL, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if api.User != "" || api.Password != "" {
+		req.SetBasicAuth(api.User, api.Password)
+	}
+
+	client := api.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// bitcoind answers RPC errors with a non-200 status *and* a JSON body, so we only bail out early
+	// when there's no body to decode
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("bitcoind %v: %v (check the RPC user and password)", method, resp.Status)
+	}
+
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var rpcResp struct {
+		Result json.RawMessage   `json:"result"`
+		Error  *BitcoindRPCError `json:"error"`
+	}
+	err = json.Unmarshal(bs, &rpcResp)
+	if err != nil {
+		return fmt.Errorf("bitcoind %v: %v (%v)", method, resp.Status, err)
+	}
+
+	if rpcResp.Error != nil {
+		if rpcResp.Error.Code == rpcErrInvalidAddressOrKey {
+			return ErrRemoteNotFound
+		}
+		return *rpcResp.Error
+	}
+
+	return json.Unmarshal(rpcResp.Result, result)
+}
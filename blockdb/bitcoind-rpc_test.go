@@ -0,0 +1,152 @@
+package blockdb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// newStubBitcoind starts an HTTP server that answers JSON-RPC calls using the given handler, which
+// receives the method name and params and returns either a result or an RPC error.
+func newStubBitcoind(T *testing.T, handler func(method string, params []interface{}) (interface{}, *BitcoindRPCError)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			ID     uint64        `json:"id"`
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			T.Fatalf("stub bitcoind: bad request: %v", err)
+		}
+
+		result, rpcErr := handler(req.Method, req.Params)
+		if rpcErr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": req.ID, "result": result, "error": rpcErr})
+	}))
+}
+
+func newTestTx() *Tx {
+	msgTx := wire.NewMsgTx(1)
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 0xffffffff}, []byte{0x51}))
+	msgTx.AddTxOut(wire.NewTxOut(5000000000, []byte{0x51}))
+	return &Tx{Tx: btcutil.NewTx(msgTx)}
+}
+
+func TestBitcoindRPCGetBlockHashForTx(T *testing.T) {
+	blockHash := chainhash.DoubleHashH([]byte("block"))
+	tx := newTestTx()
+
+	srv := newStubBitcoind(T, func(method string, params []interface{}) (interface{}, *BitcoindRPCError) {
+		if method != "getrawtransaction" {
+			T.Fatalf("unexpected method %v", method)
+		}
+		if params[0] == tx.Hash().String() {
+			return map[string]interface{}{"txid": params[0], "blockhash": blockHash.String()}, nil
+		}
+		return nil, &BitcoindRPCError{Code: -5, Message: "No such mempool or blockchain transaction"}
+	})
+	defer srv.Close()
+
+	api := NewBitcoindRPC(srv.URL, "user", "pass")
+
+	found, err := api.GetBlockHashForTx(*tx.Hash())
+	if err != nil {
+		T.Fatalf("unexpected error: %v", err)
+	} else if found != blockHash {
+		T.Fatalf("expected block %v, got %v", blockHash, found)
+	}
+
+	_, err = api.GetBlockHashForTx(chainhash.Hash{})
+	if err != ErrRemoteNotFound {
+		T.Fatalf("expected ErrRemoteNotFound, got %v", err)
+	}
+}
+
+func TestBitcoindRPCGetSpentTxOut(T *testing.T) {
+	block1 := chainhash.DoubleHashH([]byte("block 1"))
+	block2 := chainhash.DoubleHashH([]byte("block 2"))
+	spender := chainhash.DoubleHashH([]byte("spender"))
+	tx := newTestTx()
+	tx.BlockHash = block1
+
+	unspent := false
+	srv := newStubBitcoind(T, func(method string, params []interface{}) (interface{}, *BitcoindRPCError) {
+		switch method {
+		case "gettxout":
+			if unspent {
+				return map[string]interface{}{"value": 50}, nil
+			}
+			return nil, nil
+
+		case "getblock":
+			if params[0] == block1.String() {
+				return map[string]interface{}{
+					"nextblockhash": block2.String(),
+					"tx":            []interface{}{map[string]interface{}{"txid": tx.Hash().String(), "vin": []interface{}{}}},
+				}, nil
+			}
+			return map[string]interface{}{
+				"tx": []interface{}{map[string]interface{}{
+					"txid": spender.String(),
+					"vin": []interface{}{
+						map[string]interface{}{"txid": block1.String(), "vout": 0},
+						map[string]interface{}{"txid": tx.Hash().String(), "vout": 0},
+					},
+				}},
+			}, nil
+		}
+		T.Fatalf("unexpected method %v", method)
+		return nil, nil
+	})
+	defer srv.Close()
+
+	api := NewBitcoindRPC(srv.URL, "user", "pass")
+
+	row, err := api.GetSpentTxOut(tx, 0)
+	if err != nil {
+		T.Fatalf("unexpected error: %v", err)
+	} else if row.InputTxHash != spender || row.TxInIndex != 1 {
+		T.Fatalf("expected spender %v:1, got %v:%v", spender, row.InputTxHash, row.TxInIndex)
+	}
+
+	// the spender is in the second block, so it's out of reach if only one block is scanned
+	api.MaxSpendScanBlocks = 1
+	_, err = api.GetSpentTxOut(tx, 0)
+	if err != ErrRemoteNotFound {
+		T.Fatalf("expected ErrRemoteNotFound for a spender out of range, got %v", err)
+	}
+
+	unspent = true
+	_, err = api.GetSpentTxOut(tx, 0)
+	if err != ErrRemoteUnspent {
+		T.Fatalf("expected ErrRemoteUnspent for an unspent output, got %v", err)
+	}
+}
+
+func TestBitcoindRPCBadCredentials(T *testing.T) {
+	srv := newStubBitcoind(T, func(method string, params []interface{}) (interface{}, *BitcoindRPCError) {
+		return nil, nil
+	})
+	defer srv.Close()
+
+	api := NewBitcoindRPC(srv.URL, "user", "wrong")
+
+	_, err := api.GetBlockHashForTx(chainhash.Hash{})
+	if err == nil || err == ErrRemoteNotFound {
+		T.Fatalf("expected an authentication error, got %v", err)
+	}
+}
@@ -13,6 +13,9 @@ import (
 
 type BlockchainInfoAPI struct{}
 
+// ensure that BlockchainInfoAPI conforms to LookupBackend
+var _ LookupBackend = &BlockchainInfoAPI{}
+
 func (api *BlockchainInfoAPI) GetBlockHashForTx(hash chainhash.Hash) (chainhash.Hash, error) {
 	var outHash chainhash.Hash
 
@@ -89,10 +92,6 @@ func (api *BlockchainInfoAPI) GetBlockHashForTx(hash chainhash.Hash) (chainhash.
 	return outHash, fmt.Errorf("could not find block hash for tx %v", hash.String())
 }
 
-var (
-	errBlockchainAPINotFound = fmt.Errorf("not found on blockchain API")
-)
-
 func (api *BlockchainInfoAPI) GetSpentTxOut(tx *Tx, txoutIdx uint32) (SpentTxOutRow, error) {
 	addrs, err := tx.GetTxOutAddress(int(txoutIdx))
 	if err != nil {
@@ -117,7 +116,7 @@ func (api *BlockchainInfoAPI) GetSpentTxOut(tx *Tx, txoutIdx uint32) (SpentTxOut
 
 		for _, txout := range resp.TxOuts {
 			if txout.TxOutIdx == txoutIdx && txout.Spent == false {
-				return SpentTxOutRow{}, errBlockchainAPINotFound
+				return SpentTxOutRow{}, ErrRemoteUnspent
 			}
 		}
 	}
@@ -156,7 +155,48 @@ func (api *BlockchainInfoAPI) GetSpentTxOut(tx *Tx, txoutIdx uint32) (SpentTxOut
 			}
 		}
 	}
-	return SpentTxOutRow{}, errBlockchainAPINotFound
+	return SpentTxOutRow{}, ErrRemoteNotFound
+}
+
+func (api *BlockchainInfoAPI) GetAddressTxHashes(addr string) ([]chainhash.Hash, error) {
+	type AddressNTxResponse struct {
+		NumTxs int `json:"n_tx"`
+	}
+
+	var ntxResp AddressNTxResponse
+	err := getJSON(fmt.Sprintf("https://blockchain.info/address/%v?format=json", addr), &ntxResp)
+	if err != nil {
+		return nil, err
+	}
+
+	type AddressResponse struct {
+		Txs []struct {
+			Hash string `json:"hash"`
+		} `json:"txs"`
+	}
+
+	hashes := []chainhash.Hash{}
+	for offset := 0; offset < ntxResp.NumTxs; {
+		var addrResp AddressResponse
+		err := getJSON(fmt.Sprintf("https://blockchain.info/address/%v?format=json&offset=%v&sort=1", addr, offset), &addrResp)
+		if err != nil {
+			return nil, err
+		} else if len(addrResp.Txs) == 0 {
+			break
+		}
+
+		for _, tx := range addrResp.Txs {
+			txHash, err := utils.HashFromString(tx.Hash)
+			if err != nil {
+				return nil, err
+			}
+			hashes = append(hashes, txHash)
+		}
+
+		offset += len(addrResp.Txs)
+	}
+
+	return hashes, nil
 }
 
 func (api *BlockchainInfoAPI) getTxHashByTxIndex(txIndex uint32) string {
@@ -193,6 +233,10 @@ func getJSON(url string, x interface{}) error {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %v: %v", url, resp.Status)
+	}
+
 	bs, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return err
@@ -12,9 +12,32 @@ type BlockIndexRow struct {
 	DATFileIdx     uint16
 	Timestamp      int64
 	IndexInDATFile uint32
+
+	// byte offset of the block within its .dat file (just past the magic and length prefix) and its
+	// length.  Rows written by older versions don't have these, see HasLocation.
+	Offset uint64
+	Length uint32
+}
+
+// the row format used before we stored block offsets
+type blockIndexRowV1 struct {
+	DATFileIdx     uint16
+	Timestamp      int64
+	IndexInDATFile uint32
 }
 
+var blockIndexRowV1Size = binary.Size(blockIndexRowV1{})
+
 func NewBlockIndexRowFromBytes(bs []byte) (BlockIndexRow, error) {
+	if len(bs) == blockIndexRowV1Size {
+		old := blockIndexRowV1{}
+		err := binary.Read(bytes.NewReader(bs), binary.LittleEndian, &old)
+		if err != nil {
+			return BlockIndexRow{}, err
+		}
+		return BlockIndexRow{DATFileIdx: old.DATFileIdx, Timestamp: old.Timestamp, IndexInDATFile: old.IndexInDATFile}, nil
+	}
+
 	row := BlockIndexRow{}
 	err := binary.Read(bytes.NewReader(bs), binary.LittleEndian, &row)
 	if err != nil {
@@ -23,6 +46,12 @@ func NewBlockIndexRowFromBytes(bs []byte) (BlockIndexRow, error) {
 	return row, nil
 }
 
+// HasLocation returns false for rows written by older versions, which only know the block's index in its
+// .dat file.  BlockDB upgrades those rows the first time it reads them.
+func (r BlockIndexRow) HasLocation() bool {
+	return r.Length != 0
+}
+
 func (r BlockIndexRow) DATFilename() string {
 	return fmt.Sprintf("blk%05d.dat", r.DATFileIdx)
 }
@@ -39,9 +68,30 @@ func (r BlockIndexRow) ToBytes() ([]byte, error) {
 type TxIndexRow struct {
 	BlockHash    chainhash.Hash
 	IndexInBlock uint64
+
+	// byte offset and length of the tx within its serialized block
+	TxOffset uint32
+	TxLength uint32
+}
+
+// the row format used before we stored transaction offsets
+type txIndexRowV1 struct {
+	BlockHash    chainhash.Hash
+	IndexInBlock uint64
 }
 
+var txIndexRowV1Size = binary.Size(txIndexRowV1{})
+
 func NewTxIndexRowFromBytes(bs []byte) (TxIndexRow, error) {
+	if len(bs) == txIndexRowV1Size {
+		old := txIndexRowV1{}
+		err := binary.Read(bytes.NewReader(bs), binary.LittleEndian, &old)
+		if err != nil {
+			return TxIndexRow{}, err
+		}
+		return TxIndexRow{BlockHash: old.BlockHash, IndexInBlock: old.IndexInBlock}, nil
+	}
+
 	row := TxIndexRow{}
 	err := binary.Read(bytes.NewReader(bs), binary.LittleEndian, &row)
 	if err != nil {
@@ -50,6 +100,11 @@ func NewTxIndexRowFromBytes(bs []byte) (TxIndexRow, error) {
 	return row, nil
 }
 
+// HasLocation returns false for rows written by older versions, see BlockIndexRow.HasLocation.
+func (r TxIndexRow) HasLocation() bool {
+	return r.TxLength != 0
+}
+
 func (r TxIndexRow) ToBytes() ([]byte, error) {
 	rowData := &bytes.Buffer{}
 	err := binary.Write(rowData, binary.LittleEndian, r)
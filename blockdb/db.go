@@ -3,7 +3,9 @@ package blockdb
 import (
 	"crypto/sha256"
 	"fmt"
+	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/boltdb/bolt"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -16,6 +18,14 @@ type (
 	BlockDB struct {
 		store      *bolt.DB
 		datFileDir string
+
+		// backend resolves lookups that miss the local indexes and .dat files.  when it's nil (offline
+		// mode), nothing is ever requested from a remote source.
+		backend LookupBackend
+
+		// cached by SpentTxOutsIndexedHeight
+		coverage   *spentTxOutsCoverage
+		coverageMu sync.Mutex
 	}
 )
 
@@ -23,20 +33,25 @@ const (
 	BucketBlockIndex                = "BlockIndex"
 	BucketBlocksIndexedBlocks       = "BlocksIndexedBlocks"
 	BucketTransactionIndex          = "TransactionIndex"
+	BucketWitnessTxIndex            = "WitnessTxIndex"
 	BucketTransactionsIndexedBlocks = "TransactionsIndexedBlocks"
 	BucketTxOutDupes                = "TxOutDupes"
 	BucketSpentTxOuts               = "SpentTxOuts"
 	BucketSpentTxOutsIndexedBlocks  = "SpentTxOutsIndexedBlocks"
 )
 
-func NewBlockDB(dbFilename string, datFileDir string) (*BlockDB, error) {
+func NewBlockDB(dbFilename string, datFileDir string, backend LookupBackend) (*BlockDB, error) {
 	// open the BoltDB file
 	store, err := bolt.Open(dbFilename, 0600, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	return &BlockDB{store: store, datFileDir: datFileDir}, nil
+	return &BlockDB{store: store, datFileDir: datFileDir, backend: backend}, nil
+}
+
+func (db *BlockDB) IsOffline() bool {
+	return db.backend == nil
 }
 
 func (db *BlockDB) Close() error {
@@ -55,6 +70,37 @@ func (db *BlockDB) LoadBlockFromDAT(datIdx uint16, blockIdx uint32) (*btcutil.Bl
 	return utils.LoadBlockFromDAT(db.DATFilename(datIdx), blockIdx)
 }
 
+// LoadBlockFromDATAt reads a block with a single ReadAt.  Rows written by older versions of this tool
+// don't have a byte offset yet, so they're located by seeking through the .dat file once, and the
+// upgraded row is written back to the index.
+func (db *BlockDB) LoadBlockFromDATAt(blockHash chainhash.Hash, row BlockIndexRow) (*btcutil.Block, BlockIndexRow, error) {
+	row, err := db.ensureBlockLocation(blockHash, row)
+	if err != nil {
+		return nil, row, err
+	}
+
+	block, err := utils.LoadBlockFromDATAt(db.DATFilename(row.DATFileIdx), row.Offset, row.Length)
+	if err != nil {
+		return nil, row, err
+	}
+	return block, row, nil
+}
+
+func (db *BlockDB) ensureBlockLocation(blockHash chainhash.Hash, row BlockIndexRow) (BlockIndexRow, error) {
+	if row.HasLocation() {
+		return row, nil
+	}
+
+	loc, err := utils.FindBlockLocInDAT(db.DATFilename(row.DATFileIdx), row.IndexInDATFile)
+	if err != nil {
+		return row, err
+	}
+
+	row.Offset = loc.Offset
+	row.Length = loc.Length
+	return row, db.putBlockIndexRow(blockHash, row)
+}
+
 func (db *BlockDB) IndexDATFileBlocks(startBlock, endBlock uint64, force bool) error {
 	for i := int(startBlock); i < int(endBlock)+1; i++ {
 		datFilename := fmt.Sprintf("blk%05d.dat", i)
@@ -72,12 +118,12 @@ func (db *BlockDB) IndexDATFileBlocks(startBlock, endBlock uint64, force bool) e
 			}
 		}
 
-		blocks, err := utils.LoadBlocksFromDAT(datFilepath)
+		blocks, locs, err := utils.LoadBlocksAndLocsFromDAT(datFilepath)
 		if err != nil {
 			return err
 		}
 
-		err = db.writeBlockIndexToDB(blocks, i)
+		err = db.writeBlockIndexToDB(blocks, locs, i)
 		if err != nil {
 			return err
 		}
@@ -142,17 +188,17 @@ func (db *BlockDB) IndexDATFileTransactions(startBlock, endBlock uint64, force b
 			}
 		}
 
-		blocks, err := utils.LoadBlocksFromDAT(datFilepath)
+		blocks, locs, err := utils.LoadBlocksAndLocsFromDAT(datFilepath)
 		if err != nil {
 			return err
 		}
 
-		err = db.writeBlockIndexToDB(blocks, i)
+		err = db.writeBlockIndexToDB(blocks, locs, i)
 		if err != nil {
 			return err
 		}
 
-		err = db.writeTxIndexToDB(blocks)
+		err = db.writeTxIndexToDB(blocks, locs)
 		if err != nil {
 			return err
 		}
@@ -200,7 +246,7 @@ func (db *BlockDB) SetTransactionsIndexed(filename string) error {
 	return err
 }
 
-func (db *BlockDB) writeBlockIndexToDB(blocks []*btcutil.Block, datFileIdx int) error {
+func (db *BlockDB) writeBlockIndexToDB(blocks []*btcutil.Block, locs []utils.DATBlockLoc, datFileIdx int) error {
 	fmt.Println("writing block metadata...")
 
 	// we break the blocks into a bunch of smaller groups because BoltDB writes much more quickly this way
@@ -215,10 +261,13 @@ func (db *BlockDB) writeBlockIndexToDB(blocks []*btcutil.Block, datFileIdx int)
 			}
 
 			for blIdx, bl := range group {
+				indexInDATFile := (g * groupLen) + blIdx
 				row := BlockIndexRow{
 					DATFileIdx:     uint16(datFileIdx),
 					Timestamp:      bl.MsgBlock().Header.Timestamp.Unix(),
-					IndexInDATFile: uint32((g * groupLen) + blIdx),
+					IndexInDATFile: uint32(indexInDATFile),
+					Offset:         locs[indexInDATFile].Offset,
+					Length:         locs[indexInDATFile].Length,
 				}
 
 				rowBytes, err := row.ToBytes()
@@ -261,32 +310,50 @@ func (db *BlockDB) putBlockIndexRow(blockHash chainhash.Hash, row BlockIndexRow)
 	})
 }
 
-func (db *BlockDB) writeTxIndexToDB(blocks []*btcutil.Block) error {
+func (db *BlockDB) writeTxIndexToDB(blocks []*btcutil.Block, locs []utils.DATBlockLoc) error {
 	const writesPerBoltTx = 5000 // this value was determined by benchmarking, change at your own peril
 
 	fmt.Println("writing transaction index...")
 
 	keys := []chainhash.Hash{}
 	vals := []TxIndexRow{}
+	wtxids := []chainhash.Hash{}
+	wtxidTxHashes := []chainhash.Hash{}
 
-	for _, bl := range blocks {
+	for blIdx, bl := range blocks {
 		for txIdx, tx := range bl.Transactions() {
+			txLoc := locs[blIdx].TxLocs[txIdx]
 			row := TxIndexRow{
 				BlockHash:    *bl.Hash(),
 				IndexInBlock: uint64(txIdx),
+				TxOffset:     uint32(txLoc.TxStart),
+				TxLength:     uint32(txLoc.TxLen),
 			}
 
 			keys = append(keys, *tx.Hash())
 			vals = append(vals, row)
 
+			// the wtxid only differs from the txid when the tx carries witness data
+			if tx.MsgTx().HasWitness() {
+				wtxids = append(wtxids, tx.MsgTx().WitnessHash())
+				wtxidTxHashes = append(wtxidTxHashes, *tx.Hash())
+			}
+
 			if len(keys) > writesPerBoltTx {
 				err := db.putTxIndexRows(keys, vals)
 				if err != nil {
 					return err
 				}
 
+				err = db.putWitnessTxIndexRows(wtxids, wtxidTxHashes)
+				if err != nil {
+					return err
+				}
+
 				keys = []chainhash.Hash{}
 				vals = []TxIndexRow{}
+				wtxids = []chainhash.Hash{}
+				wtxidTxHashes = []chainhash.Hash{}
 			}
 		}
 
@@ -298,6 +365,11 @@ func (db *BlockDB) writeTxIndexToDB(blocks []*btcutil.Block) error {
 		if err != nil {
 			return err
 		}
+
+		err = db.putWitnessTxIndexRows(wtxids, wtxidTxHashes)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -327,6 +399,49 @@ func (db *BlockDB) putTxIndexRows(keys []chainhash.Hash, rows []TxIndexRow) erro
 	return err
 }
 
+func (db *BlockDB) putWitnessTxIndexRows(wtxids []chainhash.Hash, txHashes []chainhash.Hash) error {
+	if len(wtxids) == 0 {
+		return nil
+	}
+
+	return db.store.Update(func(boltTx *bolt.Tx) error {
+		bucket, err := boltTx.CreateBucketIfNotExists([]byte(BucketWitnessTxIndex))
+		if err != nil {
+			return fmt.Errorf("create bucket: %s", err)
+		}
+
+		for i := range wtxids {
+			err = bucket.Put(wtxids[i][:], txHashes[i][:])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetTxHashForWitnessHash looks up the txid of a segwit transaction by its wtxid.
+func (db *BlockDB) GetTxHashForWitnessHash(wtxid chainhash.Hash) (chainhash.Hash, error) {
+	var txHash chainhash.Hash
+
+	err := db.store.View(func(boltTx *bolt.Tx) error {
+		bucket := boltTx.Bucket([]byte(BucketWitnessTxIndex))
+		if bucket == nil {
+			return DataNotIndexedError{Index: "transactions"}
+		}
+
+		val := bucket.Get(wtxid[:])
+		if val == nil {
+			return TxNotFoundError{TxHash: wtxid}
+		}
+
+		copy(txHash[:], val)
+		return nil
+	})
+
+	return txHash, err
+}
+
 var emptyHash = chainhash.Hash{}
 
 func (db *BlockDB) GetBlockIndexRow(blockHash chainhash.Hash) (BlockIndexRow, error) {
@@ -385,8 +500,12 @@ func (db *BlockDB) getBlockIndexRowFromDATFiles(blockHash chainhash.Hash, startD
 	for i := startDatIdx; ; i++ {
 		fmt.Printf("\rsearching for block %v in DAT file %v", blockHash.String(), i)
 
-		blocks, err := db.LoadBlocksFromDAT(i)
-		if err != nil {
+		blocks, locs, err := utils.LoadBlocksAndLocsFromDAT(db.DATFilename(i))
+		if os.IsNotExist(err) {
+			// we've run out of .dat files
+			fmt.Printf("\r")
+			return BlockIndexRow{}, BlockNotFoundError{BlockHash: blockHash}
+		} else if err != nil {
 			return BlockIndexRow{}, err
 		}
 
@@ -396,6 +515,8 @@ func (db *BlockDB) getBlockIndexRowFromDATFiles(blockHash chainhash.Hash, startD
 					DATFileIdx:     i,
 					Timestamp:      bl.MsgBlock().Header.Timestamp.Unix(),
 					IndexInDATFile: uint32(blkIdx),
+					Offset:         locs[blkIdx].Offset,
+					Length:         locs[blkIdx].Length,
 				}
 
 				fmt.Printf("\r")
@@ -403,8 +524,6 @@ func (db *BlockDB) getBlockIndexRowFromDATFiles(blockHash chainhash.Hash, startD
 			}
 		}
 	}
-
-	return BlockIndexRow{}, fmt.Errorf("could not find block %v in DAT files", blockHash.String())
 }
 
 func (db *BlockDB) GetBlock(blockHash chainhash.Hash) (*Block, error) {
@@ -413,7 +532,7 @@ func (db *BlockDB) GetBlock(blockHash chainhash.Hash) (*Block, error) {
 		return nil, err
 	}
 
-	block, err := db.LoadBlockFromDAT(blockRow.DATFileIdx, blockRow.IndexInDATFile)
+	block, blockRow, err := db.LoadBlockFromDATAt(blockHash, blockRow)
 	if err != nil {
 		return nil, err
 	}
@@ -436,12 +555,14 @@ func (db *BlockDB) GetTxIndexRow(txHash chainhash.Hash) (TxIndexRow, error) {
 
 	switch err.(type) {
 	case DataNotIndexedError, TxNotFoundError:
-		break
+		if db.IsOffline() {
+			return TxIndexRow{}, err
+		}
 	default:
 		return TxIndexRow{}, err
 	}
 
-	row, err = db.getTxIndexRowFromBlockchainInfoAPI(txHash)
+	row, err = db.getTxIndexRowFromBackend(txHash)
 	if err == nil {
 		err = db.putTxIndexRows([]chainhash.Hash{txHash}, []TxIndexRow{row})
 		return row, err
@@ -473,6 +594,13 @@ func (db *BlockDB) getTxIndexRowFromDB(txHash chainhash.Hash) (TxIndexRow, error
 		return nil
 	})
 
+	if _, isNotFound := err.(TxNotFoundError); isNotFound {
+		// the caller may have handed us a wtxid
+		if realTxHash, werr := db.GetTxHashForWitnessHash(txHash); werr == nil {
+			return db.getTxIndexRowFromDB(realTxHash)
+		}
+	}
+
 	if err != nil {
 		return TxIndexRow{}, err
 	}
@@ -480,10 +608,8 @@ func (db *BlockDB) getTxIndexRowFromDB(txHash chainhash.Hash) (TxIndexRow, error
 	return txRow, nil
 }
 
-func (db *BlockDB) getTxIndexRowFromBlockchainInfoAPI(txHash chainhash.Hash) (TxIndexRow, error) {
-	api := &BlockchainInfoAPI{}
-
-	blockHash, err := api.GetBlockHashForTx(txHash)
+func (db *BlockDB) getTxIndexRowFromBackend(txHash chainhash.Hash) (TxIndexRow, error) {
+	blockHash, err := db.backend.GetBlockHashForTx(txHash)
 	if err != nil {
 		return TxIndexRow{}, err
 	}
@@ -493,7 +619,12 @@ func (db *BlockDB) getTxIndexRowFromBlockchainInfoAPI(txHash chainhash.Hash) (Tx
 		return TxIndexRow{}, err
 	}
 
-	bl, err := db.LoadBlockFromDAT(blockRow.DATFileIdx, blockRow.IndexInDATFile)
+	bl, _, err := db.LoadBlockFromDATAt(blockHash, blockRow)
+	if err != nil {
+		return TxIndexRow{}, err
+	}
+
+	txLocs, err := bl.TxLoc()
 	if err != nil {
 		return TxIndexRow{}, err
 	}
@@ -503,12 +634,14 @@ func (db *BlockDB) getTxIndexRowFromBlockchainInfoAPI(txHash chainhash.Hash) (Tx
 			row := TxIndexRow{
 				BlockHash:    blockHash,
 				IndexInBlock: uint64(txIdx),
+				TxOffset:     uint32(txLocs[txIdx].TxStart),
+				TxLength:     uint32(txLocs[txIdx].TxLen),
 			}
 			return row, nil
 		}
 	}
 
-	return TxIndexRow{}, fmt.Errorf("BlockDB.getTxIndexRowFromBlockchainInfoAPI: could not find transaction %v", txHash.String())
+	return TxIndexRow{}, fmt.Errorf("BlockDB.getTxIndexRowFromBackend: could not find transaction %v", txHash.String())
 }
 
 func (db *BlockDB) GetTx(txHash chainhash.Hash) (*Tx, error) {
@@ -523,14 +656,39 @@ func (db *BlockDB) GetTx(txHash chainhash.Hash) (*Tx, error) {
 		return nil, err
 	}
 
-	block, err := db.LoadBlockFromDAT(blockRow.DATFileIdx, blockRow.IndexInDATFile)
-	if err != nil {
-		return nil, err
-	}
+	var tx *btcutil.Tx
+	if txRow.HasLocation() && blockRow.HasLocation() {
+		// decode just this transaction instead of the whole block
+		tx, err = utils.LoadTxFromDATAt(db.DATFilename(blockRow.DATFileIdx), blockRow.Offset+uint64(txRow.TxOffset), txRow.TxLength)
+		if err != nil {
+			return nil, err
+		}
+		tx.SetIndex(int(txRow.IndexInBlock))
 
-	tx, err := block.Tx(int(txRow.IndexInBlock))
-	if err != nil {
-		return nil, err
+	} else {
+		var block *btcutil.Block
+		block, blockRow, err = db.LoadBlockFromDATAt(txRow.BlockHash, blockRow)
+		if err != nil {
+			return nil, err
+		}
+
+		tx, err = block.Tx(int(txRow.IndexInBlock))
+		if err != nil {
+			return nil, err
+		}
+
+		// upgrade index rows written before we stored transaction offsets
+		txLocs, err := block.TxLoc()
+		if err != nil {
+			return nil, err
+		}
+		txRow.TxOffset = uint32(txLocs[txRow.IndexInBlock].TxStart)
+		txRow.TxLength = uint32(txLocs[txRow.IndexInBlock].TxLen)
+
+		err = db.putTxIndexRows([]chainhash.Hash{*tx.Hash()}, []TxIndexRow{txRow})
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	txWrapped := &Tx{
@@ -762,6 +920,8 @@ func (db *BlockDB) CheckIfSpentTxOutsIndexed(filename string) (bool, error) {
 }
 
 func (db *BlockDB) SetSpentTxOutsIndexed(filename string) error {
+	defer db.invalidateCoverage()
+
 	err := db.store.Update(func(boltTx *bolt.Tx) error {
 		bucket, err := boltTx.CreateBucketIfNotExists([]byte(BucketSpentTxOutsIndexedBlocks))
 		if err != nil {
@@ -832,16 +992,12 @@ func (db *BlockDB) PutSpentTxOuts(keys []SpentTxOutKey, vals []SpentTxOutRow) er
 	return err
 }
 
-var (
-	errNotFoundDB = fmt.Errorf("not found in db")
-)
-
 func (db *BlockDB) GetSpentTxOut(key SpentTxOutKey) (SpentTxOutRow, error) {
 	var row SpentTxOutRow
 	err := db.store.View(func(boltTx *bolt.Tx) error {
 		bucket := boltTx.Bucket([]byte(BucketSpentTxOuts))
 		if bucket == nil {
-			return errNotFoundDB //DataNotIndexedError{Index: "spent-txouts"}
+			return DataNotIndexedError{Index: "spent-txouts"}
 		}
 
 		keyBytes, err := key.ToBytes()
@@ -851,7 +1007,7 @@ func (db *BlockDB) GetSpentTxOut(key SpentTxOutKey) (SpentTxOutRow, error) {
 
 		valBytes := bucket.Get(keyBytes)
 		if valBytes == nil {
-			return errNotFoundDB
+			return SpentTxOutNotFoundError{Key: key}
 		}
 
 		row, err = newSpentTxOutRowFromBytes(valBytes)
@@ -862,31 +1018,38 @@ func (db *BlockDB) GetSpentTxOut(key SpentTxOutKey) (SpentTxOutRow, error) {
 		return nil
 	})
 
-	if err == errNotFoundDB {
-		var tx *Tx
-		tx, err = db.GetTx(key.TxHash)
-		if err != nil {
-			fmt.Printf("error: %v\n", err)
+	switch err.(type) {
+	case nil:
+		return row, nil
+	case DataNotIndexedError, SpentTxOutNotFoundError:
+		if db.IsOffline() {
 			return row, err
 		}
+	default:
+		fmt.Printf("error: %v\n", err)
+		return row, err
+	}
 
-		fmt.Printf("requesting spent txout %v from api...", key)
-		row, err = (&BlockchainInfoAPI{}).GetSpentTxOut(tx, key.TxOutIndex)
-		if err == errBlockchainAPINotFound {
-			fmt.Printf(" not found\n")
-			return row, fmt.Errorf("can't find SpentTxOut %+v", key)
-		} else if err != nil {
-			fmt.Printf("error: %v\n", err)
-			return row, err
-		}
-		// fmt.Printf("FOUND: %+v\n", row)
-		// return row, err
+	tx, err := db.GetTx(key.TxHash)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return row, err
+	}
+
+	fmt.Printf("requesting spent txout %v from api...", key)
+	row, err = db.backend.GetSpentTxOut(tx, key.TxOutIndex)
+	if err == ErrRemoteUnspent {
+		fmt.Printf(" unspent\n")
+		return row, SpentTxOutNotFoundError{Key: key, Unspent: true}
+	} else if err == ErrRemoteNotFound {
+		fmt.Printf(" not found\n")
+		return row, SpentTxOutNotFoundError{Key: key}
 	} else if err != nil {
 		fmt.Printf("error: %v\n", err)
-	} else {
-		err = db.PutSpentTxOut(key, row)
+		return row, err
 	}
 
+	err = db.PutSpentTxOut(key, row)
 	return row, err
 }
 
@@ -896,7 +1059,10 @@ func (db *BlockDB) GetSpentTxOutFromDATFiles(key SpentTxOutKey) (SpentTxOutRow,
 	for datIdx := datFileStartIndex; ; datIdx++ {
 		filename := filepath.Join(db.datFileDir, fmt.Sprintf("blk%05d.dat", datIdx))
 		blocks, err := utils.LoadBlocksFromDAT(filename)
-		if err != nil {
+		if os.IsNotExist(err) {
+			// we've run out of .dat files
+			return SpentTxOutRow{}, SpentTxOutNotFoundError{Key: key}
+		} else if err != nil {
 			return SpentTxOutRow{}, err
 		}
 
@@ -912,6 +1078,4 @@ func (db *BlockDB) GetSpentTxOutFromDATFiles(key SpentTxOutKey) (SpentTxOutRow,
 			}
 		}
 	}
-
-	return SpentTxOutRow{}, fmt.Errorf("could not find transaction %v", key.TxHash.String())
 }
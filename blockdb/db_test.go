@@ -0,0 +1,760 @@
+package blockdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+
+	"github.com/spooktheducks/local-blockchain-parser/internal/testdat"
+)
+
+// newTestDATDir writes a blk00000.dat containing a few small, distinct blocks, each with a couple of
+// transactions, and returns the directory and the blocks.
+func newTestDATDir(T *testing.T) (string, []*wire.MsgBlock) {
+	genesis := chaincfg.MainNetParams.GenesisBlock
+	blocks := []*wire.MsgBlock{}
+	for i := 0; i < 3; i++ {
+		bl := wire.NewMsgBlock(&genesis.Header)
+		bl.Header.Nonce = uint32(i)
+		for j := 0; j < 2; j++ {
+			tx := genesis.Transactions[0].Copy()
+			tx.LockTime = uint32(i*10 + j)
+			bl.AddTransaction(tx)
+		}
+		blocks = append(blocks, bl)
+	}
+
+	return testdat.WriteDATDir(T, blocks), blocks
+}
+
+func TestGetTxUsesOffsetsAndUpgradesLegacyRows(T *testing.T) {
+	dir, blocks := newTestDATDir(T)
+	defer os.RemoveAll(dir)
+
+	db, err := NewBlockDB(filepath.Join(dir, "test.db"), dir, nil)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.IndexDATFileTransactions(0, 0, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	blockHash := blocks[2].BlockHash()
+	txHash := blocks[2].Transactions[1].TxHash()
+
+	txRow, err := db.GetTxIndexRow(txHash)
+	if err != nil {
+		T.Fatal(err)
+	} else if !txRow.HasLocation() {
+		T.Fatal("tx index row has no location")
+	}
+
+	tx, err := db.GetTx(txHash)
+	if err != nil {
+		T.Fatal(err)
+	} else if *tx.Hash() != txHash || tx.IndexInBlock != 1 || tx.BlockIndexInDATFile != 2 {
+		T.Fatalf("got tx %v (index %v in block %v)", tx.Hash(), tx.IndexInBlock, tx.BlockIndexInDATFile)
+	}
+
+	// overwrite both rows with the old, location-less format
+	err = db.store.Update(func(boltTx *bolt.Tx) error {
+		blockRow := &bytes.Buffer{}
+		binary.Write(blockRow, binary.LittleEndian, blockIndexRowV1{DATFileIdx: 0, IndexInDATFile: 2})
+		err := boltTx.Bucket([]byte(BucketBlockIndex)).Put(blockHash[:], blockRow.Bytes())
+		if err != nil {
+			return err
+		}
+
+		oldTxRow := &bytes.Buffer{}
+		binary.Write(oldTxRow, binary.LittleEndian, txIndexRowV1{BlockHash: blockHash, IndexInBlock: 1})
+		return boltTx.Bucket([]byte(BucketTransactionIndex)).Put(txHash[:], oldTxRow.Bytes())
+	})
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	tx, err = db.GetTx(txHash)
+	if err != nil {
+		T.Fatal(err)
+	} else if *tx.Hash() != txHash {
+		T.Fatalf("got tx %v from a legacy row", tx.Hash())
+	}
+
+	upgradedBlockRow, err := db.GetBlockIndexRow(blockHash)
+	if err != nil {
+		T.Fatal(err)
+	} else if !upgradedBlockRow.HasLocation() {
+		T.Error("legacy block index row was not upgraded")
+	}
+
+	upgradedTxRow, err := db.GetTxIndexRow(txHash)
+	if err != nil {
+		T.Fatal(err)
+	} else if upgradedTxRow != txRow {
+		T.Errorf("legacy tx index row was upgraded to %+v, expected %+v", upgradedTxRow, txRow)
+	}
+}
+
+func TestIndexBlockHeights(T *testing.T) {
+	genesis := chaincfg.MainNetParams.GenesisBlock
+	newBlock := func(prev *wire.MsgBlock, bits uint32) *wire.MsgBlock {
+		bl := wire.NewMsgBlock(&genesis.Header)
+		bl.Header.PrevBlock = prev.BlockHash()
+		bl.Header.Bits = bits
+		bl.AddTransaction(genesis.Transactions[0].Copy())
+		return bl
+	}
+
+	// genesis <- a <- b
+	//              <- c  (same height as b, but more work, so c is the tip)
+	a := newBlock(genesis, genesis.Header.Bits)
+	b := newBlock(a, genesis.Header.Bits)
+	c := newBlock(a, 0x1c00ffff)
+
+	// an unrelated block whose parent isn't in the index
+	lost := newBlock(b, genesis.Header.Bits)
+	lost.Header.PrevBlock[0] ^= 0xff
+
+	dir := testdat.WriteDATDir(T, []*wire.MsgBlock{genesis, a, b, c, lost})
+	defer os.RemoveAll(dir)
+
+	db, err := NewBlockDB(filepath.Join(dir, "test.db"), dir, nil)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.IndexDATFileBlocks(0, 0, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	err = db.IndexBlockHeights()
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	expected := map[*wire.MsgBlock]BlockHeightRow{
+		genesis: {Height: 0},
+		a:       {Height: 1},
+		b:       {Height: 2, Orphaned: true},
+		c:       {Height: 2},
+	}
+	for bl, expectedRow := range expected {
+		row, err := db.GetBlockHeight(bl.BlockHash())
+		if err != nil {
+			T.Fatal(err)
+		} else if row != expectedRow {
+			T.Errorf("block %v: got %+v, expected %+v", bl.BlockHash(), row, expectedRow)
+		}
+	}
+
+	_, err = db.GetBlockHeight(lost.BlockHash())
+	if _, ok := err.(BlockHeightUnknownError); !ok {
+		T.Errorf("expected BlockHeightUnknownError for an unconnected block, got %v", err)
+	}
+
+	tip, err := db.GetBlockHashAtHeight(2)
+	if err != nil {
+		T.Fatal(err)
+	} else if tip != c.BlockHash() {
+		T.Errorf("height 2 is %v, expected %v", tip, c.BlockHash())
+	}
+
+	_, err = db.GetBlockHashAtHeight(3)
+	if _, ok := err.(BlockHeightNotFoundError); !ok {
+		T.Errorf("expected BlockHeightNotFoundError above the tip, got %v", err)
+	}
+}
+
+func TestIndexBlockHeightsTieAndRebuild(T *testing.T) {
+	genesis := chaincfg.MainNetParams.GenesisBlock
+	newBlock := func(prev *wire.MsgBlock, nonce uint32) *wire.MsgBlock {
+		bl := wire.NewMsgBlock(&genesis.Header)
+		bl.Header.PrevBlock = prev.BlockHash()
+		bl.Header.Nonce = nonce
+		bl.AddTransaction(genesis.Transactions[0].Copy())
+		return bl
+	}
+
+	// genesis <- a <- b
+	//              <- c  (same work as b, but stored first, so c is the tip)
+	a := newBlock(genesis, 0)
+	b := newBlock(a, 1)
+	c := newBlock(a, 2)
+
+	dir := testdat.WriteDATDir(T, []*wire.MsgBlock{genesis, a, c, b})
+	defer os.RemoveAll(dir)
+
+	db, err := NewBlockDB(filepath.Join(dir, "test.db"), dir, nil)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.IndexDATFileBlocks(0, 0, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	// height buckets from before the indices were swapped in, which the first rebuild replaces
+	err = db.store.Update(func(boltTx *bolt.Tx) error {
+		bucket, err := boltTx.CreateBucket([]byte(BucketMainChain))
+		if err != nil {
+			return err
+		}
+		bHash := b.BlockHash()
+		return bucket.Put(heightKey(2), bHash[:])
+	})
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	checkTip := func() {
+		tip, err := db.GetBlockHashAtHeight(2)
+		if err != nil {
+			T.Fatal(err)
+		} else if tip != c.BlockHash() {
+			T.Fatalf("height 2 is %v, expected %v", tip, c.BlockHash())
+		}
+
+		row, err := db.GetBlockHeight(b.BlockHash())
+		if err != nil {
+			T.Fatal(err)
+		} else if row != (BlockHeightRow{Height: 2, Orphaned: true}) {
+			T.Fatalf("block b: got %+v", row)
+		}
+	}
+
+	// the blocks are visited in map order, so repeat to make sure the tie isn't broken by chance
+	for i := 0; i < 10; i++ {
+		err = db.IndexBlockHeights()
+		if err != nil {
+			T.Fatal(err)
+		}
+		checkTip()
+	}
+
+	// leave behind the half-written buckets of an interrupted rebuild
+	var staleBuckets []string
+	err = db.store.Update(func(boltTx *bolt.Tx) error {
+		if boltTx.Bucket([]byte(BucketMainChain)) != nil {
+			T.Error("the old MainChain bucket wasn't deleted")
+		}
+
+		suffix := "-a"
+		if activeHeightIndexSuffix(boltTx) == suffix {
+			suffix = "-b"
+		}
+		staleBuckets = []string{BucketBlockHeights + suffix, BucketMainChain + suffix}
+
+		_, err := boltTx.CreateBucket([]byte(staleBuckets[0]))
+		if err != nil {
+			return err
+		}
+		bucket, err := boltTx.CreateBucket([]byte(staleBuckets[1]))
+		if err != nil {
+			return err
+		}
+		bHash := b.BlockHash()
+		return bucket.Put(heightKey(2), bHash[:])
+	})
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	// readers still see the complete indices
+	checkTip()
+
+	err = db.IndexBlockHeights()
+	if err != nil {
+		T.Fatal(err)
+	}
+	checkTip()
+
+	err = db.store.View(func(boltTx *bolt.Tx) error {
+		if activeHeightIndexSuffix(boltTx) != staleBuckets[0][len(BucketBlockHeights):] {
+			T.Error("the rebuild wasn't written into the inactive buckets")
+		}
+		return nil
+	})
+	if err != nil {
+		T.Fatal(err)
+	}
+}
+
+func TestIndexAllResumesFromCheckpoint(T *testing.T) {
+	dir, blocks := newTestDATDir(T)
+	defer os.RemoveAll(dir)
+
+	db, err := NewBlockDB(filepath.Join(dir, "test.db"), dir, nil)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer db.Close()
+
+	// pretend that an earlier run was interrupted after committing the first block
+	err = db.store.Update(func(boltTx *bolt.Tx) error {
+		bucket, err := boltTx.CreateBucketIfNotExists([]byte(BucketIndexCheckpoints))
+		if err != nil {
+			return err
+		}
+		checkpointBytes, err := IndexCheckpointRow{BlocksDone: 1}.ToBytes()
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte("blk00000.dat"), checkpointBytes)
+	})
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	err = db.IndexAll(0, 0, 2, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	_, err = db.getBlockIndexRowFromDB(blocks[0].BlockHash())
+	if _, ok := err.(BlockNotFoundError); !ok {
+		T.Errorf("expected the checkpointed block to be skipped, got %v", err)
+	}
+
+	for _, bl := range blocks[1:] {
+		row, err := db.getBlockIndexRowFromDB(bl.BlockHash())
+		if err != nil {
+			T.Fatal(err)
+		} else if !row.HasLocation() {
+			T.Errorf("block %v was indexed without its location", bl.BlockHash())
+		}
+
+		for _, msgTx := range bl.Transactions {
+			tx, err := db.GetTx(msgTx.TxHash())
+			if err != nil {
+				T.Fatal(err)
+			} else if tx.BlockHash != bl.BlockHash() {
+				T.Errorf("tx %v: got block %v, expected %v", msgTx.TxHash(), tx.BlockHash, bl.BlockHash())
+			}
+		}
+	}
+
+	checkpoint, err := db.GetIndexCheckpoint("blk00000.dat")
+	if err != nil {
+		T.Fatal(err)
+	} else if checkpoint != (IndexCheckpointRow{BlocksDone: uint32(len(blocks)), Complete: true}) {
+		T.Errorf("unexpected checkpoint %+v", checkpoint)
+	}
+
+	indexed, err := db.CheckIfTransactionsIndexed("blk00000.dat")
+	if err != nil {
+		T.Fatal(err)
+	} else if !indexed {
+		T.Errorf("expected builddb transactions to consider blk00000.dat indexed")
+	}
+}
+
+func TestIndexDATFileAddresses(T *testing.T) {
+	genesis := chaincfg.MainNetParams.GenesisBlock
+
+	addr, err := btcutil.NewAddressPubKeyHash(bytes.Repeat([]byte{0x42}, 20), &chaincfg.MainNetParams)
+	if err != nil {
+		T.Fatal(err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	fundTx := wire.NewMsgTx(wire.TxVersion)
+	fundTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}, Index: 0}, nil))
+	fundTx.AddTxOut(wire.NewTxOut(5000, pkScript))
+	fundTx.AddTxOut(wire.NewTxOut(700, []byte{0x6a, 0x01, 0x02}))
+
+	// P2WPKH, paying to bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4
+	p2wpkh, err := hex.DecodeString("0014751e76e8199196d454941c45d1b3a323f1433bd6")
+	if err != nil {
+		T.Fatal(err)
+	}
+	fundTx.AddTxOut(wire.NewTxOut(800, p2wpkh))
+
+	spendTx := wire.NewMsgTx(wire.TxVersion)
+	spendTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: fundTx.TxHash(), Index: 0}, nil))
+	spendTx.AddTxOut(wire.NewTxOut(4000, []byte{0x51}))
+
+	fundBlock := wire.NewMsgBlock(&genesis.Header)
+	fundBlock.Header.Timestamp = time.Unix(1000, 0)
+	fundBlock.AddTransaction(fundTx)
+
+	spendBlock := wire.NewMsgBlock(&genesis.Header)
+	spendBlock.Header.Timestamp = time.Unix(2000, 0)
+	spendBlock.AddTransaction(spendTx)
+
+	// the spending block comes first, as can happen when blocks are downloaded out of order
+	dir := testdat.WriteDATDir(T, []*wire.MsgBlock{spendBlock, fundBlock})
+	defer os.RemoveAll(dir)
+
+	db, err := NewBlockDB(filepath.Join(dir, "test.db"), dir, nil)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.IndexDATFileAddresses(0, 0, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	summary, err := db.GetAddressSummary(addr.EncodeAddress())
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	expected := AddressSummary{
+		Address:       addr.EncodeAddress(),
+		NumTxs:        2,
+		NumFunded:     1,
+		NumSpent:      1,
+		TotalReceived: 5000,
+		TotalSent:     5000,
+		FirstSeen:     time.Unix(1000, 0),
+		LastSeen:      time.Unix(2000, 0),
+	}
+	if summary != expected {
+		T.Errorf("got %+v, expected %+v", summary, expected)
+	}
+
+	txHashes, err := db.GetAddressTxHashes(addr.EncodeAddress())
+	if err != nil {
+		T.Fatal(err)
+	} else if len(txHashes) != 2 || txHashes[0] != fundTx.TxHash() || txHashes[1] != spendTx.TxHash() {
+		T.Errorf("unexpected tx hashes %v", txHashes)
+	}
+
+	// non-standard scripts are indexed by script hash
+	txs, err := db.GetAddressTxs(ScriptHashKey([]byte{0x6a, 0x01, 0x02}))
+	if err != nil {
+		T.Fatal(err)
+	} else if len(txs) != 1 || txs[0].TxHash != fundTx.TxHash() || txs[0].Index != 1 || txs[0].Value != 700 {
+		T.Errorf("unexpected script hash rows %+v", txs)
+	}
+
+	// segwit outputs are found by their bc1 address
+	txs, err = db.GetAddressTxs("BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4")
+	if err != nil {
+		T.Fatal(err)
+	} else if len(txs) != 1 || txs[0].TxHash != fundTx.TxHash() || txs[0].Index != 2 || txs[0].Value != 800 {
+		T.Errorf("unexpected segwit address rows %+v", txs)
+	}
+
+	numPending, err := db.countPendingAddressSpends()
+	if err != nil {
+		T.Fatal(err)
+	} else if numPending != 1 {
+		// only the spend of the made-up outpoint in fundTx is left over
+		T.Errorf("expected 1 pending spend, got %v", numPending)
+	}
+}
+
+func TestTxOutStatusAndUTXOSnapshot(T *testing.T) {
+	genesis := chaincfg.MainNetParams.GenesisBlock
+
+	fundTx := wire.NewMsgTx(wire.TxVersion)
+	fundTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}, Index: 0}, nil))
+	fundTx.AddTxOut(wire.NewTxOut(5000, []byte{0x51}))
+	fundTx.AddTxOut(wire.NewTxOut(0, []byte{0x6a, 0x01, 0x02}))
+
+	spendTx := wire.NewMsgTx(wire.TxVersion)
+	spendTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: fundTx.TxHash(), Index: 0}, nil))
+	spendTx.AddTxOut(wire.NewTxOut(4000, []byte{0x51}))
+
+	b1 := wire.NewMsgBlock(&genesis.Header)
+	b1.Header.PrevBlock = genesis.BlockHash()
+	b1.AddTransaction(fundTx)
+
+	b2 := wire.NewMsgBlock(&genesis.Header)
+	b2.Header.PrevBlock = b1.BlockHash()
+	b2.AddTransaction(spendTx)
+
+	dir := testdat.WriteDATDir(T, []*wire.MsgBlock{genesis, b1, b2})
+	defer os.RemoveAll(dir)
+
+	db, err := NewBlockDB(filepath.Join(dir, "test.db"), dir, nil)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.IndexAll(0, 0, 1, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	spentKey := SpentTxOutKey{TxHash: fundTx.TxHash(), TxOutIndex: 0}
+	opReturnKey := SpentTxOutKey{TxHash: fundTx.TxHash(), TxOutIndex: 1}
+
+	state, err := db.GetTxOutStatusAtHeight(spentKey, 1)
+	if err != nil {
+		T.Fatal(err)
+	} else if state.Status != TxOutStatusUnspent {
+		T.Errorf("expected output to be unspent at height 1, got %v", state)
+	}
+
+	state, err = db.GetTxOutStatus(spentKey)
+	if err != nil {
+		T.Fatal(err)
+	} else if state.Status != TxOutStatusSpent || state.SpentBy.InputTxHash != spendTx.TxHash() || state.SpentAtHeight != 2 {
+		T.Errorf("expected output to be spent by %v at height 2, got %v", spendTx.TxHash(), state)
+	}
+
+	state, err = db.GetTxOutStatus(opReturnKey)
+	if err != nil {
+		T.Fatal(err)
+	} else if state.Status != TxOutStatusUnspent {
+		T.Errorf("expected OP_RETURN output to be unspent, got %v", state)
+	}
+
+	state, err = db.GetTxOutStatus(SpentTxOutKey{TxHash: chainhash.Hash{2}, TxOutIndex: 0})
+	if err != nil {
+		T.Fatal(err)
+	} else if state.Status != TxOutStatusUnknown {
+		T.Errorf("expected an unindexed output to be unknown, got %v", state)
+	}
+
+	utxos := []SpentTxOutKey{}
+	err = db.ForEachUTXO(2, func(utxo UTXO) error {
+		utxos = append(utxos, utxo.Key)
+		return nil
+	})
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	expected := []SpentTxOutKey{
+		{TxHash: genesis.Transactions[0].TxHash(), TxOutIndex: 0},
+		opReturnKey,
+		{TxHash: spendTx.TxHash(), TxOutIndex: 0},
+	}
+	if len(utxos) != len(expected) {
+		T.Fatalf("got UTXOs %v, expected %v", utxos, expected)
+	}
+	for i := range expected {
+		if utxos[i] != expected[i] {
+			T.Errorf("UTXO %v: got %v, expected %v", i, utxos[i], expected[i])
+		}
+	}
+}
+
+func TestUTXOSnapshotWithStaleSpender(T *testing.T) {
+	genesis := chaincfg.MainNetParams.GenesisBlock
+	newBlock := func(prev *wire.MsgBlock, nonce uint32, txs ...*wire.MsgTx) *wire.MsgBlock {
+		bl := wire.NewMsgBlock(&genesis.Header)
+		bl.Header.PrevBlock = prev.BlockHash()
+		bl.Header.Nonce = nonce
+		for _, tx := range txs {
+			bl.AddTransaction(tx)
+		}
+		return bl
+	}
+
+	fundTx := wire.NewMsgTx(wire.TxVersion)
+	fundTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}, Index: 0}, nil))
+	fundTx.AddTxOut(wire.NewTxOut(5000, []byte{0x51}))
+	fundTx.AddTxOut(wire.NewTxOut(6000, []byte{0x51}))
+
+	// spendTx is mined in both the stale block and its replacement, and staleOnlyTx only in the stale block
+	spendTx := wire.NewMsgTx(wire.TxVersion)
+	spendTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: fundTx.TxHash(), Index: 0}, nil))
+	spendTx.AddTxOut(wire.NewTxOut(4000, []byte{0x51}))
+
+	staleOnlyTx := wire.NewMsgTx(wire.TxVersion)
+	staleOnlyTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: fundTx.TxHash(), Index: 1}, nil))
+	staleOnlyTx.AddTxOut(wire.NewTxOut(5500, []byte{0x51}))
+
+	lastTx := genesis.Transactions[0].Copy()
+	lastTx.LockTime = 3
+
+	// genesis <- b1 <- b2 <- b3
+	//                <- stale
+	b1 := newBlock(genesis, 1, fundTx)
+	b2 := newBlock(b1, 2, spendTx)
+	stale := newBlock(b1, 3, spendTx, staleOnlyTx)
+	b3 := newBlock(b2, 4, lastTx)
+
+	// the stale block comes after b2, so the tx index places spendTx in it
+	dir := testdat.WriteDATDir(T, []*wire.MsgBlock{genesis, b1, b2, stale, b3})
+	defer os.RemoveAll(dir)
+
+	db, err := NewBlockDB(filepath.Join(dir, "test.db"), dir, nil)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.IndexAll(0, 0, 1, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	heightRow, err := db.GetTxBlockHeight(spendTx.TxHash())
+	if err != nil {
+		T.Fatal(err)
+	} else if !heightRow.Orphaned {
+		T.Fatalf("expected the tx index to place spendTx in the stale block, got %v", heightRow)
+	}
+
+	spentKey := SpentTxOutKey{TxHash: fundTx.TxHash(), TxOutIndex: 0}
+	staleSpentKey := SpentTxOutKey{TxHash: fundTx.TxHash(), TxOutIndex: 1}
+
+	state, err := db.GetTxOutStatusAtHeight(spentKey, 3)
+	if err != nil {
+		T.Fatal(err)
+	} else if state.Status != TxOutStatusSpent || state.SpentAtHeight != 2 {
+		T.Errorf("expected output to be spent at height 2 on the best chain, got %v", state)
+	}
+
+	statuses := map[SpentTxOutKey]TxOutStatus{}
+	err = db.ForEachUTXO(3, func(utxo UTXO) error {
+		statuses[utxo.Key] = utxo.Status
+		return nil
+	})
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	expected := map[SpentTxOutKey]TxOutStatus{
+		{TxHash: genesis.Transactions[0].TxHash(), TxOutIndex: 0}: TxOutStatusUnspent,
+		staleSpentKey: TxOutStatusUnknown,
+		{TxHash: spendTx.TxHash(), TxOutIndex: 0}: TxOutStatusUnspent,
+		{TxHash: lastTx.TxHash(), TxOutIndex: 0}:  TxOutStatusUnspent,
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		T.Errorf("got UTXOs %v, expected %v", statuses, expected)
+	}
+}
+
+// stubSpentTxOutBackend answers every GetSpentTxOut with err.
+type stubSpentTxOutBackend struct {
+	err error
+}
+
+func (b *stubSpentTxOutBackend) GetBlockHashForTx(txHash chainhash.Hash) (chainhash.Hash, error) {
+	return chainhash.Hash{}, ErrRemoteNotFound
+}
+
+func (b *stubSpentTxOutBackend) GetSpentTxOut(tx *Tx, txoutIdx uint32) (SpentTxOutRow, error) {
+	return SpentTxOutRow{}, b.err
+}
+
+func (b *stubSpentTxOutBackend) GetAddressTxHashes(addr string) ([]chainhash.Hash, error) {
+	return nil, ErrRemoteUnsupported
+}
+
+func TestTxOutStatusFromBackend(T *testing.T) {
+	dir, blocks := newTestDATDir(T)
+	defer os.RemoveAll(dir)
+
+	backend := &stubSpentTxOutBackend{}
+	db, err := NewBlockDB(filepath.Join(dir, "test.db"), dir, backend)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer db.Close()
+
+	// without heights or spent txouts, only the backend can answer
+	err = db.IndexDATFileTransactions(0, 0, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+	key := SpentTxOutKey{TxHash: blocks[0].Transactions[0].TxHash(), TxOutIndex: 0}
+
+	backend.err = ErrRemoteUnspent
+	state, err := db.GetTxOutStatus(key)
+	if err != nil {
+		T.Fatal(err)
+	} else if state.Status != TxOutStatusUnspent {
+		T.Errorf("expected the output to be unspent, got %v", state)
+	}
+
+	// e.g. bitcoind knows the output is spent, but the spender is too far away to find
+	backend.err = ErrRemoteNotFound
+	state, err = db.GetTxOutStatus(key)
+	if err != nil {
+		T.Fatal(err)
+	} else if state.Status != TxOutStatusUnknown {
+		T.Errorf("expected the output to be unknown, got %v", state)
+	}
+}
+
+func TestBlockFeeSummary(T *testing.T) {
+	genesis := chaincfg.MainNetParams.GenesisBlock
+	genesisCoinbase := genesis.Transactions[0]
+
+	spendTx := wire.NewMsgTx(wire.TxVersion)
+	spendTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: genesisCoinbase.TxHash(), Index: 0}, nil))
+	spendTx.AddTxOut(wire.NewTxOut(genesisCoinbase.TxOut[0].Value-1000, []byte{0x51}))
+
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: wire.MaxPrevOutIndex}, []byte{0x51, 0x51}))
+	coinbase.AddTxOut(wire.NewTxOut(50*SatoshisPerBTC+1000, []byte{0x51}))
+
+	b1 := wire.NewMsgBlock(&genesis.Header)
+	b1.Header.PrevBlock = genesis.BlockHash()
+	b1.AddTransaction(coinbase)
+	b1.AddTransaction(spendTx)
+
+	dir := testdat.WriteDATDir(T, []*wire.MsgBlock{genesis, b1})
+	defer os.RemoveAll(dir)
+
+	db, err := NewBlockDB(filepath.Join(dir, "test.db"), dir, nil)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.IndexAll(0, 0, 1, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	summary, err := db.GetBlockFeeSummary(btcutil.NewBlock(b1))
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	if summary.Height != 1 || summary.Subsidy != 50*SatoshisPerBTC || summary.TotalFees != 1000 || summary.Reward() != summary.Claimed() {
+		T.Errorf("unexpected summary %+v", summary)
+	}
+	if summary.Txs[0].Fee != 0 || summary.Txs[1].Fee != 1000 {
+		T.Errorf("unexpected tx fees %+v", summary.Txs)
+	}
+
+	for _, msgTx := range []*wire.MsgTx{coinbase, spendTx} {
+		tx, err := db.GetTx(msgTx.TxHash())
+		if err != nil {
+			T.Fatal(err)
+		}
+
+		fee, err := tx.Fee()
+		if err != nil {
+			T.Fatal(err)
+		} else if tx.IsCoinbase() && fee != 0 {
+			T.Errorf("coinbase claimed its whole reward, but got fee %v", fee)
+		} else if !tx.IsCoinbase() && fee != 1000 {
+			T.Errorf("expected fee 1000, got %v", fee)
+		}
+	}
+}
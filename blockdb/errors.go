@@ -35,3 +35,50 @@ func (e BlockNotFoundError) Error() string {
 		"Try running the \"builddb blocks\" command on the .dat file containing this block, or simply\n"+
 		"run the command on the entire set of .dat files.\n", e.BlockHash.String())
 }
+
+type SpentTxOutNotFoundError struct {
+	Key SpentTxOutKey
+
+	// set if the lookup backend says the output hasn't been spent, rather than that it can't find the spender
+	Unspent bool
+}
+
+func (e SpentTxOutNotFoundError) Error() string {
+	if e.Unspent {
+		return fmt.Sprintf("Output %v of %v is unspent.", e.Key.TxOutIndex, e.Key.TxHash.String())
+	}
+	return fmt.Sprintf("Can't find the transaction spending output %v of %v in the local index.\n\n"+
+		"Try running the \"builddb spent-txouts\" command on the .dat files following the block that\n"+
+		"contains this transaction.", e.Key.TxOutIndex, e.Key.TxHash.String())
+}
+
+type BlockHeightNotFoundError struct {
+	Height uint32
+}
+
+func (e BlockHeightNotFoundError) Error() string {
+	return fmt.Sprintf("There is no block at height %v on the best chain in the local index.\n\n"+
+		"Try running the \"builddb blocks\" command on more .dat files, then run \"builddb heights\" again.", e.Height)
+}
+
+type BlockHeightUnknownError struct {
+	BlockHash chainhash.Hash
+}
+
+func (e BlockHeightUnknownError) Error() string {
+	return fmt.Sprintf("The height of block %v is unknown.\n\n"+
+		"Either it was indexed after the last \"builddb heights\" run, or it doesn't connect to the genesis block\n"+
+		"because the .dat files containing its ancestors haven't been indexed.", e.BlockHash.String())
+}
+
+// IsNotFound returns true if err indicates that the requested data simply isn't present in the local
+// index or .dat files (as opposed to a corrupted database, an I/O failure, etc.).  Callers can use it to
+// skip missing data instead of retrying or aborting.
+func IsNotFound(err error) bool {
+	switch err.(type) {
+	case DataNotIndexedError, TxNotFoundError, BlockNotFoundError, SpentTxOutNotFoundError,
+		BlockHeightNotFoundError, BlockHeightUnknownError:
+		return true
+	}
+	return false
+}
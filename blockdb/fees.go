@@ -0,0 +1,199 @@
+package blockdb
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+func (tx *Tx) IsCoinbase() bool {
+	return IsCoinbaseTx(tx.MsgTx())
+}
+
+func (tx *Tx) OutputValue() Satoshis {
+	return outputValue(tx.MsgTx())
+}
+
+// InputValue returns the total value of the outputs spent by the transaction.  A coinbase doesn't spend
+// anything, so its input value is what it's allowed to claim instead: the block subsidy plus the fees of
+// every other transaction in the block.
+func (tx *Tx) InputValue() (Satoshis, error) {
+	if tx.IsCoinbase() {
+		block, err := tx.db.GetBlock(tx.BlockHash)
+		if err != nil {
+			return 0, err
+		}
+
+		summary, err := tx.db.GetBlockFeeSummary(block.Block)
+		if err != nil {
+			return 0, err
+		}
+		return summary.Reward(), nil
+	}
+
+	return tx.db.inputValue(tx.MsgTx(), nil)
+}
+
+// Fee returns the transaction's fee.  For a coinbase, this is the part of the block reward that the miner
+// didn't claim, which is almost always zero.
+func (tx *Tx) Fee() (Satoshis, error) {
+	inValue, err := tx.InputValue()
+	if err != nil {
+		return 0, err
+	}
+	return inValue - tx.OutputValue(), nil
+}
+
+func outputValue(msgTx *wire.MsgTx) Satoshis {
+	var value Satoshis
+	for _, txout := range msgTx.TxOut {
+		value += Satoshis(txout.Value)
+	}
+	return value
+}
+
+// inputValue sums up the outputs spent by a (non-coinbase) transaction.  Previous transactions are looked up
+// in blockTxs first, so that transactions spending outputs from the same block don't hit the index.
+func (db *BlockDB) inputValue(msgTx *wire.MsgTx, blockTxs map[chainhash.Hash]*wire.MsgTx) (Satoshis, error) {
+	var value Satoshis
+	for _, txin := range msgTx.TxIn {
+		prevMsgTx, exists := blockTxs[txin.PreviousOutPoint.Hash]
+		if !exists {
+			prevTx, err := db.GetTx(txin.PreviousOutPoint.Hash)
+			if err != nil {
+				return 0, err
+			}
+			prevMsgTx = prevTx.MsgTx()
+		}
+
+		if int(txin.PreviousOutPoint.Index) >= len(prevMsgTx.TxOut) {
+			return 0, fmt.Errorf("input spends output %v of %v, which only has %v outputs", txin.PreviousOutPoint.Index, txin.PreviousOutPoint.Hash.String(), len(prevMsgTx.TxOut))
+		}
+		value += Satoshis(prevMsgTx.TxOut[txin.PreviousOutPoint.Index].Value)
+	}
+	return value, nil
+}
+
+type TxFees struct {
+	TxHash      chainhash.Hash
+	IsCoinbase  bool
+	InputValue  Satoshis
+	OutputValue Satoshis
+	Fee         Satoshis
+
+	// the serialized size in bytes, including any witness data
+	Size int
+}
+
+// FeeRate returns the fee in satoshis per byte.
+func (f TxFees) FeeRate() float64 {
+	if f.Size == 0 {
+		return 0
+	}
+	return float64(f.Fee) / float64(f.Size)
+}
+
+type BlockFeeSummary struct {
+	BlockHash chainhash.Hash
+	Height    uint32
+	Subsidy   Satoshis
+
+	// the sum of the fees of every transaction except the coinbase
+	TotalFees Satoshis
+
+	// the sum of every transaction's outputs, including the coinbase
+	TotalOutput Satoshis
+
+	// the serialized size in bytes, including witness data
+	Size int
+
+	// in block order, starting with the coinbase
+	Txs []TxFees
+}
+
+// Reward returns what the coinbase is allowed to claim.
+func (s BlockFeeSummary) Reward() Satoshis {
+	return s.Subsidy + s.TotalFees
+}
+
+// Claimed returns what the coinbase actually claimed.
+func (s BlockFeeSummary) Claimed() Satoshis {
+	if len(s.Txs) == 0 || !s.Txs[0].IsCoinbase {
+		return 0
+	}
+	return s.Txs[0].OutputValue
+}
+
+// FeeRate returns the average fee in satoshis per byte of the block's non-coinbase transactions.
+func (s BlockFeeSummary) FeeRate() float64 {
+	size := 0
+	for _, tx := range s.Txs {
+		if !tx.IsCoinbase {
+			size += tx.Size
+		}
+	}
+	if size == 0 {
+		return 0
+	}
+	return float64(s.TotalFees) / float64(size)
+}
+
+// GetBlockFeeSummary computes the fees of every transaction in the block.  The subsidy depends on the
+// block's height, so the heights index has to be built, and every transaction spent by the block has to be
+// in the transaction index.
+func (db *BlockDB) GetBlockFeeSummary(bl *btcutil.Block) (BlockFeeSummary, error) {
+	heightRow, err := db.GetBlockHeight(*bl.Hash())
+	if err != nil {
+		return BlockFeeSummary{}, err
+	}
+
+	summary := BlockFeeSummary{
+		BlockHash: *bl.Hash(),
+		Height:    heightRow.Height,
+		Subsidy:   CalcBlockSubsidy(heightRow.Height),
+		Size:      wire.MaxBlockHeaderPayload + wire.VarIntSerializeSize(uint64(len(bl.Transactions()))),
+		Txs:       make([]TxFees, len(bl.Transactions())),
+	}
+
+	blockTxs := map[chainhash.Hash]*wire.MsgTx{}
+	for _, tx := range bl.Transactions() {
+		blockTxs[*tx.Hash()] = tx.MsgTx()
+	}
+
+	coinbaseIdx := -1
+	for i, tx := range bl.Transactions() {
+		fees := TxFees{
+			TxHash:      *tx.Hash(),
+			IsCoinbase:  IsCoinbaseTx(tx.MsgTx()),
+			OutputValue: outputValue(tx.MsgTx()),
+			Size:        tx.MsgTx().SerializeSizeWitness(),
+		}
+		summary.TotalOutput += fees.OutputValue
+		summary.Size += fees.Size
+
+		if fees.IsCoinbase {
+			// filled in below, once the other transactions' fees are known
+			coinbaseIdx = i
+			summary.Txs[i] = fees
+			continue
+		}
+
+		fees.InputValue, err = db.inputValue(tx.MsgTx(), blockTxs)
+		if err != nil {
+			return BlockFeeSummary{}, err
+		}
+		fees.Fee = fees.InputValue - fees.OutputValue
+		summary.TotalFees += fees.Fee
+		summary.Txs[i] = fees
+	}
+
+	if coinbaseIdx >= 0 {
+		coinbase := &summary.Txs[coinbaseIdx]
+		coinbase.InputValue = summary.Reward()
+		coinbase.Fee = coinbase.InputValue - coinbase.OutputValue
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,463 @@
+package blockdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/boltdb/bolt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+)
+
+const (
+	// block hash -> BlockHeightRow, for every block that connects to the genesis block
+	BucketBlockHeights = "BlockHeights"
+
+	// big-endian height -> block hash, for blocks on the best chain only
+	BucketMainChain = "MainChain"
+
+	// "active" -> the suffix of the BlockHeights and MainChain buckets that readers should use.  The height
+	// indices are rebuilt into the other pair of buckets and only then switched over, so an interrupted
+	// rebuild leaves the previous indices in place.  Databases from before this have no suffix.
+	BucketHeightIndexState = "HeightIndexState"
+)
+
+var keyActiveHeightIndex = []byte("active")
+
+// heightIndexBuckets returns the BlockHeights and MainChain buckets that are currently in use.  Either is
+// nil if the heights haven't been indexed.
+func heightIndexBuckets(boltTx *bolt.Tx) (heights *bolt.Bucket, mainChain *bolt.Bucket) {
+	suffix := activeHeightIndexSuffix(boltTx)
+	return boltTx.Bucket([]byte(BucketBlockHeights + suffix)), boltTx.Bucket([]byte(BucketMainChain + suffix))
+}
+
+func activeHeightIndexSuffix(boltTx *bolt.Tx) string {
+	bucket := boltTx.Bucket([]byte(BucketHeightIndexState))
+	if bucket == nil {
+		return ""
+	}
+	return string(bucket.Get(keyActiveHeightIndex))
+}
+
+type BlockHeightRow struct {
+	Height uint32
+
+	// true for blocks on a stale branch, i.e. not an ancestor of the tip with the most cumulative work
+	Orphaned bool
+}
+
+func (r BlockHeightRow) String() string {
+	if r.Orphaned {
+		return fmt.Sprintf("%v (orphaned)", r.Height)
+	}
+	return fmt.Sprintf("%v", r.Height)
+}
+
+func newBlockHeightRowFromBytes(bs []byte) (BlockHeightRow, error) {
+	row := BlockHeightRow{}
+	err := binary.Read(bytes.NewReader(bs), binary.LittleEndian, &row)
+	if err != nil {
+		return BlockHeightRow{}, err
+	}
+	return row, nil
+}
+
+func (r BlockHeightRow) ToBytes() ([]byte, error) {
+	data := &bytes.Buffer{}
+	err := binary.Write(data, binary.LittleEndian, r)
+	if err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+func heightKey(height uint32) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, height)
+	return key
+}
+
+type chainNode struct {
+	prevHash chainhash.Hash
+	work     *big.Int
+
+	// where the block is stored, as a stand-in for when the node received it
+	datFileIdx uint16
+	offset     uint64
+
+	// filled in by IndexBlockHeights
+	chainWork *big.Int
+	height    uint32
+	connected bool
+}
+
+// IndexBlockHeights links every block in the block index to its parent via the header's PrevBlock, picks
+// the tip with the most cumulative work as the best chain, and writes the height indices.  Like Bitcoin
+// Core, it keeps the tip it saw first when several have the same work, going by where the blocks are
+// stored.  Blocks that don't lead back to the genesis block (because their ancestors' .dat files haven't
+// been indexed) are left out.  Since the best chain can change whenever more blocks are indexed, the height
+// indices are rebuilt from scratch every time.
+func (db *BlockDB) IndexBlockHeights() error {
+	fmt.Println("reading block headers...")
+
+	nodes, err := db.readChainNodes()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("linking", len(nodes), "blocks...")
+
+	var bestTip chainhash.Hash
+	var bestWork *big.Int
+	numUnconnected := 0
+	for hash := range nodes {
+		if !db.connectChainNode(nodes, hash) {
+			numUnconnected++
+			continue
+		}
+
+		node := nodes[hash]
+		if bestWork == nil {
+			bestTip, bestWork = hash, node.chainWork
+		} else if cmp := node.chainWork.Cmp(bestWork); cmp > 0 || (cmp == 0 && node.storedBefore(nodes[bestTip])) {
+			bestTip, bestWork = hash, node.chainWork
+		}
+	}
+
+	if bestWork == nil {
+		return fmt.Errorf("none of the indexed blocks connect to the genesis block (index blk00000.dat first)")
+	}
+	if numUnconnected > 0 {
+		fmt.Printf("warning: %v blocks don't connect to the genesis block and won't get a height (are some .dat files missing from the block index?)\n", numUnconnected)
+	}
+
+	mainChain := map[chainhash.Hash]bool{}
+	for hash := bestTip; hash != emptyHash; hash = nodes[hash].prevHash {
+		mainChain[hash] = true
+	}
+
+	fmt.Printf("best chain: height %v, tip %v\n", nodes[bestTip].height, bestTip.String())
+
+	return db.writeBlockHeights(nodes, mainChain)
+}
+
+func (n *chainNode) storedBefore(other *chainNode) bool {
+	if n.datFileIdx != other.datFileIdx {
+		return n.datFileIdx < other.datFileIdx
+	}
+	return n.offset < other.offset
+}
+
+// connectChainNode computes the height and cumulative work of a block, walking back to the first ancestor
+// that has already been computed.  It returns false if the block doesn't lead back to the genesis block.
+func (db *BlockDB) connectChainNode(nodes map[chainhash.Hash]*chainNode, hash chainhash.Hash) bool {
+	// collect the ancestors that still need computing (iteratively, since the chain is very deep)
+	path := []chainhash.Hash{}
+	for cur := hash; ; {
+		node := nodes[cur]
+		if node.connected {
+			break
+		}
+		path = append(path, cur)
+
+		if node.prevHash == emptyHash {
+			// the genesis block
+			break
+		}
+		if _, exists := nodes[node.prevHash]; !exists {
+			return false
+		}
+		cur = node.prevHash
+	}
+
+	for i := len(path) - 1; i >= 0; i-- {
+		node := nodes[path[i]]
+		if node.prevHash == emptyHash {
+			node.height = 0
+			node.chainWork = new(big.Int).Set(node.work)
+		} else {
+			parent := nodes[node.prevHash]
+			node.height = parent.height + 1
+			node.chainWork = new(big.Int).Add(parent.chainWork, node.work)
+		}
+		node.connected = true
+	}
+	return true
+}
+
+func (db *BlockDB) readChainNodes() (map[chainhash.Hash]*chainNode, error) {
+	rows := map[chainhash.Hash]BlockIndexRow{}
+	err := db.store.View(func(boltTx *bolt.Tx) error {
+		bucket := boltTx.Bucket([]byte(BucketBlockIndex))
+		if bucket == nil {
+			return DataNotIndexedError{Index: "blocks"}
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			row, err := NewBlockIndexRowFromBytes(v)
+			if err != nil {
+				return err
+			}
+
+			var hash chainhash.Hash
+			copy(hash[:], k)
+			rows[hash] = row
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// group by .dat file so that each file is only opened once
+	byDATFile := map[uint16][]chainhash.Hash{}
+	for hash, row := range rows {
+		byDATFile[row.DATFileIdx] = append(byDATFile[row.DATFileIdx], hash)
+	}
+
+	nodes := make(map[chainhash.Hash]*chainNode, len(rows))
+	for datFileIdx, hashes := range byDATFile {
+		f, err := utils.OpenDATFile(db.DATFilename(datFileIdx))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hash := range hashes {
+			row, err := db.ensureBlockLocation(hash, rows[hash])
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+
+			headerBytes := make([]byte, wire.MaxBlockHeaderPayload)
+			_, err = f.ReadAt(headerBytes, int64(row.Offset))
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+
+			header := wire.BlockHeader{}
+			err = header.Deserialize(bytes.NewReader(headerBytes))
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+
+			nodes[hash] = &chainNode{prevHash: header.PrevBlock, work: calcWork(header.Bits), datFileIdx: row.DATFileIdx, offset: row.Offset}
+		}
+
+		f.Close()
+	}
+
+	return nodes, nil
+}
+
+// writeBlockHeights writes the height indices into the pair of buckets that isn't in use, in several Bolt
+// transactions, and then switches readers over to them in one final transaction.
+func (db *BlockDB) writeBlockHeights(nodes map[chainhash.Hash]*chainNode, mainChain map[chainhash.Hash]bool) error {
+	fmt.Println("writing block heights...")
+	defer db.invalidateCoverage()
+
+	var oldSuffix, newSuffix string
+	err := db.store.Update(func(boltTx *bolt.Tx) error {
+		oldSuffix = activeHeightIndexSuffix(boltTx)
+		newSuffix = "-a"
+		if oldSuffix == newSuffix {
+			newSuffix = "-b"
+		}
+
+		// clear out whatever an interrupted rebuild left behind
+		return deleteBucketsIfExist(boltTx, BucketBlockHeights+newSuffix, BucketMainChain+newSuffix)
+	})
+	if err != nil {
+		return err
+	}
+
+	const writesPerBoltTx = 5000
+
+	hashes := make([]chainhash.Hash, 0, len(nodes))
+	for hash, node := range nodes {
+		if node.connected {
+			hashes = append(hashes, hash)
+		}
+	}
+
+	for start := 0; start < len(hashes); start += writesPerBoltTx {
+		end := start + writesPerBoltTx
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+
+		err := db.store.Update(func(boltTx *bolt.Tx) error {
+			heightsBucket, err := boltTx.CreateBucketIfNotExists([]byte(BucketBlockHeights + newSuffix))
+			if err != nil {
+				return fmt.Errorf("create bucket: %s", err)
+			}
+			mainChainBucket, err := boltTx.CreateBucketIfNotExists([]byte(BucketMainChain + newSuffix))
+			if err != nil {
+				return fmt.Errorf("create bucket: %s", err)
+			}
+
+			for _, hash := range hashes[start:end] {
+				node := nodes[hash]
+				row := BlockHeightRow{Height: node.height, Orphaned: !mainChain[hash]}
+
+				rowBytes, err := row.ToBytes()
+				if err != nil {
+					return err
+				}
+
+				h := hash
+				err = heightsBucket.Put(h[:], rowBytes)
+				if err != nil {
+					return err
+				}
+
+				if !row.Orphaned {
+					err = mainChainBucket.Put(heightKey(node.height), h[:])
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return db.store.Update(func(boltTx *bolt.Tx) error {
+		// create the buckets even if no block got a height, so that readers find an (empty) index
+		for _, name := range []string{BucketBlockHeights + newSuffix, BucketMainChain + newSuffix} {
+			_, err := boltTx.CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return fmt.Errorf("create bucket: %s", err)
+			}
+		}
+
+		stateBucket, err := boltTx.CreateBucketIfNotExists([]byte(BucketHeightIndexState))
+		if err != nil {
+			return fmt.Errorf("create bucket: %s", err)
+		}
+		err = stateBucket.Put(keyActiveHeightIndex, []byte(newSuffix))
+		if err != nil {
+			return err
+		}
+
+		return deleteBucketsIfExist(boltTx, BucketBlockHeights+oldSuffix, BucketMainChain+oldSuffix)
+	})
+}
+
+func deleteBucketsIfExist(boltTx *bolt.Tx, names ...string) error {
+	for _, name := range names {
+		if boltTx.Bucket([]byte(name)) != nil {
+			err := boltTx.DeleteBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (db *BlockDB) GetBlockHeight(blockHash chainhash.Hash) (BlockHeightRow, error) {
+	var row BlockHeightRow
+
+	err := db.store.View(func(boltTx *bolt.Tx) error {
+		bucket, _ := heightIndexBuckets(boltTx)
+		if bucket == nil {
+			return DataNotIndexedError{Index: "heights"}
+		}
+
+		val := bucket.Get(blockHash[:])
+		if val == nil {
+			return BlockHeightUnknownError{BlockHash: blockHash}
+		}
+
+		var err error
+		row, err = newBlockHeightRowFromBytes(val)
+		return err
+	})
+
+	return row, err
+}
+
+// GetBlockHashAtHeight returns the hash of the block at the given height on the best chain.
+func (db *BlockDB) GetBlockHashAtHeight(height uint32) (chainhash.Hash, error) {
+	var hash chainhash.Hash
+
+	err := db.store.View(func(boltTx *bolt.Tx) error {
+		_, bucket := heightIndexBuckets(boltTx)
+		if bucket == nil {
+			return DataNotIndexedError{Index: "heights"}
+		}
+
+		val := bucket.Get(heightKey(height))
+		if val == nil {
+			return BlockHeightNotFoundError{Height: height}
+		}
+
+		copy(hash[:], val)
+		return nil
+	})
+
+	return hash, err
+}
+
+// GetTxBlockHeight returns the height of the block containing the given transaction.
+func (db *BlockDB) GetTxBlockHeight(txHash chainhash.Hash) (BlockHeightRow, error) {
+	txRow, err := db.getTxIndexRowFromDB(txHash)
+	if err != nil {
+		return BlockHeightRow{}, err
+	}
+	return db.GetBlockHeight(txRow.BlockHash)
+}
+
+// TxBlockHeightString is a convenience for outputs that have a column for the block height.  It returns
+// an empty string when the height isn't known.
+func (db *BlockDB) TxBlockHeightString(txHash chainhash.Hash) string {
+	row, err := db.GetTxBlockHeight(txHash)
+	if err != nil {
+		return ""
+	}
+	return row.String()
+}
+
+// calcWork returns the expected number of hashes needed to find a block with the given difficulty bits,
+// i.e. 2^256 / (target + 1).
+func calcWork(bits uint32) *big.Int {
+	target := compactToBig(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+
+	denominator := new(big.Int).Add(target, big.NewInt(1))
+	return new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 256), denominator)
+}
+
+// compactToBig decodes the "compact" difficulty representation used in block headers: a base-256 exponent
+// in the top byte, a sign bit, and a 23-bit mantissa.
+func compactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	isNegative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var bn *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		bn = big.NewInt(int64(mantissa))
+	} else {
+		bn = big.NewInt(int64(mantissa))
+		bn.Lsh(bn, 8*(exponent-3))
+	}
+
+	if isNegative {
+		bn = bn.Neg(bn)
+	}
+	return bn
+}
@@ -0,0 +1,383 @@
+package blockdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+)
+
+// .dat filename -> IndexCheckpointRow
+const BucketIndexCheckpoints = "IndexCheckpoints"
+
+// IndexCheckpointRow records how far IndexAll got in a .dat file.  It's committed in the same Bolt
+// transaction as the rows it describes, so after a crash the index is never ahead of or behind it.
+type IndexCheckpointRow struct {
+	BlocksDone uint32
+	Complete   bool
+}
+
+func newIndexCheckpointRowFromBytes(bs []byte) (IndexCheckpointRow, error) {
+	row := IndexCheckpointRow{}
+	err := binary.Read(bytes.NewReader(bs), binary.LittleEndian, &row)
+	if err != nil {
+		return IndexCheckpointRow{}, err
+	}
+	return row, nil
+}
+
+func (r IndexCheckpointRow) ToBytes() ([]byte, error) {
+	data := &bytes.Buffer{}
+	err := binary.Write(data, binary.LittleEndian, r)
+	if err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+// rows are buffered by the writer until there are at least this many, then committed in one Bolt transaction
+const indexRowsPerCommit = 200000
+
+// indexedBlock holds every index row derived from a single block.  A value with fileDone set doesn't
+// describe a block; it tells the writer that a worker has sent all of a .dat file's blocks.
+type indexedBlock struct {
+	datFilename    string
+	indexInDATFile uint32
+	fileDone       bool
+
+	blockHash chainhash.Hash
+	blockRow  BlockIndexRow
+
+	txHashes []chainhash.Hash
+	txRows   []TxIndexRow
+
+	wtxids        []chainhash.Hash
+	wtxidTxHashes []chainhash.Hash
+
+	spentKeys []SpentTxOutKey
+	spentRows []SpentTxOutRow
+
+	addresses blockAddressRows
+}
+
+func (b indexedBlock) numRows() int {
+	return 1 + len(b.txRows) + len(b.wtxids) + len(b.spentRows) + b.addresses.numRows()
+}
+
+// IndexAll builds the block, transaction, spent-txout and address indices in a single pass over each .dat file.
+// The parallelism is per file: each of the workers takes a whole .dat file and decodes its blocks serially, in
+// order, which keeps the per-file checkpoint a simple block count.  With fewer files than workers (e.g. when
+// indexing a single file), the extra workers sit idle.  All writes go through a single goroutine that commits
+// large batches along with each file's checkpoint, so an interrupted run picks up where the last commit left
+// off.  Finally, the block heights are recomputed.
+func (db *BlockDB) IndexAll(startBlock, endBlock uint64, workers int, force bool) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	chJobs := make(chan uint16)
+	chBlocks := make(chan indexedBlock, 1000)
+	chErr := make(chan error, workers+1)
+	quit := make(chan struct{})
+	var quitOnce sync.Once
+	stop := func(err error) {
+		chErr <- err
+		quitOnce.Do(func() { close(quit) })
+	}
+
+	go func() {
+		defer close(chJobs)
+		for i := startBlock; i <= endBlock; i++ {
+			select {
+			case chJobs <- uint16(i):
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	wg := &sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for datFileIdx := range chJobs {
+				err := db.indexAllParseDATFile(datFileIdx, force, chBlocks, quit)
+				if err != nil {
+					stop(err)
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(chBlocks)
+	}()
+
+	err := db.indexAllWriter(chBlocks)
+	if err != nil {
+		stop(err)
+		// let the workers notice and exit
+		for range chBlocks {
+		}
+	}
+
+	select {
+	case err := <-chErr:
+		return err
+	default:
+	}
+
+	err = db.IndexBlockHeights()
+	if err != nil {
+		return fmt.Errorf("computing block heights: %v", err)
+	}
+	return nil
+}
+
+func (db *BlockDB) indexAllParseDATFile(datFileIdx uint16, force bool, chBlocks chan<- indexedBlock, quit <-chan struct{}) error {
+	datFilename := utils.DATFilename(datFileIdx)
+
+	checkpoint, err := db.GetIndexCheckpoint(datFilename)
+	if err != nil {
+		return err
+	}
+	if force {
+		checkpoint = IndexCheckpointRow{}
+	} else if checkpoint.Complete {
+		fmt.Println(datFilename, "already indexed, skipping")
+		return nil
+	}
+
+	fmt.Println("parsing block file", datFilename)
+
+	blocks, locs, err := utils.LoadBlocksAndLocsFromDAT(filepath.Join(db.datFileDir, datFilename))
+	if err != nil {
+		return err
+	}
+
+	if checkpoint.BlocksDone > 0 {
+		fmt.Printf("resuming %v at block %v/%v\n", datFilename, checkpoint.BlocksDone, len(blocks))
+	}
+
+	for blIdx := int(checkpoint.BlocksDone); blIdx < len(blocks); blIdx++ {
+		bl := blocks[blIdx]
+		loc := locs[blIdx]
+
+		b := indexedBlock{
+			datFilename:    datFilename,
+			indexInDATFile: uint32(blIdx),
+			blockHash:      *bl.Hash(),
+			blockRow: BlockIndexRow{
+				DATFileIdx:     datFileIdx,
+				Timestamp:      bl.MsgBlock().Header.Timestamp.Unix(),
+				IndexInDATFile: uint32(blIdx),
+				Offset:         loc.Offset,
+				Length:         loc.Length,
+			},
+			addresses: newBlockAddressRows(bl),
+		}
+
+		for txIdx, tx := range bl.Transactions() {
+			b.txHashes = append(b.txHashes, *tx.Hash())
+			b.txRows = append(b.txRows, TxIndexRow{
+				BlockHash:    *bl.Hash(),
+				IndexInBlock: uint64(txIdx),
+				TxOffset:     uint32(loc.TxLocs[txIdx].TxStart),
+				TxLength:     uint32(loc.TxLocs[txIdx].TxLen),
+			})
+
+			if tx.MsgTx().HasWitness() {
+				b.wtxids = append(b.wtxids, tx.MsgTx().WitnessHash())
+				b.wtxidTxHashes = append(b.wtxidTxHashes, *tx.Hash())
+			}
+
+			for txinIdx, txin := range tx.MsgTx().TxIn {
+				b.spentKeys = append(b.spentKeys, SpentTxOutKey{TxHash: txin.PreviousOutPoint.Hash, TxOutIndex: txin.PreviousOutPoint.Index})
+				b.spentRows = append(b.spentRows, SpentTxOutRow{InputTxHash: *tx.Hash(), TxInIndex: uint32(txinIdx)})
+			}
+		}
+
+		select {
+		case chBlocks <- b:
+		case <-quit:
+			return nil
+		}
+	}
+
+	select {
+	case chBlocks <- indexedBlock{datFilename: datFilename, indexInDATFile: uint32(len(blocks)), fileDone: true}:
+	case <-quit:
+	}
+	return nil
+}
+
+func (db *BlockDB) indexAllWriter(chBlocks <-chan indexedBlock) error {
+	pending := []indexedBlock{}
+	pendingRows := 0
+
+	for b := range chBlocks {
+		pending = append(pending, b)
+		pendingRows += b.numRows()
+
+		if pendingRows >= indexRowsPerCommit || b.fileDone {
+			err := db.commitIndexedBlocks(pending)
+			if err != nil {
+				return err
+			}
+			pending = []indexedBlock{}
+			pendingRows = 0
+		}
+	}
+
+	if len(pending) > 0 {
+		return db.commitIndexedBlocks(pending)
+	}
+	return nil
+}
+
+func (db *BlockDB) commitIndexedBlocks(blocks []indexedBlock) error {
+	defer db.invalidateCoverage()
+
+	checkpoints := map[string]IndexCheckpointRow{}
+
+	err := db.store.Update(func(boltTx *bolt.Tx) error {
+		buckets := map[string]*bolt.Bucket{}
+		for _, name := range []string{BucketBlockIndex, BucketTransactionIndex, BucketWitnessTxIndex, BucketSpentTxOuts, BucketIndexCheckpoints,
+			BucketBlocksIndexedBlocks, BucketTransactionsIndexedBlocks, BucketSpentTxOutsIndexedBlocks, BucketAddressesIndexedBlocks} {
+			bucket, err := boltTx.CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return fmt.Errorf("create bucket: %s", err)
+			}
+			buckets[name] = bucket
+		}
+
+		for _, b := range blocks {
+			if b.fileDone {
+				checkpoints[b.datFilename] = IndexCheckpointRow{BlocksDone: b.indexInDATFile, Complete: true}
+
+				// keep the per-index markers in sync so that the individual builddb commands skip this file too
+				for _, name := range []string{BucketBlocksIndexedBlocks, BucketTransactionsIndexedBlocks, BucketSpentTxOutsIndexedBlocks, BucketAddressesIndexedBlocks} {
+					err := buckets[name].Put([]byte(b.datFilename), []byte{1})
+					if err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			checkpoints[b.datFilename] = IndexCheckpointRow{BlocksDone: b.indexInDATFile + 1}
+
+			err := b.put(buckets)
+			if err != nil {
+				return err
+			}
+
+			err = b.addresses.put(boltTx)
+			if err != nil {
+				return err
+			}
+		}
+
+		for datFilename, checkpoint := range checkpoints {
+			checkpointBytes, err := checkpoint.ToBytes()
+			if err != nil {
+				return err
+			}
+
+			err = buckets[BucketIndexCheckpoints].Put([]byte(datFilename), checkpointBytes)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for datFilename, checkpoint := range checkpoints {
+		if checkpoint.Complete {
+			fmt.Printf("finished %v (%v blocks)\n", datFilename, checkpoint.BlocksDone)
+		} else {
+			fmt.Printf("committed %v up to block %v\n", datFilename, checkpoint.BlocksDone)
+		}
+	}
+	return nil
+}
+
+func (b indexedBlock) put(buckets map[string]*bolt.Bucket) error {
+	rowBytes, err := b.blockRow.ToBytes()
+	if err != nil {
+		return err
+	}
+	err = buckets[BucketBlockIndex].Put(b.blockHash[:], rowBytes)
+	if err != nil {
+		return err
+	}
+
+	for i := range b.txRows {
+		rowBytes, err := b.txRows[i].ToBytes()
+		if err != nil {
+			return err
+		}
+		err = buckets[BucketTransactionIndex].Put(b.txHashes[i][:], rowBytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range b.wtxids {
+		err := buckets[BucketWitnessTxIndex].Put(b.wtxids[i][:], b.wtxidTxHashes[i][:])
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range b.spentRows {
+		keyBytes, err := b.spentKeys[i].ToBytes()
+		if err != nil {
+			return err
+		}
+		rowBytes, err := b.spentRows[i].ToBytes()
+		if err != nil {
+			return err
+		}
+		err = buckets[BucketSpentTxOuts].Put(keyBytes, rowBytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *BlockDB) GetIndexCheckpoint(datFilename string) (IndexCheckpointRow, error) {
+	var row IndexCheckpointRow
+
+	err := db.store.View(func(boltTx *bolt.Tx) error {
+		bucket := boltTx.Bucket([]byte(BucketIndexCheckpoints))
+		if bucket == nil {
+			return nil
+		}
+
+		val := bucket.Get([]byte(datFilename))
+		if val == nil {
+			return nil
+		}
+
+		var err error
+		row, err = newIndexCheckpointRowFromBytes(val)
+		return err
+	})
+
+	return row, err
+}
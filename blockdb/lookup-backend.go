@@ -0,0 +1,35 @@
+package blockdb
+
+import (
+	"errors"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// LookupBackend resolves data that can't be found in the local index or .dat files.  A BlockDB with a
+// nil backend runs in offline mode.
+type LookupBackend interface {
+	// GetBlockHashForTx returns the hash of the block containing the given transaction.
+	GetBlockHashForTx(txHash chainhash.Hash) (chainhash.Hash, error)
+
+	// GetSpentTxOut returns the input that spends the given output.  If the backend knows the output is
+	// unspent, it returns ErrRemoteUnspent.  If it can't tell, or the output is spent but the backend can't
+	// find the spender, it returns ErrRemoteNotFound.
+	GetSpentTxOut(tx *Tx, txoutIdx uint32) (SpentTxOutRow, error)
+
+	// GetAddressTxHashes returns the hashes of every transaction that pays to or spends from the given
+	// address, oldest first.
+	GetAddressTxHashes(addr string) ([]chainhash.Hash, error)
+}
+
+var (
+	// ErrRemoteNotFound is returned by a LookupBackend when the remote source doesn't have the data.
+	ErrRemoteNotFound = errors.New("not found by the remote lookup backend")
+
+	// ErrRemoteUnspent is returned by LookupBackend.GetSpentTxOut when the remote source says the output
+	// hasn't been spent.
+	ErrRemoteUnspent = errors.New("unspent according to the remote lookup backend")
+
+	// ErrRemoteUnsupported is returned by a LookupBackend that can't answer a particular kind of query.
+	ErrRemoteUnsupported = errors.New("query not supported by the remote lookup backend")
+)
@@ -131,6 +131,38 @@ func (tx *Tx) ConcatTxInScripts() ([]byte, error) {
 	return allBytes, nil
 }
 
+func (tx *Tx) HasWitness() bool {
+	return tx.MsgTx().HasWitness()
+}
+
+// WitnessHash returns the wtxid.  For transactions without witness data it's the same as the txid.
+func (tx *Tx) WitnessHash() chainhash.Hash {
+	return tx.MsgTx().WitnessHash()
+}
+
+func (tx *Tx) GetWitnessFromTxIn(txinIdx int) [][]byte {
+	return tx.MsgTx().TxIn[txinIdx].Witness
+}
+
+// GetWitnessScriptFromTxIn returns the script being executed by a P2WSH or taproot script-path spend,
+// which is where envelope-style data (inscriptions and the like) lives.  It returns nil for key-path
+// and P2WPKH spends, which only carry signatures and keys.
+func (tx *Tx) GetWitnessScriptFromTxIn(txinIdx int) []byte {
+	return utils.GetWitnessScript(tx.MsgTx().TxIn[txinIdx].Witness)
+}
+
+func (tx *Tx) ConcatWitnessData() ([]byte, error) {
+	allBytes := []byte{}
+
+	for _, txin := range tx.MsgTx().TxIn {
+		for _, item := range txin.Witness {
+			allBytes = append(allBytes, item...)
+		}
+	}
+
+	return allBytes, nil
+}
+
 func (tx *Tx) GetTxOutAddress(txoutIdx int) ([]btcutil.Address, error) {
 	txout := tx.MsgTx().TxOut[txoutIdx]
 
@@ -170,7 +202,7 @@ func (tx *Tx) FindMaxValueTxOut() int {
 func (tx *Tx) HasSuspiciousOutputValues() bool {
 	numTinyValues := 0
 	for _, txout := range tx.MsgTx().TxOut {
-		if Satoshis(txout.Value).ToBTC() == 0.00000001 {
+		if txout.Value == 1 {
 			numTinyValues++
 		}
 	}
@@ -181,28 +213,6 @@ func (tx *Tx) HasSuspiciousOutputValues() bool {
 	return false
 }
 
-func (tx *Tx) Fee() (BTC, error) {
-	var outValues int64
-	for _, txout := range tx.MsgTx().TxOut {
-		outValues += txout.Value
-	}
-	var inValues int64
-	for _, txin := range tx.MsgTx().TxIn {
-		// @@TODO: handle coinbase correctly
-		if txin.PreviousOutPoint.Hash == emptyHash {
-			continue
-		}
-
-		prevTx, err := tx.db.GetTx(txin.PreviousOutPoint.Hash)
-		if err != nil {
-			return 0, err
-		}
-		inValues += prevTx.MsgTx().TxOut[txin.PreviousOutPoint.Index].Value
-	}
-
-	return Satoshis(inValues - outValues).ToBTC(), nil
-}
-
 func (tx *Tx) GetSpendingTx(txoutIdx int) (*Tx, error) {
 	spentTxOut, err := tx.db.GetSpentTxOut(SpentTxOutKey{TxHash: *tx.Hash(), TxOutIndex: uint32(txoutIdx)})
 	if err != nil {
@@ -0,0 +1,46 @@
+package blockdb
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcutil"
+)
+
+// the signed native P2WPKH example from BIP143
+const bip143P2WPKHTx = "01000000000102fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f00000000494830450221008b9d1dc26ba6a9cb62127b02742fa9d754cd3bebf337f7a55d114c8e5cdd30be022040529b194ba3f9281a99f2b1c0a19c0489bc22ede944ccf4ecbab4cc618ef3ed01eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac000247304402203609e17b84f6a7d30c80bfa610b5b4542f32a8a0d5447a12fb1366d7f01cc44a0220573a954c4518331561406f90300e8f3358f51928d43c212a8caed02de67eebee0121025476c2e83188368da1ff3e292e7acafcdb3566bb0ad253f62fc70f07aeeb635711000000"
+
+func TestWitnessTx(T *testing.T) {
+	bs, err := hex.DecodeString(bip143P2WPKHTx)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	btcTx, err := btcutil.NewTxFromBytes(bs)
+	if err != nil {
+		T.Fatal(err)
+	}
+	tx := &Tx{Tx: btcTx}
+
+	if !tx.HasWitness() {
+		T.Fatal("expected witness data")
+	}
+	if got := tx.Hash().String(); got != "e8151a2af31c368a35053ddd4bdb285a8595c769a3ad83e0fa02314a602d4609" {
+		T.Errorf("txid = %v", got)
+	}
+	if *tx.Hash() == tx.WitnessHash() {
+		T.Error("wtxid should differ from txid for a segwit tx")
+	}
+
+	if n := len(tx.GetWitnessFromTxIn(0)); n != 0 {
+		T.Errorf("input 0 is a legacy input but has %v witness items", n)
+	}
+	if n := len(tx.GetWitnessFromTxIn(1)); n != 2 {
+		T.Errorf("input 1 has %v witness items, expected 2", n)
+	}
+
+	// P2WPKH spends don't execute a witness script
+	if script := tx.GetWitnessScriptFromTxIn(1); script != nil {
+		T.Errorf("unexpected witness script %x", script)
+	}
+}
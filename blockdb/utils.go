@@ -2,8 +2,10 @@ package blockdb
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
 
 	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
 )
@@ -28,3 +30,20 @@ func DecodeHashList(txListBytes []byte) ([]chainhash.Hash, error) {
 
 	return txList, nil
 }
+
+// IsCoinbaseTx returns true if the transaction is a coinbase, i.e. its only input doesn't spend a
+// previous output.
+func IsCoinbaseTx(msgTx *wire.MsgTx) bool {
+	if len(msgTx.TxIn) != 1 {
+		return false
+	}
+
+	prevOut := msgTx.TxIn[0].PreviousOutPoint
+	return prevOut.Index == wire.MaxPrevOutIndex && prevOut.Hash == emptyHash
+}
+
+// firstLine returns the first line of an error message.  Several of our errors go on to explain how to fix
+// the problem, which is too much for a one-line status.
+func firstLine(err error) string {
+	return strings.SplitN(err.Error(), "\n", 2)[0]
+}
@@ -0,0 +1,422 @@
+package blockdb
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+type TxOutStatus int
+
+const (
+	// the local index doesn't have enough information to tell
+	TxOutStatusUnknown TxOutStatus = iota
+	TxOutStatusUnspent
+	TxOutStatusSpent
+)
+
+func (s TxOutStatus) String() string {
+	switch s {
+	case TxOutStatusUnspent:
+		return "unspent"
+	case TxOutStatusSpent:
+		return "spent"
+	default:
+		return "unknown"
+	}
+}
+
+type TxOutState struct {
+	Status TxOutStatus
+
+	// when Status is TxOutStatusSpent, the input that spends the output and the height of its block
+	SpentBy       SpentTxOutRow
+	SpentAtHeight uint32
+
+	// when Status is TxOutStatusUnknown, why the index can't tell
+	Reason string
+}
+
+func (s TxOutState) String() string {
+	switch s.Status {
+	case TxOutStatusSpent:
+		return fmt.Sprintf("spent in tx %v (input %v) at height %v", s.SpentBy.InputTxHash.String(), s.SpentBy.TxInIndex, s.SpentAtHeight)
+	case TxOutStatusUnspent:
+		return "unspent"
+	default:
+		return fmt.Sprintf("unknown (%v)", s.Reason)
+	}
+}
+
+// GetTxOutStatus returns whether the given output is spent as of the tip of the local best chain.  If the
+// local index can't tell and we're online, the lookup backend is asked instead, in which case "unspent"
+// means unspent as of the remote source's tip.
+func (db *BlockDB) GetTxOutStatus(key SpentTxOutKey) (TxOutState, error) {
+	tipHeight, err := db.GetTipHeight()
+	if IsNotFound(err) {
+		return db.getTxOutStatusFromBackend(key, TxOutState{Reason: firstLine(err)})
+	} else if err != nil {
+		return TxOutState{}, err
+	}
+
+	state, err := db.GetTxOutStatusAtHeight(key, tipHeight)
+	if err != nil {
+		return TxOutState{}, err
+	} else if state.Status != TxOutStatusUnknown {
+		return state, nil
+	}
+	return db.getTxOutStatusFromBackend(key, state)
+}
+
+func (db *BlockDB) getTxOutStatusFromBackend(key SpentTxOutKey, localState TxOutState) (TxOutState, error) {
+	if db.IsOffline() {
+		return localState, nil
+	}
+
+	row, err := db.GetSpentTxOut(key)
+	if err == nil {
+		state := TxOutState{Status: TxOutStatusSpent, SpentBy: row}
+		if heightRow, err := db.GetTxBlockHeight(row.InputTxHash); err == nil {
+			state.SpentAtHeight = heightRow.Height
+		}
+		return state, nil
+	} else if notFound, ok := err.(SpentTxOutNotFoundError); ok && notFound.Unspent {
+		return TxOutState{Status: TxOutStatusUnspent}, nil
+	} else if ok {
+		// the backend couldn't find a spender, which doesn't mean there isn't one
+		localState.Reason = "the lookup backend can't find the spending transaction"
+		return localState, nil
+	} else if IsNotFound(err) {
+		return localState, nil
+	}
+	return TxOutState{}, err
+}
+
+// GetTxOutStatusAtHeight returns whether the given output was spent as of the block at the given height on
+// the local best chain.  It only uses the local indices: the output's transaction and its spender need to be
+// in the transaction index, and the spent-txouts index has to cover every block up to the height before an
+// output can be reported as unspent.
+func (db *BlockDB) GetTxOutStatusAtHeight(key SpentTxOutKey, height uint32) (TxOutState, error) {
+	coveredHeight, covered, err := db.SpentTxOutsIndexedHeight()
+	if err != nil && !IsNotFound(err) {
+		return TxOutState{}, err
+	}
+
+	var state TxOutState
+	err = db.store.View(func(boltTx *bolt.Tx) error {
+		fundingHeight, err := txBlockHeightInBoltTx(boltTx, key.TxHash)
+		if IsNotFound(err) {
+			state = TxOutState{Reason: firstLine(err)}
+			return nil
+		} else if err != nil {
+			return err
+		} else if fundingHeight.Orphaned {
+			state = TxOutState{Reason: "the transaction's block isn't on the best chain"}
+			return nil
+		} else if fundingHeight.Height > height {
+			state = TxOutState{Reason: fmt.Sprintf("the transaction was mined after height %v", height)}
+			return nil
+		}
+
+		state, err = txOutStateInBoltTx(boltTx, key, height, coveredHeight, covered)
+		return err
+	})
+	if err != nil {
+		return TxOutState{}, err
+	}
+	return db.resolveOrphanedSpender(state, height, map[uint32]map[chainhash.Hash]bool{})
+}
+
+// txOutStateInBoltTx looks up the spender of an output that is known to exist at the given height.
+func txOutStateInBoltTx(boltTx *bolt.Tx, key SpentTxOutKey, height, coveredHeight uint32, covered bool) (TxOutState, error) {
+	spentBucket := boltTx.Bucket([]byte(BucketSpentTxOuts))
+
+	var spentBytes []byte
+	if spentBucket != nil {
+		keyBytes, err := key.ToBytes()
+		if err != nil {
+			return TxOutState{}, err
+		}
+		spentBytes = spentBucket.Get(keyBytes)
+	}
+
+	if spentBytes == nil {
+		if !covered || coveredHeight < height {
+			return TxOutState{Reason: "the spent-txouts index doesn't cover every block up to this height"}, nil
+		}
+		return TxOutState{Status: TxOutStatusUnspent}, nil
+	}
+
+	spender, err := newSpentTxOutRowFromBytes(spentBytes)
+	if err != nil {
+		return TxOutState{}, err
+	}
+
+	spenderHeight, err := txBlockHeightInBoltTx(boltTx, spender.InputTxHash)
+	if IsNotFound(err) {
+		return TxOutState{Reason: "the spending transaction's block height is unknown"}, nil
+	} else if err != nil {
+		return TxOutState{}, err
+	} else if spenderHeight.Orphaned {
+		// resolveOrphanedSpender looks for the spender on the best chain
+		return TxOutState{Reason: reasonSpenderOrphaned, SpentBy: spender, SpentAtHeight: spenderHeight.Height}, nil
+	} else if spenderHeight.Height > height {
+		// the output was spent, but only later on
+		return TxOutState{Status: TxOutStatusUnspent}, nil
+	}
+
+	return TxOutState{Status: TxOutStatusSpent, SpentBy: spender, SpentAtHeight: spenderHeight.Height}, nil
+}
+
+const reasonSpenderOrphaned = "the spending transaction's block isn't on the best chain"
+
+// how many best-chain blocks on either side of a stale block's height are searched for a spending transaction
+// that the tx index places in the stale block
+const orphanedSpenderSearchBlocks = 10
+
+// resolveOrphanedSpender handles outputs whose spender the tx index places in a stale block.  The index keeps
+// one row per txid, so a tx mined both in a stale block and in its replacement on the best chain can end up
+// pointing at the stale one.  The best-chain blocks around the stale block's height are searched for the tx.
+// If it isn't found, the output stays unknown, since it may have been spent on the best chain by a
+// conflicting tx that the spent-txouts index doesn't know about.  mainChainTxs caches the txids of the blocks
+// that have been searched, by height.
+func (db *BlockDB) resolveOrphanedSpender(state TxOutState, height uint32, mainChainTxs map[uint32]map[chainhash.Hash]bool) (TxOutState, error) {
+	if state.Status != TxOutStatusUnknown || state.Reason != reasonSpenderOrphaned {
+		return state, nil
+	}
+
+	staleHeight := state.SpentAtHeight
+	from := uint32(0)
+	if staleHeight > orphanedSpenderSearchBlocks {
+		from = staleHeight - orphanedSpenderSearchBlocks
+	}
+	for h := from; h <= staleHeight+orphanedSpenderSearchBlocks; h++ {
+		txs, cached := mainChainTxs[h]
+		if !cached {
+			blockHash, err := db.GetBlockHashAtHeight(h)
+			if _, ok := err.(BlockHeightNotFoundError); ok {
+				break
+			} else if err != nil {
+				return TxOutState{}, err
+			}
+
+			block, err := db.GetBlock(blockHash)
+			if err != nil {
+				return TxOutState{}, err
+			}
+
+			txs = map[chainhash.Hash]bool{}
+			for _, tx := range block.Transactions() {
+				txs[*tx.Hash()] = true
+			}
+			mainChainTxs[h] = txs
+		}
+
+		if txs[state.SpentBy.InputTxHash] {
+			if h > height {
+				// the output was spent, but only later on
+				return TxOutState{Status: TxOutStatusUnspent}, nil
+			}
+			return TxOutState{Status: TxOutStatusSpent, SpentBy: state.SpentBy, SpentAtHeight: h}, nil
+		}
+	}
+
+	return TxOutState{Reason: fmt.Sprintf("the spending transaction %v is in a stale block at height %v and not on the best chain", state.SpentBy.InputTxHash.String(), staleHeight)}, nil
+}
+
+func txBlockHeightInBoltTx(boltTx *bolt.Tx, txHash chainhash.Hash) (BlockHeightRow, error) {
+	txBucket := boltTx.Bucket([]byte(BucketTransactionIndex))
+	if txBucket == nil {
+		return BlockHeightRow{}, DataNotIndexedError{Index: "transactions"}
+	}
+
+	txBytes := txBucket.Get(txHash[:])
+	if txBytes == nil {
+		return BlockHeightRow{}, TxNotFoundError{TxHash: txHash}
+	}
+
+	txRow, err := NewTxIndexRowFromBytes(txBytes)
+	if err != nil {
+		return BlockHeightRow{}, err
+	}
+
+	heightsBucket, _ := heightIndexBuckets(boltTx)
+	if heightsBucket == nil {
+		return BlockHeightRow{}, DataNotIndexedError{Index: "heights"}
+	}
+
+	heightBytes := heightsBucket.Get(txRow.BlockHash[:])
+	if heightBytes == nil {
+		return BlockHeightRow{}, BlockHeightUnknownError{BlockHash: txRow.BlockHash}
+	}
+	return newBlockHeightRowFromBytes(heightBytes)
+}
+
+// GetTipHeight returns the height of the tip of the local best chain.
+func (db *BlockDB) GetTipHeight() (uint32, error) {
+	var height uint32
+	err := db.store.View(func(boltTx *bolt.Tx) error {
+		_, bucket := heightIndexBuckets(boltTx)
+		if bucket == nil {
+			return DataNotIndexedError{Index: "heights"}
+		}
+
+		k, _ := bucket.Cursor().Last()
+		if k == nil {
+			return DataNotIndexedError{Index: "heights"}
+		}
+		height = binary.BigEndian.Uint32(k)
+		return nil
+	})
+	return height, err
+}
+
+// SpentTxOutsIndexedHeight returns the height up to which the spent-txouts index is complete, i.e. every
+// block on the best chain up to it comes from a .dat file that has been indexed.  covered is false if not
+// even the genesis block's .dat file has been indexed.  The result is cached, since it walks the whole
+// chain.
+func (db *BlockDB) SpentTxOutsIndexedHeight() (height uint32, covered bool, err error) {
+	db.coverageMu.Lock()
+	defer db.coverageMu.Unlock()
+
+	if db.coverage != nil {
+		return db.coverage.height, db.coverage.covered, nil
+	}
+
+	err = db.store.View(func(boltTx *bolt.Tx) error {
+		_, mainChainBucket := heightIndexBuckets(boltTx)
+		if mainChainBucket == nil {
+			return DataNotIndexedError{Index: "heights"}
+		}
+		blockBucket := boltTx.Bucket([]byte(BucketBlockIndex))
+		if blockBucket == nil {
+			return DataNotIndexedError{Index: "blocks"}
+		}
+		indexedBucket := boltTx.Bucket([]byte(BucketSpentTxOutsIndexedBlocks))
+		if indexedBucket == nil {
+			return nil
+		}
+
+		indexedFiles := map[uint16]bool{}
+		c := mainChainBucket.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			blockRow, err := NewBlockIndexRowFromBytes(blockBucket.Get(v))
+			if err != nil {
+				return err
+			}
+
+			indexed, checked := indexedFiles[blockRow.DATFileIdx]
+			if !checked {
+				indexed = indexedBucket.Get([]byte(blockRow.DATFilename())) != nil
+				indexedFiles[blockRow.DATFileIdx] = indexed
+			}
+			if !indexed {
+				break
+			}
+
+			height = binary.BigEndian.Uint32(k)
+			covered = true
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	db.coverage = &spentTxOutsCoverage{height: height, covered: covered}
+	return height, covered, nil
+}
+
+type spentTxOutsCoverage struct {
+	height  uint32
+	covered bool
+}
+
+// invalidateCoverage is called whenever the spent-txouts or heights indices change.
+func (db *BlockDB) invalidateCoverage() {
+	db.coverageMu.Lock()
+	db.coverage = nil
+	db.coverageMu.Unlock()
+}
+
+// UTXO is an output in a snapshot of the UTXO set.
+type UTXO struct {
+	Key    SpentTxOutKey
+	TxOut  *wire.TxOut
+	Height uint32 // the height of the block containing the output's transaction
+
+	// Status is TxOutStatusUnspent, or TxOutStatusUnknown (with the reason in Reason) for outputs that the
+	// local index can't decide either way
+	Status TxOutStatus
+	Reason string
+}
+
+// ForEachUTXO reconstructs the UTXO set as of the block at the given height on the local best chain, calling
+// fn for every unspent output in chain order.  It needs the block, transaction, heights and spent-txouts
+// indices to cover every block up to the height.  Unlike Bitcoin Core, provably unspendable outputs (e.g.
+// OP_RETURN) are included, since they are exactly where embedded data tends to live.  Outputs whose status
+// can't be decided (e.g. because they're only spent in a stale block) are passed to fn as well, with their
+// Status set to TxOutStatusUnknown.
+func (db *BlockDB) ForEachUTXO(height uint32, fn func(utxo UTXO) error) error {
+	coveredHeight, covered, err := db.SpentTxOutsIndexedHeight()
+	if err != nil {
+		return err
+	} else if !covered || coveredHeight < height {
+		return fmt.Errorf("the spent-txouts index only covers the best chain up to height %v (run \"builddb spent-txouts\" on the missing .dat files)", coveredHeight)
+	}
+
+	mainChainTxs := map[uint32]map[chainhash.Hash]bool{}
+	for h := uint32(0); h <= height; h++ {
+		blockHash, err := db.GetBlockHashAtHeight(h)
+		if err != nil {
+			return err
+		}
+
+		block, err := db.GetBlock(blockHash)
+		if err != nil {
+			return err
+		}
+
+		utxos := []UTXO{}
+		states := []TxOutState{}
+		err = db.store.View(func(boltTx *bolt.Tx) error {
+			for _, tx := range block.Transactions() {
+				for txoutIdx, txout := range tx.MsgTx().TxOut {
+					key := SpentTxOutKey{TxHash: *tx.Hash(), TxOutIndex: uint32(txoutIdx)}
+
+					state, err := txOutStateInBoltTx(boltTx, key, height, coveredHeight, covered)
+					if err != nil {
+						return err
+					} else if state.Status != TxOutStatusSpent {
+						utxos = append(utxos, UTXO{Key: key, TxOut: txout, Height: h})
+						states = append(states, state)
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for i, utxo := range utxos {
+			state, err := db.resolveOrphanedSpender(states[i], height, mainChainTxs)
+			if err != nil {
+				return err
+			} else if state.Status == TxOutStatusSpent {
+				continue
+			}
+
+			utxo.Status, utxo.Reason = state.Status, state.Reason
+			err = fn(utxo)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -1,13 +1,44 @@
 package blockdb
 
+import (
+	"fmt"
+	"math"
+)
+
+// Satoshis is the unit that all value accounting is done in.  Sums stay exact as int64s, so only convert
+// to BTC for display.
 type Satoshis int64
 
+const SatoshisPerBTC = 100000000
+
+// BTCString formats the amount in BTC with all 8 decimal places, without going through a float.
+func (s Satoshis) BTCString() string {
+	sign := ""
+	abs := uint64(s)
+	if s < 0 {
+		sign = "-"
+		abs = uint64(-s)
+	}
+	return fmt.Sprintf("%v%d.%08d", sign, abs/SatoshisPerBTC, abs%SatoshisPerBTC)
+}
+
 func (s Satoshis) ToBTC() BTC {
-	return BTC(float64(s) * 0.00000001)
+	return BTC(float64(s) / SatoshisPerBTC)
 }
 
 type BTC float64
 
 func (b BTC) ToSatoshis() Satoshis {
-	return Satoshis(b * 100000000)
+	return Satoshis(math.Floor(float64(b)*SatoshisPerBTC + 0.5))
+}
+
+const subsidyHalvingInterval = 210000
+
+// CalcBlockSubsidy returns the newly minted coins that the coinbase of a block at the given height may claim.
+func CalcBlockSubsidy(height uint32) Satoshis {
+	halvings := height / subsidyHalvingInterval
+	if halvings >= 64 {
+		return 0
+	}
+	return Satoshis(50*SatoshisPerBTC) >> halvings
 }
@@ -0,0 +1,54 @@
+package blockdb
+
+import (
+	"testing"
+)
+
+func TestSatoshisToBTCs(T *testing.T) {
+	s := Satoshis(1234567)
+	b := s.ToBTC()
+
+	if b != 0.01234567 {
+		T.Fatalf("Expected 0.01234567")
+	}
+}
+
+func TestBTCsToSatoshis(T *testing.T) {
+	b := BTC(0.1234567)
+	s := b.ToSatoshis()
+
+	if s != 12345670 {
+		T.Fatalf("Expected 12345670")
+	}
+}
+
+func TestSatoshisBTCString(T *testing.T) {
+	cases := map[Satoshis]string{
+		0:                   "0.00000000",
+		1:                   "0.00000001",
+		1234567:             "0.01234567",
+		-150000000:          "-1.50000000",
+		2099999997690000:    "20999999.97690000",
+		9223372036854775807: "92233720368.54775807",
+	}
+	for s, expected := range cases {
+		if got := s.BTCString(); got != expected {
+			T.Errorf("%d: got %v, expected %v", int64(s), got, expected)
+		}
+	}
+}
+
+func TestCalcBlockSubsidy(T *testing.T) {
+	cases := map[uint32]Satoshis{
+		0:        5000000000,
+		209999:   5000000000,
+		210000:   2500000000,
+		840000:   312500000,
+		13440000: 0,
+	}
+	for height, expected := range cases {
+		if got := CalcBlockSubsidy(height); got != expected {
+			T.Errorf("height %v: got %v, expected %v", height, got, expected)
+		}
+	}
+}
@@ -2,12 +2,16 @@ package cmds
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
 	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
 	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
 )
@@ -20,9 +24,10 @@ type BinaryGrepCommand struct {
 	hexPattern           string
 	carveLen             uint64
 	carveExt             string
+	raw                  bool
 }
 
-func NewBinaryGrepCommand(blocks []int, carveLen uint64, carveExt, outDir, datFileDir, hexPattern string) *BinaryGrepCommand {
+func NewBinaryGrepCommand(blocks []int, carveLen uint64, carveExt, outDir, datFileDir, hexPattern string, raw bool) *BinaryGrepCommand {
 	// if endBlock == 0 {
 	// 	endBlock = startBlock
 	// }
@@ -36,6 +41,7 @@ func NewBinaryGrepCommand(blocks []int, carveLen uint64, carveExt, outDir, datFi
 		carveLen:   carveLen,
 		carveExt:   carveExt,
 		hexPattern: hexPattern,
+		raw:        raw,
 	}
 }
 
@@ -78,7 +84,11 @@ func (cmd *BinaryGrepCommand) RunCommand() error {
 	for _, i := range cmd.blocks {
 		chDone := make(chan bool)
 		chDones = append(chDones, chDone)
-		go cmd.parseBlock(i, pattern, chResults, chErr, chDone, procLimiter)
+		if cmd.raw {
+			go cmd.parseBlockRaw(i, pattern, chResults, chErr, chDone, procLimiter)
+		} else {
+			go cmd.parseBlock(i, pattern, chResults, chErr, chDone, procLimiter)
+		}
 	}
 
 	// wait for all goroutines to complete
@@ -158,6 +168,85 @@ func (cmd *BinaryGrepCommand) parseBlock(blockFileNum int, pattern []byte, chRes
 	}
 }
 
+// parseBlockRaw searches the entire (de-obfuscated) .dat file rather than just the transaction scripts, so
+// it also finds patterns that span script boundaries or live in headers.  Offsets are relative to the start
+// of the file.
+func (cmd *BinaryGrepCommand) parseBlockRaw(blockFileNum int, pattern []byte, chResults chan string, chErr chan error, chDone chan bool, procLimiter chan bool) {
+	defer close(chDone)
+	defer func() { procLimiter <- true }()
+	<-procLimiter
+
+	filename := fmt.Sprintf("blk%05d.dat", blockFileNum)
+	os.Stderr.WriteString("parsing block " + filename + " (raw)\n")
+
+	f, err := utils.OpenDATFile(filepath.Join(cmd.datFileDir, filename))
+	if err != nil {
+		chErr <- err
+		return
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		chErr <- err
+		return
+	}
+
+	records := findDATRecords(data)
+
+	for start := 0; start < len(data); {
+		idx := bytes.Index(data[start:], pattern)
+		if idx < 0 {
+			break
+		}
+		offset := start + idx
+
+		blockHash := ""
+		for _, rec := range records {
+			if offset >= rec.start && offset < rec.end {
+				blockHash = rec.blockHash
+				break
+			}
+		}
+
+		chResults <- fmt.Sprintf("%v,%v,%v,%v,%v", filename, blockHash, "", "raw", offset)
+		if cmd.carveLen > 0 {
+			cmd.carve(filename, blockHash, "raw", offset, data)
+		}
+
+		start = offset + 1
+	}
+}
+
+type datRecord struct {
+	start, end int
+	blockHash  string
+}
+
+// findDATRecords walks the magic+length framing of a .dat file so that raw matches can be attributed to
+// the block that contains them.
+func findDATRecords(data []byte) []datRecord {
+	const headerLen = 80
+
+	records := []datRecord{}
+	for pos := 0; pos+8 <= len(data); {
+		if binary.LittleEndian.Uint32(data[pos:]) != uint32(wire.MainNet) {
+			break
+		}
+
+		blockLen := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + blockLen
+		if blockLen < headerLen || end > len(data) {
+			break
+		}
+
+		hash := chainhash.DoubleHashH(data[pos+8 : pos+8+headerLen])
+		records = append(records, datRecord{start: pos, end: end, blockHash: hash.String()})
+		pos = end
+	}
+	return records
+}
+
 func (cmd *BinaryGrepCommand) carve(filename string, txHash string, inOut string, offset int, fileData []byte) {
 	if offset >= len(fileData) {
 		return
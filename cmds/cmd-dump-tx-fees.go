@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/btcsuite/btcutil"
+
 	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
 	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
 )
@@ -13,22 +15,24 @@ type DumpTxFeesCommand struct {
 	startBlock, endBlock uint64
 	datFileDir, outDir   string
 	dbFile               string
+	backend              LookupBackend
 
 	db *BlockDB
 }
 
-func NewDumpTxFeesCommand(startBlock, endBlock uint64, datFileDir, dbFile, outDir string) *DumpTxFeesCommand {
+func NewDumpTxFeesCommand(startBlock, endBlock uint64, datFileDir, dbFile, outDir string, backend LookupBackend) *DumpTxFeesCommand {
 	return &DumpTxFeesCommand{
 		startBlock: startBlock,
 		endBlock:   endBlock,
 		datFileDir: datFileDir,
 		dbFile:     dbFile,
+		backend:    backend,
 		outDir:     filepath.Join(".", outDir, "dump-tx-fees"),
 	}
 }
 
 func (cmd *DumpTxFeesCommand) RunCommand() error {
-	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir)
+	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir, cmd.backend)
 	if err != nil {
 		return err
 	}
@@ -90,8 +94,17 @@ func (cmd *DumpTxFeesCommand) parseBlock(blockFileNum int, chErr chan error, chD
 	outFile := utils.NewConditionalFile(filepath.Join(cmd.outDir, fmt.Sprintf("blk%05d-tx-fees.csv", blockFileNum)))
 	defer outFile.Close()
 
-	// write CSV header
-	_, err = outFile.WriteString("block,tx,fee\n", false)
+	blocksFile := utils.NewConditionalFile(filepath.Join(cmd.outDir, fmt.Sprintf("blk%05d-block-fees.csv", blockFileNum)))
+	defer blocksFile.Close()
+
+	// write CSV headers
+	_, err = outFile.WriteString("block,height,tx,input value (sat),output value (sat),fee (sat),size (bytes),feerate (sat/byte)\n", false)
+	if err != nil {
+		chErr <- err
+		return
+	}
+
+	_, err = blocksFile.WriteString("block,height,txs,size (bytes),subsidy (sat),fees (sat),reward (sat),claimed (sat),output value (sat),feerate (sat/byte)\n", false)
 	if err != nil {
 		chErr <- err
 		return
@@ -101,26 +114,56 @@ func (cmd *DumpTxFeesCommand) parseBlock(blockFileNum int, chErr chan error, chD
 	for blIdx, bl := range blocks {
 		blockHash := bl.Hash().String()
 
-		// numTxs := len(bl.Transactions())
-		for _, btctx := range bl.Transactions() {
-			tx := Tx{Tx: btctx}
-			tx.SetDB(cmd.db)
-
-			txHash := tx.Hash().String()
-			fee, err := tx.Fee()
-			if err != nil {
-				chErr <- err
-				return
-			}
+		summary, err := cmd.db.GetBlockFeeSummary(bl)
+		if IsNotFound(err) {
+			// the heights index or a previous tx is missing.  don't abort the whole .dat file over it.
+			cmd.writeUnknownFees(outFile, blocksFile, bl)
+			fmt.Printf("finished block %s (%d/%d), fees unknown\n", blockHash, blIdx, numBlocks)
+			continue
+		} else if err != nil {
+			chErr <- err
+			return
+		}
 
-			outFile.WriteString(fmt.Sprintf("%v,%v,%v\n", blockHash, txHash, fee), true)
+		for _, tx := range summary.Txs {
+			outFile.WriteString(fmt.Sprintf("%v,%v,%v,%d,%d,%d,%v,%.2f\n", blockHash, summary.Height, tx.TxHash.String(),
+				tx.InputValue, tx.OutputValue, tx.Fee, tx.Size, tx.FeeRate()), true)
 		}
 
+		blocksFile.WriteString(fmt.Sprintf("%v,%v,%v,%v,%d,%d,%d,%d,%d,%.2f\n", blockHash, summary.Height, len(summary.Txs), summary.Size,
+			summary.Subsidy, summary.TotalFees, summary.Reward(), summary.Claimed(), summary.TotalOutput, summary.FeeRate()), true)
+
 		fmt.Printf("finished block %s (%d/%d)\n", blockHash, blIdx, numBlocks)
 	}
+}
 
-	if err != nil {
-		chErr <- err
-		return
+// writeUnknownFees writes the rows for a block whose fees can't be computed, filling in whatever doesn't
+// depend on the missing data.
+func (cmd *DumpTxFeesCommand) writeUnknownFees(outFile, blocksFile *utils.ConditionalFile, bl *btcutil.Block) {
+	blockHash := bl.Hash().String()
+
+	// empty if the heights index hasn't been built
+	height := ""
+	if heightRow, err := cmd.db.GetBlockHeight(*bl.Hash()); err == nil {
+		height = heightRow.String()
 	}
+
+	for _, btctx := range bl.Transactions() {
+		tx := Tx{Tx: btctx}
+		tx.SetDB(cmd.db)
+
+		inValue, fee, feeRate := "unknown", "unknown", "unknown"
+		if !tx.IsCoinbase() {
+			if v, err := tx.InputValue(); err == nil {
+				f := v - tx.OutputValue()
+				inValue, fee = fmt.Sprintf("%d", v), fmt.Sprintf("%d", f)
+				feeRate = fmt.Sprintf("%.2f", float64(f)/float64(tx.MsgTx().SerializeSizeWitness()))
+			}
+		}
+
+		outFile.WriteString(fmt.Sprintf("%v,%v,%v,%v,%d,%v,%v,%v\n", blockHash, height, tx.Hash().String(),
+			inValue, tx.OutputValue(), fee, tx.MsgTx().SerializeSizeWitness(), feeRate), true)
+	}
+
+	blocksFile.WriteString(fmt.Sprintf("%v,%v,%v,,,,,,,\n", blockHash, height, len(bl.Transactions())), true)
 }
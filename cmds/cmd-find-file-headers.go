@@ -12,19 +12,32 @@ import (
 type FindFileHeadersCommand struct {
 	startBlock, endBlock uint64
 	datFileDir, outDir   string
+	signaturesFile       string
+	signatures           utils.FileSignatures
 }
 
-func NewFindFileHeadersCommand(startBlock, endBlock uint64, datFileDir, outDir string) *FindFileHeadersCommand {
+func NewFindFileHeadersCommand(startBlock, endBlock uint64, datFileDir, outDir, signaturesFile string) *FindFileHeadersCommand {
 	return &FindFileHeadersCommand{
-		startBlock: startBlock,
-		endBlock:   endBlock,
-		datFileDir: datFileDir,
-		outDir:     filepath.Join(".", outDir, "find-file-headers"),
+		startBlock:     startBlock,
+		endBlock:       endBlock,
+		datFileDir:     datFileDir,
+		outDir:         filepath.Join(".", outDir, "find-file-headers"),
+		signaturesFile: signaturesFile,
 	}
 }
 
 func (cmd *FindFileHeadersCommand) RunCommand() error {
-	err := os.MkdirAll(cmd.outDir, 0777)
+	if cmd.signaturesFile == "" {
+		cmd.signatures = utils.DefaultFileSignatures()
+	} else {
+		signatures, err := utils.LoadFileSignatures(cmd.signaturesFile)
+		if err != nil {
+			return err
+		}
+		cmd.signatures = signatures
+	}
+
+	err := os.MkdirAll(filepath.Join(cmd.outDir, "carved"), 0777)
 	if err != nil {
 		return err
 	}
@@ -126,7 +139,7 @@ func (cmd *FindFileHeadersCommand) parseBlock(blockFileNum int, chErr chan error
 				return
 			}
 
-			matches := utils.SearchDataForMagicFileBytes(inData)
+			matches := cmd.signatures.Search(inData)
 			for _, m := range matches {
 				_, err := outFile.WriteString(fmt.Sprintf("%v,%v,%v,%v,%v\n", blockHash, txHash, "in", -1, m.Description()), true)
 				if err != nil {
@@ -135,13 +148,19 @@ func (cmd *FindFileHeadersCommand) parseBlock(blockFileNum int, chErr chan error
 				}
 			}
 
+			err = cmd.writeCarvedFiles(blockFileNum, txHash, "in", matches)
+			if err != nil {
+				chErr <- err
+				return
+			}
+
 			outData, err := tx.ConcatNonOPDataFromTxOuts()
 			if err != nil {
 				chErr <- err
 				return
 			}
 
-			matches = utils.SearchDataForMagicFileBytes(outData)
+			matches = cmd.signatures.Search(outData)
 			for _, m := range matches {
 				_, err := outFile.WriteString(fmt.Sprintf("%v,%v,%v,%v,%v\n", blockHash, txHash, "out", -1, m.Description()), true)
 				if err != nil {
@@ -150,6 +169,12 @@ func (cmd *FindFileHeadersCommand) parseBlock(blockFileNum int, chErr chan error
 				}
 			}
 
+			err = cmd.writeCarvedFiles(blockFileNum, txHash, "out", matches)
+			if err != nil {
+				chErr <- err
+				return
+			}
+
 			// fmt.Printf("finished %v (%v/%v) (%v/%v)\n", txHash, txIdx, numTxs, blIdx, numBlocks)
 		}
 	}
@@ -159,3 +184,14 @@ func (cmd *FindFileHeadersCommand) parseBlock(blockFileNum int, chErr chan error
 		return
 	}
 }
+
+func (cmd *FindFileHeadersCommand) writeCarvedFiles(blockFileNum int, txHash, inOrOut string, matches utils.MagicBytesResult) error {
+	for _, carved := range matches.CarvedFiles() {
+		filename := filepath.Join(cmd.outDir, "carved", fmt.Sprintf("blk%05d-%s-%s-%s", blockFileNum, txHash, inOrOut, carved.Filename()))
+		err := utils.CreateAndWriteFile(filename, carved.Data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -92,72 +92,41 @@ func (cmd *FindPlaintextCommand) parseBlock(blockFileNum int, chErr chan error,
 
 			txHash := tx.Hash().String()
 
-			// extract text from each TxIn scriptSig
+			// extract text from the concatenated TxIn scriptSigs
 			data := make([]byte, 0)
 			for _, txin := range tx.MsgTx().TxIn {
 				data = append(data, txin.SignatureScript...)
-				// txt, isText := utils.ExtractText(txin.SignatureScript)
-				// if !isText || len(txt) < 8 {
-				// 	continue
-				// }
 			}
-			txt := utils.StripNonTextBytes(data)
-			if len(txt) < 8 {
-				continue
-			}
-
-			_, err := outFile.WriteString(fmt.Sprintf("%v,%v,%v,%v,%v\n", blockHash, txHash, "in", -1, string(txt)))
+			err := writePlaintextRuns(outFile, blockHash, txHash, "in", utils.FindTextRuns(data, 0, 0))
 			if err != nil {
 				chErr <- err
 				return
 			}
-			// }
-
-			// extract text from each TxOut PkScript
-			/*for txoutIdx, txout := range tx.MsgTx().TxOut {
-				// txt, isText := utils.ExtractText(txout.PkScript)
-				// if !isText || len(txt) < 8 {
-				// 	continue
-				// }
-				txt := utils.StripNonTextBytes(txout.PkScript)
-				if len(txt) < 8 {
-					continue
-				}
-
-				_, err := outFile.WriteString(fmt.Sprintf("%v,%v,%v,%v,%v\n", blockHash, txHash, "out", txoutIdx, string(txt)))
-				if err != nil {
-					chErr <- err
-					return
-				}
-			}*/
 
 			// extract text from concatenated TxOut hex tokens
-
 			parsedScriptData, err := tx.ConcatNonOPDataFromTxOuts()
 			if err != nil {
 				chErr <- err
 				return
 			}
 
-			// parsedScriptText, isText := utils.ExtractText(parsedScriptData)
-			// if err != nil {
-			// 	chErr <- err
-			// 	return
-			// }
-			parsedScriptText := utils.StripNonTextBytes(parsedScriptData)
-			// if isText && len(parsedScriptText) > 8 {
-			if len(parsedScriptText) > 8 {
-				_, err := outFile.WriteString(fmt.Sprintf("%v,%v,%v,%v,%v\n", blockHash, txHash, "out", -1, string(parsedScriptText)))
-				if err != nil {
-					chErr <- err
-					return
-				}
+			err = writePlaintextRuns(outFile, blockHash, txHash, "out", utils.FindTextRuns(parsedScriptData, 0, 0))
+			if err != nil {
+				chErr <- err
+				return
 			}
 		}
 	}
+}
 
-	if err != nil {
-		chErr <- err
-		return
+// writePlaintextRuns writes a line for each run of text: block hash, tx hash, "in" or "out", encoding,
+// offset, confidence, and the quoted text.
+func writePlaintextRuns(outFile *os.File, blockHash, txHash, direction string, runs utils.TextRuns) error {
+	for _, run := range runs {
+		_, err := outFile.WriteString(fmt.Sprintf("%v,%v,%v,%v,%v,%.2f,%q\n", blockHash, txHash, direction, run.Encoding, run.Offset, run.Score, run.Text))
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
@@ -1,15 +1,22 @@
 package cmds
 
 import (
+	"encoding/csv"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 
 	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
 	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/scoring"
 )
 
-func FindSuspiciousTxs(startBlock, endBlock uint64, datFileDir, outDir string) error {
+// FindSuspiciousTxs scores every transaction in the given .dat files and writes the ones that score above
+// zero to a CSV file per .dat file, most suspicious first.
+func FindSuspiciousTxs(startBlock, endBlock uint64, datFileDir, outDir, scoringConfig string) error {
 	outSubdir := filepath.Join(".", outDir, "suspicious-txs")
 
 	err := os.MkdirAll(outSubdir, 0777)
@@ -17,6 +24,12 @@ func FindSuspiciousTxs(startBlock, endBlock uint64, datFileDir, outDir string) e
 		return err
 	}
 
+	config, err := scoring.LoadConfig(scoringConfig)
+	if err != nil {
+		return err
+	}
+	engine := scoring.NewEngine(config)
+
 	// start a goroutine to log errors
 	chErr := make(chan error)
 	go func() {
@@ -29,7 +42,7 @@ func FindSuspiciousTxs(startBlock, endBlock uint64, datFileDir, outDir string) e
 	// chDones := []chan bool{}
 	for i := int(startBlock); i < int(endBlock)+1; i++ {
 		// chDone := make(chan bool)
-		findSuspiciousTxsParseBlock(datFileDir, outSubdir, i, chErr)
+		findSuspiciousTxsParseBlock(engine, datFileDir, outSubdir, i, chErr)
 		// chDones = append(chDones, chDone)
 	}
 
@@ -44,16 +57,9 @@ func FindSuspiciousTxs(startBlock, endBlock uint64, datFileDir, outDir string) e
 	return nil
 }
 
-func findSuspiciousTxsParseBlock(datFileDir string, outDir string, blockFileNum int, chErr chan error) {
+func findSuspiciousTxsParseBlock(engine *scoring.Engine, datFileDir string, outDir string, blockFileNum int, chErr chan error) {
 	// defer close(chDone)
 
-	csvFile, err := utils.CreateFile(filepath.Join(outDir, fmt.Sprintf("suspicious-txs-blk%05d.txt", blockFileNum)))
-	if err != nil {
-		chErr <- err
-		return
-	}
-	defer utils.CloseFile(csvFile)
-
 	filename := fmt.Sprintf("blk%05d.dat", blockFileNum)
 	fmt.Println("parsing block", filename)
 
@@ -63,22 +69,54 @@ func findSuspiciousTxsParseBlock(datFileDir string, outDir string, blockFileNum
 		return
 	}
 
-	for _, bl := range blocks {
-		blockHash := bl.Hash().String()
-
-		blockTimestamp := bl.MsgBlock().Header.Timestamp
-		csvFile.WriteString("======= " + blockTimestamp.String() + " =======\n")
+	type suspiciousTx struct {
+		blockHash  string
+		numInputs  int
+		numOutputs int
+	}
 
+	scores := []scoring.TxScore{}
+	txs := map[chainhash.Hash]suspiciousTx{}
+	for _, bl := range blocks {
 		for _, btctx := range bl.Transactions() {
-			tx := Tx{Tx: btctx}
-
-			txHash := tx.Hash().String()
+			tx := &Tx{Tx: btctx}
+
+			score, err := engine.RunFullSuite(tx)
+			if err != nil {
+				chErr <- err
+				return
+			} else if score.Score == 0 {
+				continue
+			}
 
-			if tx.HasSuspiciousOutputValues() {
-				numInputs := len(tx.MsgTx().TxIn)
-				numOutputs := len(tx.MsgTx().TxOut)
-				csvFile.WriteString(fmt.Sprintf("%v,%v,%v,%v\n", blockHash, txHash, numInputs, numOutputs))
+			scores = append(scores, score)
+			txs[*tx.Hash()] = suspiciousTx{
+				blockHash:  bl.Hash().String(),
+				numInputs:  len(tx.MsgTx().TxIn),
+				numOutputs: len(tx.MsgTx().TxOut),
 			}
 		}
 	}
+
+	scoring.SortByScore(scores)
+
+	csvFile, err := utils.CreateFile(filepath.Join(outDir, fmt.Sprintf("suspicious-txs-blk%05d.csv", blockFileNum)))
+	if err != nil {
+		chErr <- err
+		return
+	}
+	defer utils.CloseFile(csvFile)
+
+	csvWriter := csv.NewWriter(csvFile)
+	csvWriter.Write([]string{"block hash", "tx hash", "inputs", "outputs", "score", "level", "reasons"})
+	for _, score := range scores {
+		tx := txs[score.TxHash]
+		csvWriter.Write([]string{tx.blockHash, score.TxHash.String(), fmt.Sprint(tx.numInputs), fmt.Sprint(tx.numOutputs),
+			fmt.Sprint(score.Score), score.Level.String(), strings.Join(score.ReasonStrings(), " | ")})
+	}
+
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		chErr <- err
+	}
 }
@@ -1,9 +1,7 @@
 package cmds
 
 import (
-	"encoding/binary"
 	"fmt"
-	"hash/crc32"
 	"os"
 	"path/filepath"
 
@@ -152,21 +150,11 @@ func opReturnsParseBlock(inDir string, outDir string, blockFileNum int, chCSVDat
 				fmt.Printf("- file magic byte match -> type: %v (block hash: %v) (tx hash: %v)\n", match.Description(), blockHash, txHash)
 			}
 
-			length := binary.LittleEndian.Uint32(allTxOutData[0:4])
-			expectedChecksum := binary.LittleEndian.Uint32(allTxOutData[4:8])
-			if len(allTxOutData) < 8+int(length) {
-				continue
-			}
-
-			data := allTxOutData[8 : 8+int(length)]
-
-			checksum := crc32.ChecksumIEEE(data)
-
-			if checksum == expectedChecksum {
-				fmt.Println("EXPECTED CHECKSUM MATCHED")
-			} else {
+			data, err := utils.GetSatoshiEncodedData(allTxOutData)
+			if err != nil {
 				continue
 			}
+			fmt.Printf("- Satoshi-encoded data (%v bytes) (block hash: %v) (tx hash: %v)\n", len(data), blockHash, txHash)
 
 			allTxOutFilename := filepath.Join(blockDir, fmt.Sprintf("txouts-combined-%v.dat", txHash))
 			err = utils.CreateAndWriteFile(allTxOutFilename, data)
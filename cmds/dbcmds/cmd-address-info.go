@@ -0,0 +1,68 @@
+package dbcmds
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+)
+
+type AddressInfoCommand struct {
+	dbFile     string
+	datFileDir string
+	address    string
+}
+
+func NewAddressInfoCommand(datFileDir, dbFile, address string) *AddressInfoCommand {
+	return &AddressInfoCommand{
+		datFileDir: datFileDir,
+		dbFile:     dbFile,
+		address:    address,
+	}
+}
+
+func (cmd *AddressInfoCommand) RunCommand() error {
+	// this command only reads the local index, so there is no reason to go online
+	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	summary, err := db.GetAddressSummary(cmd.address)
+	if err != nil {
+		return err
+	}
+
+	printAddressSummary(summary)
+
+	txs, err := db.GetAddressTxs(cmd.address)
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range txs {
+		if tx.Kind == AddressTxOut {
+			fmt.Printf("  - %v  received %v BTC  (output %v of %v)\n", time.Unix(tx.Timestamp, 0).UTC(), tx.Value.BTCString(), tx.Index, tx.TxHash.String())
+		} else {
+			fmt.Printf("  - %v  sent     %v BTC  (input %v of %v)\n", time.Unix(tx.Timestamp, 0).UTC(), tx.Value.BTCString(), tx.Index, tx.TxHash.String())
+		}
+	}
+
+	return nil
+}
+
+func printAddressSummary(summary AddressSummary) {
+	fmt.Printf("%v\n", summary.Address)
+	if summary.NumTxs == 0 {
+		fmt.Printf("  - not found in the address index\n")
+		return
+	}
+
+	fmt.Printf("  - transactions: %v (%v outputs received, %v spent)\n", summary.NumTxs, summary.NumFunded, summary.NumSpent)
+	fmt.Printf("  - total received: %v BTC\n", summary.TotalReceived.BTCString())
+	fmt.Printf("  - total sent: %v BTC\n", summary.TotalSent.BTCString())
+	fmt.Printf("  - balance: %v BTC\n", summary.Balance().BTCString())
+	fmt.Printf("  - first seen: %v\n", summary.FirstSeen.UTC())
+	fmt.Printf("  - last seen: %v\n", summary.LastSeen.UTC())
+}
@@ -2,35 +2,47 @@ package dbcmds
 
 import (
 	"fmt"
+	"strconv"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 
 	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
 	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
 )
 
 type BlockInfoCommand struct {
-	dbFile     string
-	datFileDir string
-	blockHash  string
+	dbFile            string
+	datFileDir        string
+	blockHashOrHeight string
 }
 
-func NewBlockInfoCommand(datFileDir, dbFile, blockHash string) *BlockInfoCommand {
+func NewBlockInfoCommand(datFileDir, dbFile, blockHashOrHeight string) *BlockInfoCommand {
 	return &BlockInfoCommand{
-		datFileDir: datFileDir,
-		dbFile:     dbFile,
-		blockHash:  blockHash,
+		datFileDir:        datFileDir,
+		dbFile:            dbFile,
+		blockHashOrHeight: blockHashOrHeight,
 	}
 }
 
 func (cmd *BlockInfoCommand) RunCommand() error {
-	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir)
+	// this command only reads the local index, so there is no reason to go online
+	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir, nil)
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
-	blockHash, err := utils.HashFromString(cmd.blockHash)
-	if err != nil {
-		return err
+	var blockHash chainhash.Hash
+	if height, err := strconv.ParseUint(cmd.blockHashOrHeight, 10, 32); err == nil {
+		blockHash, err = db.GetBlockHashAtHeight(uint32(height))
+		if err != nil {
+			return err
+		}
+	} else {
+		blockHash, err = utils.HashFromString(cmd.blockHashOrHeight)
+		if err != nil {
+			return err
+		}
 	}
 
 	blockIndexRow, err := db.GetBlockIndexRow(blockHash)
@@ -47,5 +59,14 @@ func (cmd *BlockInfoCommand) RunCommand() error {
 	fmt.Printf("  - %v\n", block.MsgBlock().Header.Timestamp)
 	fmt.Printf("  - %v\n", blockIndexRow.DATFilename())
 
+	heightRow, err := db.GetBlockHeight(blockHash)
+	if IsNotFound(err) {
+		fmt.Printf("  - height unknown (%v)\n", firstLine(err))
+	} else if err != nil {
+		return err
+	} else {
+		fmt.Printf("  - height %v\n", heightRow)
+	}
+
 	return nil
 }
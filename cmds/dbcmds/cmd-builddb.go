@@ -13,11 +13,12 @@ type BuildBlockDBCommand struct {
 	endBlock   uint64
 	indexWhat  string
 	force      bool
+	workers    int
 }
 
-func NewBuildBlockDBCommand(startBlock, endBlock uint64, datFileDir, dbFile, indexWhat string, force bool) (*BuildBlockDBCommand, error) {
-	if indexWhat != "blocks" && indexWhat != "transactions" {
-		return nil, fmt.Errorf("must specify either 'blocks' or 'transactions'")
+func NewBuildBlockDBCommand(startBlock, endBlock uint64, datFileDir, dbFile, indexWhat string, force bool, workers int) (*BuildBlockDBCommand, error) {
+	if indexWhat != "blocks" && indexWhat != "transactions" && indexWhat != "heights" && indexWhat != "addresses" && indexWhat != "all" {
+		return nil, fmt.Errorf("must specify either 'blocks', 'transactions', 'heights', 'addresses' or 'all'")
 	}
 
 	return &BuildBlockDBCommand{
@@ -27,11 +28,13 @@ func NewBuildBlockDBCommand(startBlock, endBlock uint64, datFileDir, dbFile, ind
 		endBlock:   endBlock,
 		indexWhat:  indexWhat,
 		force:      force,
+		workers:    workers,
 	}, nil
 }
 
 func (cmd *BuildBlockDBCommand) RunCommand() error {
-	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir)
+	// indexing only ever reads the local .dat files, so there is no reason to go online
+	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir, nil)
 	if err != nil {
 		return err
 	}
@@ -51,6 +54,28 @@ func (cmd *BuildBlockDBCommand) RunCommand() error {
 			return err
 		}
 		return nil
+
+	case "addresses":
+		err = db.IndexDATFileAddresses(cmd.startBlock, cmd.endBlock, cmd.force)
+		if err != nil {
+			return err
+		}
+		return nil
+
+	case "heights":
+		// heights are computed from the whole block index, so startBlock/endBlock/force don't apply
+		err = db.IndexBlockHeights()
+		if err != nil {
+			return err
+		}
+		return nil
+
+	case "all":
+		err = db.IndexAll(cmd.startBlock, cmd.endBlock, cmd.workers, cmd.force)
+		if err != nil {
+			return err
+		}
+		return nil
 	}
 
 	return nil
@@ -21,7 +21,8 @@ func NewBuildDupesIndexCommand(startBlock, endBlock uint64, datFileDir, dbFile s
 }
 
 func (cmd *BuildDupesIndexCommand) RunCommand() error {
-	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir)
+	// indexing only ever reads the local .dat files, so there is no reason to go online
+	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir, nil)
 	if err != nil {
 		return err
 	}
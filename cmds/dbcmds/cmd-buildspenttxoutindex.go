@@ -23,7 +23,8 @@ func NewBuildSpentTxOutIndexCommand(startBlock, endBlock uint64, datFileDir, dbF
 }
 
 func (cmd *BuildSpentTxOutIndexCommand) RunCommand() error {
-	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir)
+	// indexing only ever reads the local .dat files, so there is no reason to go online
+	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir, nil)
 	if err != nil {
 		return err
 	}
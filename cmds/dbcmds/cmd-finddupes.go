@@ -17,7 +17,8 @@ func NewScanDupesIndexCommand(datFileDir, dbFile string) *ScanDupesIndexCommand
 }
 
 func (cmd *ScanDupesIndexCommand) RunCommand() error {
-	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir)
+	// this command only reads the local index, so there is no reason to go online
+	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir, nil)
 	if err != nil {
 		return err
 	}
@@ -16,6 +16,7 @@ type GraphCommand struct {
 	datFileDir string
 	walletAddr string
 	outDir     string
+	backend    LookupBackend
 	db         *BlockDB
 }
 
@@ -25,12 +26,13 @@ type graph struct {
 	entries map[string][]string
 }
 
-func NewGraphCommand(datFileDir, dbFile, outDir, walletAddr string) *GraphCommand {
+func NewGraphCommand(datFileDir, dbFile, outDir, walletAddr string, backend LookupBackend) *GraphCommand {
 	return &GraphCommand{
 		dbFile:     dbFile,
 		datFileDir: datFileDir,
 		walletAddr: walletAddr,
 		outDir:     filepath.Join(outDir, "graph", walletAddr),
+		backend:    backend,
 	}
 }
 
@@ -40,7 +42,7 @@ func (cmd *GraphCommand) RunCommand() error {
 		return err
 	}
 
-	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir)
+	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir, cmd.backend)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,146 @@
+package dbcmds
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/uploader"
+)
+
+type SatoshiUploadsCommand struct {
+	dbFile     string
+	datFileDir string
+	outDir     string
+	startBlock uint64
+	endBlock   uint64
+	txHash     string
+	backend    LookupBackend
+
+	reconstructor *uploader.Reconstructor
+
+	// the txs that are already part of a reconstructed upload, so that chunked uploads aren't found again
+	// starting from each of their txs
+	seen map[chainhash.Hash]bool
+
+	csvWriter *csv.Writer
+}
+
+// NewSatoshiUploadsCommand reconstructs the Satoshi upload starting at txHash or, if txHash is empty, every
+// upload starting in the given .dat files.
+func NewSatoshiUploadsCommand(datFileDir, dbFile, outDir string, startBlock, endBlock uint64, txHash string, backend LookupBackend) *SatoshiUploadsCommand {
+	return &SatoshiUploadsCommand{
+		dbFile:     dbFile,
+		datFileDir: datFileDir,
+		outDir:     filepath.Join(outDir, "satoshi-uploads"),
+		startBlock: startBlock,
+		endBlock:   endBlock,
+		txHash:     txHash,
+		backend:    backend,
+		seen:       map[chainhash.Hash]bool{},
+	}
+}
+
+func (cmd *SatoshiUploadsCommand) RunCommand() error {
+	err := os.MkdirAll(cmd.outDir, 0777)
+	if err != nil {
+		return err
+	}
+
+	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir, cmd.backend)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	cmd.reconstructor = &uploader.Reconstructor{DB: db}
+
+	csvFile, err := utils.CreateFile(filepath.Join(cmd.outDir, "uploads.csv"))
+	if err != nil {
+		return err
+	}
+	defer utils.CloseFile(csvFile)
+
+	cmd.csvWriter = csv.NewWriter(csvFile)
+	cmd.csvWriter.Write([]string{"start tx hash", "txs", "bytes", "chunked", "checksum ok", "file type", "file", "error"})
+	defer cmd.csvWriter.Flush()
+
+	if cmd.txHash != "" {
+		txHash, err := utils.HashFromString(cmd.txHash)
+		if err != nil {
+			return err
+		}
+
+		tx, err := db.GetTx(txHash)
+		if err != nil {
+			return err
+		}
+
+		found, err := cmd.reconstruct(tx)
+		if err != nil {
+			return err
+		} else if !found {
+			fmt.Printf("%v doesn't start a Satoshi upload\n", txHash)
+		}
+		return cmd.csvWriter.Error()
+	}
+
+	for datIdx := int(cmd.startBlock); datIdx <= int(cmd.endBlock); datIdx++ {
+		filename := fmt.Sprintf("blk%05d.dat", datIdx)
+		fmt.Println("parsing block", filename)
+
+		blocks, err := utils.LoadBlocksFromDAT(filepath.Join(cmd.datFileDir, filename))
+		if err != nil {
+			return err
+		}
+
+		for _, bl := range blocks {
+			for _, btctx := range bl.Transactions() {
+				if cmd.seen[*btctx.Hash()] {
+					continue
+				}
+
+				_, err := cmd.reconstruct(&Tx{Tx: btctx})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return cmd.csvWriter.Error()
+}
+
+// reconstruct writes out the upload starting at tx, and returns false if there isn't one.
+func (cmd *SatoshiUploadsCommand) reconstruct(tx *Tx) (bool, error) {
+	upload, err := cmd.reconstructor.Reconstruct(tx)
+	if err != nil {
+		return false, err
+	} else if upload == nil {
+		return false, nil
+	}
+
+	fmt.Println("-", upload.Description())
+
+	var filename string
+	if upload.ChecksumOK {
+		for _, txHash := range upload.TxHashes {
+			cmd.seen[txHash] = true
+		}
+
+		filename = filepath.Join(cmd.outDir, fmt.Sprintf("%v.%v", upload.StartTxHash(), upload.Extension))
+		err = utils.CreateAndWriteFile(filename, upload.Data)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	cmd.csvWriter.Write([]string{upload.StartTxHash().String(), fmt.Sprint(len(upload.TxHashes)), fmt.Sprint(upload.Length),
+		fmt.Sprint(upload.Chunked), fmt.Sprint(upload.ChecksumOK), upload.Filetype, filename, upload.Err})
+	return true, nil
+}
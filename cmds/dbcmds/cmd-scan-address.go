@@ -1,6 +1,7 @@
 package dbcmds
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -9,9 +10,11 @@ import (
 	"github.com/spooktheducks/local-blockchain-parser/scanner/detectoroutput"
 	"github.com/spooktheducks/local-blockchain-parser/scanner/txdatasource"
 	"github.com/spooktheducks/local-blockchain-parser/scanner/txdatasourceoutput"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/txhashoutput"
 	"github.com/spooktheducks/local-blockchain-parser/scanner/txhashsource"
 
 	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
 )
 
 type ScanAddressCommand struct {
@@ -19,25 +22,36 @@ type ScanAddressCommand struct {
 	datFileDir string
 	walletAddr string
 	outDir     string
+	backend    LookupBackend
+	workers    int
+	onError    string
 	db         *BlockDB
 }
 
-func NewScanAddressCommand(datFileDir, dbFile, outDir, walletAddr string) *ScanAddressCommand {
+func NewScanAddressCommand(datFileDir, dbFile, outDir, walletAddr string, backend LookupBackend, workers int, onError string) *ScanAddressCommand {
 	return &ScanAddressCommand{
 		dbFile:     dbFile,
 		datFileDir: datFileDir,
 		walletAddr: walletAddr,
 		outDir:     filepath.Join(outDir, "address", walletAddr),
+		backend:    backend,
+		workers:    workers,
+		onError:    onError,
 	}
 }
 
 func (cmd *ScanAddressCommand) RunCommand() error {
-	err := os.MkdirAll(cmd.outDir, 0777)
+	errorPolicy, err := scanner.ParseErrorPolicy(cmd.onError)
 	if err != nil {
 		return err
 	}
 
-	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir)
+	err = os.MkdirAll(cmd.outDir, 0777)
+	if err != nil {
+		return err
+	}
+
+	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir, cmd.backend)
 	if err != nil {
 		return err
 	}
@@ -45,12 +59,34 @@ func (cmd *ScanAddressCommand) RunCommand() error {
 
 	cmd.db = db
 
+	hasIndex, err := db.HasAddressIndex()
+	if err != nil {
+		return err
+	}
+
+	if hasIndex {
+		summary, err := db.GetAddressSummary(cmd.walletAddr)
+		if err != nil {
+			return err
+		}
+		printAddressSummary(summary)
+	} else if cmd.backend == nil {
+		return DataNotIndexedError{Index: "addresses"}
+	} else {
+		fmt.Println("the address index hasn't been built, so the transaction list comes from the remote backend")
+	}
+
 	s := &scanner.Scanner{
 		DB:           db,
+		Workers:      cmd.workers,
+		ErrorPolicy:  errorPolicy,
 		TxHashSource: txhashsource.NewAddressTxHashSource(db, cmd.walletAddr),
 		TxDataSources: []scanner.ITxDataSource{
 			&txdatasource.InputScript{},
 			&txdatasource.InputScriptsConcat{},
+			&txdatasource.InputWitness{},
+			&txdatasource.InputWitnessScriptPushdata{},
+			&txdatasource.InputWitnessConcat{},
 			&txdatasource.OutputScript{},
 			&txdatasource.OutputScriptsConcat{},
 			&txdatasource.OutputScriptsSatoshi{},
@@ -64,20 +100,29 @@ func (cmd *ScanAddressCommand) RunCommand() error {
 			&detector.PGPPackets{},
 			// &detector.AESKeys{},
 			&detector.MagicBytes{},
+			&detector.KnownHashes{},
 			// &detector.Plaintext{},
 		},
 		DetectorOutputs: []scanner.IDetectorOutput{
 			&detectoroutput.Console{Prefix: "  - "},
 			&detectoroutput.RawData{OutDir: cmd.outDir},
-			&detectoroutput.CSV{OutDir: cmd.outDir},
-			&detectoroutput.CSVTxAnalysis{OutDir: cmd.outDir},
+			&detectoroutput.CarvedFiles{OutDir: cmd.outDir},
+			&detectoroutput.CSV{OutDir: cmd.outDir, DB: db},
+			&detectoroutput.CSVTxAnalysis{OutDir: cmd.outDir, DB: db},
+		},
+		SkippedTxOutputs: []scanner.ISkippedTxOutput{
+			&txhashoutput.SkippedTxs{OutDir: cmd.outDir, Filename: "skipped-txs.csv"},
 		},
 	}
 
-	err = s.Run()
-	if err != nil {
-		return err
-	}
+	ctx, cancel := utils.InterruptContext()
+	defer cancel()
 
-	return s.Close()
+	// the outputs are closed even if the scan fails or is interrupted, so that the results so far are kept
+	runErr := s.Run(ctx)
+	err = s.Close()
+	if runErr != nil {
+		return runErr
+	}
+	return err
 }
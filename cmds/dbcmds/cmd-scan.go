@@ -0,0 +1,85 @@
+package dbcmds
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spooktheducks/local-blockchain-parser/scanner/pipeline"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+)
+
+type ScanCommand struct {
+	dbFile     string
+	datFileDir string
+	outDir     string
+	spec       pipeline.Spec
+	backend    LookupBackend
+}
+
+// NewScanCommand runs a scanner pipeline described by spec (see pipeline.Spec).
+func NewScanCommand(datFileDir, dbFile, outDir string, spec pipeline.Spec, backend LookupBackend) *ScanCommand {
+	return &ScanCommand{
+		dbFile:     dbFile,
+		datFileDir: datFileDir,
+		outDir:     filepath.Join(outDir, "scan"),
+		spec:       spec,
+		backend:    backend,
+	}
+}
+
+func (cmd *ScanCommand) RunCommand() error {
+	err := os.MkdirAll(cmd.outDir, 0777)
+	if err != nil {
+		return err
+	}
+
+	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir, cmd.backend)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	s, err := cmd.spec.Build(pipeline.Env{
+		DB:         db,
+		DATFileDir: cmd.datFileDir,
+		OutDir:     cmd.outDir,
+		Stdin:      os.Stdin,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := utils.InterruptContext()
+	defer cancel()
+
+	// the outputs are closed even if the scan fails or is interrupted, so that the results so far are kept
+	runErr := s.Run(ctx)
+	err = s.Close()
+	if runErr != nil {
+		return runErr
+	}
+	return err
+}
+
+type ScanComponentsCommand struct{}
+
+// NewScanComponentsCommand lists the names that can be used in a scan pipeline.
+func NewScanComponentsCommand() *ScanComponentsCommand {
+	return &ScanComponentsCommand{}
+}
+
+func (cmd *ScanComponentsCommand) RunCommand() error {
+	fmt.Println("tx sources:")
+	fmt.Printf("  - %v\n", strings.Join(pipeline.TxHashSourceNames(), "\n  - "))
+	fmt.Println("data sources:")
+	fmt.Printf("  - %v\n", strings.Join(pipeline.TxDataSourceNames(), "\n  - "))
+	fmt.Println("detectors:")
+	fmt.Printf("  - %v\n", strings.Join(pipeline.DetectorNames(), "\n  - "))
+	fmt.Println("outputs:")
+	fmt.Printf("  - %v\n", strings.Join(pipeline.OutputNames(), "\n  - "))
+	return nil
+}
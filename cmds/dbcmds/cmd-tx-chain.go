@@ -21,13 +21,17 @@ type TxChainCommand struct {
 	datFileDir string
 	outDir     string
 	direction  string
+	strategy   string
 	txHash     string
 	limit      uint
+	backend    LookupBackend
+	workers    int
+	onError    string
 
 	db *BlockDB
 }
 
-func NewTxChainCommand(datFileDir, dbFile, outDir, direction string, limit uint, txHash string) *TxChainCommand {
+func NewTxChainCommand(datFileDir, dbFile, outDir, direction, strategy string, limit uint, txHash string, backend LookupBackend, workers int, onError string) *TxChainCommand {
 	if direction != "forward" &&
 		direction != "backward" &&
 		direction != "both" {
@@ -39,18 +43,27 @@ func NewTxChainCommand(datFileDir, dbFile, outDir, direction string, limit uint,
 		datFileDir: datFileDir,
 		txHash:     txHash,
 		direction:  direction,
+		strategy:   strategy,
 		limit:      limit,
+		backend:    backend,
+		workers:    workers,
+		onError:    onError,
 		outDir:     filepath.Join(outDir, "tx-chain", txHash),
 	}
 }
 
 func (cmd *TxChainCommand) RunCommand() error {
-	err := os.MkdirAll(cmd.outDir, 0777)
+	errorPolicy, err := scanner.ParseErrorPolicy(cmd.onError)
 	if err != nil {
 		return err
 	}
 
-	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir)
+	err = os.MkdirAll(cmd.outDir, 0777)
+	if err != nil {
+		return err
+	}
+
+	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir, cmd.backend)
 	if err != nil {
 		return err
 	}
@@ -63,17 +76,24 @@ func (cmd *TxChainCommand) RunCommand() error {
 		return err
 	}
 
+	strategy, err := txhashsource.NewNextTxStrategy(db, cmd.strategy, startHash)
+	if err != nil {
+		return err
+	}
+
 	var txHashSource scanner.ITxHashSource
 	if cmd.direction == "forward" {
-		txHashSource = txhashsource.NewForwardChain(db, startHash, cmd.limit)
+		txHashSource = txhashsource.NewForwardChain(db, startHash, cmd.limit, strategy)
 	} else if cmd.direction == "backward" {
-		txHashSource = txhashsource.NewBackwardChain(db, startHash, cmd.limit)
+		txHashSource = txhashsource.NewBackwardChain(db, startHash, cmd.limit, strategy)
 	} else {
-		txHashSource = txhashsource.NewChain(db, startHash, cmd.limit)
+		txHashSource = txhashsource.NewChain(db, startHash, cmd.limit, strategy)
 	}
 
 	s := &scanner.Scanner{
 		DB:           db,
+		Workers:      cmd.workers,
+		ErrorPolicy:  errorPolicy,
 		TxHashSource: txHashSource,
 		TxHashOutputs: []scanner.ITxHashOutput{
 			&txhashoutput.HashOnly{OutDir: cmd.outDir, Filename: "transactions.txt"},
@@ -88,6 +108,9 @@ func (cmd *TxChainCommand) RunCommand() error {
 			&txdatasource.InputScriptPushdata{},
 			&txdatasource.InputScriptFirstPushdata{},
 			&txdatasource.InputScriptsConcat{},
+			&txdatasource.InputWitness{},
+			&txdatasource.InputWitnessScriptPushdata{},
+			&txdatasource.InputWitnessConcat{},
 			&txdatasource.OutputScript{},
 			&txdatasource.OutputScript{OrderByValue: true},
 			&txdatasource.OutputScript{SkipMaxValueTxOut: true},
@@ -95,6 +118,8 @@ func (cmd *TxChainCommand) RunCommand() error {
 			&txdatasource.OutputScriptsSatoshi{},
 			&txdatasource.OutputScriptOpReturn{},
 			&txdatasource.OutputScriptsConcat{},
+			&txdatasource.OutputScriptMultisig{},
+			&txdatasource.OutputScriptMultisig{Concat: true},
 		},
 		TxDataSourceOutputs: []scanner.ITxDataSourceOutput{
 			&txdatasourceoutput.RawData{OutDir: cmd.outDir},
@@ -104,20 +129,30 @@ func (cmd *TxChainCommand) RunCommand() error {
 			// &detector.PGPPackets{},
 			&detector.AESKeys{},
 			&detector.MagicBytes{},
+			&detector.KnownHashes{},
+			&detector.FakeMultisigKeys{},
 			// &detector.Plaintext{},
 		},
 		DetectorOutputs: []scanner.IDetectorOutput{
 			&detectoroutput.Console{Prefix: "  - "},
 			&detectoroutput.RawData{OutDir: cmd.outDir},
-			&detectoroutput.CSV{OutDir: cmd.outDir},
-			&detectoroutput.CSVTxAnalysis{OutDir: cmd.outDir},
+			&detectoroutput.CarvedFiles{OutDir: cmd.outDir},
+			&detectoroutput.CSV{OutDir: cmd.outDir, DB: db},
+			&detectoroutput.CSVTxAnalysis{OutDir: cmd.outDir, DB: db},
+		},
+		SkippedTxOutputs: []scanner.ISkippedTxOutput{
+			&txhashoutput.SkippedTxs{OutDir: cmd.outDir, Filename: "skipped-txs.csv"},
 		},
 	}
 
-	err = s.Run()
-	if err != nil {
-		return err
-	}
+	ctx, cancel := utils.InterruptContext()
+	defer cancel()
 
-	return s.Close()
+	// the outputs are closed even if the scan fails or is interrupted, so that the results so far are kept
+	runErr := s.Run(ctx)
+	err = s.Close()
+	if runErr != nil {
+		return runErr
+	}
+	return err
 }
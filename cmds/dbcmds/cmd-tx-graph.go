@@ -0,0 +1,138 @@
+package dbcmds
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/detector"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/detectoroutput"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/txdatasource"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/txdatasourceoutput"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/txhashoutput"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/txhashsource"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+)
+
+type TxGraphCommand struct {
+	dbFile     string
+	datFileDir string
+	outDir     string
+	txHash     string
+	maxDepth   uint
+	maxNodes   uint
+	minValue   int64
+	backend    LookupBackend
+	workers    int
+	onError    string
+
+	db *BlockDB
+}
+
+func NewTxGraphCommand(datFileDir, dbFile, outDir string, maxDepth, maxNodes uint, minValue int64, txHash string, backend LookupBackend, workers int, onError string) *TxGraphCommand {
+	return &TxGraphCommand{
+		dbFile:     dbFile,
+		datFileDir: datFileDir,
+		txHash:     txHash,
+		maxDepth:   maxDepth,
+		maxNodes:   maxNodes,
+		minValue:   minValue,
+		backend:    backend,
+		workers:    workers,
+		onError:    onError,
+		outDir:     filepath.Join(outDir, "tx-graph", txHash),
+	}
+}
+
+func (cmd *TxGraphCommand) RunCommand() error {
+	errorPolicy, err := scanner.ParseErrorPolicy(cmd.onError)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(cmd.outDir, 0777)
+	if err != nil {
+		return err
+	}
+
+	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir, cmd.backend)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	cmd.db = db
+
+	startHash, err := utils.HashFromString(cmd.txHash)
+	if err != nil {
+		return err
+	}
+
+	s := &scanner.Scanner{
+		DB:           db,
+		Workers:      cmd.workers,
+		ErrorPolicy:  errorPolicy,
+		TxHashSource: txhashsource.NewGraph(db, startHash, cmd.maxDepth, cmd.maxNodes, cmd.minValue),
+		TxHashOutputs: []scanner.ITxHashOutput{
+			&txhashoutput.HashOnly{OutDir: cmd.outDir, Filename: "transactions.txt"},
+			&txhashoutput.OpReturn{OutDir: cmd.outDir, Filename: "transactions-opreturn.txt"},
+			&txhashoutput.NonOp{OutDir: cmd.outDir, Filename: "transactions-nonop.txt"},
+			&txhashoutput.InputScript{OutDir: cmd.outDir, Filename: "transactions-inputscripts.txt"},
+			&txhashoutput.InputScriptNonOP{OutDir: cmd.outDir, Filename: "transactions-inputscripts-nonop.txt"},
+		},
+		TxDataSources: []scanner.ITxDataSource{
+			&txdatasource.InputScript{},
+			&txdatasource.InputScriptNonOP{},
+			&txdatasource.InputScriptPushdata{},
+			&txdatasource.InputScriptFirstPushdata{},
+			&txdatasource.InputScriptsConcat{},
+			&txdatasource.InputWitness{},
+			&txdatasource.InputWitnessScriptPushdata{},
+			&txdatasource.InputWitnessConcat{},
+			&txdatasource.OutputScript{},
+			&txdatasource.OutputScript{OrderByValue: true},
+			&txdatasource.OutputScript{SkipMaxValueTxOut: true},
+			&txdatasource.OutputScript{SkipMaxValueTxOut: true, OrderByValue: true},
+			&txdatasource.OutputScriptsSatoshi{},
+			&txdatasource.OutputScriptOpReturn{},
+			&txdatasource.OutputScriptsConcat{},
+			&txdatasource.OutputScriptMultisig{},
+			&txdatasource.OutputScriptMultisig{Concat: true},
+		},
+		TxDataSourceOutputs: []scanner.ITxDataSourceOutput{
+			&txdatasourceoutput.RawData{OutDir: cmd.outDir},
+			&txdatasourceoutput.RawDataEachDataSource{OutDir: cmd.outDir},
+		},
+		Detectors: []scanner.IDetector{
+			// &detector.PGPPackets{},
+			&detector.AESKeys{},
+			&detector.MagicBytes{},
+			&detector.KnownHashes{},
+			&detector.FakeMultisigKeys{},
+			// &detector.Plaintext{},
+		},
+		DetectorOutputs: []scanner.IDetectorOutput{
+			&detectoroutput.Console{Prefix: "  - "},
+			&detectoroutput.RawData{OutDir: cmd.outDir},
+			&detectoroutput.CarvedFiles{OutDir: cmd.outDir},
+			&detectoroutput.CSV{OutDir: cmd.outDir, DB: db},
+			&detectoroutput.CSVTxAnalysis{OutDir: cmd.outDir, DB: db},
+		},
+		SkippedTxOutputs: []scanner.ISkippedTxOutput{
+			&txhashoutput.SkippedTxs{OutDir: cmd.outDir, Filename: "skipped-txs.csv"},
+		},
+	}
+
+	ctx, cancel := utils.InterruptContext()
+	defer cancel()
+
+	// the outputs are closed even if the scan fails or is interrupted, so that the results so far are kept
+	runErr := s.Run(ctx)
+	err = s.Close()
+	if runErr != nil {
+		return runErr
+	}
+	return err
+}
@@ -13,6 +13,7 @@ import (
 
 	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
 	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/scoring"
 	// "github.com/spooktheducks/local-blockchain-parser/scanner"
 	// "github.com/spooktheducks/local-blockchain-parser/scanner/detector"
 	// "github.com/spooktheducks/local-blockchain-parser/scanner/detectoroutput"
@@ -26,14 +27,20 @@ type TxInfoCommand struct {
 	datFileDir string
 	outDir     string
 	txHash     string
+	backend    LookupBackend
+
+	// a scoring config file, or "" for the default weights
+	scoringConfig string
 }
 
-func NewTxInfoCommand(datFileDir, dbFile, outDir, txHash string) *TxInfoCommand {
+func NewTxInfoCommand(datFileDir, dbFile, outDir, txHash string, backend LookupBackend, scoringConfig string) *TxInfoCommand {
 	return &TxInfoCommand{
-		dbFile:     dbFile,
-		datFileDir: datFileDir,
-		outDir:     filepath.Join(outDir, "tx-info", txHash),
-		txHash:     txHash,
+		dbFile:        dbFile,
+		datFileDir:    datFileDir,
+		outDir:        filepath.Join(outDir, "tx-info", txHash),
+		txHash:        txHash,
+		backend:       backend,
+		scoringConfig: scoringConfig,
 	}
 }
 
@@ -57,7 +64,7 @@ func (s sortableTxOuts) Swap(i, j int) {
 }
 
 func (cmd *TxInfoCommand) RunCommand() error {
-	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir)
+	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir, cmd.backend)
 	if err != nil {
 		return err
 	}
@@ -129,14 +136,21 @@ func (cmd *TxInfoCommand) RunCommand() error {
 	}
 
 	fmt.Printf("transaction %v\n", tx.Hash().String())
+	if tx.HasWitness() {
+		fmt.Printf("  - Witness hash (wtxid): %v\n", tx.WitnessHash().String())
+	}
 	fmt.Printf("  - Block %v (%v) (%v)\n", tx.BlockHash, tx.DATFilename(), time.Unix(tx.BlockTimestamp, 0))
+	if heightRow, err := db.GetBlockHeight(tx.BlockHash); err == nil {
+		fmt.Printf("  - Block height: %v\n", heightRow)
+	} else if !IsNotFound(err) {
+		return err
+	}
 	fmt.Printf("  - Lock time: %v\n", tx.MsgTx().LockTime)
 
-	fee, err := tx.Fee()
+	err = cmd.printValues(db, tx)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("  - Fee: %v BTC\n", fee)
 
 	// txoutAddrs, err := utils.GetTxOutAddresses(tx)
 	// if err != nil {
@@ -155,10 +169,15 @@ func (cmd *TxInfoCommand) RunCommand() error {
 	// 	}
 	// }
 
-	// err = cmd.printOutputsSpentUnspent(db, tx)
-	// if err != nil {
-	// 	return err
-	// }
+	err = cmd.printOutputsSpentUnspent(db, tx)
+	if err != nil {
+		return err
+	}
+
+	err = cmd.printScore(tx)
+	if err != nil {
+		return err
+	}
 
 	// err = cmd.findPlaintext(tx)
 	// if err != nil {
@@ -285,6 +304,31 @@ func (cmd *TxInfoCommand) RunCommand() error {
 		}
 	}
 
+	// write individual witness items and the script each input's witness executes
+	for txinIdx := range tx.MsgTx().TxIn {
+		for itemIdx, item := range tx.GetWitnessFromTxIn(txinIdx) {
+			err := ioutil.WriteFile(filepath.Join(cmd.outDir, fmt.Sprintf("txin-witness-%v-%v.dat", txinIdx, itemIdx)), item, 0666)
+			if err != nil {
+				return err
+			}
+		}
+
+		script := tx.GetWitnessScriptFromTxIn(txinIdx)
+		if script == nil {
+			continue
+		}
+
+		pushdata, err := utils.GetPushdataBytesFromWitnessScript(script)
+		if err != nil {
+			continue
+		}
+
+		err = ioutil.WriteFile(filepath.Join(cmd.outDir, fmt.Sprintf("txin-witness-script-pushdata-%v.dat", txinIdx)), pushdata, 0666)
+		if err != nil {
+			return err
+		}
+	}
+
 	// write concatenated txins
 	data, err = tx.ConcatTxInScripts()
 	if err == nil {
@@ -315,6 +359,46 @@ func (cmd *TxInfoCommand) RunCommand() error {
 	return nil
 }
 
+func (cmd *TxInfoCommand) printValues(db *BlockDB, tx *Tx) error {
+	if tx.IsCoinbase() {
+		block, err := db.GetBlock(tx.BlockHash)
+		if err != nil {
+			return err
+		}
+
+		summary, err := db.GetBlockFeeSummary(block.Block)
+		if IsNotFound(err) {
+			// the block's height or one of its transactions' inputs isn't available locally
+			fmt.Printf("  - Coinbase, claimed %v BTC (block reward unknown: %v)\n", tx.OutputValue().BTCString(), firstLine(err))
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		fmt.Printf("  - Coinbase, block reward: %v BTC (subsidy %v + fees %v)\n", summary.Reward().BTCString(), summary.Subsidy.BTCString(), summary.TotalFees.BTCString())
+		fmt.Printf("  - Claimed: %v BTC\n", tx.OutputValue().BTCString())
+		return nil
+	}
+
+	fmt.Printf("  - Output value: %v BTC\n", tx.OutputValue().BTCString())
+
+	inValue, err := tx.InputValue()
+	if IsNotFound(err) {
+		// one of the inputs' previous transactions isn't available locally
+		fmt.Printf("  - Input value: unknown (%v)\n", firstLine(err))
+		fmt.Printf("  - Fee: unknown\n")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	fee := inValue - tx.OutputValue()
+	size := tx.MsgTx().SerializeSizeWitness()
+	fmt.Printf("  - Input value: %v BTC\n", inValue.BTCString())
+	fmt.Printf("  - Fee: %v BTC (%.2f sat/byte, %v bytes)\n", fee.BTCString(), float64(fee)/float64(size), size)
+	return nil
+}
+
 func (cmd *TxInfoCommand) printOutputsSpentUnspent(db *BlockDB, tx *Tx) error {
 	for txoutIdx := range tx.MsgTx().TxOut {
 		addr, err := tx.GetTxOutAddress(txoutIdx)
@@ -329,19 +413,30 @@ func (cmd *TxInfoCommand) printOutputsSpentUnspent(db *BlockDB, tx *Tx) error {
 			addrString = fmt.Sprintf("%v", addr)
 		}
 
-		spentString := ""
-		spentTxOut, err := db.GetSpentTxOut(SpentTxOutKey{TxHash: *tx.Hash(), TxOutIndex: uint32(txoutIdx)})
+		state, err := db.GetTxOutStatus(SpentTxOutKey{TxHash: *tx.Hash(), TxOutIndex: uint32(txoutIdx)})
 		if err != nil {
-			if strings.Contains(err.Error(), "can't find SpentTxOut") {
-				spentString = "unspent"
-			} else {
-				return err
-			}
-		} else {
-			spentString = fmt.Sprintf("spent in tx %v (%v)", spentTxOut.InputTxHash.String(), spentTxOut.TxInIndex)
+			return err
 		}
 
-		fmt.Printf("  - TxOut %v: %v (addr: %v)\n", txoutIdx, spentString, addrString)
+		fmt.Printf("  - TxOut %v: %v (addr: %v)\n", txoutIdx, state, addrString)
+	}
+	return nil
+}
+
+func (cmd *TxInfoCommand) printScore(tx *Tx) error {
+	config, err := scoring.LoadConfig(cmd.scoringConfig)
+	if err != nil {
+		return err
+	}
+
+	score, err := scoring.NewEngine(config).RunFullSuite(tx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("  - Suspicion score: %v (%v)\n", score.Score, score.Level)
+	for _, reason := range score.ReasonStrings() {
+		fmt.Printf("      - %v\n", reason)
 	}
 	return nil
 }
@@ -362,11 +457,11 @@ func (cmd *TxInfoCommand) findGPGData(tx *Tx) error {
 	}
 
 	result := utils.FindPGPPackets(data)
-	for _, packet := range result.Packets {
+	for _, desc := range result.DescriptionStrings() {
 		if isSatoshi {
-			fmt.Printf("  - GPG packet (satoshi-encoded): %+v\n", packet)
+			fmt.Printf("  - GPG data (satoshi-encoded): %v\n", desc)
 		} else {
-			fmt.Printf("  - GPG packet: %+v\n", packet)
+			fmt.Printf("  - GPG data: %v\n", desc)
 		}
 	}
 
@@ -423,22 +518,16 @@ func (cmd *TxInfoCommand) findFileHeaders(tx *Tx) error {
 func (cmd *TxInfoCommand) findPlaintext(tx *Tx) error {
 	// extract text from each TxIn scriptSig
 	for txinIdx, txin := range tx.MsgTx().TxIn {
-		txt := utils.StripNonTextBytes(txin.SignatureScript)
-		if len(txt) < 8 {
-			continue
+		for _, run := range utils.FindTextRuns(txin.SignatureScript, 0, 0) {
+			fmt.Printf("  - TxIn %v plaintext: %v\n", txinIdx, run.Description())
 		}
-
-		fmt.Printf("  - TxIn %v plaintext: %v\n", txinIdx, string(txt))
 	}
 
 	// extract text from each TxOut PkScript
 	for txoutIdx, txout := range tx.MsgTx().TxOut {
-		txt := utils.StripNonTextBytes(txout.PkScript)
-		if len(txt) < 8 {
-			continue
+		for _, run := range utils.FindTextRuns(txout.PkScript, 0, 0) {
+			fmt.Printf("  - TxOut %v plaintext: %v\n", txoutIdx, run.Description())
 		}
-
-		fmt.Printf("  - TxOut %v plaintext: %v\n", txoutIdx, string(txt))
 	}
 
 	// extract text from concatenated TxOut hex tokens
@@ -448,13 +537,14 @@ func (cmd *TxInfoCommand) findPlaintext(tx *Tx) error {
 		return err
 	}
 
-	parsedScriptText := utils.StripNonTextBytes(parsedScriptData)
-	if err != nil {
-		return err
-	}
-	if len(parsedScriptText) > 8 {
-		fmt.Printf("  - Concatenated TxOut plaintext: %v\n", string(parsedScriptText))
+	for _, run := range utils.FindTextRuns(parsedScriptData, 0, 0) {
+		fmt.Printf("  - Concatenated TxOut plaintext: %v\n", run.Description())
 	}
 
 	return nil
 }
+
+// firstLine trims the multi-line help text from our index errors so they fit on one line of output
+func firstLine(err error) string {
+	return strings.SplitN(err.Error(), "\n", 2)[0]
+}
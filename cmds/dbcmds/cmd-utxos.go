@@ -0,0 +1,130 @@
+package dbcmds
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+)
+
+type UTXOsCommand struct {
+	dbFile     string
+	datFileDir string
+	outDir     string
+	height     int64
+	all        bool
+}
+
+// NewUTXOsCommand dumps the UTXO set as of the given height (or the tip of the local best chain if height
+// is negative).  Unless all is set, only outputs that look like they carry data are included.
+func NewUTXOsCommand(datFileDir, dbFile, outDir string, height int64, all bool) *UTXOsCommand {
+	return &UTXOsCommand{
+		dbFile:     dbFile,
+		datFileDir: datFileDir,
+		outDir:     filepath.Join(outDir, "utxos"),
+		height:     height,
+		all:        all,
+	}
+}
+
+func (cmd *UTXOsCommand) RunCommand() error {
+	// this command only reads the local index, so there is no reason to go online
+	db, err := NewBlockDB(cmd.dbFile, cmd.datFileDir, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var height uint32
+	if cmd.height < 0 {
+		height, err = db.GetTipHeight()
+		if err != nil {
+			return err
+		}
+	} else {
+		height = uint32(cmd.height)
+	}
+
+	err = os.MkdirAll(cmd.outDir, 0777)
+	if err != nil {
+		return err
+	}
+
+	outFile, err := utils.CreateFile(filepath.Join(cmd.outDir, fmt.Sprintf("utxos-%v.csv", height)))
+	if err != nil {
+		return err
+	}
+	defer utils.CloseFile(outFile)
+
+	_, err = outFile.WriteString("height,tx,txout,satoshis,script type,addresses,script,status\n")
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("reconstructing the UTXO set at height %v...\n", height)
+
+	numUTXOs, numUnknown := 0, 0
+	var value Satoshis
+	err = db.ForEachUTXO(height, func(utxo UTXO) error {
+		// outputs that the index can't decide are always listed, so that they can be checked by hand
+		class, addrs, _, _ := txscript.ExtractPkScriptAddrs(utxo.TxOut.PkScript, &chaincfg.MainNetParams)
+		if !cmd.all && utxo.Status != TxOutStatusUnknown && !isDataCarryingScript(class, utxo.TxOut.PkScript) {
+			return nil
+		}
+
+		scriptType := class.String()
+		if version, program, ok := utils.ParseWitnessProgram(utxo.TxOut.PkScript); ok {
+			scriptType = utils.WitnessProgramType(version, program)
+		}
+
+		addrStrings := make([]string, len(addrs))
+		for i := range addrs {
+			addrStrings[i] = addrs[i].EncodeAddress()
+		}
+
+		status := utxo.Status.String()
+		if utxo.Status == TxOutStatusUnknown {
+			numUnknown++
+			status = fmt.Sprintf("unknown (%v)", utxo.Reason)
+		} else {
+			numUTXOs++
+			value += Satoshis(utxo.TxOut.Value)
+		}
+
+		_, err := outFile.WriteString(fmt.Sprintf("%v,%v,%v,%v,%v,%v,%v,%v\n", utxo.Height, utxo.Key.TxHash.String(), utxo.Key.TxOutIndex,
+			utxo.TxOut.Value, scriptType, strings.Join(addrStrings, " "), hex.EncodeToString(utxo.TxOut.PkScript), status))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote %v unspent outputs (%v BTC) to %v\n", numUTXOs, value.BTCString(), outFile.Name())
+	if numUnknown > 0 {
+		fmt.Printf("%v outputs whose status the local index can't decide are listed as unknown\n", numUnknown)
+	}
+	return nil
+}
+
+// isDataCarryingScript returns true for the kinds of output that are commonly used to embed data:
+// OP_RETURN outputs, bare multisig (whose "public keys" are often just chunks of a file) and anything
+// nonstandard.  Data hidden in fake P2PKH/P2SH hashes can't be told apart from real payments.  Segwit and
+// taproot outputs are classified as nonstandard by txscript, so they're recognized separately and left out.
+func isDataCarryingScript(class txscript.ScriptClass, pkScript []byte) bool {
+	if _, _, ok := utils.ParseWitnessProgram(pkScript); ok {
+		return false
+	}
+
+	switch class {
+	case txscript.NullDataTy, txscript.MultiSigTy, txscript.NonStandardTy:
+		return true
+	}
+	return false
+}
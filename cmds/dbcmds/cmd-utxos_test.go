@@ -0,0 +1,37 @@
+package dbcmds
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestIsDataCarryingScript(T *testing.T) {
+	p2wpkh := append([]byte{txscript.OP_0, 20}, bytes.Repeat([]byte{0x11}, 20)...)
+	p2tr := append([]byte{txscript.OP_1, 32}, bytes.Repeat([]byte{0x22}, 32)...)
+	opReturn, err := txscript.NullDataScript([]byte("some data"))
+	if err != nil {
+		T.Fatal(err)
+	}
+	nonstandard := []byte{txscript.OP_DROP, txscript.OP_DROP, txscript.OP_TRUE}
+
+	tests := []struct {
+		name     string
+		pkScript []byte
+		expected bool
+	}{
+		{"p2wpkh", p2wpkh, false},
+		{"p2tr", p2tr, false},
+		{"op_return", opReturn, true},
+		{"nonstandard", nonstandard, true},
+	}
+
+	for _, test := range tests {
+		class, _, _, _ := txscript.ExtractPkScriptAddrs(test.pkScript, &chaincfg.MainNetParams)
+		if isDataCarryingScript(class, test.pkScript) != test.expected {
+			T.Errorf("%v: expected isDataCarryingScript to return %v", test.name, test.expected)
+		}
+	}
+}
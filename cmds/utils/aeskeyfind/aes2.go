@@ -20,14 +20,22 @@ func (r AESResult) IsEmpty() bool {
 func (r AESResult) DescriptionStrings() []string {
 	strs := make([]string, len(r.FoundKeys))
 	for i, fk := range r.FoundKeys {
-		strs[i] = fmt.Sprintf("AES-%d %s key (hex: %s) (string: %s)", len(fk.Key)*8, fk.KeyType, hex.EncodeToString(fk.Key), fk.Key)
+		strs[i] = fk.Description()
 	}
 	return strs
 }
 
+// FoundKey is an AES key recovered from an expanded key schedule.
 type FoundKey struct {
 	KeyType
 	Key []byte
+
+	// where the key schedule starts in the searched data
+	Offset uint64
+
+	// set if the schedule's words are stored big-endian, rather than as little-endian uint32s (like
+	// OpenSSL's on x86)
+	BigEndian bool
 }
 
 type KeyType int
@@ -37,6 +45,18 @@ const (
 	KeyTypeDecoding
 )
 
+func (fk FoundKey) Bits() int {
+	return len(fk.Key) * 8
+}
+
+func (fk FoundKey) Description() string {
+	byteOrder := "little-endian"
+	if fk.BigEndian {
+		byteOrder = "big-endian"
+	}
+	return fmt.Sprintf("AES-%d %s key at offset %d (%s schedule) (hex: %s) (string: %q)", fk.Bits(), fk.KeyType, fk.Offset, byteOrder, hex.EncodeToString(fk.Key), fk.Key)
+}
+
 func (kt KeyType) String() string {
 	switch kt {
 	case KeyTypeEncoding:
@@ -48,15 +68,36 @@ func (kt KeyType) String() string {
 	}
 }
 
+// scheduleDetector recognizes one kind of key schedule, which takes up size bytes.
+type scheduleDetector struct {
+	size   int
+	detect func(ctx []byte, reversed bool) []byte
+}
+
+var encDetectors = []scheduleDetector{
+	{240, detectEnc256},
+	{208, detectEnc192},
+	{176, detectEnc128},
+}
+
+var decDetectors = []scheduleDetector{
+	{176, detectDec128f},
+	{176, detectDec128b},
+	{208, detectDec192f},
+	{208, detectDec192b},
+	{240, detectDec256f},
+	{240, detectDec256b},
+}
+
 func Detect(data []byte) AESResult {
 	foundKeys := make([]FoundKey, 0)
 	i := 0
-	for i < len(data)-60 {
-		if key := detectEnc(data[i:]); key != nil {
-			foundKeys = append(foundKeys, FoundKey{KeyTypeEncoding, key})
+	for i+176 <= len(data) {
+		if key, reversed := detectSchedule(data[i:], encDetectors); key != nil {
+			foundKeys = append(foundKeys, FoundKey{KeyType: KeyTypeEncoding, Key: key, Offset: uint64(i), BigEndian: reversed})
 			i += 28 + len(key)
-		} else if key := detectDec(data[i:]); key != nil {
-			foundKeys = append(foundKeys, FoundKey{KeyTypeDecoding, key})
+		} else if key, reversed := detectSchedule(data[i:], decDetectors); key != nil {
+			foundKeys = append(foundKeys, FoundKey{KeyType: KeyTypeDecoding, Key: key, Offset: uint64(i), BigEndian: reversed})
 			i += 28 + len(key)
 		} else {
 			i += 4 // data is considered to be an array of uint32s, so we advance by 4 bytes and restart the search
@@ -65,50 +106,20 @@ func Detect(data []byte) AESResult {
 	return AESResult{FoundKeys: foundKeys}
 }
 
-func detectEnc(ctx []byte) []byte {
-	if key := detectEnc256(ctx, false); key != nil {
-		return key
-	} else if key := detectEnc256(ctx, true); key != nil {
-		return key
-	} else if key := detectEnc192(ctx, false); key != nil {
-		return key
-	} else if key := detectEnc192(ctx, true); key != nil {
-		return key
-	} else if key := detectEnc128(ctx, false); key != nil {
-		return key
-	} else if key := detectEnc128(ctx, true); key != nil {
-		return key
-	}
-	return nil
-}
-
-func detectDec(ctx []byte) []byte {
-	if key := detectDec128f(ctx, false); key != nil {
-		return key
-	} else if key := detectDec128f(ctx, true); key != nil {
-		return key
-	} else if key := detectDec128b(ctx, false); key != nil {
-		return key
-	} else if key := detectDec128b(ctx, true); key != nil {
-		return key
-	} else if key := detectDec192f(ctx, false); key != nil {
-		return key
-	} else if key := detectDec192f(ctx, true); key != nil {
-		return key
-	} else if key := detectDec192b(ctx, false); key != nil {
-		return key
-	} else if key := detectDec192b(ctx, true); key != nil {
-		return key
-	} else if key := detectDec256f(ctx, false); key != nil {
-		return key
-	} else if key := detectDec256f(ctx, true); key != nil {
-		return key
-	} else if key := detectDec256b(ctx, false); key != nil {
-		return key
-	} else if key := detectDec256b(ctx, true); key != nil {
-		return key
-	}
-	return nil
+// detectSchedule tries each detector, in both byte orders, on the data at the start of ctx.  It returns the
+// key, and whether the schedule was stored big-endian.
+func detectSchedule(ctx []byte, detectors []scheduleDetector) ([]byte, bool) {
+	for _, d := range detectors {
+		if len(ctx) < d.size {
+			continue
+		}
+		for _, reversed := range []bool{false, true} {
+			if key := d.detect(ctx, reversed); key != nil {
+				return key, reversed
+			}
+		}
+	}
+	return nil, false
 }
 
 func detectEnc256(ctx []byte, reversed bool) []byte {
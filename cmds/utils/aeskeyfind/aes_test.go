@@ -0,0 +1,43 @@
+package aeskeyfind
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDetect(T *testing.T) {
+	tests := []struct {
+		filename string
+		keyType  KeyType
+		bits     int
+	}{
+		{"key-128-enc.dat", KeyTypeEncoding, 128},
+		{"key-128-dec.dat", KeyTypeDecoding, 128},
+		{"key-192-enc.dat", KeyTypeEncoding, 192},
+		{"key-256-enc.dat", KeyTypeEncoding, 256},
+	}
+
+	for _, test := range tests {
+		schedule, err := ioutil.ReadFile(test.filename)
+		if err != nil {
+			T.Fatal(err)
+		}
+
+		// put the schedule somewhere in the middle of the data, and cut off a copy at the end
+		data := append(bytes.Repeat([]byte{0}, 64), schedule...)
+		data = append(data, schedule[:len(schedule)-4]...)
+
+		result := Detect(data)
+		if len(result.FoundKeys) != 1 {
+			T.Fatalf("%v: expected 1 key, got %v", test.filename, result.DescriptionStrings())
+		}
+
+		fk := result.FoundKeys[0]
+		if fk.KeyType != test.keyType || fk.Bits() != test.bits || fk.Offset != 64 || fk.BigEndian {
+			T.Fatalf("%v: expected a little-endian %v-bit %v key at offset 64, got %v", test.filename, test.bits, test.keyType, fk.Description())
+		} else if !bytes.Equal(fk.Key, bytes.Repeat([]byte("opensesame123456"), 2)[:test.bits/8]) {
+			T.Fatalf("%v: wrong key %q", test.filename, fk.Key)
+		}
+	}
+}
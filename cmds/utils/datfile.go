@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Bitcoin Core 28+ obfuscates blk*.dat and rev*.dat files by XORing them with a random key that it keeps
+// in xor.dat, next to the block files.  Byte n of a file is XORed with key[n % len(key)].  Nodes that were
+// set up before the feature existed have an all-zero key (or no xor.dat at all), which is a no-op.
+const XORKeyFilename = "xor.dat"
+
+var (
+	xorKeys   = map[string][]byte{}
+	xorKeysMu sync.Mutex
+)
+
+// DATFile reads a .dat file, transparently removing Bitcoin Core's XOR obfuscation.  It supports sequential
+// reads as well as seeking and reading at arbitrary offsets.
+type DATFile struct {
+	file *os.File
+	key  []byte
+	pos  int64
+}
+
+// ensure that DATFile conforms to io.ReadSeeker and io.ReaderAt
+var _ io.ReadSeeker = &DATFile{}
+var _ io.ReaderAt = &DATFile{}
+
+func OpenDATFile(filename string) (*DATFile, error) {
+	key, err := GetXORKey(filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DATFile{file: file, key: key}, nil
+}
+
+// GetXORKey returns the obfuscation key for the block files in datFileDir, or nil if they aren't obfuscated.
+// Keys are cached per directory.
+func GetXORKey(datFileDir string) ([]byte, error) {
+	xorKeysMu.Lock()
+	defer xorKeysMu.Unlock()
+
+	if key, exists := xorKeys[datFileDir]; exists {
+		return key, nil
+	}
+
+	key, err := ioutil.ReadFile(filepath.Join(datFileDir, XORKeyFilename))
+	if os.IsNotExist(err) {
+		key = nil
+	} else if err != nil {
+		return nil, err
+	} else if len(key) == 0 {
+		return nil, fmt.Errorf("%v is empty", filepath.Join(datFileDir, XORKeyFilename))
+	} else if isZeroKey(key) {
+		key = nil
+	}
+
+	xorKeys[datFileDir] = key
+	return key, nil
+}
+
+func isZeroKey(key []byte) bool {
+	for _, b := range key {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *DATFile) IsObfuscated() bool {
+	return f.key != nil
+}
+
+// IsUnwritten returns true if p, which was read from offset off, is all zeros on disk.  Bitcoin Core
+// preallocates block files with zeros that aren't obfuscated, so in an obfuscated file they read back as
+// the key rather than as zeros.
+func (f *DATFile) IsUnwritten(p []byte, off int64) bool {
+	// XORing with the key again gives back the bytes on disk
+	raw := append([]byte{}, p...)
+	f.deobfuscate(raw, off)
+	return isZeroKey(raw)
+}
+
+func (f *DATFile) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	f.deobfuscate(p[:n], f.pos)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *DATFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.file.ReadAt(p, off)
+	f.deobfuscate(p[:n], off)
+	return n, err
+}
+
+func (f *DATFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.file.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	f.pos = pos
+	return pos, nil
+}
+
+func (f *DATFile) Close() error {
+	return f.file.Close()
+}
+
+func (f *DATFile) deobfuscate(p []byte, off int64) {
+	if f.key == nil {
+		return
+	}
+
+	keyLen := int64(len(f.key))
+	for i := range p {
+		p[i] ^= f.key[(off+int64(i))%keyLen]
+	}
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/spooktheducks/local-blockchain-parser/internal/testdat"
+)
+
+// writeObfuscatedDATDir copies the blk00000.dat in plainDir to a new directory, XORed with key as Bitcoin
+// Core does, along with an xor.dat holding the key.  Like Core, it leaves preallocated space at the end of
+// the file unobfuscated.
+func writeObfuscatedDATDir(T *testing.T, plainDir string, key []byte) string {
+	data, err := ioutil.ReadFile(filepath.Join(plainDir, "blk00000.dat"))
+	if err != nil {
+		T.Fatal(err)
+	}
+	for i := range data {
+		data[i] ^= key[i%len(key)]
+	}
+	data = append(data, make([]byte, 64)...)
+
+	dir, err := ioutil.TempDir("", "datfile-test")
+	if err != nil {
+		T.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "blk00000.dat"), data, 0666)
+	if err != nil {
+		T.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, XORKeyFilename), key, 0666)
+	if err != nil {
+		T.Fatal(err)
+	}
+	return dir
+}
+
+func TestObfuscatedDATFile(T *testing.T) {
+	genesis := chaincfg.MainNetParams.GenesisBlock
+	blocks := []*wire.MsgBlock{}
+	for i := 0; i < 3; i++ {
+		bl := wire.NewMsgBlock(&genesis.Header)
+		bl.Header.Nonce = uint32(i)
+		for j := 0; j < 2; j++ {
+			tx := genesis.Transactions[0].Copy()
+			tx.LockTime = uint32(i*10 + j)
+			bl.AddTransaction(tx)
+		}
+		blocks = append(blocks, bl)
+	}
+
+	plainDir := testdat.WriteDATDir(T, blocks)
+	defer os.RemoveAll(plainDir)
+
+	// a key length that doesn't divide the block offsets, so that reads start mid-key
+	dir := writeObfuscatedDATDir(T, plainDir, []byte{0x13, 0x37, 0xc0, 0xde, 0x42, 0x99, 0x01})
+	defer os.RemoveAll(dir)
+
+	plainBlocks, plainLocs, err := LoadBlocksAndLocsFromDAT(filepath.Join(plainDir, "blk00000.dat"))
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	// sequential reads
+	obfuscatedFile := filepath.Join(dir, "blk00000.dat")
+	loaded, err := LoadBlocksFromDAT(obfuscatedFile)
+	if err != nil {
+		T.Fatal(err)
+	} else if len(loaded) != len(blocks) || len(plainBlocks) != len(blocks) {
+		T.Fatalf("expected %v blocks, got %v (%v from the plain file)", len(blocks), len(loaded), len(plainBlocks))
+	}
+	for i := range blocks {
+		if *loaded[i].Hash() != blocks[i].BlockHash() {
+			T.Errorf("block %v: got %v, expected %v", i, loaded[i].Hash(), blocks[i].BlockHash())
+		}
+	}
+
+	// seeking past blocks
+	bl, err := LoadBlockFromDAT(obfuscatedFile, 2)
+	if err != nil {
+		T.Fatal(err)
+	} else if *bl.Hash() != blocks[2].BlockHash() {
+		T.Errorf("got block %v, expected %v", bl.Hash(), blocks[2].BlockHash())
+	}
+
+	// ReadAt, at the locations found in the plain file
+	for i, loc := range plainLocs {
+		bl, err := LoadBlockFromDATAt(obfuscatedFile, loc.Offset, loc.Length)
+		if err != nil {
+			T.Fatal(err)
+		} else if *bl.Hash() != blocks[i].BlockHash() {
+			T.Errorf("block %v: got %v, expected %v", i, bl.Hash(), blocks[i].BlockHash())
+		}
+
+		for j, txLoc := range loc.TxLocs {
+			tx, err := LoadTxFromDATAt(obfuscatedFile, loc.Offset+uint64(txLoc.TxStart), uint32(txLoc.TxLen))
+			if err != nil {
+				T.Fatal(err)
+			} else if *tx.Hash() != blocks[i].Transactions[j].TxHash() {
+				T.Errorf("block %v tx %v: got %v, expected %v", i, j, tx.Hash(), blocks[i].Transactions[j].TxHash())
+			}
+		}
+	}
+
+	// with the wrong key, reading fails instead of returning no blocks
+	staleDir := writeObfuscatedDATDir(T, plainDir, []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08})
+	defer os.RemoveAll(staleDir)
+	err = ioutil.WriteFile(filepath.Join(staleDir, XORKeyFilename), []byte{0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01}, 0666)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	_, err = LoadBlocksFromDAT(filepath.Join(staleDir, "blk00000.dat"))
+	if err == nil {
+		T.Fatal("expected a bad network magic error with the wrong key")
+	}
+}
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+)
+
+// AESDecryption is data that decrypted to something recognizable with an AES key found elsewhere.
+type AESDecryption struct {
+	Mode string // "ecb", "cbc" or "ctr"
+
+	// set if the IV was the 16 bytes before the ciphertext, rather than all zeroes (ECB has no IV)
+	IVFromData bool
+
+	// where the ciphertext (or the IV in front of it) starts in the data
+	Offset uint64
+
+	Data []byte
+
+	// set if Data starts with a file signature
+	Filetype  string
+	Extension string
+
+	TextRuns TextRuns
+}
+
+// the fraction of the decrypted data that has to be text for the decryption to count
+const minDecryptedTextShare = 0.5
+
+func (d AESDecryption) Description() string {
+	iv := "zero IV"
+	if d.Mode == "ecb" {
+		iv = "no IV"
+	} else if d.IVFromData {
+		iv = "IV from data"
+	}
+
+	found := fmt.Sprintf("%d text runs", len(d.TextRuns))
+	if d.Filetype != "" {
+		found = d.Filetype
+	}
+	return fmt.Sprintf("AES-%s (%s) at offset %d: %d bytes of %s", d.Mode, iv, d.Offset, len(d.Data), found)
+}
+
+// TryAESDecryption decrypts data with key in ECB, CBC and CTR modes, with a zero IV and with the first block
+// as the IV.  The ciphertext is taken to start at the beginning of the data, and also just past the header
+// if data starts with a Satoshi uploader header.  It returns the decryptions that start with a file
+// signature from signatures (utils.DefaultFileSignatures if nil) or are mostly text.
+func TryAESDecryption(key, data []byte, signatures FileSignatures) ([]AESDecryption, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if signatures == nil {
+		signatures = DefaultFileSignatures()
+	}
+
+	offsets := []int{0}
+	if _, _, ok := ParseSatoshiHeader(data); ok {
+		offsets = append(offsets, SatoshiHeaderLen)
+	}
+
+	decryptions := []AESDecryption{}
+	for _, offset := range offsets {
+		ciphertext := data[offset:]
+		zeroIV := make([]byte, aes.BlockSize)
+
+		attempts := []AESDecryption{
+			{Mode: "ecb", Data: decryptECB(block, ciphertext)},
+			{Mode: "cbc", Data: decryptCBC(block, zeroIV, ciphertext)},
+			{Mode: "ctr", Data: decryptCTR(block, zeroIV, ciphertext)},
+		}
+		if len(ciphertext) > aes.BlockSize {
+			iv, rest := ciphertext[:aes.BlockSize], ciphertext[aes.BlockSize:]
+			attempts = append(attempts,
+				AESDecryption{Mode: "cbc", IVFromData: true, Data: decryptCBC(block, iv, rest)},
+				AESDecryption{Mode: "ctr", IVFromData: true, Data: decryptCTR(block, iv, rest)},
+			)
+		}
+
+		for _, d := range attempts {
+			if len(d.Data) == 0 {
+				continue
+			}
+			d.Offset = uint64(offset)
+			if d.recognize(signatures) {
+				decryptions = append(decryptions, d)
+			}
+		}
+	}
+	return decryptions, nil
+}
+
+// recognize runs the magic-byte and plaintext checks on the decrypted data, and returns true if either
+// finds something.
+func (d *AESDecryption) recognize(signatures FileSignatures) bool {
+	for _, found := range signatures.Search(d.Data) {
+		if found.Offset == 0 && !found.Reversed && !found.Footer && found.Extension != "" {
+			d.Filetype, d.Extension = found.Filetype, found.Extension
+			return true
+		}
+	}
+
+	runs := FindTextRuns(d.Data, 0, 0)
+	var textLen uint64
+	for _, run := range runs {
+		textLen += run.Length
+	}
+	if float64(textLen) >= minDecryptedTextShare*float64(len(d.Data)) {
+		d.TextRuns = runs
+		return true
+	}
+	return false
+}
+
+func decryptECB(block cipher.Block, ciphertext []byte) []byte {
+	plaintext := make([]byte, len(ciphertext)-len(ciphertext)%aes.BlockSize)
+	for i := 0; i < len(plaintext); i += aes.BlockSize {
+		block.Decrypt(plaintext[i:], ciphertext[i:])
+	}
+	return trimPKCS7Padding(plaintext)
+}
+
+func decryptCBC(block cipher.Block, iv, ciphertext []byte) []byte {
+	plaintext := make([]byte, len(ciphertext)-len(ciphertext)%aes.BlockSize)
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext[:len(plaintext)])
+	return trimPKCS7Padding(plaintext)
+}
+
+func decryptCTR(block cipher.Block, iv, ciphertext []byte) []byte {
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, iv).XORKeyStream(plaintext, ciphertext)
+	return plaintext
+}
+
+// trimPKCS7Padding removes the padding from the end of data, if it has valid padding.
+func trimPKCS7Padding(data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+
+	n := int(data[len(data)-1])
+	if n == 0 || n > aes.BlockSize || n > len(data) {
+		return data
+	}
+	if !bytes.Equal(data[len(data)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return data
+	}
+	return data[:len(data)-n]
+}
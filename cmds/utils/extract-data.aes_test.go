@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+)
+
+func TestTryAESDecryption(T *testing.T) {
+	key := []byte("opensesame123456")
+	text := []byte("This is the message that was hidden in the blockchain, encrypted with the key.")
+
+	padding := aes.BlockSize - len(text)%aes.BlockSize
+	plaintext := append(append([]byte{}, text...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		T.Fatal(err)
+	}
+	iv := []byte("0123456789abcdef")
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+
+	data := append(append([]byte{}, iv...), ciphertext...)
+
+	decryptions, err := TryAESDecryption(key, data, FileSignatures{})
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	// with a zero IV, CBC gets everything but the first block right, so that counts as well
+	if len(decryptions) != 2 || decryptions[0].Mode != "cbc" || decryptions[0].IVFromData {
+		T.Fatalf("expected CBC decryptions with a zero IV and with the IV from the data, got %v", decryptions)
+	}
+
+	d := decryptions[1]
+	if d.Mode != "cbc" || !d.IVFromData || d.Offset != 0 || len(d.TextRuns) == 0 {
+		T.Fatalf("expected a CBC decryption to text with the IV from the data, got %v", d.Description())
+	} else if !bytes.Equal(d.Data, text) {
+		T.Fatalf("expected %q, got %q", text, d.Data)
+	}
+
+	decryptions, err = TryAESDecryption([]byte("the wrong key..."), data, FileSignatures{})
+	if err != nil {
+		T.Fatal(err)
+	} else if len(decryptions) != 0 {
+		T.Fatalf("expected no decryptions with the wrong key, got %v", decryptions)
+	}
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// CarvedFile is a candidate file cut out of the data around a signature's header.
+type CarvedFile struct {
+	Filetype  string
+	Extension string
+	Offset    uint64 // of the header that was found, in the searched data
+	Reversed  bool   // if the file was found byte-reversed (Data is in the right order)
+
+	// set if the data ended before the footer, or before the declared length
+	Truncated bool
+
+	Data []byte
+}
+
+// Filename returns a name for the carved file, unique within the data it was carved from.
+func (c CarvedFile) Filename() string {
+	name := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '/' || r == '(' || r == ')' {
+			return '-'
+		}
+		return r
+	}, c.Filetype)
+
+	name = fmt.Sprintf("%s-%d", name, c.Offset)
+	if c.Reversed {
+		name += "-reversed"
+	}
+	if c.Truncated {
+		name += "-truncated"
+	}
+	return name + "." + c.Extension
+}
+
+// carve cuts the file starting at start out of data.  The file ends at its declared length if the signature
+// has one, or else at the end of the first footer after the header, and is never longer than MaxSize.  It
+// returns nil if the declared length is impossible.
+func (def MagicBytesDef) carve(data []byte, start int) *CarvedFile {
+	carved := &CarvedFile{Filetype: def.Filetype, Extension: def.Extension}
+
+	maxEnd := len(data)
+	if def.MaxSize > 0 && uint64(maxEnd-start) > def.MaxSize {
+		maxEnd = start + int(def.MaxSize)
+	}
+
+	end := maxEnd
+	switch {
+	case len(def.Length) > 0:
+		length, ok := def.declaredLength(data[start:])
+		if !ok {
+			// the length field itself is cut off
+			carved.Truncated = true
+			break
+		}
+		if length < def.HeaderOffset+uint64(len(def.Header.Bytes)) || (def.MaxSize > 0 && length > def.MaxSize) {
+			return nil
+		}
+		if length > uint64(len(data)-start) {
+			carved.Truncated = true
+		} else {
+			end = start + int(length)
+		}
+
+	case len(def.Footer.Bytes) > 0:
+		searchFrom := start + int(def.HeaderOffset) + len(def.Header.Bytes)
+		if searchFrom > maxEnd {
+			carved.Truncated = true
+			break
+		}
+
+		footers := def.Footer.FindAll(data[searchFrom:maxEnd])
+		if len(footers) == 0 {
+			carved.Truncated = true
+			break
+		}
+		end = searchFrom + footers[0] + len(def.Footer.Bytes) + int(def.Trailer)
+		if end > maxEnd {
+			end = maxEnd
+			carved.Truncated = true
+		}
+	}
+
+	carved.Data = data[start:end]
+	return carved
+}
+
+// declaredLength adds up the signature's length terms, reading fields from data (which starts at the start
+// of the file).  It returns false if a field runs past the end of data.
+func (def MagicBytesDef) declaredLength(data []byte) (uint64, bool) {
+	var length uint64
+	for _, term := range def.Length {
+		if term.Size == 0 {
+			length += term.Constant
+			continue
+		}
+		if term.Offset+uint64(term.Size) > uint64(len(data)) {
+			return 0, false
+		}
+
+		field := data[term.Offset : term.Offset+uint64(term.Size)]
+		var value uint64
+		switch {
+		case term.Size == 1:
+			value = uint64(field[0])
+		case term.Size == 2 && term.BigEndian:
+			value = uint64(binary.BigEndian.Uint16(field))
+		case term.Size == 2:
+			value = uint64(binary.LittleEndian.Uint16(field))
+		case term.Size == 4 && term.BigEndian:
+			value = uint64(binary.BigEndian.Uint32(field))
+		case term.Size == 4:
+			value = uint64(binary.LittleEndian.Uint32(field))
+		case term.BigEndian:
+			value = binary.BigEndian.Uint64(field)
+		default:
+			value = binary.LittleEndian.Uint64(field)
+		}
+
+		// a huge field is either corrupt or not a length at all
+		if value > 1<<40 || length+value < length {
+			return ^uint64(0), true
+		}
+		length += value
+	}
+	return length, true
+}
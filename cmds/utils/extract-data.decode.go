@@ -0,0 +1,248 @@
+package utils
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+)
+
+// DecodedData is data found encoded or compressed inside other data.
+type DecodedData struct {
+	Encoding string // "hex", "base64", "ascii85", "uuencode", "zlib", "gzip" or "bzip2"
+	Offset   uint64 // where the encoded data starts
+	Data     []byte
+}
+
+const (
+	// hex and base64 runs shorter than this many characters aren't decoded, since short runs turn up
+	// everywhere by chance
+	minHexRunLen    = 32
+	minBase64RunLen = 24
+
+	// compressed streams that decompress to more than this many bytes are dropped, in case of decompression
+	// bombs
+	maxDecompressedLen = 16 << 20
+)
+
+// DecodeData tries every textual encoding and decompressor on data, at every offset where one could start,
+// and returns whatever decodes.  Compressed streams are only returned if they're complete and pass their
+// checksum.
+func DecodeData(data []byte) []DecodedData {
+	decoded := []DecodedData{}
+	decoded = append(decoded, findHexRuns(data)...)
+	decoded = append(decoded, findBase64Runs(data)...)
+	decoded = append(decoded, findASCII85Blocks(data)...)
+	decoded = append(decoded, findUUEncodedBlocks(data)...)
+	decoded = append(decoded, findCompressedStreams(data)...)
+	return decoded
+}
+
+func isHexChar(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isBase64Char(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '+' || c == '/'
+}
+
+// findRuns returns the [start, end) offsets of the maximal runs of bytes matching isRunChar that are at least
+// minLen long.
+func findRuns(data []byte, minLen int, isRunChar func(byte) bool) [][2]int {
+	runs := [][2]int{}
+	for i := 0; i < len(data); {
+		if !isRunChar(data[i]) {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(data) && isRunChar(data[i]) {
+			i++
+		}
+		if i-start >= minLen {
+			runs = append(runs, [2]int{start, i})
+		}
+	}
+	return runs
+}
+
+func findHexRuns(data []byte) []DecodedData {
+	decoded := []DecodedData{}
+	for _, run := range findRuns(data, minHexRunLen, isHexChar) {
+		str := data[run[0]:run[1]]
+		bs, err := hex.DecodeString(string(str[:len(str)-len(str)%2]))
+		if err != nil {
+			continue
+		}
+		decoded = append(decoded, DecodedData{Encoding: "hex", Offset: uint64(run[0]), Data: bs})
+	}
+	return decoded
+}
+
+func findBase64Runs(data []byte) []DecodedData {
+	isBase64OrNewline := func(c byte) bool { return isBase64Char(c) || c == '\r' || c == '\n' }
+
+	decoded := []DecodedData{}
+	for _, run := range findRuns(data, minBase64RunLen, isBase64OrNewline) {
+		str := bytes.Replace(bytes.Replace(data[run[0]:run[1]], []byte("\r"), nil, -1), []byte("\n"), nil, -1)
+		if len(str) < minBase64RunLen || !looksLikeBase64(str) {
+			continue
+		}
+
+		// any padding after the run is left off, and so is a trailing character that can't be decoded alone
+		if len(str)%4 == 1 {
+			str = str[:len(str)-1]
+		}
+		bs, err := base64.RawStdEncoding.DecodeString(string(str))
+		if err != nil {
+			continue
+		}
+		decoded = append(decoded, DecodedData{Encoding: "base64", Offset: uint64(run[0]), Data: bs})
+	}
+	return decoded
+}
+
+// looksLikeBase64 rules out runs that are hex (which findHexRuns already decodes) or all letters (long words,
+// identifiers), which base64-encoded binary data almost never is.
+func looksLikeBase64(str []byte) bool {
+	allHex, hasNonLetter := true, false
+	for _, c := range str {
+		if !isHexChar(c) {
+			allHex = false
+		}
+		if (c >= '0' && c <= '9') || c == '+' || c == '/' {
+			hasNonLetter = true
+		}
+	}
+	return !allHex && hasNonLetter
+}
+
+// findASCII85Blocks finds Adobe-style blocks delimited by "<~" and "~>".
+func findASCII85Blocks(data []byte) []DecodedData {
+	decoded := []DecodedData{}
+	for offset := 0; ; {
+		start := bytes.Index(data[offset:], []byte("<~"))
+		if start < 0 {
+			break
+		}
+		start += offset
+		end := bytes.Index(data[start+2:], []byte("~>"))
+		if end < 0 {
+			break
+		}
+		end += start + 2
+		offset = end + 2
+
+		bs, err := ioutil.ReadAll(ascii85.NewDecoder(bytes.NewReader(data[start+2 : end])))
+		if err != nil || len(bs) == 0 {
+			continue
+		}
+		decoded = append(decoded, DecodedData{Encoding: "ascii85", Offset: uint64(start), Data: bs})
+	}
+	return decoded
+}
+
+// findUUEncodedBlocks finds blocks starting with a "begin <mode> <filename>" line.
+func findUUEncodedBlocks(data []byte) []DecodedData {
+	decoded := []DecodedData{}
+	for offset := 0; ; {
+		idx := bytes.Index(data[offset:], []byte("begin "))
+		if idx < 0 {
+			break
+		}
+		start := offset + idx
+		offset = start + len("begin ")
+
+		if start > 0 && data[start-1] != '\n' {
+			continue
+		}
+		lineEnd := bytes.IndexByte(data[start:], '\n')
+		if lineEnd < 0 {
+			break
+		}
+
+		bs, ok := decodeUULines(data[start+lineEnd+1:])
+		if ok && len(bs) > 0 {
+			decoded = append(decoded, DecodedData{Encoding: "uuencode", Offset: uint64(start), Data: bs})
+		}
+	}
+	return decoded
+}
+
+// decodeUULines decodes uuencoded lines up to the zero-length line (or "end") that finishes them.  It returns
+// false if a line is malformed before then.
+func decodeUULines(data []byte) ([]byte, bool) {
+	decoded := []byte{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 || bytes.Equal(line, []byte("end")) {
+			return decoded, len(decoded) > 0
+		}
+
+		n := int((line[0] - ' ') & 0x3f)
+		if n == 0 {
+			return decoded, len(decoded) > 0
+		}
+
+		chars := line[1:]
+		if len(chars) < (n+2)/3*4 {
+			return nil, false
+		}
+
+		lineBytes := []byte{}
+		for i := 0; i+4 <= len(chars) && len(lineBytes) < n; i += 4 {
+			var c [4]byte
+			for j := range c {
+				if chars[i+j] < ' ' || chars[i+j] > '`' {
+					return nil, false
+				}
+				c[j] = (chars[i+j] - ' ') & 0x3f
+			}
+			lineBytes = append(lineBytes, c[0]<<2|c[1]>>4, c[1]<<4|c[2]>>2, c[2]<<6|c[3])
+		}
+		decoded = append(decoded, lineBytes[:n]...)
+	}
+	return decoded, len(decoded) > 0
+}
+
+func findCompressedStreams(data []byte) []DecodedData {
+	decoded := []DecodedData{}
+	for i := 0; i+4 <= len(data); i++ {
+		var encoding string
+		var r io.Reader
+		var err error
+
+		switch {
+		case data[i]&0x0f == 8 && data[i]>>4 <= 7 && (uint16(data[i])<<8|uint16(data[i+1]))%31 == 0 && data[i+1]&0x20 == 0:
+			// zlib: deflate with a window of at most 32K, a valid header checksum and no preset dictionary
+			encoding = "zlib"
+			r, err = zlib.NewReader(bytes.NewReader(data[i:]))
+		case data[i] == 0x1f && data[i+1] == 0x8b && data[i+2] == 0x08:
+			encoding = "gzip"
+			r, err = gzip.NewReader(bytes.NewReader(data[i:]))
+		case bytes.HasPrefix(data[i:], []byte("BZh")) && data[i+3] >= '1' && data[i+3] <= '9' &&
+			bytes.HasPrefix(data[i+4:], []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}):
+			encoding = "bzip2"
+			r = bzip2.NewReader(bytes.NewReader(data[i:]))
+		default:
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		// read one byte past the limit, so that oversized streams are dropped rather than silently truncated
+		bs, err := ioutil.ReadAll(io.LimitReader(r, maxDecompressedLen+1))
+		if err != nil || len(bs) == 0 || len(bs) > maxDecompressedLen {
+			continue
+		}
+		decoded = append(decoded, DecodedData{Encoding: encoding, Offset: uint64(i), Data: bs})
+	}
+	return decoded
+}
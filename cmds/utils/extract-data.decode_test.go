@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDecodeData(T *testing.T) {
+	text := []byte("a secret message, compressed and then base64-encoded")
+
+	gzipped := &bytes.Buffer{}
+	gz := gzip.NewWriter(gzipped)
+	gz.Write(text)
+	gz.Close()
+
+	data := append([]byte("junk "), base64.StdEncoding.EncodeToString(gzipped.Bytes())...)
+
+	decoded := DecodeData(data)
+	if len(decoded) != 1 || decoded[0].Encoding != "base64" || decoded[0].Offset != 5 {
+		T.Fatalf("expected one base64 result at offset 5, got %v", decoded)
+	} else if !bytes.Equal(decoded[0].Data, gzipped.Bytes()) {
+		T.Fatalf("base64 decoded to %x, expected %x", decoded[0].Data, gzipped.Bytes())
+	}
+
+	decoded = DecodeData(decoded[0].Data)
+	if len(decoded) != 1 || decoded[0].Encoding != "gzip" || !bytes.Equal(decoded[0].Data, text) {
+		T.Fatalf("expected the base64 data to gunzip to %q, got %v", text, decoded)
+	}
+}
+
+func TestDecodeDataHexAndZlib(T *testing.T) {
+	text := []byte("hex-encoded text that's long enough to count as a run")
+
+	compressed := &bytes.Buffer{}
+	z := zlib.NewWriter(compressed)
+	z.Write(text)
+	z.Close()
+
+	data := append([]byte(hex.EncodeToString(text)+" "), compressed.Bytes()...)
+
+	decoded := DecodeData(data)
+	if len(decoded) != 2 {
+		T.Fatalf("expected a hex and a zlib result, got %v", decoded)
+	}
+	if decoded[0].Encoding != "hex" || decoded[0].Offset != 0 || !bytes.Equal(decoded[0].Data, text) {
+		T.Fatalf("expected hex data at offset 0 decoding to %q, got %v", text, decoded[0])
+	}
+	if decoded[1].Encoding != "zlib" || decoded[1].Offset != uint64(len(text)*2+1) || !bytes.Equal(decoded[1].Data, text) {
+		T.Fatalf("expected zlib data at offset %v decoding to %q, got %v", len(text)*2+1, text, decoded[1])
+	}
+}
+
+func TestDecodeDataDropsOversizedStreams(T *testing.T) {
+	gzipped := &bytes.Buffer{}
+	gz := gzip.NewWriter(gzipped)
+	gz.Write(make([]byte, maxDecompressedLen+1))
+	gz.Close()
+
+	for _, d := range DecodeData(gzipped.Bytes()) {
+		if d.Encoding == "gzip" {
+			T.Fatalf("expected a stream that decompresses past the limit to be dropped, got %v bytes", len(d.Data))
+		}
+	}
+}
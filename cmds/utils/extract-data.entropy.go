@@ -0,0 +1,265 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+)
+
+type (
+	DataClass int
+
+	// DataRegion is a run of data that was all classified the same way.
+	DataRegion struct {
+		Class     DataClass
+		Offset    uint64
+		Length    uint64
+		Entropy   float64 // in bits per byte
+		ChiSquare float64 // against a uniform distribution of byte values
+	}
+
+	DataRegions []DataRegion
+)
+
+const (
+	DataClassStructured DataClass = iota
+	DataClassText
+	DataClassRandom
+	DataClassPadding
+)
+
+const (
+	// DefaultEntropyWindowSize is the size of the windows ClassifyDataRegions slides over the data, and the
+	// step is a quarter of it.
+	DefaultEntropyWindowSize = 256
+
+	// data shorter than this isn't classified, since a handful of bytes always looks random
+	minClassifiedDataLen = 32
+
+	// text and random regions shorter than this don't count as a detection
+	minInterestingRegionLen = 64
+
+	// a window is text if at least this fraction of it is printable ASCII
+	textByteFraction = 0.9
+
+	// a window is padding if a single byte value makes up at least this fraction of it
+	paddingByteFraction = 0.9
+
+	// data shorter than this never looks compressed or encrypted.  Shorter high-entropy blobs are
+	// everywhere (signatures, pubkeys, hashes), so a full default window is needed before it means anything.
+	minRandomDataLen = DefaultEntropyWindowSize
+
+	// a window looks compressed or encrypted if its entropy is at least this fraction of 8 bits per byte...
+	randomEntropyFraction = 0.85
+
+	// ...and its chi-square statistic is below this.  Uniformly random data has a mean of 255 and a standard
+	// deviation of about 22.6.
+	randomChiSquareMax = 350
+)
+
+func (c DataClass) String() string {
+	switch c {
+	case DataClassText:
+		return "text"
+	case DataClassRandom:
+		return "compressed or encrypted"
+	case DataClassPadding:
+		return "padding"
+	default:
+		return "structured"
+	}
+}
+
+// ShannonEntropy returns the entropy of data in bits per byte (from 0 to 8).
+func ShannonEntropy(data []byte) float64 {
+	return entropyOfHistogram(byteHistogram(data), len(data))
+}
+
+// ChiSquare returns the chi-square statistic of data's byte values against a uniform distribution.
+func ChiSquare(data []byte) float64 {
+	return chiSquareOfHistogram(byteHistogram(data), len(data))
+}
+
+// ClassifyData classifies data as a whole.
+func ClassifyData(data []byte) DataClass {
+	return classifyHistogram(byteHistogram(data), len(data))
+}
+
+// ClassifyDataRegions slides a window of windowSize bytes over data (0 means DefaultEntropyWindowSize),
+// classifies each one, and merges neighbouring windows of the same class into regions.
+func ClassifyDataRegions(data []byte, windowSize int) DataRegions {
+	if len(data) < minClassifiedDataLen {
+		return nil
+	}
+	if windowSize <= 0 {
+		windowSize = DefaultEntropyWindowSize
+	}
+	if windowSize > len(data) {
+		windowSize = len(data)
+	}
+	step := windowSize / 4
+	if step == 0 {
+		step = 1
+	}
+
+	// each window decides the class of the step-sized chunk at its start, and the last window decides
+	// the class of everything after that
+	regions := DataRegions{}
+	for start := 0; start < len(data); start += step {
+		end := start + windowSize
+		chunkEnd := start + step
+		if end >= len(data) {
+			start = len(data) - windowSize
+			end = len(data)
+			chunkEnd = len(data)
+		}
+
+		class := ClassifyData(data[start:end])
+
+		if len(regions) > 0 && regions[len(regions)-1].Class == class {
+			regions[len(regions)-1].Length = uint64(chunkEnd) - regions[len(regions)-1].Offset
+		} else {
+			offset := uint64(start)
+			if len(regions) > 0 {
+				last := regions[len(regions)-1]
+				offset = last.Offset + last.Length
+			}
+			regions = append(regions, DataRegion{Class: class, Offset: offset, Length: uint64(chunkEnd) - offset})
+		}
+
+		if end == len(data) {
+			break
+		}
+	}
+
+	regions = absorbShortRegions(regions, uint64(windowSize))
+
+	for i := range regions {
+		regionData := data[regions[i].Offset : regions[i].Offset+regions[i].Length]
+		regions[i].Entropy = ShannonEntropy(regionData)
+		regions[i].ChiSquare = ChiSquare(regionData)
+	}
+	return regions
+}
+
+// absorbShortRegions splits regions shorter than a window between their neighbours.  They come from windows
+// straddling the boundary between two different kinds of data, which usually don't look like either.
+func absorbShortRegions(regions DataRegions, minLen uint64) DataRegions {
+	for i := 0; i < len(regions) && len(regions) > 1; {
+		r := regions[i]
+		if r.Length >= minLen {
+			i++
+			continue
+		}
+
+		if i == 0 {
+			regions[1].Offset = r.Offset
+			regions[1].Length += r.Length
+		} else if i == len(regions)-1 {
+			regions[i-1].Length += r.Length
+		} else {
+			half := r.Length / 2
+			regions[i-1].Length += half
+			regions[i+1].Offset -= r.Length - half
+			regions[i+1].Length += r.Length - half
+		}
+		regions = append(regions[:i], regions[i+1:]...)
+
+		// the neighbours may now be the same kind of region
+		if i > 0 && i < len(regions) && regions[i-1].Class == regions[i].Class {
+			regions[i-1].Length += regions[i].Length
+			regions = append(regions[:i], regions[i+1:]...)
+		}
+		if i > 0 {
+			i--
+		}
+	}
+	return regions
+}
+
+func (r DataRegion) Description() string {
+	return fmt.Sprintf("%v [offset %d, %d bytes, entropy %.2f, chi-square %.1f]", r.Class, r.Offset, r.Length, r.Entropy, r.ChiSquare)
+}
+
+// IsEmpty returns true unless there's a text or random-looking region long enough to be worth a look.
+func (rs DataRegions) IsEmpty() bool {
+	for _, r := range rs {
+		if (r.Class == DataClassText || r.Class == DataClassRandom) && r.Length >= minInterestingRegionLen {
+			return false
+		}
+	}
+	return true
+}
+
+func (rs DataRegions) DescriptionStrings() []string {
+	strs := make([]string, len(rs))
+	for i, r := range rs {
+		strs[i] = r.Description()
+	}
+	return strs
+}
+
+func byteHistogram(data []byte) [256]int {
+	var hist [256]int
+	for _, b := range data {
+		hist[b]++
+	}
+	return hist
+}
+
+func entropyOfHistogram(hist [256]int, n int) float64 {
+	if n == 0 {
+		return 0
+	}
+
+	var e float64
+	for _, count := range hist {
+		if count > 0 {
+			p := float64(count) / float64(n)
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
+
+func chiSquareOfHistogram(hist [256]int, n int) float64 {
+	if n == 0 {
+		return 0
+	}
+
+	expected := float64(n) / 256
+	var chi float64
+	for _, count := range hist {
+		d := float64(count) - expected
+		chi += d * d / expected
+	}
+	return chi
+}
+
+func classifyHistogram(hist [256]int, n int) DataClass {
+	if n == 0 {
+		return DataClassPadding
+	}
+
+	maxCount, textCount := 0, 0
+	for b, count := range hist {
+		if count > maxCount {
+			maxCount = count
+		}
+		if isValidPlaintextByte(byte(b)) {
+			textCount += count
+		}
+	}
+
+	switch {
+	case float64(maxCount) >= paddingByteFraction*float64(n):
+		return DataClassPadding
+	case float64(textCount) >= textByteFraction*float64(n):
+		return DataClassText
+	}
+
+	if n >= minRandomDataLen && entropyOfHistogram(hist, n) >= randomEntropyFraction*8 &&
+		chiSquareOfHistogram(hist, n) < randomChiSquareMax {
+		return DataClassRandom
+	}
+	return DataClassStructured
+}
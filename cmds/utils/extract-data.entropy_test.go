@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestClassifyDataRegions(T *testing.T) {
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 23)[:1024]
+	random := make([]byte, 2048)
+	rand.New(rand.NewSource(1)).Read(random)
+	padding := make([]byte, 1024)
+
+	data := append(append(append([]byte{}, text...), random...), padding...)
+
+	regions := ClassifyDataRegions(data, 0)
+	if len(regions) != 3 {
+		T.Fatalf("expected 3 regions, got %v", regions.DescriptionStrings())
+	}
+
+	expected := []DataClass{DataClassText, DataClassRandom, DataClassPadding}
+	for i, r := range regions {
+		if r.Class != expected[i] {
+			T.Fatalf("expected region %v to be %v, got %v", i, expected[i], r.Description())
+		}
+
+		// region boundaries are only as precise as the window step
+		boundary := uint64(1024 * (i + i/2))
+		if r.Offset+DefaultEntropyWindowSize < boundary || r.Offset > boundary+DefaultEntropyWindowSize {
+			T.Fatalf("region %v is too far from offset %v: %v", i, boundary, r.Description())
+		}
+	}
+
+	if regions[1].Entropy < 7.5 {
+		T.Fatalf("expected random data to have high entropy, got %v", regions[1].Description())
+	} else if chi := ChiSquare(random); chi > randomChiSquareMax {
+		T.Fatalf("expected random data to have a low chi-square, got %v", chi)
+	} else if regions.IsEmpty() {
+		T.Fatal("expected the result not to be empty")
+	}
+
+	if !ClassifyDataRegions(padding, 0).IsEmpty() {
+		T.Fatal("expected padding alone not to count as a detection")
+	}
+}
+
+func TestClassifyDataRegionsIgnoresShortRandomData(T *testing.T) {
+	// the size of a P2PKH input's signature and pubkey
+	sigAndPubkey := make([]byte, 107)
+	rand.New(rand.NewSource(2)).Read(sigAndPubkey)
+
+	regions := ClassifyDataRegions(sigAndPubkey, 0)
+	if !regions.IsEmpty() {
+		T.Fatalf("expected a signature-sized blob not to count as a detection, got %v", regions.DescriptionStrings())
+	}
+
+	// nor do a few concatenated hash160s
+	hashes := make([]byte, 5*20)
+	rand.New(rand.NewSource(3)).Read(hashes)
+	if !ClassifyDataRegions(hashes, 0).IsEmpty() {
+		T.Fatal("expected concatenated hashes not to count as a detection")
+	}
+
+	random := make([]byte, DefaultEntropyWindowSize)
+	rand.New(rand.NewSource(4)).Read(random)
+	if ClassifyData(random) != DataClassRandom {
+		T.Fatal("expected a full window of random data to look compressed or encrypted")
+	}
+}
@@ -1,34 +1,84 @@
 package utils
 
 import (
+	"bufio"
 	"bytes"
-	// "encoding/hex"
+	"encoding/hex"
 	"fmt"
-	// "io/ioutil"
-	// "strings"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 type (
+	// MagicBytesDef is a file signature (see file-signatures.txt for the file format).
 	MagicBytesDef struct {
-		Filetype  string
-		MagicData []byte
+		Filetype string
+
+		Header       BytePattern
+		HeaderOffset uint64 // how far into the file the header is
+		Footer       BytePattern
+		Trailer      uint64 // how many bytes after the footer still belong to the file
+		Length       []LengthTerm
+		MaxSize      uint64
+
+		// if this is empty, matches are only reported, not carved
+		Extension string
 	}
 
+	// BytePattern is a byte string where the bytes whose Wildcard entry is set match any byte.
+	BytePattern struct {
+		Bytes    []byte
+		Wildcard []bool
+	}
+
+	// LengthTerm is a constant (if Size is 0) or an unsigned field of Size bytes at Offset in the file.
+	LengthTerm struct {
+		Offset    uint64
+		Size      int
+		BigEndian bool
+		Constant  uint64
+	}
+
+	FileSignatures []MagicBytesDef
+
 	FoundMagicBytes struct {
-		Filetype string
-		Reversed bool
-		Offset   uint64
+		Filetype  string
+		Extension string // set if the signature is for a file type that can be carved
+		Footer    bool
+		Reversed  bool
+		Offset    uint64
+
+		// the file carved from the data, for headers of carvable signatures
+		Carved *CarvedFile
 	}
 
 	MagicBytesResult []FoundMagicBytes
 )
 
+// DefaultFileSignaturesPath is where the signatures used by SearchDataForMagicFileBytes are loaded from.  It
+// can be changed before the first search.
+var DefaultFileSignaturesPath = "file-signatures.txt"
+
 func (f FoundMagicBytes) Description() string {
+	name := f.Filetype
+	if f.Footer {
+		name += " footer"
+	} else if f.Extension != "" {
+		name += " header"
+	}
 	if f.Reversed {
-		return fmt.Sprintf("%s (reversed) [offset %d]", f.Filetype, f.Offset)
-	} else {
-		return fmt.Sprintf("%s [offset %d]", f.Filetype, f.Offset)
+		name += " (reversed)"
+	}
+
+	if f.Carved == nil {
+		return fmt.Sprintf("%s [offset %d]", name, f.Offset)
+	} else if f.Carved.Truncated {
+		return fmt.Sprintf("%s [offset %d, carved %d bytes, truncated]", name, f.Offset, len(f.Carved.Data))
 	}
+	return fmt.Sprintf("%s [offset %d, carved %d bytes]", name, f.Offset, len(f.Carved.Data))
 }
 
 func (m MagicBytesResult) IsEmpty() bool {
@@ -38,147 +88,353 @@ func (m MagicBytesResult) IsEmpty() bool {
 func (m MagicBytesResult) DescriptionStrings() []string {
 	strs := make([]string, len(m))
 	for i, found := range m {
-		if found.Reversed {
-			strs[i] = fmt.Sprintf("%s (reversed) [offset %d]", found.Filetype, found.Offset)
-		} else {
-			strs[i] = fmt.Sprintf("%s [offset %d]", found.Filetype, found.Offset)
-		}
+		strs[i] = found.Description()
 	}
 	return strs
 }
 
-var magicBytes = []MagicBytesDef{
-	{"DOC Header", []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}},
-	{"DOC Footer", []byte{0x57, 0x6f, 0x72, 0x64, 0x2e, 0x44, 0x6f, 0x63, 0x75, 0x6d, 0x65, 0x6e, 0x74, 0x2e}},
-	{"XLS Header", []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}},
-	{"XLS Footer", []byte{0xfe, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x57, 0x00, 0x6f, 0x00, 0x72, 0x00, 0x6b, 0x00, 0x62, 0x00, 0x6f, 0x00, 0x6f, 0x00, 0x6b, 0x00}},
-	{"PPT Header", []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}},
-	{"PPT Footer", []byte{0xa0, 0x46, 0x1d, 0xf0}},
-	{"ZIP Header", []byte{0x50, 0x4b, 0x03, 0x04}},
-	{"ZIP Footer", []byte{0x50, 0x4b, 0x05, 0x06, 0x00}},
-	{"ZIPLock Footer", []byte{0x50, 0x4b, 0x03, 0x04, 0x14, 0x00, 0x01, 0x00, 0x63, 0x00, 0x00, 0x00, 0x00, 0x00}},
-	{"JPG Header", []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10, 0x4a, 0x46, 0x49, 0x46, 0x00, 0x01, 0x01}},
-	{"GIF Header", []byte{0x47, 0x49, 0x46, 0x38, 0x39, 0x61}},
-	{"GIF Footer", []byte{0x21, 0x00, 0x00, 0x3b, 0x00}},
-	{"PDF Header", []byte{0x25, 0x50, 0x44, 0x46}},
-	{"PDF Header (alternate)", []byte{0x26, 0x23, 0x32, 0x30, 0x35}},
-	{"PDF Footer", []byte{0x25, 0x25, 0x45, 0x4f, 0x46}},
-	{"Torrent Header", []byte{0x61, 0x6e, 0x6e, 0x6f, 0x75, 0x6e, 0x63, 0x65}},
-	{"GZ Header", []byte{0x1f, 0x8b, 0x08, 0x08}},
-	{"TAR Header", []byte{0x1f, 0x8b, 0x08, 0x00}},
-	{"TAR.GZ Header", []byte{0x1f, 0x9d, 0x90, 0x70}},
-	{"EPUB Header", []byte{0x50, 0x4b, 0x03, 0x04, 0x0a, 0x00, 0x02, 0x00}},
-	{"PNG Header", []byte{0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a}},
-	{"8192 Header", []byte{0x6d, 0x51, 0x51, 0x4e, 0x42}},
-	{"4096 Header", []byte{0x6d, 0x51, 0x49, 0x4e, 0x42, 0x46, 0x67, 0x2f}},
-	{"2048 Header", []byte{0x95, 0x2e, 0x3e, 0x2e, 0x58, 0x4b, 0x7a}},
-	{"Secret Header", []byte{0x52, 0x61, 0x72, 0x21, 0x1a, 0x07, 0x00}},
-	{"RAR Header", []byte{0x6d, 0x51, 0x45, 0x4e, 0x42, 0x46, 0x67}},
-	{"OGG Header", []byte{0x4f, 0x67, 0x67, 0x53}},
-	{"WAV Header", []byte{0x42, 0x49, 0x46, 0x46}},
-	{"WAV Header (alternate)", []byte{0x57, 0x41, 0x56, 0x45}},
-	{"AVI Header", []byte{0x42, 0x49, 0x46, 0x46}},
-	{"AVI Header (alternate)", []byte{0x41, 0x56, 0x49, 0x20}},
-	{"MIDI Header", []byte{0x4d, 0x54, 0x68, 0x64}},
-	{"7z Header", []byte{0x37, 0x7a, 0xbc, 0xaf, 0x27, 0x1c}},
-	{"7z Footer", []byte{0x00, 0x00, 0x00, 0x17, 0x06}},
-	{"DMG Header", []byte{0x78, 0x01, 0x73, 0x0d, 0x62, 0x62, 0x60}},
-	{"Wikileaks", []byte{0x57, 0x69, 0x6b, 0x69, 0x6c, 0x65, 0x61, 0x6b, 0x73}},
-	{"Julian Assange", []byte{0x4a, 0x75, 0x6c, 0x69, 0x61, 0x6e, 0x20, 0x41, 0x73, 0x73, 0x61, 0x6e, 0x67, 0x65}},
-	{"Mendax", []byte{0x4d, 0x65, 0x6e, 0x64, 0x61, 0x7}},
-	{"Peter Todd OTS hello world", []byte{0x1d, 0xf8, 0x85, 0x9e, 0x60, 0xbc, 0x67, 0x95, 0x03, 0xd1, 0x6d, 0xcb, 0x87, 0x0e, 0x6c, 0xe9, 0x1a, 0x57, 0xe9, 0xdf}},
-
-	{"OpenTimestamps", []byte("OpenTimestamps")},
-	{"PGP header (BEGIN)", []byte("BEGIN PGP")},
-	{"PGP header (END)", []byte("END PGP")},
-	{"PGP", []byte("PGP")},
-	{"PUBLIC KEY", []byte("PUBLIC KEY")},
-	{"public key", []byte("public key")},
-	{"private key", []byte("private key")},
-	{"BEGIN", []byte("BEGIN")},
-	{"END", []byte("END")},
-}
-
-var wlRipemd160SHA256Hashes = []MagicBytesDef{}
-
-// func init() {
-// 	data, err := ioutil.ReadFile("./wlhashes/ripemd160-sha256-hashes.txt")
-// 	if err != nil {
-// 		panic(err)
-// 	}
-
-// 	lines := strings.Split(string(data), "\n")
-// 	for _, line := range lines {
-// 		line = strings.TrimSpace(line)
-// 		parts := strings.Split(line, "  ")
-// 		if len(parts) != 2 {
-// 			panic(fmt.Sprintf("len(parts) = %v: %v", len(parts), line))
-// 		}
-// 		digestHex, filename := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
-
-// 		digestBytes, err := hex.DecodeString(digestHex)
-// 		if err != nil {
-// 			panic(err)
-// 		}
-
-// 		wlRipemd160SHA256Hashes = append(wlRipemd160SHA256Hashes, MagicBytesDef{filename + " (ripemd160 + sha256 digest)", digestBytes})
-// 	}
-// }
+// CarvedFiles returns the files carved from the data.
+func (m MagicBytesResult) CarvedFiles() []CarvedFile {
+	carved := []CarvedFile{}
+	for _, found := range m {
+		if found.Carved != nil {
+			carved = append(carved, *found.Carved)
+		}
+	}
+	return carved
+}
+
+var (
+	defaultFileSignatures     FileSignatures
+	defaultFileSignaturesOnce sync.Once
+)
+
+// DefaultFileSignatures loads DefaultFileSignaturesPath the first time it's needed.  Commands aren't always
+// run from the directory containing it, so if it's missing no signatures are found.
+func DefaultFileSignatures() FileSignatures {
+	defaultFileSignaturesOnce.Do(func() {
+		sigs, err := LoadFileSignatures(DefaultFileSignaturesPath)
+		if os.IsNotExist(err) {
+			fmt.Printf("warning: %v not found, so file headers won't be detected\n", DefaultFileSignaturesPath)
+		} else if err != nil {
+			fmt.Printf("warning: can't load file signatures: %v\n", err)
+		}
+		defaultFileSignatures = sigs
+	})
+	return defaultFileSignatures
+}
 
+// SearchDataForMagicFileBytes searches data for DefaultFileSignatures.
 func SearchDataForMagicFileBytes(data []byte) MagicBytesResult {
+	return DefaultFileSignatures().Search(data)
+}
+
+// Search reports every occurrence of each signature's header and footer in data, both as-is and
+// byte-reversed, and carves the files that carvable headers start.
+func (sigs FileSignatures) Search(data []byte) MagicBytesResult {
 	if data == nil {
 		return nil
 	}
 
-	chMatches := make(chan MagicBytesResult)
-	go func() {
-		matches := MagicBytesResult{}
-		for _, def := range magicBytes {
-			if idx := bytes.Index(data, def.MagicData); idx > -1 {
-				matches = append(matches, FoundMagicBytes{Filetype: def.Filetype, Reversed: false, Offset: uint64(idx)})
-			}
-		}
-		chMatches <- matches
-	}()
-
 	chMatchesReversed := make(chan MagicBytesResult)
 	go func() {
+		reversed := ReverseBytes(data)
 		matches := MagicBytesResult{}
-		for _, def := range magicBytes {
-			if idx := bytes.Index(data, ReverseBytes(def.MagicData)); idx > -1 {
-				matches = append(matches, FoundMagicBytes{Filetype: def.Filetype, Reversed: true, Offset: uint64(idx)})
-			}
+		for _, def := range sigs {
+			matches = append(matches, def.search(reversed, true)...)
 		}
 		chMatchesReversed <- matches
 	}()
 
-	chRipemd160SHA256 := make(chan MagicBytesResult)
-	go func() {
-		matches := MagicBytesResult{}
-		for _, def := range wlRipemd160SHA256Hashes {
-			if idx := bytes.Index(data, def.MagicData); idx > -1 {
-				matches = append(matches, FoundMagicBytes{Filetype: def.Filetype, Reversed: false, Offset: uint64(idx)})
-			}
+	matches := MagicBytesResult{}
+	for _, def := range sigs {
+		matches = append(matches, def.search(data, false)...)
+	}
+	matches = append(matches, <-chMatchesReversed...)
+
+	return matches
+}
+
+// search finds def in data, which is the reverse of the data being searched if reversed is set.  Offsets
+// are reported in the original data.
+func (def MagicBytesDef) search(data []byte, reversed bool) MagicBytesResult {
+	originalOffset := func(idx, length int) uint64 {
+		if reversed {
+			return uint64(len(data) - idx - length)
 		}
-		chRipemd160SHA256 <- matches
-	}()
+		return uint64(idx)
+	}
 
-	chRipemd160SHA256Reversed := make(chan MagicBytesResult)
-	go func() {
-		matches := MagicBytesResult{}
-		for _, def := range wlRipemd160SHA256Hashes {
-			if idx := bytes.Index(data, ReverseBytes(def.MagicData)); idx > -1 {
-				matches = append(matches, FoundMagicBytes{Filetype: def.Filetype, Reversed: true, Offset: uint64(idx)})
+	matches := MagicBytesResult{}
+	if reversed && def.Header.isPalindrome() {
+		// every reversed match would just be a forward match again
+		return matches
+	}
+
+	for _, idx := range def.Header.FindAll(data) {
+		found := FoundMagicBytes{Filetype: def.Filetype, Extension: def.Extension, Reversed: reversed, Offset: originalOffset(idx, len(def.Header.Bytes))}
+		if def.Extension != "" && uint64(idx) >= def.HeaderOffset {
+			found.Carved = def.carve(data, idx-int(def.HeaderOffset))
+			if found.Carved != nil {
+				found.Carved.Offset = found.Offset
+				found.Carved.Reversed = reversed
 			}
 		}
-		chRipemd160SHA256Reversed <- matches
-	}()
+		matches = append(matches, found)
+	}
 
-	matches := MagicBytesResult{}
-	matches = append(matches, <-chMatches...)
-	matches = append(matches, <-chMatchesReversed...)
-	matches = append(matches, <-chRipemd160SHA256...)
-	matches = append(matches, <-chRipemd160SHA256Reversed...)
+	if len(def.Footer.Bytes) > 0 {
+		for _, idx := range def.Footer.FindAll(data) {
+			matches = append(matches, FoundMagicBytes{Filetype: def.Filetype, Extension: def.Extension, Footer: true, Reversed: reversed, Offset: originalOffset(idx, len(def.Footer.Bytes))})
+		}
+	}
 
 	return matches
 }
+
+// LoadFileSignatures reads a signature file (see file-signatures.txt for the format).
+func LoadFileSignatures(filename string) (FileSignatures, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sigs, err := ParseFileSignatures(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return sigs, nil
+}
+
+func ParseFileSignatures(r io.Reader) (FileSignatures, error) {
+	sigs := FileSignatures{}
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		def, err := parseFileSignature(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		sigs = append(sigs, def)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sigs, nil
+}
+
+func parseFileSignature(line string) (MagicBytesDef, error) {
+	fields, err := splitSignatureFields(line)
+	if err != nil {
+		return MagicBytesDef{}, err
+	}
+
+	def := MagicBytesDef{Filetype: strings.Replace(fields[0], `"`, "", -1)}
+	for _, field := range fields[1:] {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return MagicBytesDef{}, fmt.Errorf("expected key=value, got '%v'", field)
+		}
+		key, value := parts[0], parts[1]
+
+		switch key {
+		case "header":
+			def.Header, err = ParseBytePattern(value)
+		case "footer":
+			def.Footer, err = ParseBytePattern(value)
+		case "offset":
+			def.HeaderOffset, err = strconv.ParseUint(value, 10, 64)
+		case "trailer":
+			def.Trailer, err = strconv.ParseUint(value, 10, 64)
+		case "max":
+			def.MaxSize, err = parseSize(value)
+		case "length":
+			def.Length, err = parseLengthTerms(value)
+		case "ext":
+			def.Extension = value
+		default:
+			err = fmt.Errorf("unknown setting '%v'", key)
+		}
+		if err != nil {
+			return MagicBytesDef{}, fmt.Errorf("%v: %v", def.Filetype, err)
+		}
+	}
+
+	if len(def.Header.Bytes) == 0 {
+		return MagicBytesDef{}, fmt.Errorf("%v: no header", def.Filetype)
+	} else if def.Extension != "" && len(def.Footer.Bytes) == 0 && len(def.Length) == 0 && def.MaxSize == 0 {
+		return MagicBytesDef{}, fmt.Errorf("%v: carvable signatures need a footer, length or max", def.Filetype)
+	}
+	return def, nil
+}
+
+// splitSignatureFields splits a line on whitespace, except inside double quotes.
+func splitSignatureFields(line string) ([]string, error) {
+	fields := []string{}
+	field := []byte{}
+	inField, inQuotes := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+			field = append(field, c)
+			inField = true
+		case !inQuotes && (c == ' ' || c == '\t'):
+			if inField {
+				fields = append(fields, string(field))
+				field, inField = []byte{}, false
+			}
+		default:
+			field = append(field, c)
+			inField = true
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inField {
+		fields = append(fields, string(field))
+	}
+	return fields, nil
+}
+
+// ParseBytePattern parses a double-quoted string, or hex where "??" matches any byte.
+func ParseBytePattern(str string) (BytePattern, error) {
+	if len(str) >= 2 && str[0] == '"' && str[len(str)-1] == '"' {
+		literal := str[1 : len(str)-1]
+		return BytePattern{Bytes: []byte(literal), Wildcard: make([]bool, len(literal))}, nil
+	}
+
+	if len(str)%2 != 0 {
+		return BytePattern{}, fmt.Errorf("pattern '%v' is neither quoted nor hex", str)
+	}
+	p := BytePattern{}
+	for i := 0; i < len(str); i += 2 {
+		if str[i:i+2] == "??" {
+			p.Bytes = append(p.Bytes, 0)
+			p.Wildcard = append(p.Wildcard, true)
+			continue
+		}
+		b, err := hex.DecodeString(str[i : i+2])
+		if err != nil {
+			return BytePattern{}, fmt.Errorf("pattern '%v' is neither quoted nor hex", str)
+		}
+		p.Bytes = append(p.Bytes, b[0])
+		p.Wildcard = append(p.Wildcard, false)
+	}
+	if len(p.Bytes) > 0 && p.Wildcard[0] {
+		return BytePattern{}, fmt.Errorf("pattern '%v' can't start with a wildcard", str)
+	}
+	return p, nil
+}
+
+// FindAll returns the offset of every occurrence of the pattern in data, including overlapping ones.
+func (p BytePattern) FindAll(data []byte) []int {
+	if len(p.Bytes) == 0 {
+		return nil
+	}
+
+	// the literal bytes before the first wildcard are searched for, and the rest is checked at each hit
+	prefixLen := len(p.Bytes)
+	for i, wild := range p.Wildcard {
+		if wild {
+			prefixLen = i
+			break
+		}
+	}
+	prefix := p.Bytes[:prefixLen]
+
+	found := []int{}
+	for start := 0; start+len(p.Bytes) <= len(data); {
+		idx := bytes.Index(data[start:], prefix)
+		if idx < 0 {
+			break
+		}
+		idx += start
+		if idx+len(p.Bytes) <= len(data) && p.matchAt(data, idx) {
+			found = append(found, idx)
+		}
+		start = idx + 1
+	}
+	return found
+}
+
+func (p BytePattern) isPalindrome() bool {
+	for i, j := 0, len(p.Bytes)-1; i < j; i, j = i+1, j-1 {
+		if p.Bytes[i] != p.Bytes[j] || p.Wildcard[i] != p.Wildcard[j] {
+			return false
+		}
+	}
+	return true
+}
+
+func (p BytePattern) matchAt(data []byte, idx int) bool {
+	for i, b := range p.Bytes {
+		if !p.Wildcard[i] && data[idx+i] != b {
+			return false
+		}
+	}
+	return true
+}
+
+func parseSize(str string) (uint64, error) {
+	multiplier := uint64(1)
+	switch {
+	case strings.HasSuffix(str, "k"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(str, "m"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(str, "g"):
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		str = str[:len(str)-1]
+	}
+
+	n, err := strconv.ParseUint(str, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * multiplier, nil
+}
+
+var lengthFieldTypes = map[string]LengthTerm{
+	"u8":    {Size: 1},
+	"u16le": {Size: 2},
+	"u16be": {Size: 2, BigEndian: true},
+	"u32le": {Size: 4},
+	"u32be": {Size: 4, BigEndian: true},
+	"u64le": {Size: 8},
+	"u64be": {Size: 8, BigEndian: true},
+}
+
+func parseLengthTerms(str string) ([]LengthTerm, error) {
+	terms := []LengthTerm{}
+	for _, termStr := range strings.Split(str, "+") {
+		parts := strings.SplitN(termStr, ":", 2)
+		offset, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad length term '%v'", termStr)
+		}
+
+		if len(parts) == 1 {
+			terms = append(terms, LengthTerm{Constant: offset})
+			continue
+		}
+
+		term, ok := lengthFieldTypes[parts[1]]
+		if !ok {
+			return nil, fmt.Errorf("bad length field type '%v'", parts[1])
+		}
+		term.Offset = offset
+		terms = append(terms, term)
+	}
+	return terms, nil
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSignatures(T *testing.T) {
+	// the signatures shipped with the repo must parse
+	if _, err := LoadFileSignatures(filepath.Join("..", "..", DefaultFileSignaturesPath)); err != nil {
+		T.Fatal(err)
+	}
+
+	sigs, err := ParseFileSignatures(strings.NewReader(`
+# test signatures
+jpg header=ffd8ff footer=ffd9 max=1k ext=jpg
+wav header=52494646????????57415645 length=4:u32le+8 max=1m ext=wav
+"my name" header="Mendax"
+`))
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	jpg := append([]byte{0xff, 0xd8, 0xff, 0xe0}, bytes.Repeat([]byte{0x11}, 20)...)
+	jpg = append(jpg, 0xff, 0xd9)
+
+	wav := append([]byte("RIFF\x00\x00\x00\x00WAVE"), bytes.Repeat([]byte{0x22}, 28)...)
+	binary.LittleEndian.PutUint32(wav[4:], uint32(len(wav)-8))
+
+	data := []byte("Mendax..")
+	data = append(data, jpg...)
+	data = append(data, "..Mendax.."...)
+	data = append(data, ReverseBytes(wav)...)
+	data = append(data, wav[:20]...)
+
+	result := sigs.Search(data)
+	descriptions := strings.Join(result.DescriptionStrings(), "\n")
+	expected := strings.Join([]string{
+		"jpg header [offset 8, carved 26 bytes]",
+		"jpg footer [offset 32]",
+		"wav header [offset 84, carved 20 bytes, truncated]",
+		"my name [offset 0]",
+		"my name [offset 36]",
+		"wav header (reversed) [offset 72, carved 40 bytes]",
+	}, "\n")
+	if descriptions != expected {
+		T.Fatalf("expected:\n%v\ngot:\n%v", expected, descriptions)
+	}
+
+	carved := result.CarvedFiles()
+	if len(carved) != 3 || !bytes.Equal(carved[0].Data, jpg) || !bytes.Equal(carved[2].Data, wav) {
+		T.Fatalf("unexpected carved files: %+v", carved)
+	}
+	if carved[0].Filename() != "jpg-8.jpg" || carved[1].Filename() != "wav-84-truncated.wav" || carved[2].Filename() != "wav-72-reversed.wav" {
+		T.Fatalf("unexpected filenames: %v, %v, %v", carved[0].Filename(), carved[1].Filename(), carved[2].Filename())
+	}
+}
@@ -14,18 +14,30 @@ import (
 	// "github.com/btcsuite/btcutil"
 )
 
-func GetSatoshiEncodedData(data []byte) ([]byte, error) {
-	if len(data) < 8 {
-		return nil, fmt.Errorf("GetSatoshiEncodedData: not enough data")
+// SatoshiHeaderLen is the length of the Satoshi uploader's header: the length of the file and its CRC32,
+// both as little-endian uint32s.
+const SatoshiHeaderLen = 8
+
+// ParseSatoshiHeader reads the Satoshi uploader's header from the start of data.  It returns false if data is
+// too short or declares an empty file.
+func ParseSatoshiHeader(data []byte) (length uint32, checksum uint32, ok bool) {
+	if len(data) < SatoshiHeaderLen {
+		return 0, 0, false
 	}
 
-	length := binary.LittleEndian.Uint32(data[0:4])
-	checksum := binary.LittleEndian.Uint32(data[4:8])
-	if len(data) < 8+int(length) {
+	length = binary.LittleEndian.Uint32(data[0:4])
+	checksum = binary.LittleEndian.Uint32(data[4:8])
+	return length, checksum, length > 0
+}
+
+// GetSatoshiEncodedData decodes a file uploaded with the Satoshi uploader, if data holds the whole of one.
+func GetSatoshiEncodedData(data []byte) ([]byte, error) {
+	length, checksum, ok := ParseSatoshiHeader(data)
+	if !ok || len(data) < SatoshiHeaderLen+int(length) {
 		return nil, fmt.Errorf("GetSatoshiEncodedData: not enough data")
 	}
 
-	data = data[8 : 8+length]
+	data = data[SatoshiHeaderLen : SatoshiHeaderLen+int(length)]
 
 	if crc32.ChecksumIEEE(data) != checksum {
 		return nil, fmt.Errorf("GetSatoshiEncodedData: crc32 failed")
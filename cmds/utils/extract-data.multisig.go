@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// MultisigOutput is a bare m-of-n multisig output script ("OP_m <pubkey>... OP_n OP_CHECKMULTISIG").  Data is
+// often hidden in 1-of-n outputs whose other "pubkeys" are really payload, since only one key has to work.
+type MultisigOutput struct {
+	Required int
+	Keys     []MultisigKey
+}
+
+type MultisigKey struct {
+	Data []byte // as pushed, including the prefix byte
+
+	// set if the key is a point on secp256k1.  A fake key made of data almost never is (except that about
+	// half of all compressed keys are, whatever they contain).
+	Valid bool
+}
+
+// the sizes of compressed and uncompressed pubkeys, which are the only pushes Bitcoin Core's multisig
+// template accepted
+const (
+	minMultisigKeyLen = 33
+	maxMultisigKeyLen = 65
+)
+
+// ParseMultisigOutput parses a bare multisig output script, and checks each of its keys.  It returns false if
+// the script isn't one.
+func ParseMultisigOutput(script []byte) (MultisigOutput, bool) {
+	if len(script) < 3 || !isSmallIntOpcode(script[0]) || script[len(script)-1] != txscript.OP_CHECKMULTISIG {
+		return MultisigOutput{}, false
+	}
+
+	m := MultisigOutput{Required: int(script[0]-txscript.OP_1) + 1}
+	keys := script[1 : len(script)-2]
+	for len(keys) > 0 {
+		pushLen := int(keys[0])
+		if pushLen < minMultisigKeyLen || pushLen > maxMultisigKeyLen || len(keys) < 1+pushLen {
+			return MultisigOutput{}, false
+		}
+
+		data := keys[1 : 1+pushLen]
+		_, err := btcec.ParsePubKey(data, btcec.S256())
+		m.Keys = append(m.Keys, MultisigKey{Data: data, Valid: err == nil})
+		keys = keys[1+pushLen:]
+	}
+
+	n := script[len(script)-2]
+	if !isSmallIntOpcode(n) || int(n-txscript.OP_1)+1 != len(m.Keys) || m.Required > len(m.Keys) {
+		return MultisigOutput{}, false
+	}
+	return m, true
+}
+
+func isSmallIntOpcode(op byte) bool {
+	return op >= txscript.OP_1 && op <= txscript.OP_16
+}
+
+// FakeKeys returns the keys that aren't points on secp256k1.
+func (m MultisigOutput) FakeKeys() []MultisigKey {
+	fake := []MultisigKey{}
+	for _, k := range m.Keys {
+		if !k.Valid {
+			fake = append(fake, k)
+		}
+	}
+	return fake
+}
+
+// FakeKeyData concatenates the payloads of the fake keys.
+func (m MultisigOutput) FakeKeyData() []byte {
+	data := []byte{}
+	for _, k := range m.FakeKeys() {
+		data = append(data, k.Payload()...)
+	}
+	return data
+}
+
+// Payload returns the key's data without its prefix byte.  Uploaders give fake keys a real prefix (0x02 or
+// 0x03 for 33-byte keys, 0x04, 0x06 or 0x07 for 65-byte ones) so that they're relayed, so that byte is only
+// stripped if it's the right prefix for the key's size.  Otherwise it's part of the payload.
+func (k MultisigKey) Payload() []byte {
+	switch {
+	case len(k.Data) == 33 && (k.Data[0] == 0x02 || k.Data[0] == 0x03):
+		return k.Data[1:]
+	case len(k.Data) == 65 && (k.Data[0] == 0x04 || k.Data[0] == 0x06 || k.Data[0] == 0x07):
+		return k.Data[1:]
+	default:
+		return k.Data
+	}
+}
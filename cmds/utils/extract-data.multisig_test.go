@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestParseMultisigOutput(T *testing.T) {
+	_, pub := btcec.PrivKeyFromBytes(btcec.S256(), bytes.Repeat([]byte{1}, 32))
+	realKey := pub.SerializeUncompressed()
+
+	payload1 := []byte("This 64-byte payload is pretending to be an uncompressed pubkey.")
+	payload2 := []byte("and this one is 65 bytes long, with no prefix byte for the parser")
+	fakeKey1 := append([]byte{0x04}, payload1...)
+
+	script, err := txscript.NewScriptBuilder().AddOp(txscript.OP_1).
+		AddData(realKey).AddData(fakeKey1).AddData(payload2).
+		AddOp(txscript.OP_3).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	m, ok := ParseMultisigOutput(script)
+	if !ok {
+		T.Fatal("expected the script to parse as multisig")
+	} else if m.Required != 1 || len(m.Keys) != 3 {
+		T.Fatalf("expected a 1-of-3 multisig, got %v-of-%v", m.Required, len(m.Keys))
+	} else if !m.Keys[0].Valid || m.Keys[1].Valid || m.Keys[2].Valid {
+		T.Fatal("expected only the first key to be valid")
+	}
+
+	expected := append(append([]byte{}, payload1...), payload2...)
+	if !bytes.Equal(m.FakeKeyData(), expected) {
+		T.Fatalf("expected fake key data %q, got %q", expected, m.FakeKeyData())
+	}
+
+	// n doesn't match the number of keys
+	script[len(script)-2] = txscript.OP_2
+	if _, ok := ParseMultisigOutput(script); ok {
+		T.Fatal("expected a script with the wrong key count not to parse")
+	}
+}
@@ -1,41 +1,518 @@
 package utils
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/base64"
 	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"golang.org/x/crypto/openpgp/packet"
 )
 
-type PGPPacketResult struct {
-	Packets []packet.Packet
-}
+type (
+	PGPPacketResult struct {
+		Armor   []PGPArmorBlock
+		Packets []PGPPacket
+	}
+
+	// PGPArmorBlock is an ASCII-armored block ("-----BEGIN PGP ...-----").  Its packets are listed in the
+	// result's Packets with Armored set.
+	PGPArmorBlock struct {
+		Offset uint64
+		Type   string // e.g. "PUBLIC KEY BLOCK"
+
+		// set if the block couldn't be decoded (it's often truncated, or split across txs)
+		Err string
+	}
+
+	PGPPacket struct {
+		// the offset of the packet in the data or, if Armored, in the decoded armor block that starts at
+		// ArmorOffset
+		Offset      uint64
+		Armored     bool
+		ArmorOffset uint64
+
+		Tag  uint8
+		Kind string
+
+		KeyID        string // the key's own ID, or the ID of the key that made a signature or can decrypt a session key
+		Fingerprint  string
+		UserID       string
+		CreationTime time.Time
+
+		// set if the key ID or fingerprint belongs to one of the watched keys
+		Watched bool
+	}
+)
+
+// WatchedPGPFingerprints are always flagged by FindPGPPackets.
+var WatchedPGPFingerprints = []string{WLKeyFingerprint}
 
 func (r PGPPacketResult) IsEmpty() bool {
-	return len(r.Packets) == 0
+	return len(r.Armor) == 0 && len(r.Packets) == 0
 }
 
 func (r PGPPacketResult) DescriptionStrings() []string {
-	strs := make([]string, len(r.Packets))
-	for i, p := range r.Packets {
-		strs[i] = fmt.Sprintf("%T", p)
+	strs := []string{}
+	for _, block := range r.Armor {
+		strs = append(strs, block.Description())
+	}
+	for _, p := range r.Packets {
+		strs = append(strs, p.Description())
 	}
 	return strs
 }
 
-func FindPGPPackets(data []byte) PGPPacketResult {
-	packets := []packet.Packet{}
+func (b PGPArmorBlock) Description() string {
+	if b.Err != "" {
+		return fmt.Sprintf("armored %v (can't decode: %v) [offset %d]", b.Type, b.Err, b.Offset)
+	}
+	return fmt.Sprintf("armored %v [offset %d]", b.Type, b.Offset)
+}
+
+func (p PGPPacket) Description() string {
+	desc := p.Kind
+	if p.UserID != "" {
+		desc += fmt.Sprintf(" %q", p.UserID)
+	}
+	if p.Fingerprint != "" {
+		desc += " fingerprint " + p.Fingerprint
+	} else if p.KeyID != "" {
+		desc += " key ID " + p.KeyID
+	}
+	if !p.CreationTime.IsZero() {
+		desc += " created " + p.CreationTime.UTC().Format("2006-01-02")
+	}
+	if p.Watched {
+		desc += " (WATCHED KEY)"
+	}
+
+	if p.Armored {
+		return fmt.Sprintf("%v [armor offset %d, packet offset %d]", desc, p.ArmorOffset, p.Offset)
+	}
+	return fmt.Sprintf("%v [offset %d]", desc, p.Offset)
+}
+
+// FindPGPPackets finds ASCII-armored PGP blocks and binary OpenPGP packets in data.  Packets involving
+// WatchedPGPFingerprints or watchedFingerprints (hex, spaces are ignored) are flagged.
+//
+// A binary packet is only reported if its header is well-formed and fits in the data, it parses, and it's a
+// kind that can't easily happen by accident (e.g. a key, signature or user ID).  Packets with no structure
+// of their own (e.g. encrypted data) are only reported when they follow one of those.
+func FindPGPPackets(data []byte, watchedFingerprints ...string) PGPPacketResult {
+	watched := newWatchedPGPKeys(append(append([]string{}, WatchedPGPFingerprints...), watchedFingerprints...))
+
+	result := PGPPacketResult{
+		Packets: findBinaryPGPPackets(data, watched),
+	}
+
+	for _, block := range findPGPArmorBlocks(data) {
+		result.Armor = append(result.Armor, block.PGPArmorBlock)
+		for _, p := range findBinaryPGPPackets(block.decoded, watched) {
+			p.Armored = true
+			p.ArmorOffset = block.Offset
+			result.Packets = append(result.Packets, p)
+		}
+	}
+
+	return result
+}
+
+// LoadPGPFingerprints reads a list of key fingerprints, one per line.  Blank lines and lines starting with
+// '#' are ignored.
+func LoadPGPFingerprints(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fingerprints := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fingerprints = append(fingerprints, line)
+	}
+	return fingerprints, scanner.Err()
+}
+
+// watchedPGPKeys holds normalized fingerprints, and the key IDs (the last 16 hex digits) of v4 fingerprints,
+// since signatures and encrypted session keys only name the key ID.
+type watchedPGPKeys map[string]bool
+
+func newWatchedPGPKeys(fingerprints []string) watchedPGPKeys {
+	watched := watchedPGPKeys{}
+	for _, fp := range fingerprints {
+		fp = normalizeFingerprint(fp)
+		watched[fp] = true
+		if len(fp) == 40 {
+			watched[fp[24:]] = true
+		}
+	}
+	return watched
+}
+
+func normalizeFingerprint(fp string) string {
+	return strings.ToUpper(strings.Replace(fp, " ", "", -1))
+}
+
+func (w watchedPGPKeys) isWatched(p PGPPacket) bool {
+	return (p.Fingerprint != "" && w[p.Fingerprint]) || (p.KeyID != "" && w[p.KeyID])
+}
+
+const (
+	pgpTagEncryptedKey              = 1
+	pgpTagSignature                 = 2
+	pgpTagSymmetricKeyEncrypted     = 3
+	pgpTagOnePassSignature          = 4
+	pgpTagPrivateKey                = 5
+	pgpTagPublicKey                 = 6
+	pgpTagPrivateSubkey             = 7
+	pgpTagCompressed                = 8
+	pgpTagSymmetricallyEncrypted    = 9
+	pgpTagLiteralData               = 11
+	pgpTagUserID                    = 13
+	pgpTagPublicSubkey              = 14
+	pgpTagUserAttribute             = 17
+	pgpTagSymmetricallyEncryptedMDC = 18
+)
+
+// the tags of packets that are checked enough when parsed to be reported on their own
+var pgpStandaloneTags = map[uint8]bool{
+	pgpTagEncryptedKey:          true,
+	pgpTagSignature:             true,
+	pgpTagSymmetricKeyEncrypted: true,
+	pgpTagOnePassSignature:      true,
+	pgpTagPrivateKey:            true,
+	pgpTagPublicKey:             true,
+	pgpTagPrivateSubkey:         true,
+	pgpTagUserID:                true,
+	pgpTagPublicSubkey:          true,
+}
+
+// the tags of every packet the openpgp package can parse
+var pgpKnownTags = map[uint8]bool{
+	pgpTagEncryptedKey: true, pgpTagSignature: true, pgpTagSymmetricKeyEncrypted: true, pgpTagOnePassSignature: true,
+	pgpTagPrivateKey: true, pgpTagPublicKey: true, pgpTagPrivateSubkey: true, pgpTagCompressed: true,
+	pgpTagSymmetricallyEncrypted: true, pgpTagLiteralData: true, pgpTagUserID: true, pgpTagPublicSubkey: true,
+	pgpTagUserAttribute: true, pgpTagSymmetricallyEncryptedMDC: true,
+}
+
+// key and signature creation times outside this range mean the bytes only happen to parse
+var (
+	pgpEarliestTime = time.Date(1991, 1, 1, 0, 0, 0, 0, time.UTC)
+	pgpLatestTime   = time.Now().AddDate(1, 0, 0)
+)
+
+func findBinaryPGPPackets(data []byte, watched watchedPGPKeys) []PGPPacket {
+	packets := []PGPPacket{}
+
+	for i := 0; i < len(data); {
+		p, length, ok := parsePGPPacket(data[i:])
+		if !ok || !pgpStandaloneTags[p.Tag] {
+			i++
+			continue
+		}
+
+		// follow the chain of packets for as long as they keep parsing
+		for ok {
+			p.Offset = uint64(i)
+			p.Watched = watched.isWatched(p)
+			packets = append(packets, p)
+
+			i += length
+			p, length, ok = parsePGPPacket(data[i:])
+		}
+	}
+
+	return packets
+}
+
+// parsePGPPacket parses the packet at the start of data, and returns it along with its length (including the
+// header).
+func parsePGPPacket(data []byte) (PGPPacket, int, bool) {
+	tag, length, ok := pgpPacketHeader(data)
+	if !ok || !pgpKnownTags[tag] {
+		return PGPPacket{}, 0, false
+	}
+
+	parsed, err := packet.Read(bytes.NewReader(data[:length]))
+	if err != nil {
+		return PGPPacket{}, 0, false
+	}
+
+	p := PGPPacket{Tag: tag}
+	switch pkt := parsed.(type) {
+	case *packet.PrivateKey:
+		p.Kind = "private key"
+		if pkt.IsSubkey {
+			p.Kind = "private subkey"
+		}
+		p.KeyID, p.Fingerprint, p.CreationTime = pkt.KeyIdString(), fmt.Sprintf("%X", pkt.Fingerprint[:]), pkt.CreationTime
+	case *packet.PublicKey:
+		p.Kind = "public key"
+		if pkt.IsSubkey {
+			p.Kind = "public subkey"
+		}
+		p.KeyID, p.Fingerprint, p.CreationTime = pkt.KeyIdString(), fmt.Sprintf("%X", pkt.Fingerprint[:]), pkt.CreationTime
+	case *packet.PublicKeyV3:
+		p.Kind = "v3 public key"
+		if pkt.IsSubkey {
+			p.Kind = "v3 public subkey"
+		}
+		p.KeyID, p.Fingerprint, p.CreationTime = fmt.Sprintf("%016X", pkt.KeyId), fmt.Sprintf("%X", pkt.Fingerprint[:]), pkt.CreationTime
+	case *packet.Signature:
+		p.Kind = "signature"
+		if pkt.IssuerKeyId != nil {
+			p.KeyID = fmt.Sprintf("%016X", *pkt.IssuerKeyId)
+		}
+		p.CreationTime = pkt.CreationTime
+	case *packet.SignatureV3:
+		p.Kind = "v3 signature"
+		p.KeyID, p.CreationTime = fmt.Sprintf("%016X", pkt.IssuerKeyId), pkt.CreationTime
+	case *packet.OnePassSignature:
+		p.Kind = "one-pass signature"
+		p.KeyID = fmt.Sprintf("%016X", pkt.KeyId)
+	case *packet.EncryptedKey:
+		p.Kind = "public-key encrypted session key"
+		p.KeyID = fmt.Sprintf("%016X", pkt.KeyId)
+	case *packet.SymmetricKeyEncrypted:
+		p.Kind = "symmetric-key encrypted session key"
+	case *packet.UserId:
+		if !isPrintableUserID(pkt.Id) {
+			return PGPPacket{}, 0, false
+		}
+		p.Kind, p.UserID = "user ID", pkt.Id
+	case *packet.UserAttribute:
+		p.Kind = "user attribute"
+	case *packet.LiteralData:
+		p.Kind = "literal data"
+		if pkt.FileName != "" {
+			p.Kind += fmt.Sprintf(" (%q)", pkt.FileName)
+		}
+	case *packet.Compressed:
+		p.Kind = "compressed data"
+	case *packet.SymmetricallyEncrypted:
+		p.Kind = "symmetrically encrypted data"
+		if pkt.MDC {
+			p.Kind += " (with MDC)"
+		}
+	default:
+		p.Kind = fmt.Sprintf("%T", parsed)
+	}
+
+	if !p.CreationTime.IsZero() && (p.CreationTime.Before(pgpEarliestTime) || p.CreationTime.After(pgpLatestTime)) {
+		return PGPPacket{}, 0, false
+	}
+
+	return p, length, true
+}
+
+func isPrintableUserID(id string) bool {
+	if id == "" || !utf8.ValidString(id) {
+		return false
+	}
+	for _, r := range id {
+		if !isTextRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// pgpPacketHeader returns the tag and the total length of the packet at the start of data, and false if
+// data doesn't start with a well-formed header or is too short to hold the whole packet (RFC 4880 4.2).
+func pgpPacketHeader(data []byte) (uint8, int, bool) {
+	if len(data) < 2 || data[0]&0x80 == 0 {
+		return 0, 0, false
+	}
+
+	if data[0]&0x40 == 0 {
+		// old format: the length type is in the bottom two bits
+		tag := (data[0] >> 2) & 0x0f
+		var bodyLen, headerLen int
+		switch data[0] & 0x03 {
+		case 0:
+			headerLen, bodyLen = 2, int(data[1])
+		case 1:
+			if len(data) < 3 {
+				return 0, 0, false
+			}
+			headerLen, bodyLen = 3, int(data[1])<<8|int(data[2])
+		case 2:
+			if len(data) < 5 {
+				return 0, 0, false
+			}
+			headerLen, bodyLen = 5, int(data[1])<<24|int(data[2])<<16|int(data[3])<<8|int(data[4])
+		default:
+			// indeterminate length: the packet runs to the end of the data
+			return tag, len(data), tag != 0
+		}
+		if tag == 0 || bodyLen <= 0 || headerLen+bodyLen > len(data) {
+			return 0, 0, false
+		}
+		return tag, headerLen + bodyLen, true
+	}
+
+	// new format: the body may be split into several partial-length chunks
+	tag := data[0] & 0x3f
+	if tag == 0 {
+		return 0, 0, false
+	}
+	pos := 1
+	for {
+		if pos >= len(data) {
+			return 0, 0, false
+		}
 
-	for i := range data {
-		reader := packet.NewReader(bytes.NewReader(data[i:]))
-		for {
-			packet, err := reader.Next()
-			if err != nil {
-				break
+		b := int(data[pos])
+		var chunkLen int
+		partial := false
+		switch {
+		case b < 192:
+			chunkLen, pos = b, pos+1
+		case b < 224:
+			if pos+1 >= len(data) {
+				return 0, 0, false
+			}
+			chunkLen, pos = (b-192)<<8+int(data[pos+1])+192, pos+2
+		case b == 255:
+			if pos+4 >= len(data) {
+				return 0, 0, false
 			}
-			packets = append(packets, packet)
+			chunkLen, pos = int(data[pos+1])<<24|int(data[pos+2])<<16|int(data[pos+3])<<8|int(data[pos+4]), pos+5
+		default:
+			chunkLen, pos, partial = 1<<uint(b&0x1f), pos+1, true
+		}
+
+		if chunkLen < 0 || pos+chunkLen > len(data) {
+			return 0, 0, false
+		}
+		pos += chunkLen
+		if !partial {
+			return tag, pos, true
 		}
 	}
+}
+
+type decodedPGPArmorBlock struct {
+	PGPArmorBlock
+	decoded []byte
+}
+
+var (
+	pgpArmorStart = []byte("-----BEGIN PGP ")
+	pgpArmorEnd   = []byte("-----END PGP ")
+)
+
+// findPGPArmorBlocks finds and decodes the ASCII-armored blocks in data (RFC 4880 6.2).
+func findPGPArmorBlocks(data []byte) []decodedPGPArmorBlock {
+	blocks := []decodedPGPArmorBlock{}
+
+	for offset := 0; ; {
+		idx := bytes.Index(data[offset:], pgpArmorStart)
+		if idx < 0 {
+			break
+		}
+		start := offset + idx
+		offset = start + len(pgpArmorStart)
+
+		typeEnd := bytes.Index(data[offset:], []byte("-----"))
+		if typeEnd < 0 || typeEnd > 64 {
+			continue
+		}
+		block := decodedPGPArmorBlock{PGPArmorBlock: PGPArmorBlock{Offset: uint64(start), Type: string(data[offset : offset+typeEnd])}}
+		offset += typeEnd + len("-----")
+
+		if block.Type == "SIGNED MESSAGE" {
+			// the cleartext follows, and the signature is in its own armored block
+			blocks = append(blocks, block)
+			continue
+		}
+
+		block.decoded, offset, block.Err = decodePGPArmorBody(data, offset)
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
 
-	return PGPPacketResult{Packets: packets}
+// decodePGPArmorBody decodes the body of an armored block starting just after its BEGIN line, and returns the
+// offset to continue searching from.
+func decodePGPArmorBody(data []byte, offset int) ([]byte, int, string) {
+	lines := bytes.Split(data[offset:], []byte("\n"))
+
+	// skip the rest of the BEGIN line, and the armor headers ("Version: ...") up to the first blank line
+	pos := offset
+	i := 0
+	if len(lines) > 0 {
+		pos += len(lines[0]) + 1
+		i++
+	}
+	for ; i < len(lines); i++ {
+		line := bytes.TrimSpace(lines[i])
+		pos += len(lines[i]) + 1
+		if len(line) == 0 {
+			i++
+			break
+		} else if !bytes.Contains(line, []byte(": ")) {
+			// no headers at all
+			pos -= len(lines[i]) + 1
+			break
+		}
+	}
+
+	body := &bytes.Buffer{}
+	var checksum []byte
+	for ; i < len(lines); i++ {
+		line := bytes.TrimSpace(lines[i])
+		lineStart := pos
+		pos += len(lines[i]) + 1
+
+		if bytes.HasPrefix(line, pgpArmorEnd) {
+			break
+		} else if len(line) == 5 && line[0] == '=' {
+			checksum, _ = base64.StdEncoding.DecodeString(string(line[1:]))
+			continue
+		} else if bytes.HasPrefix(line, []byte("-----")) {
+			// the line may begin the next block, so the search has to resume at it
+			return nil, lineStart, "unterminated block"
+		}
+		body.Write(line)
+	}
+	if pos > len(data) {
+		pos = len(data)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(body.String())
+	if err != nil {
+		return nil, pos, "bad base64"
+	} else if len(decoded) == 0 {
+		return nil, pos, "empty block"
+	} else if len(checksum) == 3 && pgpCRC24(decoded) != uint32(checksum[0])<<16|uint32(checksum[1])<<8|uint32(checksum[2]) {
+		return decoded, pos, "checksum mismatch"
+	}
+	return decoded, pos, ""
+}
+
+// pgpCRC24 is the armor checksum from RFC 4880 6.1.
+func pgpCRC24(data []byte) uint32 {
+	crc := uint32(0xb704ce)
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= 0x1864cfb
+			}
+		}
+	}
+	return crc & 0xffffff
 }
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	mathrand "math/rand"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestFindPGPPackets(T *testing.T) {
+	noise := make([]byte, 8192)
+	mathrand.New(mathrand.NewSource(1)).Read(noise)
+
+	if result := FindPGPPackets(noise); !result.IsEmpty() {
+		T.Fatalf("expected no PGP data in random data, got %v", result.DescriptionStrings())
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		T.Fatal(err)
+	}
+	pubKey := packet.NewRSAPublicKey(time.Date(2016, 11, 7, 0, 0, 0, 0, time.UTC), &rsaKey.PublicKey)
+
+	keyData := &bytes.Buffer{}
+	if err := pubKey.Serialize(keyData); err != nil {
+		T.Fatal(err)
+	}
+	if err := packet.NewUserId("Julian", "", "julian@example.com").Serialize(keyData); err != nil {
+		T.Fatal(err)
+	}
+	fingerprint := fmt.Sprintf("%X", pubKey.Fingerprint[:])
+
+	data := append([]byte{}, noise[:100]...)
+	data = append(data, keyData.Bytes()...)
+	data = append(data, noise[100:200]...)
+	armorOffset := len(data)
+	data = append(data, armorPGPBlock("PUBLIC KEY BLOCK", keyData.Bytes())...)
+
+	result := FindPGPPackets(data, fingerprint)
+	if len(result.Armor) != 1 || result.Armor[0].Type != "PUBLIC KEY BLOCK" || result.Armor[0].Err != "" || result.Armor[0].Offset != uint64(armorOffset) {
+		T.Fatalf("unexpected armor blocks: %v", result.DescriptionStrings())
+	}
+	if len(result.Packets) != 4 {
+		T.Fatalf("expected 4 packets, got %v", result.DescriptionStrings())
+	}
+
+	for i, armored := range []bool{false, true} {
+		key, userID := result.Packets[2*i], result.Packets[2*i+1]
+		if key.Kind != "public key" || key.Fingerprint != fingerprint || !key.Watched || key.Armored != armored || !key.CreationTime.Equal(pubKey.CreationTime) {
+			T.Fatalf("unexpected key packet: %v", key.Description())
+		}
+		if userID.Kind != "user ID" || userID.UserID != "Julian <julian@example.com>" || userID.Armored != armored {
+			T.Fatalf("unexpected user ID packet: %v", userID.Description())
+		}
+	}
+	if result.Packets[0].Offset != 100 || result.Packets[2].Offset != 0 || result.Packets[2].ArmorOffset != uint64(armorOffset) {
+		T.Fatalf("unexpected offsets: %v", result.DescriptionStrings())
+	}
+
+	// without the fingerprint, the key isn't flagged
+	if result := FindPGPPackets(keyData.Bytes()); result.Packets[0].Watched {
+		T.Fatalf("unexpected watched key: %v", result.Packets[0].Description())
+	}
+}
+
+func armorPGPBlock(blockType string, data []byte) []byte {
+	crc := pgpCRC24(data)
+	checksum := base64.StdEncoding.EncodeToString([]byte{byte(crc >> 16), byte(crc >> 8), byte(crc)})
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "-----BEGIN PGP %v-----\nVersion: GnuPG v2\n\n", blockType)
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 64 {
+		fmt.Fprintf(buf, "%v\n", encoded[:64])
+		encoded = encoded[64:]
+	}
+	fmt.Fprintf(buf, "%v\n=%v\n-----END PGP %v-----\n", encoded, checksum, blockType)
+	return buf.Bytes()
+}
+
+func TestFindPGPArmorBlocksAfterTruncatedBlock(T *testing.T) {
+	truncated := armorPGPBlock("MESSAGE", []byte("a message whose END line is missing"))
+	truncated = truncated[:bytes.Index(truncated, pgpArmorEnd)]
+
+	data := append([]byte("uploaded text\n"), truncated...)
+	secondOffset := len(data)
+	data = append(data, armorPGPBlock("SIGNATURE", []byte("a complete block"))...)
+
+	blocks := findPGPArmorBlocks(data)
+	if len(blocks) != 2 {
+		T.Fatalf("expected 2 armor blocks, got %v", len(blocks))
+	}
+	if blocks[0].Type != "MESSAGE" || blocks[0].Err != "unterminated block" {
+		T.Fatalf("unexpected first block: %+v", blocks[0].PGPArmorBlock)
+	}
+	if blocks[1].Type != "SIGNATURE" || blocks[1].Err != "" || blocks[1].Offset != uint64(secondOffset) || string(blocks[1].decoded) != "a complete block" {
+		T.Fatalf("unexpected second block: %+v", blocks[1].PGPArmorBlock)
+	}
+}
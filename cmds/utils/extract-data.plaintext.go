@@ -1,51 +1,255 @@
 package utils
 
-func ExtractText(bs []byte) ([]byte, bool) {
-	start := 0
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
 
-	for start < len(bs) {
-		if isValidPlaintextByte(bs[start]) {
-			break
+type (
+	TextEncoding int
+
+	// TextRun is a contiguous run of printable text found in binary data.
+	TextRun struct {
+		Encoding TextEncoding
+		Offset   uint64 // in bytes, from the start of the data
+		Length   uint64 // in bytes
+		Text     string
+
+		// how much the text looks like English, from 0 to 1 (see EnglishScore)
+		Score float64
+	}
+
+	TextRuns []TextRun
+)
+
+const (
+	TextEncodingUTF8 TextEncoding = iota
+	TextEncodingUTF16LE
+	TextEncodingUTF16BE
+)
+
+const (
+	// DefaultMinTextLength is the fewest characters a run of text needs to be reported.
+	DefaultMinTextLength = 8
+
+	// DefaultMinTextScore is the lowest EnglishScore a run of text needs to be reported.  Runs of random
+	// printable bytes score below 0.15, and English sentences above 0.6.
+	DefaultMinTextScore = 0.3
+)
+
+func (e TextEncoding) String() string {
+	switch e {
+	case TextEncodingUTF16LE:
+		return "utf-16le"
+	case TextEncodingUTF16BE:
+		return "utf-16be"
+	default:
+		return "utf-8"
+	}
+}
+
+func (r TextRun) Description() string {
+	return fmt.Sprintf("%v [offset %d, confidence %.2f]: %q", r.Encoding, r.Offset, r.Score, r.Text)
+}
+
+// FindTextRuns finds every run of at least minLength printable characters in data, decoded as UTF-8 and
+// as UTF-16 in both byte orders, and keeps the ones whose EnglishScore is at least minScore.  Zero values
+// mean DefaultMinTextLength and DefaultMinTextScore.
+func FindTextRuns(data []byte, minLength int, minScore float64) TextRuns {
+	if minLength <= 0 {
+		minLength = DefaultMinTextLength
+	}
+	if minScore <= 0 {
+		minScore = DefaultMinTextScore
+	}
+
+	runs := TextRuns{}
+	for _, run := range findUTF8Runs(data, minLength) {
+		if run.Score >= minScore {
+			runs = append(runs, run)
 		}
-		start++
 	}
-	if start == len(bs) {
-		return nil, false
+
+	// text in one byte order, read in the other from the next byte, decodes to almost the same characters,
+	// so big-endian runs are only kept if they don't overlap a little-endian one (the more common order)
+	utf16leRuns := findUTF16Runs(data, TextEncodingUTF16LE, minLength)
+	for _, run := range utf16leRuns {
+		if run.Score >= minScore {
+			runs = append(runs, run)
+		}
+	}
+	for _, run := range findUTF16Runs(data, TextEncodingUTF16BE, minLength) {
+		if run.Score >= minScore && !overlapsAny(run, utf16leRuns) {
+			runs = append(runs, run)
+		}
+	}
+	return runs
+}
+
+func overlapsAny(run TextRun, others TextRuns) bool {
+	for _, other := range others {
+		if run.Offset < other.Offset+other.Length && other.Offset < run.Offset+run.Length {
+			return true
+		}
+	}
+	return false
+}
+
+func findUTF8Runs(data []byte, minLength int) TextRuns {
+	runs := TextRuns{}
+
+	start, numChars := 0, 0
+	endRun := func(end int) {
+		if numChars >= minLength {
+			runs = append(runs, newTextRun(TextEncodingUTF8, start, end, string(data[start:end])))
+		}
+	}
+
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError || !isTextRune(r) {
+			endRun(i)
+			i += size
+			start, numChars = i, 0
+			continue
+		}
+
+		numChars++
+		i += size
+	}
+	endRun(len(data))
+
+	return runs
+}
+
+// findUTF16Runs looks for text at both even and odd offsets, since the data may not start on a character
+// boundary.
+func findUTF16Runs(data []byte, encoding TextEncoding, minLength int) TextRuns {
+	runs := TextRuns{}
+
+	unitAt := func(i int) uint16 {
+		if encoding == TextEncodingUTF16BE {
+			return uint16(data[i])<<8 | uint16(data[i+1])
+		}
+		return uint16(data[i+1])<<8 | uint16(data[i])
 	}
 
-	end := start
-	for end < len(bs) {
-		if !isValidPlaintextByte(bs[end]) {
-			break
+	for alignment := 0; alignment < 2; alignment++ {
+		start := alignment
+		chars := []rune{}
+		endRun := func(end int) {
+			if len(chars) >= minLength {
+				runs = append(runs, newTextRun(encoding, start, end, string(chars)))
+			}
+		}
+
+		i := alignment
+		for i+1 < len(data) {
+			r, size := rune(unitAt(i)), 2
+			if utf16.IsSurrogate(r) && i+3 < len(data) {
+				r, size = utf16.DecodeRune(r, rune(unitAt(i+2))), 4
+			}
+
+			if !isTextRune(r) || !isLikelyUTF16Rune(r) {
+				endRun(i)
+				i += 2
+				start, chars = i, []rune{}
+				continue
+			}
+
+			chars = append(chars, r)
+			i += size
 		}
-		end++
+		endRun(i)
 	}
 
-	// sublen := end - start + 1
-	// if sublen < 5 {
-	//  return nil, false
-	// }
-	// fmt.Println("~~~~ EXTRACT TEXT", start, end)
+	return runs
+}
 
-	substr := bs[start:end]
-	return substr, true
+func newTextRun(encoding TextEncoding, start, end int, text string) TextRun {
+	return TextRun{
+		Encoding: encoding,
+		Offset:   uint64(start),
+		Length:   uint64(end - start),
+		Text:     text,
+		Score:    EnglishScore(text),
+	}
 }
 
-func StripNonTextBytes(bs []byte) []byte {
-	newBs := make([]byte, len(bs))
-	newBsLen := 0
-	for i := range bs {
-		if isValidPlaintextByte(bs[i]) {
-			newBs[newBsLen] = bs[i]
-			newBsLen++
+func isTextRune(r rune) bool {
+	switch r {
+	case '\r', '\n', '\t':
+		return true
+	case utf8.RuneError:
+		return false
+	}
+	return unicode.IsPrint(r)
+}
+
+// Two bytes of ASCII text, or of random data, almost always decode as UTF-16 to a printable CJK character
+// or symbol.  Only characters from the alphabetic scripts below U+2000 are accepted, plus the common
+// punctuation that follows it, so that UTF-16 runs aren't found everywhere.
+func isLikelyUTF16Rune(r rune) bool {
+	return r < 0x2000 || (r >= 0x2010 && r <= 0x2027)
+}
+
+// EnglishScore estimates how much text looks like English, from 0 to 1.  Half of it comes from the share of
+// letters that are in common English words, a third from the share of letter pairs that are common English
+// bigrams, and the rest from the share of characters that are letters or spaces.
+func EnglishScore(text string) float64 {
+	var numChars, numLettersOrSpaces int
+	for _, r := range text {
+		numChars++
+		if unicode.IsLetter(r) || r == ' ' {
+			numLettersOrSpaces++
 		}
 	}
+	if numChars == 0 {
+		return 0
+	}
 
-	if newBsLen == 0 {
-		return nil
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) })
+
+	var wordLetters, knownWordLetters, numBigrams, numCommonBigrams int
+	for _, word := range words {
+		wordLen := utf8.RuneCountInString(word)
+		wordLetters += wordLen
+		if commonEnglishWords[word] {
+			knownWordLetters += wordLen
+		}
+
+		for i := 0; i+1 < len(word); i++ {
+			numBigrams++
+			if commonEnglishBigrams[word[i:i+2]] {
+				numCommonBigrams++
+			}
+		}
 	}
 
-	return newBs[0:newBsLen]
+	var wordScore, bigramScore float64
+	if wordLetters > 0 {
+		wordScore = float64(knownWordLetters) / float64(wordLetters)
+	}
+	if numBigrams > 0 {
+		// about 60% of the letter pairs in English text are one of the common bigrams
+		bigramScore = clamp01(float64(numCommonBigrams) / float64(numBigrams) / 0.6)
+	}
+	// English is about 95% letters and spaces, and random printable ASCII about 55%
+	charScore := clamp01((float64(numLettersOrSpaces)/float64(numChars) - 0.6) / 0.35)
+
+	return wordScore/2 + bigramScore/3 + charScore/6
+}
+
+func clamp01(x float64) float64 {
+	if x < 0 {
+		return 0
+	} else if x > 1 {
+		return 1
+	}
+	return x
 }
 
 func isValidPlaintextByte(x byte) bool {
@@ -61,3 +265,30 @@ func isValidPlaintextByte(x byte) bool {
 
 	return false
 }
+
+var commonEnglishBigrams = map[string]bool{}
+
+var commonEnglishWords = map[string]bool{}
+
+func init() {
+	for _, bigram := range strings.Fields(`th he in er an re on at en nd ti es or te of ed is it al ar st to nt ng se ha
+		as ou io le ve co me de hi ri ro ic ne ea ra ce li ch ll be ma si om ur`) {
+		commonEnglishBigrams[bigram] = true
+	}
+
+	for _, word := range strings.Fields(`a i the be to of and in that have it for not on with he as you do at this
+		but his by from they we say her she or an will my one all would there their what so up out if about
+		who get which go me when make can like time no just him know take people into year your good some
+		could them see other than then now look only come its over think also back after use two how our work
+		first well way even new want because any these give day most us is are was were has had been did
+		said does made many more may must should very here where why each much own such those through
+		while before between under again never always still every something nothing anything world life
+		man men woman women child children government state states country war police military secret
+		public report information document documents file files data message money bitcoin block chain
+		transaction key keys private password security law court president army intelligence agency
+		national international foreign news press freedom free truth leak leaks wikileaks julian assange
+		cable cables embassy department release released note read write please help love hello thanks
+		thank god peace death dead life live name date page text email address phone contact`) {
+		commonEnglishWords[word] = true
+	}
+}
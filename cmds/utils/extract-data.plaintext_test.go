@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"math/rand"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestFindTextRuns(T *testing.T) {
+	noise := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(noise)
+
+	// random bytes are full of short printable runs, none of which should look like English
+	if runs := FindTextRuns(noise, 0, 0); len(runs) != 0 {
+		T.Fatalf("expected no text in random data, got %v", runs[0].Description())
+	}
+
+	english := "This is a message for the people of the world."
+	utf16le := []byte{}
+	for _, unit := range utf16.Encode([]rune("Cable from the embassy: please read")) {
+		utf16le = append(utf16le, byte(unit), byte(unit>>8))
+	}
+
+	data := append([]byte{}, noise[:100]...)
+	data = append(data, 0x00)
+	data = append(data, english...)
+	data = append(data, 0xff, 0xff, 0xff)
+	data = append(data, utf16le...)
+	data = append(data, 0xff, 0xff, 0xff)
+
+	runs := FindTextRuns(data, 0, 0)
+	if len(runs) != 2 {
+		T.Fatalf("expected 2 runs of text, got %v", len(runs))
+	}
+
+	if r := runs[0]; r.Encoding != TextEncodingUTF8 || r.Text != english || r.Offset != 101 || r.Score < 0.6 {
+		T.Fatalf("unexpected run: %v", r.Description())
+	}
+	if r := runs[1]; r.Encoding != TextEncodingUTF16LE || r.Text != "Cable from the embassy: please read" || r.Offset != uint64(101+len(english)+3) || r.Length != uint64(len(utf16le)) {
+		T.Fatalf("unexpected run: %v", r.Description())
+	}
+}
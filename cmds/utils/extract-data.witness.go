@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// the first byte of an optional BIP341 annex, which is always the last witness item if present
+	taprootAnnexTag = 0x50
+
+	// BIP341 control blocks are 33 bytes plus 32 bytes per level of the script merkle path
+	taprootControlBaseSize = 33
+	taprootControlNodeSize = 32
+	taprootLeafMask        = 0xfe
+	taprootLeafTapscript   = 0xc0
+)
+
+// ParseWitnessProgram recognizes the output scripts of segwit (v0) and taproot (v1) outputs, and of future
+// witness versions: OP_0 or OP_1..OP_16 followed by a single 2-40 byte push of the witness program.  The
+// vendored txscript predates segwit, so it classifies all of these as nonstandard.
+func ParseWitnessProgram(pkScript []byte) (version int, program []byte, ok bool) {
+	if len(pkScript) < 4 || len(pkScript) > 42 || int(pkScript[1]) != len(pkScript)-2 {
+		return 0, nil, false
+	}
+
+	switch op := pkScript[0]; {
+	case op == 0x00: // OP_0
+		version = 0
+	case op >= 0x51 && op <= 0x60: // OP_1..OP_16
+		version = int(op-0x51) + 1
+	default:
+		return 0, nil, false
+	}
+	return version, pkScript[2:], true
+}
+
+// WitnessProgramType names a witness program the way bitcoind does (e.g. "witness_v0_keyhash").
+func WitnessProgramType(version int, program []byte) string {
+	switch {
+	case version == 0 && len(program) == 20:
+		return "witness_v0_keyhash"
+	case version == 0 && len(program) == 32:
+		return "witness_v0_scripthash"
+	case version == 1 && len(program) == 32:
+		return "witness_v1_taproot"
+	}
+	return "witness_unknown"
+}
+
+// GetWitnessScript returns the script that a witness stack executes: the last item of a P2WSH spend,
+// or the second to last item of a taproot script-path spend.  P2WPKH and taproot key-path spends don't
+// carry a script, so nil is returned for those.
+func GetWitnessScript(witness [][]byte) []byte {
+	n := len(witness)
+	if n >= 2 && len(witness[n-1]) > 0 && witness[n-1][0] == taprootAnnexTag {
+		n--
+	}
+	if n < 2 {
+		return nil
+	}
+
+	last := witness[n-1]
+	if isTaprootControlBlock(last) {
+		return witness[n-2]
+	} else if n == 2 && len(last) == 33 && (last[0] == 0x02 || last[0] == 0x03) {
+		// P2WPKH: <signature> <compressed pubkey>
+		return nil
+	}
+	return last
+}
+
+func isTaprootControlBlock(bs []byte) bool {
+	if len(bs) < taprootControlBaseSize || (len(bs)-taprootControlBaseSize)%taprootControlNodeSize != 0 {
+		return false
+	}
+	return bs[0]&taprootLeafMask == taprootLeafTapscript
+}
+
+// GetPushdataBytesFromWitnessScript concatenates every data push in a witness script.  Unlike the
+// input script helpers, it includes the short OP_DATA_N pushes, since envelope formats split their
+// payload into chunks of at most 520 bytes and any of them may be short.
+func GetPushdataBytesFromWitnessScript(scriptBytes []byte) ([]byte, error) {
+	outData := []byte{}
+	for i := 0; i < len(scriptBytes); {
+		op := scriptBytes[i]
+
+		var start, length int
+		switch {
+		case op >= OP_DATA_1 && op <= OP_DATA_75:
+			start, length = i+1, int(op)
+		case op == OP_PUSHDATA1 && i+1 < len(scriptBytes):
+			start, length = i+2, int(scriptBytes[i+1])
+		case op == OP_PUSHDATA2 && i+2 < len(scriptBytes):
+			start, length = i+3, int(binary.LittleEndian.Uint16(scriptBytes[i+1:]))
+		case op == OP_PUSHDATA4 && i+4 < len(scriptBytes):
+			start, length = i+5, int(binary.LittleEndian.Uint32(scriptBytes[i+1:]))
+		case op == OP_PUSHDATA1 || op == OP_PUSHDATA2 || op == OP_PUSHDATA4:
+			return outData, fmt.Errorf("truncated pushdata length at offset %d", i)
+		default:
+			i++
+			continue
+		}
+
+		if length < 0 || start+length > len(scriptBytes) {
+			return outData, fmt.Errorf("pushdata at offset %d runs past the end of the script", i)
+		}
+		outData = append(outData, scriptBytes[start:start+length]...)
+		i = start + length
+	}
+
+	return outData, nil
+}
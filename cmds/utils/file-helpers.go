@@ -2,6 +2,7 @@ package utils
 
 import (
 	"os"
+	"strings"
 )
 
 var maxFiles = 256
@@ -43,6 +44,12 @@ func CloseFile(file *os.File) error {
 	return err
 }
 
+// SafeFilename replaces the characters in a data source name (like the "|" separating the steps of a
+// decoded result's name) that can't go in a filename on every platform.
+func SafeFilename(name string) string {
+	return strings.NewReplacer("|", ".", ":", "_").Replace(name)
+}
+
 type ConditionalFile struct {
 	filename     string
 	buffer       []byte
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// InterruptContext returns a context that is cancelled when the process receives SIGINT (Ctrl-C) or
+// SIGTERM, so that long-running commands can stop cleanly and write out what they have so far.  A second
+// signal kills the process as usual.
+func InterruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	chSignals := make(chan os.Signal, 1)
+	signal.Notify(chSignals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-chSignals:
+			fmt.Println("interrupted, finishing up (press Ctrl-C again to quit immediately)")
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(chSignals)
+	}()
+
+	return ctx, cancel
+}
@@ -0,0 +1,268 @@
+// Package knownhashes finds digests of known files (by default, the WikiLeaks releases listed in wlhashes/)
+// in arbitrary data.
+package knownhashes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultDir is where the hash lists are loaded from when no other location is given.
+const DefaultDir = "wlhashes"
+
+type (
+	// Set holds digests indexed by their raw bytes, so that every offset in a piece of data can be checked
+	// against all of them with one map lookup per digest length.
+	Set struct {
+		digests  map[string]*Digest
+		reversed map[string]*Digest
+		lengths  []int
+	}
+
+	Digest struct {
+		Hash      []byte
+		Algorithm string
+		Filenames []string
+	}
+
+	Match struct {
+		Digest   *Digest
+		Reversed bool
+		Offset   uint64
+	}
+
+	Result []Match
+)
+
+func NewSet() *Set {
+	return &Set{
+		digests:  map[string]*Digest{},
+		reversed: map[string]*Digest{},
+	}
+}
+
+// Load returns a Set containing the hash lists at each path, which may be a single file or a directory of
+// them.
+func Load(paths ...string) (*Set, error) {
+	s := NewSet()
+	for _, path := range paths {
+		err := s.LoadPath(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Set) Len() int {
+	return len(s.digests)
+}
+
+// Add adds a digest of the given file.  Adding the same digest again only records the extra filename.
+func (s *Set) Add(hash []byte, algorithm string, filename string) {
+	if len(hash) == 0 {
+		return
+	}
+
+	if d, exists := s.digests[string(hash)]; exists {
+		for _, f := range d.Filenames {
+			if f == filename {
+				return
+			}
+		}
+		d.Filenames = append(d.Filenames, filename)
+		return
+	}
+
+	d := &Digest{Hash: hash, Algorithm: algorithm, Filenames: []string{filename}}
+	s.digests[string(hash)] = d
+	s.reversed[string(reverseBytes(hash))] = d
+
+	for _, l := range s.lengths {
+		if l == len(hash) {
+			return
+		}
+	}
+	s.lengths = append(s.lengths, len(hash))
+	sort.Ints(s.lengths)
+}
+
+// LoadPath loads a hash list, or every hash list in a directory (files whose names start with "." are
+// ignored).
+func (s *Set) LoadPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	} else if !info.IsDir() {
+		return s.LoadFile(path)
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		err = s.LoadFile(filepath.Join(path, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadFile loads a hash list in either of the formats used in wlhashes/:
+//
+//   - a JSON object mapping hex digests to lists of filenames (md5sums.txt, sha1sums.txt, ...)
+//   - lines of "<hex digest>  <filename>", as written by sha256sum and friends (ripemd160-sha256-hashes.txt)
+//
+// The hash algorithm is taken from the start of the list's filename (e.g. "sha1sums.txt" is sha1), or else
+// guessed from the length of each digest.
+func (s *Set) LoadFile(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	algorithm := algorithmFromFilename(filepath.Base(filename))
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var digests map[string][]string
+		err = json.Unmarshal(trimmed, &digests)
+		if err != nil {
+			return fmt.Errorf("reading %v: %v", filename, err)
+		}
+
+		for digestHex, files := range digests {
+			hash, err := hex.DecodeString(strings.TrimSpace(digestHex))
+			if err != nil {
+				return fmt.Errorf("reading %v: bad digest '%v'", filename, digestHex)
+			}
+			for _, file := range files {
+				s.Add(hash, algorithmOrGuess(algorithm, hash), strings.TrimSpace(file))
+			}
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return fmt.Errorf("%v:%v: expected '<hex digest>  <filename>'", filename, lineNum)
+		}
+
+		hash, err := hex.DecodeString(fields[0])
+		if err != nil {
+			return fmt.Errorf("%v:%v: bad digest '%v'", filename, lineNum, fields[0])
+		}
+
+		// sha256sum marks files read in binary mode with a '*'
+		file := strings.TrimPrefix(strings.TrimSpace(line[len(fields[0]):]), "*")
+		s.Add(hash, algorithmOrGuess(algorithm, hash), file)
+	}
+	return scanner.Err()
+}
+
+// Search finds every known digest in data, in either byte order.
+func (s *Set) Search(data []byte) Result {
+	matches := Result{}
+	for _, l := range s.lengths {
+		for i := 0; i+l <= len(data); i++ {
+			window := string(data[i : i+l])
+			if d, exists := s.digests[window]; exists {
+				matches = append(matches, Match{Digest: d, Offset: uint64(i)})
+			} else if d, exists := s.reversed[window]; exists {
+				matches = append(matches, Match{Digest: d, Reversed: true, Offset: uint64(i)})
+			}
+		}
+	}
+	return matches
+}
+
+func (m Match) Description() string {
+	desc := fmt.Sprintf("%v of %v (%x)", m.Digest.Algorithm, strings.Join(m.Digest.Filenames, ", "), m.Digest.Hash)
+	if m.Reversed {
+		desc += " (reversed)"
+	}
+	return fmt.Sprintf("%v [offset %d]", desc, m.Offset)
+}
+
+func (r Result) IsEmpty() bool {
+	return len(r) == 0
+}
+
+func (r Result) DescriptionStrings() []string {
+	strs := make([]string, len(r))
+	for i, m := range r {
+		strs[i] = m.Description()
+	}
+	return strs
+}
+
+// the prefixes of the lists in wlhashes/, longest first so that "ripemd160-sha256" isn't taken for sha256
+var algorithmPrefixes = []struct {
+	prefix    string
+	algorithm string
+}{
+	{"ripemd160-sha256", "ripemd160(sha256)"},
+	{"ripemd160", "ripemd160"},
+	{"sha256", "sha256"},
+	{"sha512", "sha512"},
+	{"sha1", "sha1"},
+	{"md5", "md5"},
+}
+
+func algorithmFromFilename(filename string) string {
+	filename = strings.ToLower(filename)
+	for _, p := range algorithmPrefixes {
+		if strings.HasPrefix(filename, p.prefix) {
+			return p.algorithm
+		}
+	}
+	return ""
+}
+
+func algorithmOrGuess(algorithm string, hash []byte) string {
+	if algorithm != "" {
+		return algorithm
+	}
+
+	switch len(hash) {
+	case 16:
+		return "md5"
+	case 20:
+		return "sha1"
+	case 32:
+		return "sha256"
+	case 64:
+		return "sha512"
+	}
+	return fmt.Sprintf("%v-byte digest", len(hash))
+}
+
+func reverseBytes(bs []byte) []byte {
+	reversed := make([]byte, len(bs))
+	for i := range bs {
+		reversed[len(bs)-1-i] = bs[i]
+	}
+	return reversed
+}
@@ -0,0 +1,47 @@
+package knownhashes
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSearch(T *testing.T) {
+	dir, err := ioutil.TempDir("", "knownhashes-test")
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	userFile := filepath.Join(dir, "my-hashes.txt")
+	err = ioutil.WriteFile(userFile, []byte("# user-supplied\n0102030405060708090a0b0c0d0e0f10  secret.doc\n"), 0666)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	s, err := Load(filepath.Join("..", "..", "..", DefaultDir), userFile)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	cablegateMD5, _ := hex.DecodeString("2f3d8c4d6808a9d93f9b30594c6eb7a0")
+	userHash, _ := hex.DecodeString("0102030405060708090a0b0c0d0e0f10")
+
+	data := append(bytes.Repeat([]byte{0xff}, 7), reverseBytes(cablegateMD5)...)
+	data = append(data, userHash...)
+
+	result := s.Search(data)
+	if len(result) != 2 {
+		T.Fatalf("expected 2 matches, got %v", result.DescriptionStrings())
+	}
+
+	if m := result[0]; m.Digest.Algorithm != "md5" || m.Digest.Filenames[0] != "cablegate-201102171331.7z" || !m.Reversed || m.Offset != 7 {
+		T.Fatalf("unexpected match: %v", m.Description())
+	}
+	if m := result[1]; m.Digest.Algorithm != "md5" || m.Digest.Filenames[0] != "secret.doc" || m.Reversed || m.Offset != 23 {
+		T.Fatalf("unexpected match: %v", m.Description())
+	}
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the vendored btcutil predates segwit, so bech32 (BIP173) and bech32m (BIP350) addresses are decoded here
+
+const (
+	segwitAddressHRP = "bc"
+	bech32Charset    = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	bech32Const      = 1
+	bech32mConst     = 0x2bc830a3
+)
+
+// DecodeSegwitAddress decodes a mainnet segwit or taproot address (bc1...) to the output script it pays to.
+func DecodeSegwitAddress(addr string) ([]byte, error) {
+	if len(addr) > 90 {
+		return nil, fmt.Errorf("bech32 address is too long")
+	} else if strings.ToLower(addr) != addr && strings.ToUpper(addr) != addr {
+		return nil, fmt.Errorf("bech32 address mixes upper and lower case")
+	}
+	addr = strings.ToLower(addr)
+
+	sep := strings.LastIndex(addr, "1")
+	if sep < 1 || sep+7 > len(addr) {
+		return nil, fmt.Errorf("bech32 address has no separator or is too short")
+	} else if addr[:sep] != segwitAddressHRP {
+		return nil, fmt.Errorf("not a mainnet segwit address (prefix %q)", addr[:sep])
+	}
+
+	data := make([]byte, len(addr)-sep-1)
+	for i := range data {
+		idx := strings.IndexByte(bech32Charset, addr[sep+1+i])
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid bech32 character %q", addr[sep+1+i])
+		}
+		data[i] = byte(idx)
+	}
+
+	checksum := bech32Polymod(append(bech32ExpandHRP(addr[:sep]), data...))
+	if checksum != bech32Const && checksum != bech32mConst {
+		return nil, fmt.Errorf("bad bech32 checksum")
+	}
+
+	data = data[:len(data)-6]
+	if len(data) == 0 {
+		return nil, fmt.Errorf("bech32 address has no witness version")
+	}
+
+	version := data[0]
+	program, err := convertBits(data[1:], 5, 8)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case version > 16:
+		return nil, fmt.Errorf("invalid witness version %v", version)
+	case len(program) < 2 || len(program) > 40:
+		return nil, fmt.Errorf("invalid witness program length %v", len(program))
+	case version == 0 && len(program) != 20 && len(program) != 32:
+		return nil, fmt.Errorf("invalid v0 witness program length %v", len(program))
+	case version == 0 && checksum != bech32Const, version > 0 && checksum != bech32mConst:
+		// BIP350: v0 addresses use bech32, and later versions bech32m
+		return nil, fmt.Errorf("wrong checksum variant for witness version %v", version)
+	}
+
+	opcode := byte(0x00) // OP_0
+	if version > 0 {
+		opcode = 0x50 + version // OP_1..OP_16
+	}
+	return append([]byte{opcode, byte(len(program))}, program...), nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := uint(0); i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32ExpandHRP(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+// convertBits regroups 5-bit groups into bytes, rejecting leftover bits that aren't zero padding.
+func convertBits(data []byte, fromBits, toBits uint) ([]byte, error) {
+	acc, bits := uint32(0), uint(0)
+	maxValue := uint32(1)<<toBits - 1
+	converted := []byte{}
+	for _, v := range data {
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			converted = append(converted, byte(acc>>bits&maxValue))
+		}
+	}
+	if bits >= fromBits || (acc<<(toBits-bits))&maxValue != 0 {
+		return nil, fmt.Errorf("invalid bech32 padding")
+	}
+	return converted, nil
+}
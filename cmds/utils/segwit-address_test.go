@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestDecodeSegwitAddress(T *testing.T) {
+	// test vectors from BIP173 and BIP350
+	valid := map[string]string{
+		"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4":                     "0014751e76e8199196d454941c45d1b3a323f1433bd6",
+		"bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3": "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262",
+		"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0": "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+	}
+	for addr, expected := range valid {
+		pkScript, err := DecodeSegwitAddress(addr)
+		if err != nil {
+			T.Errorf("%v: %v", addr, err)
+		} else if hex.EncodeToString(pkScript) != expected {
+			T.Errorf("%v: got script %x, expected %v", addr, pkScript, expected)
+		}
+	}
+
+	invalid := []string{
+		"tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx",                     // testnet
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5",                     // bad checksum
+		"bc1qW508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",                     // mixed case
+		"bc1zw508d6qejxtdg4y5r3zarvaryvqyzf3du",                          // leftover bits that aren't zero padding
+		"bc1qr508d6qejxtdg4y5r3zarvaryv98gj9p",                           // v0 with a 16 byte program
+		"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd", // v1 with a bech32 checksum
+	}
+	for _, addr := range invalid {
+		if pkScript, err := DecodeSegwitAddress(addr); err == nil {
+			T.Errorf("%v: expected an error, got script %x", addr, pkScript)
+		}
+	}
+}
@@ -1,25 +1,40 @@
 package utils
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
-	"os"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 )
 
-func LoadBlocksFromDAT(file string) (blocks []*btcutil.Block, err error) {
+// DATBlockLoc records where a block lives inside its .dat file.  Offset points just past the network magic
+// and length prefix, i.e. at the first byte of the block header.  TxLocs are relative to Offset.
+type DATBlockLoc struct {
+	Offset uint64
+	Length uint32
+	TxLocs []wire.TxLoc
+}
+
+func LoadBlocksFromDAT(file string) ([]*btcutil.Block, error) {
+	blocks, _, err := LoadBlocksAndLocsFromDAT(file)
+	return blocks, err
+}
+
+// LoadBlocksAndLocsFromDAT is LoadBlocksFromDAT, but it also returns the location of each block (and of
+// each transaction within it) so that they can be indexed and read back later with a single ReadAt.
+func LoadBlocksAndLocsFromDAT(file string) (blocks []*btcutil.Block, locs []DATBlockLoc, err error) {
 	<-fileSemaphore
 	defer func() { fileSemaphore <- true }()
 
 	var network = wire.MainNet
 	var dr io.Reader
-	var fi io.ReadCloser
+	var fi *DATFile
 
-	fi, err = os.Open(file)
+	fi, err = OpenDATFile(file)
 	if err != nil {
 		return
 	}
@@ -27,12 +42,12 @@ func LoadBlocksFromDAT(file string) (blocks []*btcutil.Block, err error) {
 	dr = fi
 	defer fi.Close()
 
-	var block *btcutil.Block
+	var pos uint64
 
 	err = nil
 	for height := int64(1); err == nil; height++ {
-		var rintbuf uint32
-		err = binary.Read(dr, binary.LittleEndian, &rintbuf)
+		var magic [4]byte
+		_, err = io.ReadFull(dr, magic[:])
 		if err == io.EOF {
 			// hit end of file at expected offset: no warning
 			height--
@@ -42,34 +57,61 @@ func LoadBlocksFromDAT(file string) (blocks []*btcutil.Block, err error) {
 		if err != nil {
 			break
 		}
-		if rintbuf != uint32(network) {
+		if binary.LittleEndian.Uint32(magic[:]) != uint32(network) {
+			// the rest of the file is preallocated space that hasn't been written to yet
+			if !fi.IsUnwritten(magic[:], int64(pos)) {
+				err = badMagicError(file, fi, binary.LittleEndian.Uint32(magic[:]))
+			}
 			break
 		}
+
+		var rintbuf uint32
 		err = binary.Read(dr, binary.LittleEndian, &rintbuf)
+		if err != nil {
+			break
+		}
 		blocklen := rintbuf
+		pos += 8
 
 		rbytes := make([]byte, blocklen)
 
 		// read block
-		dr.Read(rbytes)
+		_, err = io.ReadFull(dr, rbytes)
+		if err != nil {
+			return
+		}
 
-		block, err = btcutil.NewBlockFromBytes(rbytes)
+		msgBlock := &wire.MsgBlock{}
+		var txLocs []wire.TxLoc
+		txLocs, err = msgBlock.DeserializeTxLoc(bytes.NewBuffer(rbytes))
 		if err != nil {
 			return
 		}
-		blocks = append(blocks, block)
+
+		blocks = append(blocks, btcutil.NewBlockFromBlockAndBytes(msgBlock, rbytes))
+		locs = append(locs, DATBlockLoc{Offset: pos, Length: blocklen, TxLocs: txLocs})
+		pos += uint64(blocklen)
 	}
 
 	return
 }
 
+// badMagicError is returned when a block doesn't start with the network magic, which usually means that the
+// obfuscation key is missing or doesn't match the file.
+func badMagicError(file string, fi *DATFile, magic uint32) error {
+	if fi.IsObfuscated() {
+		return fmt.Errorf("%v: bad network magic %#08x (is %v out of date?)", file, magic, XORKeyFilename)
+	}
+	return fmt.Errorf("%v: bad network magic %#08x (is %v missing from the .dat directory?)", file, magic, XORKeyFilename)
+}
+
 func LoadBlockFromDAT(file string, height uint32) (*btcutil.Block, error) {
 	<-fileSemaphore
 	defer func() { fileSemaphore <- true }()
 
 	var network = wire.MainNet
 
-	fi, err := os.Open(file)
+	fi, err := OpenDATFile(file)
 	if err != nil {
 		return nil, err
 	}
@@ -87,7 +129,7 @@ func LoadBlockFromDAT(file string, height uint32) (*btcutil.Block, error) {
 			return nil, err
 		}
 		if networkBits != uint32(network) {
-			return nil, fmt.Errorf("block has bad network bits")
+			return nil, badMagicError(file, fi, networkBits)
 		}
 
 		var blocklen uint32
@@ -106,6 +148,84 @@ func LoadBlockFromDAT(file string, height uint32) (*btcutil.Block, error) {
 	return nil, fmt.Errorf("block %v not found in DAT file", height)
 }
 
+// FindBlockLocInDAT seeks through the block headers of a .dat file to find the location of the block at
+// the given index.  It's used to upgrade index rows written before we stored block offsets.  TxLocs is
+// not populated.
+func FindBlockLocInDAT(file string, height uint32) (DATBlockLoc, error) {
+	<-fileSemaphore
+	defer func() { fileSemaphore <- true }()
+
+	fi, err := OpenDATFile(file)
+	if err != nil {
+		return DATBlockLoc{}, err
+	}
+	defer fi.Close()
+
+	var pos uint64
+	for i := uint32(0); i <= height; i++ {
+		var header [8]byte
+		_, err := io.ReadFull(fi, header[:])
+		if err == io.EOF {
+			return DATBlockLoc{}, fmt.Errorf("block %v not found in DAT file", height)
+		} else if err != nil {
+			return DATBlockLoc{}, err
+		}
+		if binary.LittleEndian.Uint32(header[:4]) != uint32(wire.MainNet) {
+			return DATBlockLoc{}, fmt.Errorf("block has bad network bits")
+		}
+		blocklen := binary.LittleEndian.Uint32(header[4:])
+		pos += 8
+
+		if i == height {
+			return DATBlockLoc{Offset: pos, Length: blocklen}, nil
+		}
+
+		pos += uint64(blocklen)
+		_, err = fi.Seek(int64(pos), io.SeekStart)
+		if err != nil {
+			return DATBlockLoc{}, err
+		}
+	}
+
+	return DATBlockLoc{}, fmt.Errorf("block %v not found in DAT file", height)
+}
+
+// LoadBlockFromDATAt reads a single block with one ReadAt, given its location from the block index.
+func LoadBlockFromDATAt(file string, offset uint64, length uint32) (*btcutil.Block, error) {
+	rbytes, err := readDATAt(file, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	return btcutil.NewBlockFromBytes(rbytes)
+}
+
+// LoadTxFromDATAt reads a single transaction with one ReadAt, without decoding the rest of its block.
+func LoadTxFromDATAt(file string, offset uint64, length uint32) (*btcutil.Tx, error) {
+	rbytes, err := readDATAt(file, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	return btcutil.NewTxFromBytes(rbytes)
+}
+
+func readDATAt(file string, offset uint64, length uint32) ([]byte, error) {
+	<-fileSemaphore
+	defer func() { fileSemaphore <- true }()
+
+	fi, err := OpenDATFile(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+
+	rbytes := make([]byte, length)
+	_, err = fi.ReadAt(rbytes, int64(offset))
+	if err != nil {
+		return nil, err
+	}
+	return rbytes, nil
+}
+
 func GroupBlocks(blocks []*btcutil.Block, groupLen int) [][]*btcutil.Block {
 	extra := len(blocks) % groupLen
 	numGroups := ((len(blocks) - extra) / groupLen) + 1
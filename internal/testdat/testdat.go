@@ -0,0 +1,39 @@
+// Package testdat writes blk*.dat fixtures for tests.
+package testdat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// WriteDATDir creates a temporary directory containing a blk00000.dat that holds the given blocks, in the
+// same format bitcoind uses, and returns the directory.  The caller is responsible for removing it.
+func WriteDATDir(T *testing.T, blocks []*wire.MsgBlock) string {
+	dir, err := ioutil.TempDir("", "testdat")
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	for _, bl := range blocks {
+		blBytes := &bytes.Buffer{}
+		err := bl.Serialize(blBytes)
+		if err != nil {
+			T.Fatal(err)
+		}
+		binary.Write(buf, binary.LittleEndian, uint32(wire.MainNet))
+		binary.Write(buf, binary.LittleEndian, uint32(blBytes.Len()))
+		buf.Write(blBytes.Bytes())
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "blk00000.dat"), buf.Bytes(), 0666)
+	if err != nil {
+		T.Fatal(err)
+	}
+	return dir
+}
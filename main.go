@@ -10,8 +10,10 @@ import (
 
 	"github.com/urfave/cli"
 
+	"github.com/spooktheducks/local-blockchain-parser/blockdb"
 	"github.com/spooktheducks/local-blockchain-parser/cmds"
 	"github.com/spooktheducks/local-blockchain-parser/cmds/dbcmds"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/pipeline"
 )
 
 func main() {
@@ -21,9 +23,32 @@ func main() {
 		return
 	}
 
+	var backend blockdb.LookupBackend
+
 	app := cli.NewApp()
 
 	app.Name = "local blockchain parser"
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "offline", Usage: "Resolve every lookup from the local index and .dat files only (overrides the config file)"},
+		cli.BoolFlag{Name: "online", Usage: "Allow lookups to fall back to the remote backend (overrides the config file)"},
+		cli.StringFlag{Name: "backend", Usage: "The remote lookup backend: 'blockchain.info' or 'bitcoind' (overrides the config file)"},
+	}
+	app.Before = func(c *cli.Context) error {
+		if c.Bool("offline") && c.Bool("online") {
+			return fmt.Errorf("--offline and --online are mutually exclusive")
+		} else if c.Bool("offline") {
+			cfg.Offline = true
+		} else if c.Bool("online") {
+			cfg.Offline = false
+		}
+
+		if c.String("backend") != "" {
+			cfg.Backend = c.String("backend")
+		}
+
+		backend, err = cfg.lookupBackend()
+		return err
+	}
 	app.Commands = []cli.Command{
 		{
 			Name: "querydb",
@@ -33,14 +58,15 @@ func main() {
 					Flags: []cli.Flag{
 						cli.StringFlag{Name: "dbFile", Usage: "The database file", Value: cfg.DBFile},
 						cli.StringFlag{Name: "outDir", Usage: "The output directory", Value: "output"},
+						cli.StringFlag{Name: "scoring", Usage: "A JSON file with suspicion score weights (see README)"},
 					},
 					Action: func(c *cli.Context) error {
-						dbFile, outDir := c.String("dbFile"), c.String("outDir")
+						dbFile, outDir, scoringConfig := c.String("dbFile"), c.String("outDir"), c.String("scoring")
 						txHash := c.Args().Get(0)
 						if txHash == "" {
 							return fmt.Errorf("must specify tx hash")
 						}
-						cmd := dbcmds.NewTxInfoCommand(cfg.DatFileDir, dbFile, outDir, txHash)
+						cmd := dbcmds.NewTxInfoCommand(cfg.DatFileDir, dbFile, outDir, txHash, backend, scoringConfig)
 						return cmd.RunCommand()
 					},
 				},
@@ -51,11 +77,11 @@ func main() {
 					},
 					Action: func(c *cli.Context) error {
 						dbFile := c.String("dbFile")
-						blockHash := c.Args().Get(0)
-						if blockHash == "" {
-							return fmt.Errorf("must specify block hash")
+						blockHashOrHeight := c.Args().Get(0)
+						if blockHashOrHeight == "" {
+							return fmt.Errorf("must specify block hash or height")
 						}
-						cmd := dbcmds.NewBlockInfoCommand(cfg.DatFileDir, dbFile, blockHash)
+						cmd := dbcmds.NewBlockInfoCommand(cfg.DatFileDir, dbFile, blockHashOrHeight)
 						return cmd.RunCommand()
 					},
 				},
@@ -65,15 +91,41 @@ func main() {
 						cli.StringFlag{Name: "dbFile", Usage: "The database file", Value: cfg.DBFile},
 						cli.StringFlag{Name: "outDir", Usage: "The output directory", Value: "output"},
 						cli.StringFlag{Name: "direction, d", Usage: "'forward', 'backward', or 'both'", Value: "both"},
+						cli.StringFlag{Name: "strategy, s", Usage: "How to pick the next transaction: 'max-value', 'change-output', 'same-address[:<address>]', 'dust-pattern' or 'largest-input'", Value: "max-value"},
+						cli.UintFlag{Name: "limit, l", Usage: "Limits the number of transactions crawled", Value: 0},
+						cli.IntFlag{Name: "workers, w", Usage: "The number of transactions to analyze in parallel", Value: 1},
+						cli.StringFlag{Name: "on-error", Usage: "What to do with a transaction that can't be scanned: 'abort', 'skip' or 'retry'", Value: "abort"},
+					},
+					Action: func(c *cli.Context) error {
+						dbFile, outDir, direction, limit, workers := c.String("dbFile"), c.String("outDir"), c.String("direction"), c.Uint("limit"), c.Int("workers")
+						onError, strategy := c.String("on-error"), c.String("strategy")
+						txHash := c.Args().Get(0)
+						if txHash == "" {
+							return fmt.Errorf("must specify tx hash")
+						}
+						cmd := dbcmds.NewTxChainCommand(cfg.DatFileDir, dbFile, outDir, direction, strategy, limit, txHash, backend, workers, onError)
+						return cmd.RunCommand()
+					},
+				},
+				{
+					Name: "tx-graph",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "dbFile", Usage: "The database file", Value: cfg.DBFile},
+						cli.StringFlag{Name: "outDir", Usage: "The output directory", Value: "output"},
+						cli.UintFlag{Name: "depth, d", Usage: "Limits how many hops away from the starting transaction the crawl goes", Value: 0},
 						cli.UintFlag{Name: "limit, l", Usage: "Limits the number of transactions crawled", Value: 0},
+						cli.Int64Flag{Name: "min-value", Usage: "Don't follow spends or inputs carrying fewer satoshis than this", Value: 0},
+						cli.IntFlag{Name: "workers, w", Usage: "The number of transactions to analyze in parallel", Value: 1},
+						cli.StringFlag{Name: "on-error", Usage: "What to do with a transaction that can't be scanned: 'abort', 'skip' or 'retry'", Value: "abort"},
 					},
 					Action: func(c *cli.Context) error {
-						dbFile, outDir, direction, limit := c.String("dbFile"), c.String("outDir"), c.String("direction"), c.Uint("limit")
+						dbFile, outDir, depth, limit, minValue := c.String("dbFile"), c.String("outDir"), c.Uint("depth"), c.Uint("limit"), c.Int64("min-value")
+						workers, onError := c.Int("workers"), c.String("on-error")
 						txHash := c.Args().Get(0)
 						if txHash == "" {
 							return fmt.Errorf("must specify tx hash")
 						}
-						cmd := dbcmds.NewTxChainCommand(cfg.DatFileDir, dbFile, outDir, direction, limit, txHash)
+						cmd := dbcmds.NewTxGraphCommand(cfg.DatFileDir, dbFile, outDir, depth, limit, minValue, txHash, backend, workers, onError)
 						return cmd.RunCommand()
 					},
 				},
@@ -82,14 +134,124 @@ func main() {
 					Flags: []cli.Flag{
 						cli.StringFlag{Name: "dbFile", Usage: "The database file", Value: cfg.DBFile},
 						cli.StringFlag{Name: "outDir", Usage: "The output directory", Value: "output"},
+						cli.IntFlag{Name: "workers, w", Usage: "The number of transactions to analyze in parallel", Value: 1},
+						cli.StringFlag{Name: "on-error", Usage: "What to do with a transaction that can't be scanned: 'abort', 'skip' or 'retry'", Value: "abort"},
 					},
 					Action: func(c *cli.Context) error {
-						dbFile, outDir := c.String("dbFile"), c.String("outDir")
+						dbFile, outDir, workers, onError := c.String("dbFile"), c.String("outDir"), c.Int("workers"), c.String("on-error")
 						address := c.Args().Get(0)
 						if address == "" {
 							return fmt.Errorf("must specify address")
 						}
-						cmd := dbcmds.NewScanAddressCommand(cfg.DatFileDir, dbFile, outDir, address)
+						cmd := dbcmds.NewScanAddressCommand(cfg.DatFileDir, dbFile, outDir, address, backend, workers, onError)
+						return cmd.RunCommand()
+					},
+				},
+				{
+					Name: "satoshi-uploads",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "dbFile", Usage: "The database file", Value: cfg.DBFile},
+						cli.StringFlag{Name: "outDir", Usage: "The output directory", Value: "output"},
+						cli.Uint64Flag{Name: "startBlock", Usage: "The .dat file to start from (if no tx hash is given)"},
+						cli.Uint64Flag{Name: "endBlock", Usage: "The .dat file to end on (if no tx hash is given)"},
+					},
+					Action: func(c *cli.Context) error {
+						dbFile, outDir, startBlock, endBlock := c.String("dbFile"), c.String("outDir"), c.Uint64("startBlock"), c.Uint64("endBlock")
+						txHash := c.Args().Get(0)
+						cmd := dbcmds.NewSatoshiUploadsCommand(cfg.DatFileDir, dbFile, outDir, startBlock, endBlock, txHash, backend)
+						return cmd.RunCommand()
+					},
+				},
+				{
+					Name: "address-info",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "dbFile", Usage: "The database file", Value: cfg.DBFile},
+					},
+					Action: func(c *cli.Context) error {
+						dbFile := c.String("dbFile")
+						address := c.Args().Get(0)
+						if address == "" {
+							return fmt.Errorf("must specify address")
+						}
+						cmd := dbcmds.NewAddressInfoCommand(cfg.DatFileDir, dbFile, address)
+						return cmd.RunCommand()
+					},
+				},
+				{
+					Name: "utxos",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "dbFile", Usage: "The database file", Value: cfg.DBFile},
+						cli.StringFlag{Name: "outDir", Usage: "The output directory", Value: "output"},
+						cli.Int64Flag{Name: "height", Usage: "The block height of the snapshot (defaults to the tip of the local best chain)", Value: -1},
+						cli.BoolFlag{Name: "all", Usage: "Dump every unspent output instead of only the data-carrying ones"},
+					},
+					Action: func(c *cli.Context) error {
+						dbFile, outDir, height, all := c.String("dbFile"), c.String("outDir"), c.Int64("height"), c.Bool("all")
+						cmd := dbcmds.NewUTXOsCommand(cfg.DatFileDir, dbFile, outDir, height, all)
+						return cmd.RunCommand()
+					},
+				},
+				{
+					Name: "scan",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "dbFile", Usage: "The database file", Value: cfg.DBFile},
+						cli.StringFlag{Name: "outDir", Usage: "The output directory", Value: "output"},
+						cli.StringFlag{Name: "spec", Usage: "A JSON or YAML (.yaml/.yml) pipeline spec (the flags below add to it)"},
+						cli.StringSliceFlag{Name: "source", Usage: "A tx source, e.g. chain:<tx hash>, address:<address> or list:<file> (- for stdin)"},
+						cli.StringSliceFlag{Name: "datasource", Usage: "A data source (defaults to all of them)"},
+						cli.StringSliceFlag{Name: "detector", Usage: "A detector (defaults to all of them)"},
+						cli.StringSliceFlag{Name: "output", Usage: "An output (defaults to console, raw-data and csv)"},
+						cli.UintFlag{Name: "limit, l", Usage: "Limits the number of transactions crawled by chain sources"},
+						cli.StringFlag{Name: "strategy", Usage: "How chain sources pick the next transaction (see tx-chain --strategy)"},
+						cli.UintFlag{Name: "depth", Usage: "Limits how many hops graph sources go from their starting transaction"},
+						cli.Int64Flag{Name: "min-value", Usage: "Graph sources don't follow spends or inputs carrying fewer satoshis than this"},
+						cli.IntFlag{Name: "decode-depth", Usage: "How many layers of nested encoding the decoded data source unwraps (default 3)"},
+						cli.IntFlag{Name: "workers, w", Usage: "The number of transactions to analyze in parallel"},
+						cli.StringFlag{Name: "on-error", Usage: "What to do with a transaction that can't be scanned: 'abort', 'skip' or 'retry'"},
+						cli.BoolFlag{Name: "list", Usage: "List the available sources, data sources, detectors and outputs"},
+					},
+					Action: func(c *cli.Context) error {
+						if c.Bool("list") {
+							return dbcmds.NewScanComponentsCommand().RunCommand()
+						}
+
+						var spec pipeline.Spec
+						if c.String("spec") != "" {
+							var err error
+							spec, err = pipeline.LoadSpec(c.String("spec"))
+							if err != nil {
+								return err
+							}
+						}
+
+						spec.Sources = append(spec.Sources, c.StringSlice("source")...)
+						spec.DataSources = append(spec.DataSources, c.StringSlice("datasource")...)
+						spec.Detectors = append(spec.Detectors, c.StringSlice("detector")...)
+						spec.Outputs = append(spec.Outputs, c.StringSlice("output")...)
+						if c.IsSet("limit") {
+							spec.Limit = c.Uint("limit")
+						}
+						if c.IsSet("strategy") {
+							spec.Strategy = c.String("strategy")
+						}
+						if c.IsSet("depth") {
+							spec.Depth = c.Uint("depth")
+						}
+						if c.IsSet("min-value") {
+							spec.MinValue = c.Int64("min-value")
+						}
+						if c.IsSet("decode-depth") {
+							spec.DecodeDepth = c.Int("decode-depth")
+						}
+						if c.IsSet("workers") {
+							spec.Workers = c.Int("workers")
+						}
+						if c.IsSet("on-error") {
+							spec.OnError = c.String("on-error")
+						}
+
+						dbFile, outDir := c.String("dbFile"), c.String("outDir")
+						cmd := dbcmds.NewScanCommand(cfg.DatFileDir, dbFile, outDir, spec, backend)
 						return cmd.RunCommand()
 					},
 				},
@@ -110,6 +272,24 @@ func main() {
 		{
 			Name: "builddb",
 			Subcommands: []cli.Command{
+				{
+					Name: "all",
+					Flags: []cli.Flag{
+						cli.Uint64Flag{Name: "startBlock", Usage: "The block number to start from"},
+						cli.Uint64Flag{Name: "endBlock", Usage: "The block number to end on"},
+						cli.StringFlag{Name: "dbFile", Usage: "The database file", Value: cfg.DBFile},
+						cli.BoolFlag{Name: "force, f", Usage: "Force the indexer to re-index blocks that have already been indexed"},
+						cli.IntFlag{Name: "workers, w", Usage: "The number of .dat files to parse in parallel; each worker decodes a whole file, in memory, serially", Value: 4},
+					},
+					Action: func(c *cli.Context) error {
+						startBlock, endBlock, dbFile, force, workers := c.Uint64("startBlock"), c.Uint64("endBlock"), c.String("dbFile"), c.Bool("force"), c.Int("workers")
+						cmd, err := dbcmds.NewBuildBlockDBCommand(startBlock, endBlock, cfg.DatFileDir, dbFile, "all", force, workers)
+						if err != nil {
+							return err
+						}
+						return cmd.RunCommand()
+					},
+				},
 				{
 					Name: "blocks",
 					Flags: []cli.Flag{
@@ -120,7 +300,7 @@ func main() {
 					},
 					Action: func(c *cli.Context) error {
 						startBlock, endBlock, dbFile, force := c.Uint64("startBlock"), c.Uint64("endBlock"), c.String("dbFile"), c.Bool("force")
-						cmd, err := dbcmds.NewBuildBlockDBCommand(startBlock, endBlock, cfg.DatFileDir, dbFile, "blocks", force)
+						cmd, err := dbcmds.NewBuildBlockDBCommand(startBlock, endBlock, cfg.DatFileDir, dbFile, "blocks", force, 1)
 						if err != nil {
 							return err
 						}
@@ -137,7 +317,38 @@ func main() {
 					},
 					Action: func(c *cli.Context) error {
 						startBlock, endBlock, dbFile, force := c.Uint64("startBlock"), c.Uint64("endBlock"), c.String("dbFile"), c.Bool("force")
-						cmd, err := dbcmds.NewBuildBlockDBCommand(startBlock, endBlock, cfg.DatFileDir, dbFile, "transactions", force)
+						cmd, err := dbcmds.NewBuildBlockDBCommand(startBlock, endBlock, cfg.DatFileDir, dbFile, "transactions", force, 1)
+						if err != nil {
+							return err
+						}
+						return cmd.RunCommand()
+					},
+				},
+				{
+					Name: "addresses",
+					Flags: []cli.Flag{
+						cli.Uint64Flag{Name: "startBlock", Usage: "The block number to start from"},
+						cli.Uint64Flag{Name: "endBlock", Usage: "The block number to end on"},
+						cli.StringFlag{Name: "dbFile", Usage: "The database file", Value: cfg.DBFile},
+						cli.BoolFlag{Name: "force, f", Usage: "Force the indexer to re-index blocks that have already been indexed"},
+					},
+					Action: func(c *cli.Context) error {
+						startBlock, endBlock, dbFile, force := c.Uint64("startBlock"), c.Uint64("endBlock"), c.String("dbFile"), c.Bool("force")
+						cmd, err := dbcmds.NewBuildBlockDBCommand(startBlock, endBlock, cfg.DatFileDir, dbFile, "addresses", force, 1)
+						if err != nil {
+							return err
+						}
+						return cmd.RunCommand()
+					},
+				},
+				{
+					Name: "heights",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "dbFile", Usage: "The database file", Value: cfg.DBFile},
+					},
+					Action: func(c *cli.Context) error {
+						dbFile := c.String("dbFile")
+						cmd, err := dbcmds.NewBuildBlockDBCommand(0, 0, cfg.DatFileDir, dbFile, "heights", false, 1)
 						if err != nil {
 							return err
 						}
@@ -183,14 +394,15 @@ func main() {
 				cli.StringFlag{Name: "outDir, out", Usage: "The directory where carved files will be saved", Value: "output"},
 				cli.Uint64Flag{Name: "carveLen, len", Usage: "The amount of data to carve after each match"},
 				cli.StringFlag{Name: "carveExt, ext", Usage: "The extension of the files that are carved", Value: "dat"},
+				cli.BoolFlag{Name: "raw", Usage: "Search the whole (de-obfuscated) .dat file instead of only the transaction scripts"},
 			},
 			Action: func(c *cli.Context) error {
-				/*startBlock, endBlock,*/ blocks, outDir, carveLen, carveExt := c.IntSlice("block"), c.String("outDir") /*c.Uint64("startBlock"), c.Uint64("endBlock"),*/, c.Uint64("carveLen"), c.String("carveExt")
+				/*startBlock, endBlock,*/ blocks, outDir, carveLen, carveExt, raw := c.IntSlice("block"), c.String("outDir") /*c.Uint64("startBlock"), c.Uint64("endBlock"),*/, c.Uint64("carveLen"), c.String("carveExt"), c.Bool("raw")
 				hexPattern := c.Args().Get(0)
 				if hexPattern == "" {
 					return fmt.Errorf("must specify hex pattern to search for")
 				}
-				cmd := cmds.NewBinaryGrepCommand(blocks, carveLen, carveExt, outDir, cfg.DatFileDir, hexPattern)
+				cmd := cmds.NewBinaryGrepCommand(blocks, carveLen, carveExt, outDir, cfg.DatFileDir, hexPattern, raw)
 				return cmd.RunCommand()
 			},
 		},
@@ -203,7 +415,7 @@ func main() {
 			},
 			Action: func(c *cli.Context) error {
 				dbFile, outDir := c.String("dbFile"), c.String("outDir")
-				cmd := dbcmds.NewGraphCommand(cfg.DatFileDir, dbFile, outDir, "")
+				cmd := dbcmds.NewGraphCommand(cfg.DatFileDir, dbFile, outDir, "", backend)
 				return cmd.RunCommand()
 			},
 		},
@@ -218,7 +430,7 @@ func main() {
 			},
 			Action: func(c *cli.Context) error {
 				startBlock, endBlock, dbFile, outDir := c.Uint64("startBlock"), c.Uint64("endBlock"), c.String("dbFile"), c.String("outDir")
-				cmd := cmds.NewDumpTxFeesCommand(startBlock, endBlock, cfg.DatFileDir, dbFile, outDir)
+				cmd := cmds.NewDumpTxFeesCommand(startBlock, endBlock, cfg.DatFileDir, dbFile, outDir, backend)
 				return cmd.RunCommand()
 			},
 		},
@@ -248,10 +460,11 @@ func main() {
 				cli.Uint64Flag{Name: "startBlock", Usage: "The block number to start from"},
 				cli.Uint64Flag{Name: "endBlock", Usage: "The block number to end on"},
 				cli.StringFlag{Name: "outDir", Usage: "The output directory", Value: "output"},
+				cli.StringFlag{Name: "scoring", Usage: "A JSON file with suspicion score weights (see README)"},
 			},
 			Action: func(c *cli.Context) error {
-				startBlock, endBlock, outDir := c.Uint64("startBlock"), c.Uint64("endBlock"), c.String("outDir")
-				return cmds.FindSuspiciousTxs(startBlock, endBlock, cfg.DatFileDir, outDir)
+				startBlock, endBlock, outDir, scoringConfig := c.Uint64("startBlock"), c.Uint64("endBlock"), c.String("outDir"), c.String("scoring")
+				return cmds.FindSuspiciousTxs(startBlock, endBlock, cfg.DatFileDir, outDir, scoringConfig)
 			},
 		},
 
@@ -289,10 +502,11 @@ func main() {
 				cli.Uint64Flag{Name: "startBlock", Usage: "The block number to start from"},
 				cli.Uint64Flag{Name: "endBlock", Usage: "The block number to end on"},
 				cli.StringFlag{Name: "outDir", Usage: "The output directory", Value: "output"},
+				cli.StringFlag{Name: "signatures", Usage: "A file signature list to use instead of file-signatures.txt"},
 			},
 			Action: func(c *cli.Context) error {
 				startBlock, endBlock, outDir := c.Uint64("startBlock"), c.Uint64("endBlock"), c.String("outDir")
-				cmd := cmds.NewFindFileHeadersCommand(startBlock, endBlock, cfg.DatFileDir, outDir)
+				cmd := cmds.NewFindFileHeadersCommand(startBlock, endBlock, cfg.DatFileDir, outDir, c.String("signatures"))
 				return cmd.RunCommand()
 			},
 		},
@@ -314,13 +528,41 @@ func main() {
 	err = app.Run(os.Args)
 	if err != nil {
 		fmt.Println(err)
-		return
+		os.Exit(1)
 	}
 }
 
 type Config struct {
-	DatFileDir string `json:"datFileDir"`
-	DBFile     string `json:"dbFile"`
+	DatFileDir string         `json:"datFileDir"`
+	DBFile     string         `json:"dbFile"`
+	Offline    bool           `json:"offline"`
+	Backend    string         `json:"backend,omitempty"`
+	Bitcoind   BitcoindConfig `json:"bitcoind"`
+}
+
+type BitcoindConfig struct {
+	RPCURL      string `json:"rpcURL"`
+	RPCUser     string `json:"rpcUser"`
+	RPCPassword string `json:"rpcPassword"`
+}
+
+// lookupBackend returns the remote backend that BlockDB should fall back to, or nil in offline mode.
+func (cfg Config) lookupBackend() (blockdb.LookupBackend, error) {
+	if cfg.Offline {
+		return nil, nil
+	}
+
+	switch cfg.Backend {
+	case "", "blockchain.info":
+		return &blockdb.BlockchainInfoAPI{}, nil
+	case "bitcoind":
+		if cfg.Bitcoind.RPCURL == "" {
+			return nil, fmt.Errorf("the bitcoind backend needs \"bitcoind\": {\"rpcURL\": ...} in %v", configFilename)
+		}
+		return blockdb.NewBitcoindRPC(cfg.Bitcoind.RPCURL, cfg.Bitcoind.RPCUser, cfg.Bitcoind.RPCPassword), nil
+	default:
+		return nil, fmt.Errorf("unknown backend '%v' (must be 'blockchain.info' or 'bitcoind')", cfg.Backend)
+	}
 }
 
 var configFilename = filepath.Join(os.Getenv("HOME"), ".wlff-blockchain")
@@ -367,12 +609,19 @@ func getConfig() (Config, error) {
 }
 
 func saveConfig(cfg Config) error {
-	f, err := os.Create(configFilename)
+	// the config can hold the bitcoind RPC password, so only the owner may read it
+	f, err := os.OpenFile(configFilename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
+	// OpenFile doesn't change the mode of a config written by an older version
+	err = f.Chmod(0600)
+	if err != nil {
+		return err
+	}
+
 	j := json.NewEncoder(f)
 	j.SetIndent("", "    ")
 
@@ -388,7 +637,7 @@ func promptInput(prompt string) (string, error) {
 	var input string
 	var err error
 	for input == "" {
-		fmt.Printf(prompt)
+		fmt.Print(prompt)
 		input, err = scanStr()
 		if err != nil {
 			return "", err
@@ -1,20 +1,117 @@
 package detector
 
 import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
 	"github.com/spooktheducks/local-blockchain-parser/cmds/utils/aeskeyfind"
 	"github.com/spooktheducks/local-blockchain-parser/scanner"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/txhashsource"
 )
 
-type AESKeys struct{}
+type (
+	// AESKeys finds expanded AES key schedules.  If Decrypt is set, each key found is tried on the data in
+	// the same tx and, if DB is set, in the txs before and after it in the chain (see
+	// utils.TryAESDecryption).
+	AESKeys struct {
+		Decrypt bool
+		DB      *BlockDB
+
+		// used to recognize decrypted files (utils.DefaultFileSignatures if nil)
+		Signatures utils.FileSignatures
+	}
+
+	AESKeysResult struct {
+		aeskeyfind.AESResult
+		Decryptions []AESKeyDecryption
+	}
+
+	// AESKeyDecryption is data that one of the keys found decrypted to something recognizable.
+	AESKeyDecryption struct {
+		Key    aeskeyfind.FoundKey
+		TxHash chainhash.Hash
+		Source string // "txouts" or "txins"
+		utils.AESDecryption
+	}
+)
 
-// ensure AESKeys conforms to scanner.IDetector
-var _ scanner.IDetector = &AESKeys{}
+// ensure AESKeys conforms to scanner.ITxDetector
+var _ scanner.ITxDetector = &AESKeys{}
 
-// ensure PGPPacketResult conforms to scanner.IDetectionResult
-var _ scanner.IDetectionResult = &aeskeyfind.AESResult{}
+// ensure AESKeysResult conforms to scanner.IDetectionResult
+var _ scanner.IDetectionResult = AESKeysResult{}
 
 func (d *AESKeys) DetectData(data []byte) (scanner.IDetectionResult, error) {
-	return aeskeyfind.Detect(data), nil
+	return AESKeysResult{AESResult: aeskeyfind.Detect(data)}, nil
+}
+
+func (d *AESKeys) DetectTxData(tx *Tx, data []byte) (scanner.IDetectionResult, error) {
+	result := AESKeysResult{AESResult: aeskeyfind.Detect(data)}
+	if !d.Decrypt || result.AESResult.IsEmpty() {
+		return result, nil
+	}
+
+	txs, err := d.neighbouringTxs(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fk := range result.FoundKeys {
+		for _, t := range txs {
+			for _, source := range []string{"txouts", "txins"} {
+				var ciphertext []byte
+				if source == "txouts" {
+					ciphertext, err = t.ConcatNonOPDataFromTxOuts()
+				} else {
+					ciphertext, err = t.ConcatNonOPDataFromTxIns()
+				}
+				if err != nil {
+					// as with data sources, an error means there's no data of that type
+					continue
+				}
+
+				decryptions, err := utils.TryAESDecryption(fk.Key, ciphertext, d.Signatures)
+				if err != nil {
+					return nil, err
+				}
+				for _, dec := range decryptions {
+					result.Decryptions = append(result.Decryptions, AESKeyDecryption{Key: fk, TxHash: *t.Hash(), Source: source, AESDecryption: dec})
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// neighbouringTxs returns tx and, if the detector has a DB, the txs before and after it in the chain
+// (following the largest output, as the chain sources do by default).
+func (d *AESKeys) neighbouringTxs(tx *Tx) ([]*Tx, error) {
+	txs := []*Tx{tx}
+	if d.DB == nil {
+		return txs, nil
+	}
+
+	strategy := &txhashsource.MaxValueStrategy{DB: d.DB}
+	for _, step := range []func(*Tx) (chainhash.Hash, bool, error){strategy.Backward, strategy.Forward} {
+		hash, ok, err := step(tx)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		neighbour, err := d.DB.GetTx(hash)
+		if IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		txs = append(txs, neighbour)
+	}
+	return txs, nil
 }
 
 func (d *AESKeys) Name() string {
@@ -24,3 +121,37 @@ func (d *AESKeys) Name() string {
 func (d *AESKeys) SafeName() string {
 	return "aes-keys"
 }
+
+func (r AESKeysResult) DescriptionStrings() []string {
+	strs := r.AESResult.DescriptionStrings()
+	for _, dec := range r.Decryptions {
+		strs = append(strs, fmt.Sprintf("AES-%d key at offset %d decrypts %v %v: %v", dec.Key.Bits(), dec.Key.Offset, dec.TxHash, dec.Source, dec.Description()))
+	}
+	return strs
+}
+
+func (r AESKeysResult) IsEmpty() bool {
+	return r.AESResult.IsEmpty()
+}
+
+// CarvedFiles returns the decrypted data, so that the carved-files output writes it out.
+func (r AESKeysResult) CarvedFiles() []utils.CarvedFile {
+	files := make([]utils.CarvedFile, len(r.Decryptions))
+	for i, dec := range r.Decryptions {
+		ext := dec.Extension
+		if ext == "" {
+			ext = "txt"
+		}
+		mode := dec.Mode
+		if dec.IVFromData {
+			mode += "-iv"
+		}
+		files[i] = utils.CarvedFile{
+			Filetype:  fmt.Sprintf("aes-%s-key%d-decrypted-%v-%s", mode, dec.Key.Offset, dec.TxHash, dec.Source),
+			Extension: ext,
+			Offset:    dec.Offset,
+			Data:      dec.Data,
+		}
+	}
+	return files
+}
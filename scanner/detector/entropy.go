@@ -0,0 +1,31 @@
+package detector
+
+import (
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
+)
+
+// Entropy classifies regions of the data as text, compressed or encrypted, structured binary, or padding,
+// so that the blobs worth a closer look can be told apart from ordinary script data.
+type Entropy struct {
+	// defaults to utils.DefaultEntropyWindowSize
+	WindowSize int
+}
+
+// ensure Entropy conforms to scanner.IDetector
+var _ scanner.IDetector = &Entropy{}
+
+// ensure DataRegions conforms to scanner.IDetectionResult
+var _ scanner.IDetectionResult = utils.DataRegions{}
+
+func (d *Entropy) DetectData(data []byte) (scanner.IDetectionResult, error) {
+	return utils.ClassifyDataRegions(data, d.WindowSize), nil
+}
+
+func (d *Entropy) Name() string {
+	return "Entropy"
+}
+
+func (d *Entropy) SafeName() string {
+	return "entropy"
+}
@@ -0,0 +1,69 @@
+package detector
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils/knownhashes"
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
+)
+
+// KnownHashes finds digests of known files in tx data.  If Hashes is nil, the lists in
+// knownhashes.DefaultDir are used.
+type KnownHashes struct {
+	Hashes *knownhashes.Set
+}
+
+// ensure KnownHashes conforms to scanner.IDetector
+var _ scanner.IDetector = &KnownHashes{}
+
+// ensure knownhashes.Result conforms to scanner.IDetectionResult
+var _ scanner.IDetectionResult = knownhashes.Result{}
+
+// NewKnownHashes loads the hash lists at the given paths (files, or directories of them).
+func NewKnownHashes(paths ...string) (*KnownHashes, error) {
+	hashes, err := knownhashes.Load(paths...)
+	if err != nil {
+		return nil, err
+	}
+	return &KnownHashes{Hashes: hashes}, nil
+}
+
+func (d *KnownHashes) DetectData(data []byte) (scanner.IDetectionResult, error) {
+	hashes := d.Hashes
+	if hashes == nil {
+		hashes = defaultKnownHashes()
+	}
+	return hashes.Search(data), nil
+}
+
+func (d *KnownHashes) Name() string {
+	return "Known file hash"
+}
+
+func (d *KnownHashes) SafeName() string {
+	return "known-hashes"
+}
+
+var (
+	defaultHashes     *knownhashes.Set
+	defaultHashesOnce sync.Once
+)
+
+// defaultKnownHashes loads knownhashes.DefaultDir the first time it's needed.  Commands aren't always run
+// from the directory containing it, so if it's missing the detector just finds nothing.
+func defaultKnownHashes() *knownhashes.Set {
+	defaultHashesOnce.Do(func() {
+		hashes, err := knownhashes.Load(knownhashes.DefaultDir)
+		if os.IsNotExist(err) {
+			fmt.Printf("warning: %v not found, so known file hashes won't be detected\n", knownhashes.DefaultDir)
+			hashes = knownhashes.NewSet()
+		} else if err != nil {
+			fmt.Printf("warning: can't load known file hashes: %v\n", err)
+			hashes = knownhashes.NewSet()
+		}
+		defaultHashes = hashes
+	})
+	return defaultHashes
+}
@@ -5,7 +5,11 @@ import (
 	"github.com/spooktheducks/local-blockchain-parser/scanner"
 )
 
-type MagicBytes struct{}
+// MagicBytes finds file signatures in tx data and carves out the files they start.  If Signatures is nil,
+// utils.DefaultFileSignatures are used.
+type MagicBytes struct {
+	Signatures utils.FileSignatures
+}
 
 // ensure MagicBytes conforms to scanner.IDetector
 var _ scanner.IDetector = &MagicBytes{}
@@ -14,7 +18,10 @@ var _ scanner.IDetector = &MagicBytes{}
 var _ scanner.IDetectionResult = utils.MagicBytesResult{}
 
 func (d *MagicBytes) DetectData(data []byte) (scanner.IDetectionResult, error) {
-	return utils.SearchDataForMagicFileBytes(data), nil
+	if d.Signatures == nil {
+		return utils.SearchDataForMagicFileBytes(data), nil
+	}
+	return d.Signatures.Search(data), nil
 }
 
 func (d *MagicBytes) Name() string {
@@ -0,0 +1,84 @@
+package detector
+
+import (
+	"bytes"
+	"fmt"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
+)
+
+type (
+	// FakeMultisigKeys reports the bare multisig outputs of the tx whose fake pubkeys (see
+	// utils.MultisigOutput) carry data found in the data being scanned, and how many of their keys are fake.
+	// It needs the tx, so DetectData alone never finds anything.
+	FakeMultisigKeys struct{}
+
+	FakeMultisigKeysResult struct {
+		Outputs []FakeMultisigOutput
+	}
+
+	FakeMultisigOutput struct {
+		TxOutIndex int
+		Required   int
+		Keys       int
+		FakeKeys   int
+	}
+)
+
+// ensure FakeMultisigKeys conforms to scanner.ITxDetector
+var _ scanner.ITxDetector = &FakeMultisigKeys{}
+
+// ensure FakeMultisigKeysResult conforms to scanner.IDetectionResult
+var _ scanner.IDetectionResult = FakeMultisigKeysResult{}
+
+func (d *FakeMultisigKeys) DetectData(data []byte) (scanner.IDetectionResult, error) {
+	return FakeMultisigKeysResult{}, nil
+}
+
+func (d *FakeMultisigKeys) DetectTxData(tx *Tx, data []byte) (scanner.IDetectionResult, error) {
+	result := FakeMultisigKeysResult{}
+	for i, txout := range tx.MsgTx().TxOut {
+		m, ok := utils.ParseMultisigOutput(txout.PkScript)
+		if !ok {
+			continue
+		}
+
+		fakeKeys := m.FakeKeys()
+		if len(fakeKeys) == 0 || !containsAnyPayload(data, fakeKeys) {
+			continue
+		}
+		result.Outputs = append(result.Outputs, FakeMultisigOutput{TxOutIndex: i, Required: m.Required, Keys: len(m.Keys), FakeKeys: len(fakeKeys)})
+	}
+	return result, nil
+}
+
+func containsAnyPayload(data []byte, keys []utils.MultisigKey) bool {
+	for _, k := range keys {
+		if bytes.Contains(data, k.Payload()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *FakeMultisigKeys) Name() string {
+	return "Fake multisig keys"
+}
+
+func (d *FakeMultisigKeys) SafeName() string {
+	return "fake-multisig-keys"
+}
+
+func (r FakeMultisigKeysResult) DescriptionStrings() []string {
+	strs := make([]string, len(r.Outputs))
+	for i, o := range r.Outputs {
+		strs[i] = fmt.Sprintf("txout %d: %d of %d keys are fake (%d-of-%d multisig)", o.TxOutIndex, o.FakeKeys, o.Keys, o.Required, o.Keys)
+	}
+	return strs
+}
+
+func (r FakeMultisigKeysResult) IsEmpty() bool {
+	return len(r.Outputs) == 0
+}
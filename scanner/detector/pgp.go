@@ -5,7 +5,11 @@ import (
 	"github.com/spooktheducks/local-blockchain-parser/scanner"
 )
 
-type PGPPackets struct{}
+// PGPPackets finds armored PGP blocks and OpenPGP packets in tx data.  Packets involving the WikiLeaks key
+// or one of WatchedFingerprints are flagged.
+type PGPPackets struct {
+	WatchedFingerprints []string
+}
 
 // ensure PGPPackets conforms to scanner.IDetector
 var _ scanner.IDetector = &PGPPackets{}
@@ -14,7 +18,7 @@ var _ scanner.IDetector = &PGPPackets{}
 var _ scanner.IDetectionResult = &utils.PGPPacketResult{}
 
 func (d *PGPPackets) DetectData(data []byte) (scanner.IDetectionResult, error) {
-	return utils.FindPGPPackets(data), nil
+	return utils.FindPGPPackets(data, d.WatchedFingerprints...), nil
 }
 
 func (d *PGPPackets) Name() string {
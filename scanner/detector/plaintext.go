@@ -6,10 +6,15 @@ import (
 )
 
 type (
-	Plaintext struct{}
+	// Plaintext finds runs of UTF-8 and UTF-16 text that look like English.
+	Plaintext struct {
+		// default to utils.DefaultMinTextLength and utils.DefaultMinTextScore
+		MinLength int
+		MinScore  float64
+	}
 
 	PlaintextResult struct {
-		TextData []byte
+		Runs utils.TextRuns
 	}
 )
 
@@ -20,8 +25,7 @@ var _ scanner.IDetector = &Plaintext{}
 var _ scanner.IDetectionResult = PlaintextResult{}
 
 func (d *Plaintext) DetectData(bs []byte) (scanner.IDetectionResult, error) {
-	nonText := utils.StripNonTextBytes(bs)
-	return PlaintextResult{TextData: nonText}, nil
+	return PlaintextResult{Runs: utils.FindTextRuns(bs, d.MinLength, d.MinScore)}, nil
 }
 
 func (d *Plaintext) Name() string {
@@ -33,9 +37,13 @@ func (d *Plaintext) SafeName() string {
 }
 
 func (r PlaintextResult) DescriptionStrings() []string {
-	return []string{string(r.TextData)}
+	strs := make([]string, len(r.Runs))
+	for i, run := range r.Runs {
+		strs[i] = run.Description()
+	}
+	return strs
 }
 
 func (r PlaintextResult) IsEmpty() bool {
-	return r.TextData == nil || len(r.TextData) < 8
+	return len(r.Runs) == 0
 }
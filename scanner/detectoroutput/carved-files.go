@@ -0,0 +1,63 @@
+package detectoroutput
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/detector"
+)
+
+// CarvedFiles writes the files carved by detectors (magic-bytes, and aes-keys' decryptions) to OutDir/carved.
+type CarvedFiles struct {
+	OutDir string
+}
+
+// carvedFilesResult is implemented by detection results that carve files out of the data.
+type carvedFilesResult interface {
+	CarvedFiles() []utils.CarvedFile
+}
+
+// ensure CarvedFiles conforms to scanner.IDetectorOutput
+var _ scanner.IDetectorOutput = &CarvedFiles{}
+
+// ensure MagicBytesResult conforms to carvedFilesResult
+var _ carvedFilesResult = utils.MagicBytesResult{}
+
+// ensure AESKeysResult conforms to carvedFilesResult
+var _ carvedFilesResult = detector.AESKeysResult{}
+
+func (o *CarvedFiles) PrintOutput(txHash chainhash.Hash, txDataSource scanner.ITxDataSource, dataResult scanner.ITxDataSourceResult, detector scanner.IDetector, result scanner.IDetectionResult) error {
+	carver, ok := result.(carvedFilesResult)
+	if !ok {
+		return nil
+	}
+
+	carved := carver.CarvedFiles()
+	if len(carved) == 0 {
+		return nil
+	}
+
+	dir := filepath.Join(o.OutDir, "carved")
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range carved {
+		filename := filepath.Join(dir, fmt.Sprintf("%s-%s-%s", txHash.String(), utils.SafeFilename(dataResult.SourceName()), c.Filename()))
+		err := utils.CreateAndWriteFile(filename, c.Data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *CarvedFiles) Close() error {
+	return nil
+}
@@ -6,12 +6,17 @@ import (
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
 	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
 	"github.com/spooktheducks/local-blockchain-parser/scanner"
 )
 
 type CSV struct {
-	OutDir   string
+	OutDir string
+
+	// if set, a block height column is included (requires the "heights" index)
+	DB *BlockDB
+
 	csvFiles map[string]*utils.ConditionalFile
 }
 
@@ -25,7 +30,11 @@ func (o *CSV) PrintOutput(txHash chainhash.Hash, txDataSource scanner.ITxDataSou
 			o.csvFiles = make(map[string]*utils.ConditionalFile)
 		}
 		csvFile = utils.NewConditionalFile(filepath.Join(o.OutDir, detector.SafeName()+".csv"))
-		_, err := csvFile.WriteString("tx hash,data source,description\n", false)
+		header := "tx hash,data source,description\n"
+		if o.DB != nil {
+			header = "tx hash,block height,data source,description\n"
+		}
+		_, err := csvFile.WriteString(header, false)
 		if err != nil {
 			return err
 		}
@@ -33,8 +42,13 @@ func (o *CSV) PrintOutput(txHash chainhash.Hash, txDataSource scanner.ITxDataSou
 		o.csvFiles[detector.SafeName()] = csvFile
 	}
 
+	txCols := txHash.String()
+	if o.DB != nil {
+		txCols += "," + o.DB.TxBlockHeightString(txHash)
+	}
+
 	for _, str := range result.DescriptionStrings() {
-		_, err := csvFile.WriteString(fmt.Sprintf("%s,%s,%s\n", txHash.String(), dataResult.SourceName(), str), true)
+		_, err := csvFile.WriteString(fmt.Sprintf("%s,%s,%s\n", txCols, dataResult.SourceName(), str), true)
 		if err != nil {
 			return err
 		}
@@ -19,7 +19,7 @@ var _ scanner.IDetectorOutput = &RawData{}
 
 func (o *RawData) PrintOutput(txHash chainhash.Hash, txDataSource scanner.ITxDataSource, dataResult scanner.ITxDataSourceResult, detector scanner.IDetector, result scanner.IDetectionResult) error {
 	if !result.IsEmpty() {
-		filename := filepath.Join(o.OutDir, fmt.Sprintf("%s-%s-%s.dat", detector.SafeName(), txHash.String(), dataResult.SourceName()))
+		filename := filepath.Join(o.OutDir, fmt.Sprintf("%s-%s-%s.dat", detector.SafeName(), txHash.String(), utils.SafeFilename(dataResult.SourceName())))
 		return utils.CreateAndWriteFile(filename, dataResult.RawData())
 	}
 	return nil
@@ -58,8 +58,12 @@ func (o *CSVTxAnalysis) appendColumnIfUnique(c string) {
 }
 
 func (o *CSVTxAnalysis) Close() error {
-	// add 'tx-hash' as the first column
-	o.columns = append([]string{"tx hash"}, o.columns...)
+	// add 'tx-hash' (and 'block height' if we can look it up) as the first columns
+	if o.DB != nil {
+		o.columns = append([]string{"tx hash", "block height"}, o.columns...)
+	} else {
+		o.columns = append([]string{"tx hash"}, o.columns...)
+	}
 	// o.columns = append(o.columns, "fee")
 
 	// open the csv file
@@ -85,6 +89,9 @@ func (o *CSVTxAnalysis) Close() error {
 			if col == "tx hash" {
 				row = append(row, txHash.String())
 				continue
+			} else if col == "block height" {
+				row = append(row, o.DB.TxBlockHeightString(txHash))
+				continue
 			}
 
 			val := ""
@@ -0,0 +1,379 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/detector"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/detectoroutput"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/scoring"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/txdatasource"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/txdatasourceoutput"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/txhashoutput"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/txhashsource"
+)
+
+// Env is everything a component might need in order to be constructed.
+type Env struct {
+	DB         *BlockDB
+	DATFileDir string
+	OutDir     string
+
+	// the maximum number of txs crawled by the chain and graph sources (0 means no limit)
+	Limit uint
+
+	// how far the graph source goes from its starting tx (0 means no limit), and the smallest value (in
+	// satoshis) of the spends and inputs it follows
+	Depth    uint
+	MinValue int64
+
+	// the name of the NextTxStrategy used by the chain sources (see txhashsource.NewNextTxStrategy)
+	Strategy string
+
+	// how many layers of encoding the decoded data source unwraps (0 means txdatasource.DefaultDecodeDepth)
+	DecodeDepth int
+
+	// read by the "list:-" source
+	Stdin io.Reader
+}
+
+type (
+	// Each factory receives the part of the component's name after the first colon (e.g. the tx hash in
+	// "chain:<hash>"), or "" if there isn't one.
+	TxHashSourceFactory func(env Env, arg string) (scanner.ITxHashSource, error)
+	TxDataSourceFactory func(env Env, arg string) (scanner.ITxDataSource, error)
+	DetectorFactory     func(env Env, arg string) (scanner.IDetector, error)
+
+	// OutputFactory returns a value implementing at least one of scanner.ITxHashOutput,
+	// scanner.ITxDataSourceOutput, scanner.IDetectorOutput and scanner.ISkippedTxOutput.
+	OutputFactory func(env Env, arg string) (interface{}, error)
+)
+
+var TxHashSources = map[string]TxHashSourceFactory{
+	"tx": func(env Env, arg string) (scanner.ITxHashSource, error) {
+		hash, err := utils.HashFromString(arg)
+		if err != nil {
+			return nil, err
+		}
+		return txhashsource.NewListTxHashSource([]chainhash.Hash{hash}), nil
+	},
+	"chain": func(env Env, arg string) (scanner.ITxHashSource, error) {
+		hash, err := utils.HashFromString(arg)
+		if err != nil {
+			return nil, err
+		}
+		strategy, err := txhashsource.NewNextTxStrategy(env.DB, env.Strategy, hash)
+		if err != nil {
+			return nil, err
+		}
+		return txhashsource.NewChain(env.DB, hash, env.Limit, strategy), nil
+	},
+	"forward-chain": func(env Env, arg string) (scanner.ITxHashSource, error) {
+		hash, err := utils.HashFromString(arg)
+		if err != nil {
+			return nil, err
+		}
+		strategy, err := txhashsource.NewNextTxStrategy(env.DB, env.Strategy, hash)
+		if err != nil {
+			return nil, err
+		}
+		return txhashsource.NewForwardChain(env.DB, hash, env.Limit, strategy), nil
+	},
+	"backward-chain": func(env Env, arg string) (scanner.ITxHashSource, error) {
+		hash, err := utils.HashFromString(arg)
+		if err != nil {
+			return nil, err
+		}
+		strategy, err := txhashsource.NewNextTxStrategy(env.DB, env.Strategy, hash)
+		if err != nil {
+			return nil, err
+		}
+		return txhashsource.NewBackwardChain(env.DB, hash, env.Limit, strategy), nil
+	},
+	"graph": func(env Env, arg string) (scanner.ITxHashSource, error) {
+		hash, err := utils.HashFromString(arg)
+		if err != nil {
+			return nil, err
+		}
+		return txhashsource.NewGraph(env.DB, hash, env.Depth, env.Limit, env.MinValue), nil
+	},
+	"address": func(env Env, arg string) (scanner.ITxHashSource, error) {
+		if arg == "" {
+			return nil, fmt.Errorf("must specify an address (address:<address>)")
+		}
+		return txhashsource.NewAddressTxHashSource(env.DB, arg), nil
+	},
+	"list": func(env Env, arg string) (scanner.ITxHashSource, error) {
+		if arg == "" {
+			return nil, fmt.Errorf("must specify a file, or - for stdin (list:<file>)")
+		}
+		return txhashsource.NewListTxHashSourceFromFile(arg, env.Stdin)
+	},
+	"datfiles": func(env Env, arg string) (scanner.ITxHashSource, error) {
+		// datfiles:<start> or datfiles:<start>-<end>
+		parts := strings.SplitN(arg, "-", 2)
+		start, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("bad .dat file range '%v' (datfiles:<start>[-<end>])", arg)
+		}
+		end := start
+		if len(parts) == 2 {
+			end, err = strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("bad .dat file range '%v' (datfiles:<start>[-<end>])", arg)
+			}
+		}
+		return txhashsource.NewDATFileTxHashSource(env.DATFileDir, start, end), nil
+	},
+}
+
+var TxDataSources = map[string]TxDataSourceFactory{}
+
+var Detectors = map[string]DetectorFactory{
+	// aes-keys:decrypt also tries each key found on the data in the same tx and the txs next to it in the chain
+	"aes-keys": func(env Env, arg string) (scanner.IDetector, error) {
+		switch arg {
+		case "":
+			return &detector.AESKeys{}, nil
+		case "decrypt":
+			return &detector.AESKeys{Decrypt: true, DB: env.DB}, nil
+		default:
+			return nil, fmt.Errorf("bad argument '%v' (aes-keys or aes-keys:decrypt)", arg)
+		}
+	},
+
+	// entropy:<window size> changes the size of the windows the data is classified in
+	"entropy": func(env Env, arg string) (scanner.IDetector, error) {
+		if arg == "" {
+			return &detector.Entropy{}, nil
+		}
+		windowSize, err := strconv.Atoi(arg)
+		if err != nil || windowSize <= 0 {
+			return nil, fmt.Errorf("bad window size '%v' (entropy:<window size>)", arg)
+		}
+		return &detector.Entropy{WindowSize: windowSize}, nil
+	},
+
+	// known-hashes:<path>[,<path>...] loads hash lists from the given files or directories instead of
+	// wlhashes/
+	"known-hashes": func(env Env, arg string) (scanner.IDetector, error) {
+		if arg == "" {
+			return &detector.KnownHashes{}, nil
+		}
+		return detector.NewKnownHashes(strings.Split(arg, ",")...)
+	},
+
+	// magic-bytes:<signature file> uses the signatures in the file instead of file-signatures.txt
+	"magic-bytes": func(env Env, arg string) (scanner.IDetector, error) {
+		if arg == "" {
+			return &detector.MagicBytes{}, nil
+		}
+		signatures, err := utils.LoadFileSignatures(arg)
+		if err != nil {
+			return nil, err
+		}
+		return &detector.MagicBytes{Signatures: signatures}, nil
+	},
+
+	// pgp-data:<fingerprint file> also flags packets involving the keys listed in the file
+	"pgp-data": func(env Env, arg string) (scanner.IDetector, error) {
+		if arg == "" {
+			return &detector.PGPPackets{}, nil
+		}
+		fingerprints, err := utils.LoadPGPFingerprints(arg)
+		if err != nil {
+			return nil, err
+		}
+		return &detector.PGPPackets{WatchedFingerprints: fingerprints}, nil
+	},
+}
+
+var Outputs = map[string]OutputFactory{
+	// tx hash outputs
+	"hashes": func(env Env, arg string) (interface{}, error) {
+		return &txhashoutput.HashOnly{OutDir: env.OutDir, Filename: "transactions.txt"}, nil
+	},
+	"opreturn": func(env Env, arg string) (interface{}, error) {
+		return &txhashoutput.OpReturn{OutDir: env.OutDir, Filename: "transactions-opreturn.txt"}, nil
+	},
+	"nonop": func(env Env, arg string) (interface{}, error) {
+		return &txhashoutput.NonOp{OutDir: env.OutDir, Filename: "transactions-nonop.txt"}, nil
+	},
+	"inputscripts": func(env Env, arg string) (interface{}, error) {
+		return &txhashoutput.InputScript{OutDir: env.OutDir, Filename: "transactions-inputscripts.txt"}, nil
+	},
+	"inputscripts-nonop": func(env Env, arg string) (interface{}, error) {
+		return &txhashoutput.InputScriptNonOP{OutDir: env.OutDir, Filename: "transactions-inputscripts-nonop.txt"}, nil
+	},
+
+	// data source outputs
+	"raw-data": func(env Env, arg string) (interface{}, error) {
+		return &txdatasourceoutput.RawData{OutDir: env.OutDir}, nil
+	},
+	"raw-data-each-datasource": func(env Env, arg string) (interface{}, error) {
+		return &txdatasourceoutput.RawDataEachDataSource{OutDir: env.OutDir}, nil
+	},
+
+	// detector outputs
+	"console": func(env Env, arg string) (interface{}, error) {
+		return &detectoroutput.Console{Prefix: "  - "}, nil
+	},
+	"detected-raw-data": func(env Env, arg string) (interface{}, error) {
+		return &detectoroutput.RawData{OutDir: env.OutDir}, nil
+	},
+	"carved-files": func(env Env, arg string) (interface{}, error) {
+		return &detectoroutput.CarvedFiles{OutDir: env.OutDir}, nil
+	},
+	"csv": func(env Env, arg string) (interface{}, error) {
+		return &detectoroutput.CSV{OutDir: env.OutDir, DB: env.DB}, nil
+	},
+	"tx-analysis": func(env Env, arg string) (interface{}, error) {
+		return &detectoroutput.CSVTxAnalysis{OutDir: env.OutDir, DB: env.DB}, nil
+	},
+
+	// scores every tx with the pipeline's detectors (scores:<config file> to override the weights)
+	"scores": func(env Env, arg string) (interface{}, error) {
+		config, err := scoring.LoadConfig(arg)
+		if err != nil {
+			return nil, err
+		}
+		return &scoring.Output{Engine: scoring.NewEngine(config), OutDir: env.OutDir, Filename: "tx-scores.csv"}, nil
+	},
+}
+
+func init() {
+	// data sources and detectors without any configuration are registered under their own names
+	for _, ds := range []scanner.ITxDataSource{
+		&txdatasource.InputScript{},
+		&txdatasource.InputScriptNonOP{},
+		&txdatasource.InputScriptPushdata{},
+		&txdatasource.InputScriptFirstPushdata{},
+		&txdatasource.InputScriptsConcat{},
+		&txdatasource.InputWitness{},
+		&txdatasource.InputWitnessScriptPushdata{},
+		&txdatasource.InputWitnessConcat{},
+		&txdatasource.OutputScript{},
+		&txdatasource.OutputScript{OrderByValue: true},
+		&txdatasource.OutputScript{SkipMaxValueTxOut: true},
+		&txdatasource.OutputScript{SkipMaxValueTxOut: true, OrderByValue: true},
+		&txdatasource.OutputScriptsSatoshi{},
+		&txdatasource.OutputScriptOpReturn{},
+		&txdatasource.OutputScriptsConcat{},
+		&txdatasource.OutputScriptMultisig{},
+		&txdatasource.OutputScriptMultisig{Concat: true},
+	} {
+		RegisterTxDataSource(ds)
+	}
+
+	// decoded:<data source>[,<data source>...] decodes the results of the given data sources instead of all
+	// the others
+	TxDataSources["decoded"] = func(env Env, arg string) (scanner.ITxDataSource, error) {
+		names := []string{}
+		if arg == "" {
+			for _, name := range TxDataSourceNames() {
+				if name != "decoded" {
+					names = append(names, name)
+				}
+			}
+		} else {
+			names = strings.Split(arg, ",")
+		}
+
+		ds := &txdatasource.Decoded{MaxDepth: env.DecodeDepth}
+		for _, fullName := range names {
+			name, wrappedArg := splitName(fullName)
+			factory, exists := TxDataSources[name]
+			if !exists || name == "decoded" {
+				return nil, fmt.Errorf("can't decode data source '%v'", name)
+			}
+
+			wrapped, err := factory(env, wrappedArg)
+			if err != nil {
+				return nil, err
+			}
+			ds.DataSources = append(ds.DataSources, wrapped)
+		}
+		return ds, nil
+	}
+
+	for _, d := range []scanner.IDetector{
+		&detector.FakeMultisigKeys{},
+		&detector.Plaintext{},
+	} {
+		RegisterDetector(d)
+	}
+}
+
+// RegisterTxDataSource registers a data source that takes no arguments under its Name().
+func RegisterTxDataSource(ds scanner.ITxDataSource) {
+	TxDataSources[ds.Name()] = func(env Env, arg string) (scanner.ITxDataSource, error) {
+		if arg != "" {
+			return nil, fmt.Errorf("data source %v doesn't take an argument", ds.Name())
+		}
+		return ds, nil
+	}
+}
+
+// RegisterDetector registers a detector that takes no arguments under its SafeName().
+func RegisterDetector(d scanner.IDetector) {
+	Detectors[d.SafeName()] = func(env Env, arg string) (scanner.IDetector, error) {
+		if arg != "" {
+			return nil, fmt.Errorf("detector %v doesn't take an argument", d.SafeName())
+		}
+		return d, nil
+	}
+}
+
+// splitName splits "name:arg" into its parts.
+func splitName(str string) (string, string) {
+	parts := strings.SplitN(str, ":", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func sortedNames(names []string) []string {
+	sort.Strings(names)
+	return names
+}
+
+func TxHashSourceNames() []string {
+	names := []string{}
+	for name := range TxHashSources {
+		names = append(names, name)
+	}
+	return sortedNames(names)
+}
+
+func TxDataSourceNames() []string {
+	names := []string{}
+	for name := range TxDataSources {
+		names = append(names, name)
+	}
+	return sortedNames(names)
+}
+
+func DetectorNames() []string {
+	names := []string{}
+	for name := range Detectors {
+		names = append(names, name)
+	}
+	return sortedNames(names)
+}
+
+func OutputNames() []string {
+	names := []string{}
+	for name := range Outputs {
+		names = append(names, name)
+	}
+	return sortedNames(names)
+}
@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// decodeYAMLSpec reads the small subset of YAML that a spec needs: top-level "key: value" pairs whose values
+// are scalars, flow lists ("[a, b]") or block lists ("- item" lines), plus comments.  Anything else
+// (nested maps, multi-line strings, anchors, ...) is an error.  The keys are the same as the JSON ones.
+func decodeYAMLSpec(r io.Reader) (Spec, error) {
+	fields := map[string]interface{}{}
+	var listKey string // the key whose block list is being read, if any
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimRight(stripYAMLComment(scanner.Text()), " \t")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if listKey == "" {
+				return Spec{}, fmt.Errorf("line %v: list item outside of a list", lineNum)
+			}
+			value, err := parseYAMLScalar(strings.TrimSpace(strings.TrimPrefix(trimmed, "-")))
+			if err != nil {
+				return Spec{}, fmt.Errorf("line %v: %v", lineNum, err)
+			}
+			fields[listKey] = append(fields[listKey].([]interface{}), value)
+			continue
+		}
+
+		if line != trimmed {
+			return Spec{}, fmt.Errorf("line %v: unexpected indentation (only top-level keys and lists are supported)", lineNum)
+		}
+
+		key, rest, ok := splitYAMLKey(line)
+		if !ok {
+			return Spec{}, fmt.Errorf("line %v: expected \"key: value\"", lineNum)
+		} else if _, exists := fields[key]; exists {
+			return Spec{}, fmt.Errorf("line %v: duplicate key %v", lineNum, key)
+		}
+
+		listKey = ""
+		switch {
+		case rest == "":
+			// a block list follows
+			listKey = key
+			fields[key] = []interface{}{}
+
+		case strings.HasPrefix(rest, "["):
+			if !strings.HasSuffix(rest, "]") {
+				return Spec{}, fmt.Errorf("line %v: flow lists must be on one line", lineNum)
+			}
+			list := []interface{}{}
+			for _, item := range splitYAMLFlowList(rest[1 : len(rest)-1]) {
+				value, err := parseYAMLScalar(item)
+				if err != nil {
+					return Spec{}, fmt.Errorf("line %v: %v", lineNum, err)
+				}
+				list = append(list, value)
+			}
+			fields[key] = list
+
+		default:
+			value, err := parseYAMLScalar(rest)
+			if err != nil {
+				return Spec{}, fmt.Errorf("line %v: %v", lineNum, err)
+			}
+			fields[key] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Spec{}, err
+	}
+
+	// let encoding/json map the fields onto the spec, so that both formats use the same keys and types
+	bs, err := json.Marshal(fields)
+	if err != nil {
+		return Spec{}, err
+	}
+
+	var spec Spec
+	err = json.Unmarshal(bs, &spec)
+	return spec, err
+}
+
+// splitYAMLKey splits "key: value" (or "key:") into its key and value.
+func splitYAMLKey(line string) (key, rest string, ok bool) {
+	i := strings.Index(line, ": ")
+	if i < 0 {
+		if !strings.HasSuffix(line, ":") {
+			return "", "", false
+		}
+		i = len(line) - 1
+	}
+
+	key = strings.TrimSpace(line[:i])
+	if key == "" || strings.ContainsAny(key, "\"'[]{}") {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(line[i+1:]), true
+}
+
+// stripYAMLComment removes a "#" comment, unless the "#" is inside quotes or part of a word.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitYAMLFlowList splits the inside of "[a, b, c]" on the commas that aren't inside quotes.
+func splitYAMLFlowList(s string) []string {
+	items := []string{}
+	if strings.TrimSpace(s) == "" {
+		return items
+	}
+
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(items, strings.TrimSpace(s[start:]))
+}
+
+// parseYAMLScalar returns a quoted or plain scalar as a string, number or bool.
+func parseYAMLScalar(s string) (interface{}, error) {
+	switch {
+	case s == "":
+		return nil, fmt.Errorf("empty value")
+	case strings.HasPrefix(s, "\""):
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad double-quoted string %v", s)
+		}
+		return unquoted, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("bad single-quoted string %v", s)
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	case strings.ContainsAny(s[:1], "[]{}&*!|>%@`"):
+		return nil, fmt.Errorf("unsupported YAML value %v", s)
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	}
+
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	} else if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	return s, nil
+}
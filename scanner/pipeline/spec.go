@@ -0,0 +1,196 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/txhashoutput"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/txhashsource"
+)
+
+// Spec describes a scanner pipeline by the registered names of its parts, so that new combinations can be
+// tried without a rebuild.  Names that take an argument are written as "name:arg" (e.g. "chain:<tx hash>").
+type Spec struct {
+	// the txs from every source are scanned, one source after another
+	Sources []string `json:"sources"`
+
+	// defaults to every registered data source
+	DataSources []string `json:"datasources"`
+
+	// defaults to every registered detector
+	Detectors []string `json:"detectors"`
+
+	// defaults to "console", "raw-data" and "csv"
+	Outputs []string `json:"outputs"`
+
+	// the maximum number of txs crawled by the chain and graph sources (0 means no limit)
+	Limit uint `json:"limit"`
+
+	// how far the graph sources go from their starting tx (0 means no limit)
+	Depth uint `json:"depth"`
+
+	// graph sources don't follow spends or inputs carrying fewer satoshis than this
+	MinValue int64 `json:"minValue"`
+
+	// how the chain sources pick the next tx (defaults to "max-value")
+	Strategy string `json:"strategy"`
+
+	// how many layers of encoding the decoded data source unwraps (defaults to 3)
+	DecodeDepth int `json:"decodeDepth"`
+
+	Workers int `json:"workers"`
+
+	// "abort" (the default), "skip" or "retry"
+	OnError string `json:"onError"`
+}
+
+var defaultOutputs = []string{"console", "raw-data", "csv"}
+
+// LoadSpec reads a spec file.  Files ending in .yaml or .yml are read as YAML (see decodeYAMLSpec for the
+// subset that's supported), and anything else as JSON.
+func LoadSpec(filename string) (Spec, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return Spec{}, err
+	}
+	defer f.Close()
+
+	var spec Spec
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		spec, err = decodeYAMLSpec(f)
+	default:
+		err = json.NewDecoder(f).Decode(&spec)
+	}
+	if err != nil {
+		return Spec{}, fmt.Errorf("reading %v: %v", filename, err)
+	}
+	return spec, nil
+}
+
+// Build constructs a Scanner from the spec.  The scanner always reports skipped txs to skipped-txs.csv in
+// env.OutDir.
+func (spec Spec) Build(env Env) (*scanner.Scanner, error) {
+	if len(spec.Sources) == 0 {
+		return nil, fmt.Errorf("a pipeline needs at least one tx source")
+	}
+
+	if spec.OnError == "" {
+		spec.OnError = "abort"
+	}
+	errorPolicy, err := scanner.ParseErrorPolicy(spec.OnError)
+	if err != nil {
+		return nil, err
+	}
+
+	env.Limit = spec.Limit
+	env.Strategy = spec.Strategy
+	env.Depth = spec.Depth
+	env.MinValue = spec.MinValue
+	env.DecodeDepth = spec.DecodeDepth
+
+	s := &scanner.Scanner{
+		DB:          env.DB,
+		Workers:     spec.Workers,
+		ErrorPolicy: errorPolicy,
+	}
+
+	sources := []scanner.ITxHashSource{}
+	for _, fullName := range spec.Sources {
+		name, arg := splitName(fullName)
+		factory, exists := TxHashSources[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown tx source '%v'", name)
+		}
+
+		src, err := factory(env, arg)
+		if err != nil {
+			return nil, fmt.Errorf("tx source '%v': %v", fullName, err)
+		}
+		sources = append(sources, src)
+	}
+
+	if len(sources) == 1 {
+		s.TxHashSource = sources[0]
+	} else {
+		s.TxHashSource = txhashsource.NewConcatTxHashSource(sources...)
+	}
+
+	dataSourceNames := spec.DataSources
+	if len(dataSourceNames) == 0 {
+		dataSourceNames = TxDataSourceNames()
+	}
+	for _, fullName := range dataSourceNames {
+		name, arg := splitName(fullName)
+		factory, exists := TxDataSources[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown data source '%v'", name)
+		}
+
+		ds, err := factory(env, arg)
+		if err != nil {
+			return nil, fmt.Errorf("data source '%v': %v", fullName, err)
+		}
+		s.TxDataSources = append(s.TxDataSources, ds)
+	}
+
+	detectorNames := spec.Detectors
+	if len(detectorNames) == 0 {
+		detectorNames = DetectorNames()
+	}
+	for _, fullName := range detectorNames {
+		name, arg := splitName(fullName)
+		factory, exists := Detectors[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown detector '%v'", name)
+		}
+
+		d, err := factory(env, arg)
+		if err != nil {
+			return nil, fmt.Errorf("detector '%v': %v", fullName, err)
+		}
+		s.Detectors = append(s.Detectors, d)
+	}
+
+	outputNames := spec.Outputs
+	if len(outputNames) == 0 {
+		outputNames = defaultOutputs
+	}
+	for _, fullName := range outputNames {
+		name, arg := splitName(fullName)
+		factory, exists := Outputs[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown output '%v'", name)
+		}
+
+		out, err := factory(env, arg)
+		if err != nil {
+			return nil, fmt.Errorf("output '%v': %v", fullName, err)
+		}
+		addOutput(s, out)
+	}
+
+	s.SkippedTxOutputs = append(s.SkippedTxOutputs, &txhashoutput.SkippedTxs{OutDir: env.OutDir, Filename: "skipped-txs.csv"})
+
+	return s, nil
+}
+
+// addOutput adds out to every list of outputs whose interface it implements.
+func addOutput(s *scanner.Scanner, out interface{}) {
+	if o, ok := out.(scanner.ITxHashOutput); ok {
+		s.TxHashOutputs = append(s.TxHashOutputs, o)
+	}
+	if o, ok := out.(scanner.ITxDataSourceOutput); ok {
+		s.TxDataSourceOutputs = append(s.TxDataSourceOutputs, o)
+	}
+	if o, ok := out.(scanner.IDetectorOutput); ok {
+		s.DetectorOutputs = append(s.DetectorOutputs, o)
+	}
+	if o, ok := out.(scanner.ISkippedTxOutput); ok {
+		s.SkippedTxOutputs = append(s.SkippedTxOutputs, o)
+	}
+}
@@ -0,0 +1,194 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/internal/testdat"
+)
+
+func TestSpecBuildAndRun(T *testing.T) {
+	genesis := chaincfg.MainNetParams.GenesisBlock
+	bl := wire.NewMsgBlock(&genesis.Header)
+	txHashes := []string{}
+	for i := 0; i < 3; i++ {
+		tx := genesis.Transactions[0].Copy()
+		tx.LockTime = uint32(i)
+		bl.AddTransaction(tx)
+		txHashes = append(txHashes, tx.TxHash().String())
+	}
+
+	dir := testdat.WriteDATDir(T, []*wire.MsgBlock{bl})
+	defer os.RemoveAll(dir)
+
+	db, err := NewBlockDB(filepath.Join(dir, "test.db"), dir, nil)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.IndexDATFileTransactions(0, 0, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	env := Env{
+		DB:         db,
+		DATFileDir: dir,
+		OutDir:     dir,
+		Stdin:      strings.NewReader("# comment\n" + txHashes[2] + ",extra column\n\n" + txHashes[0] + "\n"),
+	}
+
+	_, err = Spec{Sources: []string{"tx:" + txHashes[0]}, Detectors: []string{"no-such-detector"}}.Build(env)
+	if err == nil {
+		T.Fatal("expected an error for an unknown detector")
+	}
+
+	s, err := Spec{
+		Sources:     []string{"list:-", "tx:" + txHashes[1]},
+		DataSources: []string{"txout-script"},
+		Detectors:   []string{"magic-bytes"},
+		Outputs:     []string{"hashes"},
+	}.Build(env)
+	if err != nil {
+		T.Fatal(err)
+	} else if len(s.TxDataSources) != 1 || len(s.Detectors) != 1 || len(s.TxHashOutputs) != 1 || len(s.DetectorOutputs) != 0 {
+		T.Fatalf("unexpected pipeline: %+v", s)
+	}
+
+	err = s.Run(context.Background())
+	if err != nil {
+		T.Fatal(err)
+	}
+	err = s.Close()
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "transactions.txt"))
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	expected := txHashes[2] + "\n" + txHashes[0] + "\n" + txHashes[1] + "\n"
+	if string(bs) != expected {
+		T.Fatalf("expected transactions.txt to be:\n%v\ngot:\n%v", expected, string(bs))
+	}
+}
+
+func TestDecodedWrapsEveryDataSource(T *testing.T) {
+	plaintext := "a message that was base64 encoded before being stored"
+	script, err := txscript.NullDataScript([]byte(base64.StdEncoding.EncodeToString([]byte(plaintext))))
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 0xffffffff}, []byte{0x51}))
+	msgTx.AddTxOut(wire.NewTxOut(0, script))
+	tx := &Tx{Tx: btcutil.NewTx(msgTx)}
+
+	// some of the wrapped sources (e.g. outputs-satoshi) fail on this tx, which mustn't hide the others' data
+	ds, err := TxDataSources["decoded"](Env{}, "")
+	if err != nil {
+		T.Fatal(err)
+	}
+	results, err := ds.GetData(tx)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	found := false
+	for _, r := range results {
+		if r.SourceName() == "txout-script-opreturn-0|base64" && string(r.RawData()) == plaintext {
+			found = true
+		}
+	}
+	if !found {
+		names := []string{}
+		for _, r := range results {
+			names = append(names, r.SourceName())
+		}
+		T.Fatalf("expected the OP_RETURN data to be decoded from base64, got %v", names)
+	}
+}
+
+func TestLoadSpecYAML(T *testing.T) {
+	dir, err := ioutil.TempDir("", "pipeline-test")
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	jsonSpec := `{
+    "sources": ["chain:5c593b7b71063a01f4128c98e36fb407b00a87454e67b39ad5f8820ebc1b2ad5", "list:-"],
+    "datasources": ["txout-script-byvalue", "outputs-satoshi"],
+    "detectors": ["magic-bytes", "plaintext"],
+    "outputs": ["csv"],
+    "limit": 130,
+    "minValue": 546,
+    "strategy": "same-address:1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa",
+    "workers": 4,
+    "onError": "skip"
+}`
+	yamlSpec := `# the same spec as YAML
+---
+sources:
+  - chain:5c593b7b71063a01f4128c98e36fb407b00a87454e67b39ad5f8820ebc1b2ad5
+  - "list:-"   # stdin
+datasources: [txout-script-byvalue, 'outputs-satoshi']
+detectors:
+- magic-bytes
+- plaintext
+outputs: [csv]
+limit: 130
+minValue: 546
+strategy: same-address:1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa
+workers: 4
+onError: skip
+`
+
+	load := func(name, contents string) (Spec, error) {
+		filename := filepath.Join(dir, name)
+		err := ioutil.WriteFile(filename, []byte(contents), 0666)
+		if err != nil {
+			T.Fatal(err)
+		}
+		return LoadSpec(filename)
+	}
+
+	expected, err := load("spec.json", jsonSpec)
+	if err != nil {
+		T.Fatal(err)
+	}
+	spec, err := load("spec.yaml", yamlSpec)
+	if err != nil {
+		T.Fatal(err)
+	} else if !reflect.DeepEqual(spec, expected) {
+		T.Fatalf("got %+v, expected %+v", spec, expected)
+	}
+
+	for _, bad := range []string{
+		"sources:\n  nested: map\n",
+		"limit: [1, 2]\n",
+		"- chain:abc\n",
+		"description: |\n  text\n",
+	} {
+		_, err := load("bad.yml", bad)
+		if err == nil {
+			T.Errorf("expected an error for %q", bad)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package scanner
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 
@@ -18,10 +22,25 @@ type (
 		DetectorOutputs     []IDetectorOutput
 
 		DB *BlockDB
+
+		// the number of txs to fetch and analyze in parallel.  0 or 1 scans serially.
+		Workers int
+
+		// what to do with a tx that can't be fetched or analyzed.  txs that aren't in the local index are
+		// skipped under every policy.
+		ErrorPolicy ErrorPolicy
+
+		// the number of times ErrorPolicyRetry retries a tx before skipping it (defaults to 3)
+		Retries int
+
+		// receive every tx that was skipped, along with the reason
+		SkippedTxOutputs []ISkippedTxOutput
 	}
 
+	// ITxHashSource produces the txs to scan.  NextHash returns false once the source is exhausted.  It
+	// returns ctx's error once ctx is cancelled.
 	ITxHashSource interface {
-		NextHash() (chainhash.Hash, bool)
+		NextHash(ctx context.Context) (chainhash.Hash, bool, error)
 	}
 
 	ITxHashOutput interface {
@@ -50,6 +69,13 @@ type (
 		SafeName() string
 	}
 
+	// ITxDetector is implemented by detectors that also look at the rest of the tx the data came from.  The
+	// scanner calls DetectTxData instead of DetectData for them.
+	ITxDetector interface {
+		IDetector
+		DetectTxData(tx *Tx, data []byte) (IDetectionResult, error)
+	}
+
 	IDetectionResult interface {
 		DescriptionStrings() []string
 		IsEmpty() bool
@@ -59,8 +85,46 @@ type (
 		PrintOutput(txHash chainhash.Hash, txDataSource ITxDataSource, dataResult ITxDataSourceResult, detector IDetector, result IDetectionResult) error
 		Close() error
 	}
+
+	ISkippedTxOutput interface {
+		OutputSkippedTx(txHash chainhash.Hash, err error) error
+		Close() error
+	}
 )
 
+type ErrorPolicy int
+
+const (
+	// stop the scan at the first tx that can't be fetched or analyzed
+	ErrorPolicyAbort ErrorPolicy = iota
+
+	// skip the tx and carry on
+	ErrorPolicySkip
+
+	// retry the tx a few times with an increasing delay (for flaky remote backends), then skip it
+	ErrorPolicyRetry
+)
+
+func ParseErrorPolicy(str string) (ErrorPolicy, error) {
+	switch str {
+	case "abort":
+		return ErrorPolicyAbort, nil
+	case "skip":
+		return ErrorPolicySkip, nil
+	case "retry":
+		return ErrorPolicyRetry, nil
+	}
+	return 0, fmt.Errorf("error policy must be 'abort', 'skip' or 'retry' (got '%v')", str)
+}
+
+const (
+	defaultRetries = 3
+	retryDelay     = time.Second
+)
+
+// ErrInterrupted is returned by Scanner.Run when its context is cancelled.
+var ErrInterrupted = errors.New("scan interrupted")
+
 func (s *Scanner) Close() error {
 	for _, out := range s.TxHashOutputs {
 		err := out.Close()
@@ -83,57 +147,283 @@ func (s *Scanner) Close() error {
 		}
 	}
 
+	for _, out := range s.SkippedTxOutputs {
+		err := out.Close()
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (s *Scanner) Run() error {
-	for {
-		txHash, exists := s.TxHashSource.NextHash()
-		if !exists {
-			break
-		}
+// Run scans every tx from TxHashSource until the source runs out or ctx is cancelled, in which case it
+// returns ErrInterrupted.  Either way, the outputs should still be closed afterwards so that the results so
+// far are written out.
+//
+// With more than one worker, txs are fetched and analyzed in parallel, but the results are still passed to
+// the outputs one tx at a time, in the order that the source produced them, so the output files are the same
+// as with a serial scan.
+func (s *Scanner) Run(ctx context.Context) error {
+	if s.Workers <= 1 {
+		for {
+			txHash, exists, err := s.TxHashSource.NextHash(ctx)
+			if ctx.Err() != nil {
+				return ErrInterrupted
+			} else if err != nil {
+				return err
+			} else if !exists {
+				return nil
+			}
 
-		tx, err := s.DB.GetTx(txHash)
-		if err != nil {
-			fmt.Printf("cannot get tx %v\n", txHash)
-			return err
-		}
+			scan := s.scanTxWithRetries(ctx, txHash)
+			if ctx.Err() != nil {
+				return ErrInterrupted
+			}
 
-		for _, out := range s.TxHashOutputs {
-			err := out.OutputTx(tx)
+			err = s.outputTx(scan)
 			if err != nil {
 				return err
 			}
 		}
+	}
+
+	return s.runParallel(ctx)
+}
+
+type (
+	// txScan holds everything that was found in a tx, so that it can be analyzed on one goroutine and
+	// passed to the outputs on another.
+	txScan struct {
+		seq    int
+		txHash chainhash.Hash
+		tx     *Tx
+		err    error
+
+		dataSources []txDataSourceScan
+	}
+
+	txDataSourceScan struct {
+		source  ITxDataSource
+		results []ITxDataSourceResult
+
+		// indexed by [data result][detector]
+		detections [][]IDetectionResult
+	}
+)
 
-		for _, txDataSource := range s.TxDataSources {
-			dataResults, err := txDataSource.GetData(tx)
+func (s *Scanner) runParallel(parentCtx context.Context) error {
+	ctx, cancel := context.WithCancel(parentCtx)
+	defer cancel()
+
+	chHashes := make(chan txScan)
+	chScans := make(chan txScan, s.Workers)
+
+	// limits how far the workers can get ahead of the tx that's next in line for output
+	inFlight := make(chan struct{}, s.Workers*4)
+
+	// only read once chScans is closed, which happens after the producer has exited
+	var sourceErr error
+
+	go func() {
+		defer close(chHashes)
+		for seq := 0; ; seq++ {
+			select {
+			case inFlight <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			txHash, exists, err := s.TxHashSource.NextHash(ctx)
 			if err != nil {
-				// if a data source returns an error, we assume that means there's
-				// no data of that type, so we just continue to the next source
-				continue
+				sourceErr = err
+				return
+			} else if !exists {
+				return
+			}
+
+			select {
+			case chHashes <- txScan{seq: seq, txHash: txHash}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < s.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range chHashes {
+				scan := s.scanTxWithRetries(ctx, job.txHash)
+				scan.seq = job.seq
+
+				select {
+				case chScans <- scan:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(chScans)
+	}()
+
+	pending := map[int]txScan{}
+	next := 0
+	var outputErr error
+	for scan := range chScans {
+		if outputErr != nil || ctx.Err() != nil {
+			// draining, so that the producer and workers can exit
+			continue
+		}
+
+		pending[scan.seq] = scan
+
+		for ctx.Err() == nil {
+			scan, exists := pending[next]
+			if !exists {
+				break
+			}
+			delete(pending, next)
+			next++
+			<-inFlight
+
+			outputErr = s.outputTx(scan)
+			if outputErr != nil {
+				cancel()
+				break
 			}
+		}
+	}
+
+	if parentCtx.Err() != nil {
+		return ErrInterrupted
+	} else if outputErr != nil {
+		return outputErr
+	}
+	return sourceErr
+}
+
+// scanTxWithRetries calls scanTx, retrying errors other than the tx not being found when the error policy
+// says so.
+func (s *Scanner) scanTxWithRetries(ctx context.Context, txHash chainhash.Hash) txScan {
+	scan := s.scanTx(txHash)
+	if s.ErrorPolicy != ErrorPolicyRetry {
+		return scan
+	}
+
+	retries := s.Retries
+	if retries <= 0 {
+		retries = defaultRetries
+	}
+
+	for attempt := 1; attempt <= retries && scan.err != nil && !IsNotFound(scan.err); attempt++ {
+		fmt.Printf("retrying tx %v in %v (attempt %v of %v): %v\n", txHash, time.Duration(attempt)*retryDelay, attempt, retries, scan.err)
+
+		select {
+		case <-time.After(time.Duration(attempt) * retryDelay):
+		case <-ctx.Done():
+			return scan
+		}
+
+		scan = s.scanTx(txHash)
+	}
+	return scan
+}
+
+// scanTx fetches a tx and runs the data sources and detectors on it.  It doesn't touch the outputs, so it
+// can run on any goroutine.
+func (s *Scanner) scanTx(txHash chainhash.Hash) txScan {
+	scan := txScan{txHash: txHash}
+
+	scan.tx, scan.err = s.DB.GetTx(txHash)
+	if scan.err != nil {
+		return scan
+	}
+
+	for _, txDataSource := range s.TxDataSources {
+		dataResults, err := txDataSource.GetData(scan.tx)
+		if err != nil {
+			// if a data source returns an error, we assume that means there's
+			// no data of that type, so we just continue to the next source
+			continue
+		}
 
-			for _, out := range s.TxDataSourceOutputs {
-				err := out.PrintOutput(txHash, txDataSource, dataResults)
+		dsScan := txDataSourceScan{source: txDataSource, results: dataResults}
+		for _, dataResult := range dataResults {
+			detections := make([]IDetectionResult, len(s.Detectors))
+			for i, detector := range s.Detectors {
+				detections[i], err = DetectTxData(detector, scan.tx, dataResult.RawData())
 				if err != nil {
-					return err
+					scan.err = err
+					return scan
 				}
 			}
+			dsScan.detections = append(dsScan.detections, detections)
+		}
+
+		scan.dataSources = append(scan.dataSources, dsScan)
+	}
+
+	return scan
+}
+
+// DetectTxData runs d on data taken from tx, passing it the tx if it's an ITxDetector.
+func DetectTxData(d IDetector, tx *Tx, data []byte) (IDetectionResult, error) {
+	if txDetector, ok := d.(ITxDetector); ok {
+		return txDetector.DetectTxData(tx, data)
+	}
+	return d.DetectData(data)
+}
 
-			for _, dataResult := range dataResults {
-				for _, detector := range s.Detectors {
-					detectionResult, err := detector.DetectData(dataResult.RawData())
+// outputTx passes the results of scanTx to the outputs, or records the tx as skipped if it couldn't be
+// scanned and the error policy allows it.
+func (s *Scanner) outputTx(scan txScan) error {
+	if scan.err != nil {
+		// a tx that simply isn't available locally (for example, in offline mode) is always skipped, since
+		// retrying won't change that.
+		if s.ErrorPolicy == ErrorPolicyAbort && !IsNotFound(scan.err) {
+			fmt.Printf("cannot scan tx %v\n", scan.txHash)
+			return scan.err
+		}
+
+		fmt.Printf("skipping tx %v (%v)\n", scan.txHash, scan.err)
+		for _, out := range s.SkippedTxOutputs {
+			err := out.OutputSkippedTx(scan.txHash, scan.err)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, out := range s.TxHashOutputs {
+		err := out.OutputTx(scan.tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, dsScan := range scan.dataSources {
+		for _, out := range s.TxDataSourceOutputs {
+			err := out.PrintOutput(scan.txHash, dsScan.source, dsScan.results)
+			if err != nil {
+				return err
+			}
+		}
+
+		for resultIdx, dataResult := range dsScan.results {
+			for detectorIdx, detector := range s.Detectors {
+				for _, out := range s.DetectorOutputs {
+					err := out.PrintOutput(scan.txHash, dsScan.source, dataResult, detector, dsScan.detections[resultIdx][detectorIdx])
 					if err != nil {
 						return err
 					}
-
-					for _, out := range s.DetectorOutputs {
-						err := out.PrintOutput(txHash, txDataSource, dataResult, detector, detectionResult)
-						if err != nil {
-							return err
-						}
-					}
 				}
 			}
 		}
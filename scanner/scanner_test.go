@@ -0,0 +1,169 @@
+package scanner
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/internal/testdat"
+)
+
+type (
+	testHashSource struct {
+		hashes []chainhash.Hash
+	}
+
+	testDataSource struct{}
+
+	testDataResult struct {
+		data []byte
+	}
+
+	// testDetector takes longer on earlier txs, so that parallel workers finish out of order
+	testDetector struct{}
+
+	testDetectionResult struct {
+		lockTime uint32
+	}
+
+	// testOutput records every call, in the order it was made
+	testOutput struct {
+		log []string
+	}
+)
+
+func (s *testHashSource) NextHash(ctx context.Context) (chainhash.Hash, bool, error) {
+	if len(s.hashes) == 0 {
+		return chainhash.Hash{}, false, nil
+	}
+	hash := s.hashes[0]
+	s.hashes = s.hashes[1:]
+	return hash, true, nil
+}
+
+func (ds testDataSource) Name() string { return "test" }
+
+func (ds testDataSource) GetData(tx *Tx) ([]ITxDataSourceResult, error) {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, tx.MsgTx().LockTime)
+	return []ITxDataSourceResult{testDataResult{data}}, nil
+}
+
+func (r testDataResult) SourceName() string { return "test" }
+func (r testDataResult) RawData() []byte    { return r.data }
+
+func (d testDetector) Name() string     { return "test" }
+func (d testDetector) SafeName() string { return "test" }
+
+func (d testDetector) DetectData(data []byte) (IDetectionResult, error) {
+	lockTime := binary.LittleEndian.Uint32(data)
+	time.Sleep(time.Duration(100-lockTime) * 100 * time.Microsecond)
+	return testDetectionResult{lockTime}, nil
+}
+
+func (r testDetectionResult) DescriptionStrings() []string { return []string{fmt.Sprint(r.lockTime)} }
+func (r testDetectionResult) IsEmpty() bool                { return false }
+
+func (o *testOutput) OutputTx(tx *Tx) error {
+	o.log = append(o.log, "tx "+tx.Hash().String())
+	return nil
+}
+
+func (o *testOutput) PrintOutput(txHash chainhash.Hash, ds ITxDataSource, results []ITxDataSourceResult) error {
+	o.log = append(o.log, fmt.Sprintf("data %v %x", txHash.String(), results[0].RawData()))
+	return nil
+}
+
+func (o *testOutput) OutputSkippedTx(txHash chainhash.Hash, err error) error {
+	o.log = append(o.log, "skipped "+txHash.String())
+	return nil
+}
+
+func (o *testOutput) Close() error { return nil }
+
+// testDetectorOutput appends to the same log as a testOutput
+type testDetectorOutput struct{ *testOutput }
+
+func (o testDetectorOutput) PrintOutput(txHash chainhash.Hash, ds ITxDataSource, dataResult ITxDataSourceResult, detector IDetector, result IDetectionResult) error {
+	o.log = append(o.log, fmt.Sprintf("detect %v %v", txHash.String(), result.DescriptionStrings()))
+	return nil
+}
+
+func TestParallelScanIsOrdered(T *testing.T) {
+	genesis := chaincfg.MainNetParams.GenesisBlock
+	blocks := []*wire.MsgBlock{}
+	hashes := []chainhash.Hash{}
+	for i := 0; i < 5; i++ {
+		bl := wire.NewMsgBlock(&genesis.Header)
+		bl.Header.Nonce = uint32(i)
+		for j := 0; j < 8; j++ {
+			tx := genesis.Transactions[0].Copy()
+			tx.LockTime = uint32(i*8 + j)
+			bl.AddTransaction(tx)
+			hashes = append(hashes, tx.TxHash())
+		}
+		blocks = append(blocks, bl)
+	}
+
+	// txs that aren't in the index are skipped
+	hashes = append(hashes[:3], append([]chainhash.Hash{{0x01}}, hashes[3:]...)...)
+
+	dir := testdat.WriteDATDir(T, blocks)
+	defer os.RemoveAll(dir)
+
+	db, err := NewBlockDB(filepath.Join(dir, "test.db"), dir, nil)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.IndexDATFileTransactions(0, 0, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	scan := func(workers int) []string {
+		out := &testOutput{}
+		s := &Scanner{
+			DB:                  db,
+			Workers:             workers,
+			TxHashSource:        &testHashSource{hashes: append([]chainhash.Hash{}, hashes...)},
+			TxHashOutputs:       []ITxHashOutput{out},
+			TxDataSources:       []ITxDataSource{testDataSource{}},
+			TxDataSourceOutputs: []ITxDataSourceOutput{out},
+			Detectors:           []IDetector{testDetector{}},
+			DetectorOutputs:     []IDetectorOutput{testDetectorOutput{out}},
+			SkippedTxOutputs:    []ISkippedTxOutput{out},
+		}
+
+		err := s.Run(context.Background())
+		if err != nil {
+			T.Fatal(err)
+		}
+		return out.log
+	}
+
+	serial := scan(1)
+	if len(serial) != 40*3+1 {
+		T.Fatalf("expected %v output calls, got %v", 40*3+1, len(serial))
+	} else if serial[9] != "skipped "+hashes[3].String() {
+		T.Fatalf("expected the missing tx to be reported as skipped, got %v", serial[9])
+	}
+
+	for _, workers := range []int{2, 8} {
+		parallel := scan(workers)
+		if !reflect.DeepEqual(serial, parallel) {
+			T.Fatalf("output with %v workers differs from a serial scan", workers)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package scoring
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/detector"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/txdatasource"
+)
+
+// the longest detail kept for a reason, since some detectors (e.g. plaintext) describe what they found with
+// the data itself
+const maxDetailLen = 80
+
+type Engine struct {
+	Config Config
+
+	// used by RunFullSuite
+	DataSources []scanner.ITxDataSource
+	Detectors   []scanner.IDetector
+}
+
+// NewEngine returns an engine whose RunFullSuite runs every known check.
+func NewEngine(config Config) *Engine {
+	return &Engine{
+		Config: config,
+		DataSources: []scanner.ITxDataSource{
+			&txdatasource.InputScript{},
+			&txdatasource.InputScriptPushdata{},
+			&txdatasource.InputScriptsConcat{},
+			&txdatasource.InputWitness{},
+			&txdatasource.InputWitnessScriptPushdata{},
+			&txdatasource.OutputScript{},
+			&txdatasource.OutputScriptsConcat{},
+			&txdatasource.OutputScriptsSatoshi{},
+			&txdatasource.OutputScriptOpReturn{},
+			&txdatasource.OutputScriptMultisig{},
+		},
+		Detectors: []scanner.IDetector{
+			&detector.AESKeys{},
+			&detector.MagicBytes{},
+			&detector.KnownHashes{},
+			&detector.PGPPackets{},
+			&detector.Plaintext{},
+			&detector.FakeMultisigKeys{},
+		},
+	}
+}
+
+// RunFullSuite runs the tx-level checks, and every detector on every data source, and returns the tx's
+// score.
+func (e *Engine) RunFullSuite(tx *Tx) (TxScore, error) {
+	score := e.ScoreTx(tx)
+
+	for _, ds := range e.DataSources {
+		dataResults, err := ds.GetData(tx)
+		if err != nil {
+			// as in the scanner, an error means there's no data of that type
+			continue
+		}
+
+		for _, dataResult := range dataResults {
+			for _, d := range e.Detectors {
+				result, err := scanner.DetectTxData(d, tx, dataResult.RawData())
+				if err != nil {
+					return TxScore{}, err
+				}
+				e.AddDetection(&score, ds, d, result)
+			}
+		}
+	}
+
+	return score, nil
+}
+
+// ScoreTx starts a score with the checks that look at the tx as a whole.
+func (e *Engine) ScoreTx(tx *Tx) TxScore {
+	score := TxScore{TxHash: *tx.Hash()}
+
+	if tx.HasSuspiciousOutputValues() {
+		e.addFeature(&score, FeatureSuspiciousOutputValues, fmt.Sprintf("%v of %v outputs carry 1 satoshi", len(tx.MsgTx().TxOut)-1, len(tx.MsgTx().TxOut)))
+	}
+
+	if data, err := tx.ConcatNonOPDataFromTxOuts(); err == nil {
+		if satoshiData, err := utils.GetSatoshiEncodedData(data); err == nil {
+			e.addFeature(&score, FeatureSatoshiEncoded, fmt.Sprintf("%v bytes", len(satoshiData)))
+		}
+	}
+
+	return score
+}
+
+// AddDetection adds a detector's result to a score.  Empty results are ignored.
+func (e *Engine) AddDetection(score *TxScore, ds scanner.ITxDataSource, d scanner.IDetector, result scanner.IDetectionResult) {
+	if result.IsEmpty() {
+		return
+	}
+
+	detail := fmt.Sprintf("%v: %v", ds.Name(), strings.Join(result.DescriptionStrings(), "; "))
+	if len(detail) > maxDetailLen {
+		// don't cut a multi-byte character in half
+		n := maxDetailLen
+		for n > 0 && !utf8.RuneStart(detail[n]) {
+			n--
+		}
+		detail = detail[:n] + "..."
+	}
+	e.addFeature(score, d.SafeName(), detail)
+}
+
+func (e *Engine) addFeature(score *TxScore, feature string, detail string) {
+	for i := range score.Reasons {
+		if score.Reasons[i].Feature == feature {
+			score.Reasons[i].Details = appendIfUnique(score.Reasons[i].Details, detail)
+			return
+		}
+	}
+
+	weight := e.Config.Weight(feature)
+	score.Reasons = append(score.Reasons, Reason{Feature: feature, Weight: weight, Details: []string{detail}})
+	score.Score += weight
+	score.Level = e.Config.Level(score.Score)
+}
+
+func appendIfUnique(strs []string, str string) []string {
+	for _, s := range strs {
+		if s == str {
+			return strs
+		}
+	}
+	return append(strs, str)
+}
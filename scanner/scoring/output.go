@@ -0,0 +1,94 @@
+package scoring
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
+)
+
+// ensure that Output conforms to ITxHashOutput and IDetectorOutput
+var _ scanner.ITxHashOutput = &Output{}
+var _ scanner.IDetectorOutput = &Output{}
+
+// Output scores every tx that passes through a Scanner, using the scanner's own data sources and detectors,
+// and writes the scores to a CSV file, most suspicious first.  It has to be added to both the scanner's
+// TxHashOutputs and DetectorOutputs.
+type Output struct {
+	Engine   *Engine
+	OutDir   string
+	Filename string
+
+	scores []TxScore
+	index  map[chainhash.Hash]int
+	closed bool
+}
+
+func (o *Output) OutputTx(tx *Tx) error {
+	if o.index == nil {
+		o.index = map[chainhash.Hash]int{}
+	}
+
+	o.index[*tx.Hash()] = len(o.scores)
+	o.scores = append(o.scores, o.Engine.ScoreTx(tx))
+	return nil
+}
+
+func (o *Output) PrintOutput(txHash chainhash.Hash, txDataSource scanner.ITxDataSource, dataResult scanner.ITxDataSourceResult, d scanner.IDetector, result scanner.IDetectionResult) error {
+	idx, exists := o.index[txHash]
+	if !exists {
+		return fmt.Errorf("scoring output: got a detection for tx %v before the tx itself", txHash)
+	}
+
+	o.Engine.AddDetection(&o.scores[idx], txDataSource, d, result)
+	return nil
+}
+
+// Scores returns the scores so far, most suspicious first.
+func (o *Output) Scores() []TxScore {
+	scores := append([]TxScore{}, o.scores...)
+	SortByScore(scores)
+	return scores
+}
+
+func (o *Output) Close() error {
+	// the scanner closes us once as a tx hash output and once as a detector output
+	if o.closed {
+		return nil
+	}
+	o.closed = true
+
+	return WriteCSV(filepath.Join(o.OutDir, o.Filename), o.Scores())
+}
+
+// WriteCSV writes scores to a CSV file in the given order.
+func WriteCSV(filename string, scores []TxScore) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	csvWriter := csv.NewWriter(f)
+
+	err = csvWriter.Write([]string{"tx hash", "score", "level", "reasons"})
+	if err != nil {
+		return err
+	}
+
+	for _, score := range scores {
+		err := csvWriter.Write([]string{score.TxHash.String(), fmt.Sprint(score.Score), score.Level.String(), strings.Join(score.ReasonStrings(), " | ")})
+		if err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
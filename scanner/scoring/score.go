@@ -0,0 +1,163 @@
+package scoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// Features contributed by checks that look at a tx as a whole.  Every detector also contributes a feature,
+// named after its SafeName.
+const (
+	// all outputs but one carry a single satoshi, the pattern used by the Satoshi uploader
+	FeatureSuspiciousOutputValues = "suspicious-output-values"
+
+	// the concatenated output data has a valid Satoshi length+checksum prefix
+	FeatureSatoshiEncoded = "satoshi-encoded"
+)
+
+// DefaultWeights is used for any feature that a config file doesn't mention.  Features that aren't here
+// either (e.g. from a detector added later) weigh 1.
+var DefaultWeights = map[string]float64{
+	FeatureSuspiciousOutputValues: 2,
+	FeatureSatoshiEncoded:         4,
+	"magic-bytes":                 3,
+	"pgp-data":                    3,
+	"aes-keys":                    2,
+	"known-hashes":                5,
+	"fake-multisig-keys":          3,
+	"plaintext":                   0.5,
+}
+
+type Config struct {
+	Weights map[string]float64 `json:"weights"`
+
+	// the minimum score for each level
+	SlightlySuspicious float64 `json:"slightlySuspicious"`
+	Suspicious         float64 `json:"suspicious"`
+	VerySuspicious     float64 `json:"verySuspicious"`
+}
+
+func DefaultConfig() Config {
+	weights := map[string]float64{}
+	for feature, weight := range DefaultWeights {
+		weights[feature] = weight
+	}
+
+	return Config{
+		Weights:            weights,
+		SlightlySuspicious: 0.5,
+		Suspicious:         3,
+		VerySuspicious:     6,
+	}
+}
+
+// LoadConfig reads a JSON scoring config.  Anything the file leaves out keeps its default.  An empty
+// filename returns the default config.
+func LoadConfig(filename string) (Config, error) {
+	config := DefaultConfig()
+	if filename == "" {
+		return config, nil
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+
+	err = json.NewDecoder(f).Decode(&config)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading %v: %v", filename, err)
+	}
+	return config, nil
+}
+
+func (c Config) Weight(feature string) float64 {
+	if weight, exists := c.Weights[feature]; exists {
+		return weight
+	}
+	return 1
+}
+
+func (c Config) Level(score float64) Level {
+	switch {
+	case score >= c.VerySuspicious:
+		return LevelVerySuspicious
+	case score >= c.Suspicious:
+		return LevelSuspicious
+	case score > 0 && score >= c.SlightlySuspicious:
+		return LevelSlightlySuspicious
+	default:
+		return LevelNotSuspicious
+	}
+}
+
+type Level int
+
+const (
+	LevelNotSuspicious Level = iota
+	LevelSlightlySuspicious
+	LevelSuspicious
+	LevelVerySuspicious
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelSlightlySuspicious:
+		return "slightly suspicious"
+	case LevelSuspicious:
+		return "suspicious"
+	case LevelVerySuspicious:
+		return "very suspicious"
+	default:
+		return "not suspicious"
+	}
+}
+
+// Reason is a feature that contributed to a tx's score.  A feature only counts once, no matter how many
+// data sources it was found in.
+type Reason struct {
+	Feature string
+	Weight  float64
+
+	// where the feature was found and what was found
+	Details []string
+}
+
+func (r Reason) String() string {
+	if len(r.Details) == 0 {
+		return fmt.Sprintf("%v (+%v)", r.Feature, r.Weight)
+	}
+	return fmt.Sprintf("%v (+%v): %v", r.Feature, r.Weight, strings.Join(r.Details, ", "))
+}
+
+type TxScore struct {
+	TxHash  chainhash.Hash
+	Score   float64
+	Level   Level
+	Reasons []Reason
+}
+
+func (s TxScore) ReasonStrings() []string {
+	strs := make([]string, len(s.Reasons))
+	for i := range s.Reasons {
+		strs[i] = s.Reasons[i].String()
+	}
+	return strs
+}
+
+// SortByScore orders scores from most to least suspicious, keeping the original order for equal scores.
+func SortByScore(scores []TxScore) {
+	sort.Stable(byScore(scores))
+}
+
+type byScore []TxScore
+
+func (s byScore) Len() int           { return len(s) }
+func (s byScore) Less(i, j int) bool { return s[i].Score > s[j].Score }
+func (s byScore) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,118 @@
+package scoring
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/detector"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/txdatasource"
+)
+
+type testDetectionResult []string
+
+func (r testDetectionResult) DescriptionStrings() []string { return r }
+func (r testDetectionResult) IsEmpty() bool                { return len(r) == 0 }
+
+// newUploaderTx builds a tx in the style of the Satoshi uploader: every output but the last carries 1
+// satoshi, and the fake P2PKH hashes spell out a 7z archive header.
+func newUploaderTx(T *testing.T) *Tx {
+	data := append([]byte{0x37, 0x7a, 0xbc, 0xaf, 0x27, 0x1c}, bytes.Repeat([]byte{0x42}, 34)...)
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(&wire.TxIn{SignatureScript: []byte{0x00}})
+	for i := 0; i < len(data); i += 20 {
+		script, err := txscript.NewScriptBuilder().AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).
+			AddData(data[i : i+20]).AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG).Script()
+		if err != nil {
+			T.Fatal(err)
+		}
+		msgTx.AddTxOut(wire.NewTxOut(1, script))
+	}
+	msgTx.AddTxOut(wire.NewTxOut(5000000, []byte{txscript.OP_TRUE}))
+
+	return &Tx{Tx: btcutil.NewTx(msgTx)}
+}
+
+func TestRunFullSuite(T *testing.T) {
+	utils.DefaultFileSignaturesPath = filepath.Join("..", "..", "file-signatures.txt")
+	tx := newUploaderTx(T)
+
+	score, err := NewEngine(DefaultConfig()).RunFullSuite(tx)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	features := map[string]bool{}
+	for _, reason := range score.Reasons {
+		features[reason.Feature] = true
+	}
+	if !features[FeatureSuspiciousOutputValues] || !features["magic-bytes"] {
+		T.Fatalf("expected suspicious output values and magic bytes, got %v", score.ReasonStrings())
+	}
+
+	// each feature only counts once, however many data sources it was found in
+	var expected float64
+	for _, reason := range score.Reasons {
+		expected += reason.Weight
+	}
+	if score.Score != expected {
+		T.Fatalf("expected a score of %v, got %v", expected, score.Score)
+	} else if score.Level != LevelSuspicious && score.Level != LevelVerySuspicious {
+		T.Fatalf("expected the tx to be at least suspicious, got %v (%v)", score.Level, score.Score)
+	}
+
+	// weights from a config file override the defaults, and everything else keeps its default
+	dir, err := ioutil.TempDir("", "scoring-test")
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "scoring.json")
+	err = ioutil.WriteFile(configFile, []byte(`{"weights": {"magic-bytes": 10}, "verySuspicious": 100}`), 0666)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	config, err := LoadConfig(configFile)
+	if err != nil {
+		T.Fatal(err)
+	} else if config.Weight("magic-bytes") != 10 || config.Weight(FeatureSatoshiEncoded) != DefaultWeights[FeatureSatoshiEncoded] || config.Suspicious != 3 {
+		T.Fatalf("unexpected config: %+v", config)
+	}
+
+	heavierScore, err := NewEngine(config).RunFullSuite(tx)
+	if err != nil {
+		T.Fatal(err)
+	} else if heavierScore.Score != score.Score+10-DefaultWeights["magic-bytes"] {
+		T.Fatalf("expected a score of %v, got %v", score.Score+10-DefaultWeights["magic-bytes"], heavierScore.Score)
+	} else if heavierScore.Level != LevelSuspicious {
+		T.Fatalf("expected the tx to be suspicious, got %v", heavierScore.Level)
+	}
+}
+
+func TestAddDetectionTruncatesOnRuneBoundary(T *testing.T) {
+	score := &TxScore{}
+	NewEngine(DefaultConfig()).AddDetection(score, &txdatasource.OutputScriptOpReturn{}, &detector.Plaintext{}, testDetectionResult{strings.Repeat("\u00e9", 100)})
+
+	if len(score.Reasons) != 1 || len(score.Reasons[0].Details) != 1 {
+		T.Fatalf("expected one reason with one detail, got %v", score.ReasonStrings())
+	}
+	detail := score.Reasons[0].Details[0]
+	if !utf8.ValidString(detail) {
+		T.Fatalf("expected the truncated detail to be valid UTF-8, got %q", detail)
+	} else if !strings.HasSuffix(detail, "...") || len(detail) > maxDetailLen+len("...") {
+		T.Fatalf("expected the detail to be truncated to %v bytes, got %q", maxDetailLen, detail)
+	}
+}
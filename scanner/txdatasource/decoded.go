@@ -0,0 +1,85 @@
+package txdatasource
+
+import (
+	"fmt"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
+)
+
+// Decoded wraps other data sources, and returns whatever hex, base64, ascii85, uuencoded or compressed data
+// can be decoded from their results.  Decoded data is decoded again, up to MaxDepth times, so that nested
+// encodings (e.g. gzipped data in base64) get unwrapped.  The wrapped sources' own results aren't returned.
+type Decoded struct {
+	DataSources []scanner.ITxDataSource
+
+	// defaults to DefaultDecodeDepth
+	MaxDepth int
+}
+
+// DecodedResult's SourceName records how the data was found, e.g. "txout-script-3|base64|gzip", with the
+// offset of the encoded data appended to a step ("|zlib@12") when it doesn't start at the beginning.
+type DecodedResult struct {
+	sourceName string
+	rawData    []byte
+}
+
+const DefaultDecodeDepth = 3
+
+// ensure that Decoded conforms to ITxDataSource
+var _ scanner.ITxDataSource = &Decoded{}
+
+// ensure that DecodedResult conforms to ITxDataSourceResult
+var _ scanner.ITxDataSourceResult = DecodedResult{}
+
+func (ds *Decoded) Name() string {
+	return "decoded"
+}
+
+func (ds *Decoded) GetData(tx *Tx) ([]scanner.ITxDataSourceResult, error) {
+	results := []scanner.ITxDataSourceResult{}
+	for _, wrapped := range ds.DataSources {
+		wrappedResults, err := wrapped.GetData(tx)
+		if err != nil {
+			// as in the scanner, an error means the tx has no data of that type (e.g. outputs-satoshi on a
+			// tx without a Satoshi header), so just move on to the next source
+			continue
+		}
+
+		for _, r := range wrappedResults {
+			results = ds.decode(results, r.SourceName(), r.RawData(), 1)
+		}
+	}
+	return results, nil
+}
+
+func (ds *Decoded) decode(results []scanner.ITxDataSourceResult, sourceName string, data []byte, depth int) []scanner.ITxDataSourceResult {
+	for _, decoded := range utils.DecodeData(data) {
+		name := sourceName + "|" + decoded.Encoding
+		if decoded.Offset > 0 {
+			name += fmt.Sprintf("@%d", decoded.Offset)
+		}
+
+		results = append(results, DecodedResult{sourceName: name, rawData: decoded.Data})
+		if depth < ds.maxDepth() {
+			results = ds.decode(results, name, decoded.Data, depth+1)
+		}
+	}
+	return results
+}
+
+func (ds *Decoded) maxDepth() int {
+	if ds.MaxDepth <= 0 {
+		return DefaultDecodeDepth
+	}
+	return ds.MaxDepth
+}
+
+func (r DecodedResult) SourceName() string {
+	return r.sourceName
+}
+
+func (r DecodedResult) RawData() []byte {
+	return r.rawData
+}
@@ -0,0 +1,41 @@
+package txdatasource
+
+import (
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
+)
+
+type InputWitnessConcat struct{}
+
+type InputWitnessConcatResult []byte
+
+// ensure that InputWitnessConcat conforms to ITxDataSource
+var _ scanner.ITxDataSource = &InputWitnessConcat{}
+
+// ensure that InputWitnessConcatResult conforms to ITxDataSourceResult
+var _ scanner.ITxDataSourceResult = &InputWitnessConcatResult{}
+
+func (ds *InputWitnessConcat) Name() string {
+	return "witness-concatenated"
+}
+
+func (ds *InputWitnessConcat) GetData(tx *Tx) ([]scanner.ITxDataSourceResult, error) {
+	if !tx.HasWitness() {
+		return []scanner.ITxDataSourceResult{}, nil
+	}
+
+	data, err := tx.ConcatWitnessData()
+	if err != nil {
+		return nil, err
+	}
+
+	return []scanner.ITxDataSourceResult{InputWitnessConcatResult(data)}, nil
+}
+
+func (r InputWitnessConcatResult) SourceName() string {
+	return "witness-concatenated"
+}
+
+func (r InputWitnessConcatResult) RawData() []byte {
+	return r
+}
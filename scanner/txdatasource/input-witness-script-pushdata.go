@@ -0,0 +1,55 @@
+package txdatasource
+
+import (
+	"fmt"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
+)
+
+// InputWitnessScriptPushdata reassembles the data pushed by each input's witness script (P2WSH or
+// taproot script path).  This is where inscription-style envelopes keep their payload.
+type InputWitnessScriptPushdata struct{}
+
+type InputWitnessScriptPushdataResult struct {
+	rawData []byte
+	index   int
+}
+
+// ensure that InputWitnessScriptPushdata conforms to ITxDataSource
+var _ scanner.ITxDataSource = &InputWitnessScriptPushdata{}
+
+// ensure that InputWitnessScriptPushdataResult conforms to ITxDataSourceResult
+var _ scanner.ITxDataSourceResult = InputWitnessScriptPushdataResult{}
+
+func (ds *InputWitnessScriptPushdata) Name() string {
+	return "txin-witness-script-pushdata"
+}
+
+func (ds *InputWitnessScriptPushdata) GetData(tx *Tx) ([]scanner.ITxDataSourceResult, error) {
+	results := []scanner.ITxDataSourceResult{}
+	for txinIdx := range tx.MsgTx().TxIn {
+		script := tx.GetWitnessScriptFromTxIn(txinIdx)
+		if script == nil {
+			continue
+		}
+
+		data, err := utils.GetPushdataBytesFromWitnessScript(script)
+		if err != nil {
+			continue
+		}
+
+		results = append(results, InputWitnessScriptPushdataResult{rawData: data, index: txinIdx})
+	}
+
+	return results, nil
+}
+
+func (r InputWitnessScriptPushdataResult) SourceName() string {
+	return fmt.Sprintf("txin-witness-script-pushdata-%d", r.index)
+}
+
+func (r InputWitnessScriptPushdataResult) RawData() []byte {
+	return r.rawData
+}
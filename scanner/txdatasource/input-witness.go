@@ -0,0 +1,46 @@
+package txdatasource
+
+import (
+	"fmt"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
+)
+
+// InputWitness yields every item of every input's witness stack separately.
+type InputWitness struct{}
+
+type InputWitnessResult struct {
+	rawData   []byte
+	index     int
+	itemIndex int
+}
+
+// ensure that InputWitness conforms to ITxDataSource
+var _ scanner.ITxDataSource = &InputWitness{}
+
+// ensure that InputWitnessResult conforms to ITxDataSourceResult
+var _ scanner.ITxDataSourceResult = InputWitnessResult{}
+
+func (ds *InputWitness) Name() string {
+	return "txin-witness"
+}
+
+func (ds *InputWitness) GetData(tx *Tx) ([]scanner.ITxDataSourceResult, error) {
+	results := []scanner.ITxDataSourceResult{}
+	for txinIdx := range tx.MsgTx().TxIn {
+		for itemIdx, item := range tx.GetWitnessFromTxIn(txinIdx) {
+			results = append(results, InputWitnessResult{rawData: item, index: txinIdx, itemIndex: itemIdx})
+		}
+	}
+
+	return results, nil
+}
+
+func (r InputWitnessResult) SourceName() string {
+	return fmt.Sprintf("txin-witness-%d-%d", r.index, r.itemIndex)
+}
+
+func (r InputWitnessResult) RawData() []byte {
+	return r.rawData
+}
@@ -0,0 +1,72 @@
+package txdatasource
+
+import (
+	"fmt"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
+)
+
+// OutputScriptMultisig returns the payloads of the fake pubkeys (the ones that aren't points on secp256k1) in
+// each bare multisig output, without their prefix bytes.  Real keys are left out.  If Concat is set, the
+// payloads of every output are returned as one result.
+type OutputScriptMultisig struct {
+	Concat bool
+}
+
+type OutputScriptMultisigResult struct {
+	rawData []byte
+	index   int // -1 for the concatenated result
+}
+
+// ensure that OutputScriptMultisig conforms to ITxDataSource
+var _ scanner.ITxDataSource = &OutputScriptMultisig{}
+
+// ensure that OutputScriptMultisigResult conforms to ITxDataSourceResult
+var _ scanner.ITxDataSourceResult = OutputScriptMultisigResult{}
+
+func (ds *OutputScriptMultisig) Name() string {
+	if ds.Concat {
+		return "outputs-multisig-fakekeys-concatenated"
+	}
+	return "txout-multisig-fakekeys"
+}
+
+func (ds *OutputScriptMultisig) GetData(tx *Tx) ([]scanner.ITxDataSourceResult, error) {
+	results := []scanner.ITxDataSourceResult{}
+	concat := []byte{}
+	for i, txout := range tx.MsgTx().TxOut {
+		m, ok := utils.ParseMultisigOutput(txout.PkScript)
+		if !ok {
+			continue
+		}
+
+		data := m.FakeKeyData()
+		if len(data) == 0 {
+			continue
+		}
+
+		if ds.Concat {
+			concat = append(concat, data...)
+		} else {
+			results = append(results, OutputScriptMultisigResult{rawData: data, index: i})
+		}
+	}
+
+	if ds.Concat && len(concat) > 0 {
+		results = append(results, OutputScriptMultisigResult{rawData: concat, index: -1})
+	}
+	return results, nil
+}
+
+func (r OutputScriptMultisigResult) SourceName() string {
+	if r.index < 0 {
+		return "outputs-multisig-fakekeys-concatenated"
+	}
+	return fmt.Sprintf("txout-multisig-fakekeys-%d", r.index)
+}
+
+func (r OutputScriptMultisigResult) RawData() []byte {
+	return r.rawData
+}
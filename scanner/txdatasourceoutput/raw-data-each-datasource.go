@@ -25,7 +25,7 @@ func (o *RawDataEachDataSource) PrintOutput(txHash chainhash.Hash, txDataSource
 			continue
 		}
 
-		filename := filepath.Join(o.OutDir, fmt.Sprintf("%s-%s.dat", txHash.String(), result.SourceName()))
+		filename := filepath.Join(o.OutDir, fmt.Sprintf("%s-%s.dat", txHash.String(), utils.SafeFilename(result.SourceName())))
 		err := ioutil.WriteFile(filename, result.RawData(), 0666)
 		if err != nil {
 			return err
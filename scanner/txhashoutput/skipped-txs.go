@@ -0,0 +1,62 @@
+package txhashoutput
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
+)
+
+// SkippedTxs writes a CSV report of the txs that the scanner skipped and why.  The file is only created if
+// something was skipped.
+type SkippedTxs struct {
+	OutDir   string
+	Filename string
+	data     []skippedTx
+}
+
+type skippedTx struct {
+	txHash chainhash.Hash
+	err    error
+}
+
+// ensure that SkippedTxs conforms to ISkippedTxOutput
+var _ scanner.ISkippedTxOutput = &SkippedTxs{}
+
+func (o *SkippedTxs) OutputSkippedTx(txHash chainhash.Hash, err error) error {
+	o.data = append(o.data, skippedTx{txHash: txHash, err: err})
+	return nil
+}
+
+func (o *SkippedTxs) Close() error {
+	if len(o.data) == 0 {
+		return nil
+	}
+
+	f, err := os.Create(filepath.Join(o.OutDir, o.Filename))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString("tx,error\n")
+	if err != nil {
+		return err
+	}
+
+	for _, skipped := range o.data {
+		// keep each error on one line and out of the way of the CSV separators
+		errStr := strings.Replace(strings.Replace(skipped.err.Error(), "\n", " ", -1), ",", ";", -1)
+		_, err := f.WriteString(fmt.Sprintf("%s,%s\n", skipped.txHash.String(), errStr))
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("skipped %v txs (see %v)\n", len(o.data), f.Name())
+	return nil
+}
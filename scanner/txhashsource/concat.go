@@ -0,0 +1,31 @@
+package txhashsource
+
+import (
+	"context"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
+)
+
+// NewConcatTxHashSource yields every hash from each of the given sources in turn.
+func NewConcatTxHashSource(sources ...scanner.ITxHashSource) *TxHashSource {
+	return newTxHashSource(func(ctx context.Context, yield func(chainhash.Hash) error) error {
+		for _, src := range sources {
+			for {
+				hash, exists, err := src.NextHash(ctx)
+				if err != nil {
+					return err
+				} else if !exists {
+					break
+				}
+
+				err = yield(hash)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -1,6 +1,7 @@
 package txhashsource
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 
@@ -9,25 +10,23 @@ import (
 	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
 )
 
-func NewDATFileTxHashSource(datFileDir string, startBlock, endBlock int) TxHashSource {
-	ch := make(chan chainhash.Hash)
-	go func() {
-		defer close(ch)
-
+func NewDATFileTxHashSource(datFileDir string, startBlock, endBlock int) *TxHashSource {
+	return newTxHashSource(func(ctx context.Context, yield func(chainhash.Hash) error) error {
 		for datIdx := startBlock; datIdx <= endBlock; datIdx++ {
-			blocks, err := utils.LoadBlocksFromDAT(filepath.Join(datFileDir, fmt.Sprintf("blk%05d.dat")))
+			blocks, err := utils.LoadBlocksFromDAT(filepath.Join(datFileDir, fmt.Sprintf("blk%05d.dat", datIdx)))
 			if err != nil {
-				// @@TODO
-				panic(err)
+				return err
 			}
 
 			for _, bl := range blocks {
 				for _, tx := range bl.Transactions() {
-					ch <- *tx.Hash()
+					err := yield(*tx.Hash())
+					if err != nil {
+						return err
+					}
 				}
 			}
 		}
-	}()
-
-	return TxHashSource(ch)
+		return nil
+	})
 }
@@ -0,0 +1,114 @@
+package txhashsource
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+)
+
+// NewGraph crawls every tx connected to startHash, breadth-first: the txs spending each of its outputs and
+// the txs whose outputs it spends, then theirs, and so on.  Uploads often fan out into several parallel
+// chains, which a linear chain crawl misses.
+//
+// maxDepth limits how many hops away from startHash the crawl goes, and maxNodes limits how many txs it
+// yields (0 means no limit for either).  Spends and inputs carrying fewer than minValue satoshis aren't
+// followed.
+//
+// Txs that aren't in the local index are still yielded (so the scanner reports them as skipped), but the
+// crawl can't go any further through them.
+func NewGraph(db *BlockDB, startHash chainhash.Hash, maxDepth, maxNodes uint, minValue int64) *TxHashSource {
+	return newTxHashSource(func(ctx context.Context, yield func(chainhash.Hash) error) error {
+		type node struct {
+			hash  chainhash.Hash
+			depth uint
+		}
+
+		visited := map[chainhash.Hash]bool{startHash: true}
+		queue := []node{{hash: startHash}}
+		var yielded uint
+		for len(queue) > 0 {
+			if maxNodes > 0 && yielded >= maxNodes {
+				return nil
+			}
+
+			current := queue[0]
+			queue = queue[1:]
+
+			err := yield(current.hash)
+			if err != nil {
+				return err
+			}
+			yielded++
+
+			if maxDepth > 0 && current.depth >= maxDepth {
+				continue
+			}
+
+			tx, err := db.GetTx(current.hash)
+			if IsNotFound(err) {
+				fmt.Printf("can't crawl past %v (not found in the local index)\n", current.hash)
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			neighbours, err := graphNeighbours(db, tx, minValue)
+			if err != nil {
+				return err
+			}
+
+			for _, hash := range neighbours {
+				if !visited[hash] {
+					visited[hash] = true
+					queue = append(queue, node{hash: hash, depth: current.depth + 1})
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// graphNeighbours returns the txs spending tx's outputs, followed by the txs whose outputs tx spends,
+// skipping those connected by fewer than minValue satoshis.
+func graphNeighbours(db *BlockDB, tx *Tx, minValue int64) ([]chainhash.Hash, error) {
+	neighbours := []chainhash.Hash{}
+
+	for txoutIdx, txout := range tx.MsgTx().TxOut {
+		if txout.Value < minValue {
+			continue
+		}
+
+		spentTxOut, err := db.GetSpentTxOut(SpentTxOutKey{TxHash: *tx.Hash(), TxOutIndex: uint32(txoutIdx)})
+		if IsNotFound(err) {
+			// unspent, or spent by a tx we don't know about
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		neighbours = append(neighbours, spentTxOut.InputTxHash)
+	}
+
+	if tx.IsCoinbase() {
+		return neighbours, nil
+	}
+
+	for _, txin := range tx.MsgTx().TxIn {
+		if minValue > 0 {
+			prevTxOut, err := prevTxOutOf(db, txin.PreviousOutPoint)
+			if IsNotFound(err) {
+				// the value can't be checked, so the threshold isn't met
+				continue
+			} else if err != nil {
+				return nil, err
+			} else if prevTxOut.Value < minValue {
+				continue
+			}
+		}
+		neighbours = append(neighbours, txin.PreviousOutPoint.Hash)
+	}
+
+	return neighbours, nil
+}
@@ -0,0 +1,99 @@
+package txhashsource
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/internal/testdat"
+)
+
+func newTestTx(prevOuts []wire.OutPoint, values ...int64) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for i := range prevOuts {
+		tx.AddTxIn(wire.NewTxIn(&prevOuts[i], []byte{0x51}))
+	}
+	for _, value := range values {
+		tx.AddTxOut(wire.NewTxOut(value, []byte{0x51}))
+	}
+	return tx
+}
+
+func TestGraphTxHashSource(T *testing.T) {
+	// a fans out into two chains: a -> b -> d and a -> c -> e
+	a := newTestTx([]wire.OutPoint{{Index: 0xffffffff}}, 5000, 100)
+	b := newTestTx([]wire.OutPoint{{Hash: a.TxHash(), Index: 0}}, 4000)
+	c := newTestTx([]wire.OutPoint{{Hash: a.TxHash(), Index: 1}}, 50)
+	d := newTestTx([]wire.OutPoint{{Hash: b.TxHash(), Index: 0}}, 3000)
+	e := newTestTx([]wire.OutPoint{{Hash: c.TxHash(), Index: 0}}, 10)
+
+	bl := wire.NewMsgBlock(&chaincfg.MainNetParams.GenesisBlock.Header)
+	for _, tx := range []*wire.MsgTx{a, b, c, d, e} {
+		bl.AddTransaction(tx)
+	}
+
+	dir := testdat.WriteDATDir(T, []*wire.MsgBlock{bl})
+	defer os.RemoveAll(dir)
+
+	db, err := NewBlockDB(filepath.Join(dir, "test.db"), dir, nil)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.IndexDATFileTransactions(0, 0, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+	err = db.IndexDATFileSpentTxOuts(0, 0, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	crawl := func(maxDepth, maxNodes uint, minValue int64) []chainhash.Hash {
+		src := NewGraph(db, b.TxHash(), maxDepth, maxNodes, minValue)
+		received := []chainhash.Hash{}
+		for {
+			hash, exists, err := src.NextHash(context.Background())
+			if err != nil {
+				T.Fatal(err)
+			} else if !exists {
+				break
+			}
+			received = append(received, hash)
+		}
+		return received
+	}
+
+	cases := []struct {
+		maxDepth, maxNodes uint
+		minValue           int64
+		expected           []*wire.MsgTx
+	}{
+		// spends come before inputs, and each tx is only visited once
+		{0, 0, 0, []*wire.MsgTx{b, d, a, c, e}},
+		{1, 0, 0, []*wire.MsgTx{b, d, a}},
+		{0, 2, 0, []*wire.MsgTx{b, d}},
+		// a's 100 satoshi output to c isn't followed
+		{0, 0, 1000, []*wire.MsgTx{b, d, a}},
+	}
+
+	for _, c := range cases {
+		expected := []chainhash.Hash{}
+		for _, tx := range c.expected {
+			expected = append(expected, tx.TxHash())
+		}
+
+		received := crawl(c.maxDepth, c.maxNodes, c.minValue)
+		if !reflect.DeepEqual(received, expected) {
+			T.Fatalf("depth %v, nodes %v, min value %v: expected %v, got %v", c.maxDepth, c.maxNodes, c.minValue, expected, received)
+		}
+	}
+}
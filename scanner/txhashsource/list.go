@@ -1,18 +1,69 @@
 package txhashsource
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
-func NewListTxHashSource(hashes []chainhash.Hash) TxHashSource {
-	ch := make(chan chainhash.Hash)
-	go func() {
-		defer close(ch)
-
+func NewListTxHashSource(hashes []chainhash.Hash) *TxHashSource {
+	return newTxHashSource(func(ctx context.Context, yield func(chainhash.Hash) error) error {
 		for _, hash := range hashes {
-			ch <- hash
+			err := yield(hash)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// NewListTxHashSourceFromFile reads a list of tx hashes from the given file, or from stdin if the filename
+// is "-".  See ReadTxHashList for the format.
+func NewListTxHashSourceFromFile(filename string, stdin io.Reader) (*TxHashSource, error) {
+	r := stdin
+	if filename != "-" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	hashes, err := ReadTxHashList(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewListTxHashSource(hashes), nil
+}
+
+// ReadTxHashList reads hex tx hashes, one per line.  Only the first field of each line is used, so CSV-ish
+// files with the hash in the first column work too.  Blank lines and lines starting with # are ignored.
+func ReadTxHashList(r io.Reader) ([]chainhash.Hash, error) {
+	hashes := []chainhash.Hash{}
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
 		}
-	}()
 
-	return TxHashSource(ch)
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		if len(fields) == 0 {
+			continue
+		}
+
+		hash, err := chainhash.NewHashFromStr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", lineNum, err)
+		}
+		hashes = append(hashes, *hash)
+	}
+	return hashes, scanner.Err()
 }
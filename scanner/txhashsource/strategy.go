@@ -0,0 +1,314 @@
+package txhashsource
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+)
+
+// NextTxStrategy decides which tx a chain crawl moves to next.  Uploads don't all use the same convention,
+// so the chain sources take one of these instead of hard-coding a rule.
+type NextTxStrategy interface {
+	// Forward returns the tx that continues the chain after tx, or false if the chain ends at tx.
+	Forward(tx *Tx) (chainhash.Hash, bool, error)
+
+	// Backward returns the tx that comes before tx in the chain, or false if the chain starts at tx.
+	Backward(tx *Tx) (chainhash.Hash, bool, error)
+}
+
+type (
+	// MaxValueStrategy follows the spend of the largest output forwards, and backwards only through txs
+	// with a single input.  This is the convention used by the Cablegate upload.
+	MaxValueStrategy struct {
+		DB *BlockDB
+	}
+
+	// ChangeOutputStrategy follows the output that looks like change: one paying back to an address that
+	// the tx spent from or, failing that, the only output whose value isn't a round number.  If no output
+	// looks like change, it falls back to the largest one.  Backwards, it follows the input that spends its
+	// previous tx's change.
+	ChangeOutputStrategy struct {
+		DB *BlockDB
+	}
+
+	// SameAddressStrategy follows outputs paying to, and inputs spending from, a single address.
+	SameAddressStrategy struct {
+		DB      *BlockDB
+		Address string
+	}
+
+	// DustPatternStrategy moves like MaxValueStrategy, but stops as soon as the next tx doesn't have the
+	// uploader's 1-satoshi output pattern (see Tx.HasSuspiciousOutputValues).
+	DustPatternStrategy struct {
+		DB *BlockDB
+	}
+
+	// LargestInputStrategy moves forwards like MaxValueStrategy, but backwards it follows the input that
+	// spends the most valuable output, so it doesn't stop at txs with several inputs.
+	LargestInputStrategy struct {
+		DB *BlockDB
+	}
+)
+
+// ensure that the strategies conform to NextTxStrategy
+var (
+	_ NextTxStrategy = &MaxValueStrategy{}
+	_ NextTxStrategy = &ChangeOutputStrategy{}
+	_ NextTxStrategy = &SameAddressStrategy{}
+	_ NextTxStrategy = &DustPatternStrategy{}
+	_ NextTxStrategy = &LargestInputStrategy{}
+)
+
+var nextTxStrategyNames = []string{"max-value", "change-output", "same-address", "dust-pattern", "largest-input"}
+
+// NewNextTxStrategy returns the strategy with the given name.  "same-address" follows the address of the
+// start tx's largest output unless one is given as "same-address:<address>".
+func NewNextTxStrategy(db *BlockDB, name string, startHash chainhash.Hash) (NextTxStrategy, error) {
+	parts := strings.SplitN(name, ":", 2)
+	switch parts[0] {
+	case "", "max-value":
+		return &MaxValueStrategy{DB: db}, nil
+	case "change-output":
+		return &ChangeOutputStrategy{DB: db}, nil
+	case "dust-pattern":
+		return &DustPatternStrategy{DB: db}, nil
+	case "largest-input":
+		return &LargestInputStrategy{DB: db}, nil
+	case "same-address":
+		if len(parts) == 2 && parts[1] != "" {
+			return &SameAddressStrategy{DB: db, Address: AddressIndexKey(parts[1])}, nil
+		}
+
+		startTx, err := db.GetTx(startHash)
+		if err != nil {
+			return nil, err
+		}
+		addrs := AddressKeysForScript(startTx.MsgTx().TxOut[startTx.FindMaxValueTxOut()].PkScript)
+		return &SameAddressStrategy{DB: db, Address: addrs[0]}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy '%v' (must be one of %v)", name, strings.Join(nextTxStrategyNames, ", "))
+}
+
+func (s *MaxValueStrategy) Forward(tx *Tx) (chainhash.Hash, bool, error) {
+	return spenderOf(s.DB, tx, tx.FindMaxValueTxOut())
+}
+
+func (s *MaxValueStrategy) Backward(tx *Tx) (chainhash.Hash, bool, error) {
+	if len(tx.MsgTx().TxIn) != 1 || tx.IsCoinbase() {
+		return chainhash.Hash{}, false, nil
+	}
+	return tx.MsgTx().TxIn[0].PreviousOutPoint.Hash, true, nil
+}
+
+func (s *ChangeOutputStrategy) Forward(tx *Tx) (chainhash.Hash, bool, error) {
+	changeIdx, err := changeOutputIndex(s.DB, tx)
+	if err != nil {
+		return chainhash.Hash{}, false, err
+	} else if changeIdx < 0 {
+		changeIdx = tx.FindMaxValueTxOut()
+	}
+	return spenderOf(s.DB, tx, changeIdx)
+}
+
+func (s *ChangeOutputStrategy) Backward(tx *Tx) (chainhash.Hash, bool, error) {
+	if tx.IsCoinbase() {
+		return chainhash.Hash{}, false, nil
+	} else if len(tx.MsgTx().TxIn) == 1 {
+		return tx.MsgTx().TxIn[0].PreviousOutPoint.Hash, true, nil
+	}
+
+	for _, txin := range tx.MsgTx().TxIn {
+		prevTx, err := s.DB.GetTx(txin.PreviousOutPoint.Hash)
+		if IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return chainhash.Hash{}, false, err
+		}
+
+		changeIdx, err := changeOutputIndex(s.DB, prevTx)
+		if err != nil {
+			return chainhash.Hash{}, false, err
+		} else if changeIdx == int(txin.PreviousOutPoint.Index) {
+			return txin.PreviousOutPoint.Hash, true, nil
+		}
+	}
+	return chainhash.Hash{}, false, nil
+}
+
+func (s *SameAddressStrategy) Forward(tx *Tx) (chainhash.Hash, bool, error) {
+	for txoutIdx, txout := range tx.MsgTx().TxOut {
+		if !containsString(AddressKeysForScript(txout.PkScript), s.Address) {
+			continue
+		}
+
+		spender, found, err := spenderOf(s.DB, tx, txoutIdx)
+		if err != nil || found {
+			return spender, found, err
+		}
+	}
+	return chainhash.Hash{}, false, nil
+}
+
+func (s *SameAddressStrategy) Backward(tx *Tx) (chainhash.Hash, bool, error) {
+	if tx.IsCoinbase() {
+		return chainhash.Hash{}, false, nil
+	}
+
+	for _, txin := range tx.MsgTx().TxIn {
+		prevTxOut, err := prevTxOutOf(s.DB, txin.PreviousOutPoint)
+		if IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return chainhash.Hash{}, false, err
+		}
+
+		if containsString(AddressKeysForScript(prevTxOut.PkScript), s.Address) {
+			return txin.PreviousOutPoint.Hash, true, nil
+		}
+	}
+	return chainhash.Hash{}, false, nil
+}
+
+func (s *DustPatternStrategy) Forward(tx *Tx) (chainhash.Hash, bool, error) {
+	next, found, err := (&MaxValueStrategy{DB: s.DB}).Forward(tx)
+	if err != nil || !found {
+		return next, found, err
+	}
+	return s.checkPattern(next)
+}
+
+func (s *DustPatternStrategy) Backward(tx *Tx) (chainhash.Hash, bool, error) {
+	prev, found, err := (&MaxValueStrategy{DB: s.DB}).Backward(tx)
+	if err != nil || !found {
+		return prev, found, err
+	}
+	return s.checkPattern(prev)
+}
+
+func (s *DustPatternStrategy) checkPattern(txHash chainhash.Hash) (chainhash.Hash, bool, error) {
+	tx, err := s.DB.GetTx(txHash)
+	if IsNotFound(err) {
+		// let the chain source report that it can't go further
+		return txHash, true, nil
+	} else if err != nil {
+		return chainhash.Hash{}, false, err
+	}
+
+	if !tx.HasSuspiciousOutputValues() {
+		fmt.Printf("stopping before %v (no suspicious output values)\n", txHash)
+		return chainhash.Hash{}, false, nil
+	}
+	return txHash, true, nil
+}
+
+func (s *LargestInputStrategy) Forward(tx *Tx) (chainhash.Hash, bool, error) {
+	return (&MaxValueStrategy{DB: s.DB}).Forward(tx)
+}
+
+func (s *LargestInputStrategy) Backward(tx *Tx) (chainhash.Hash, bool, error) {
+	if tx.IsCoinbase() {
+		return chainhash.Hash{}, false, nil
+	}
+
+	var largest int64 = -1
+	var largestHash chainhash.Hash
+	for _, txin := range tx.MsgTx().TxIn {
+		prevTxOut, err := prevTxOutOf(s.DB, txin.PreviousOutPoint)
+		if IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return chainhash.Hash{}, false, err
+		}
+
+		if prevTxOut.Value > largest {
+			largest = prevTxOut.Value
+			largestHash = txin.PreviousOutPoint.Hash
+		}
+	}
+	return largestHash, largest >= 0, nil
+}
+
+// spenderOf returns the tx that spends the given output, or false if it's unspent or its spender can't be
+// found.
+func spenderOf(db *BlockDB, tx *Tx, txoutIdx int) (chainhash.Hash, bool, error) {
+	spentTxOut, err := db.GetSpentTxOut(SpentTxOutKey{TxHash: *tx.Hash(), TxOutIndex: uint32(txoutIdx)})
+	if IsNotFound(err) {
+		fmt.Printf("stopping at %v (output %v: %v)\n", tx.Hash(), txoutIdx, strings.SplitN(err.Error(), "\n", 2)[0])
+		return chainhash.Hash{}, false, nil
+	} else if err != nil {
+		return chainhash.Hash{}, false, err
+	}
+	return spentTxOut.InputTxHash, true, nil
+}
+
+func prevTxOutOf(db *BlockDB, outpoint wire.OutPoint) (*wire.TxOut, error) {
+	prevTx, err := db.GetTx(outpoint.Hash)
+	if err != nil {
+		return nil, err
+	} else if int(outpoint.Index) >= len(prevTx.MsgTx().TxOut) {
+		return nil, fmt.Errorf("input spends output %v of %v, which only has %v outputs", outpoint.Index, outpoint.Hash.String(), len(prevTx.MsgTx().TxOut))
+	}
+	return prevTx.MsgTx().TxOut[outpoint.Index], nil
+}
+
+// a value that's a multiple of this many satoshis (0.0001 BTC) is considered round, i.e. probably typed in
+// by a person rather than left over as change
+const roundValue = 10000
+
+// changeOutputIndex guesses which output of tx is change, returning -1 if it can't tell.
+func changeOutputIndex(db *BlockDB, tx *Tx) (int, error) {
+	txouts := tx.MsgTx().TxOut
+	if len(txouts) < 2 {
+		return -1, nil
+	}
+
+	// an output paying back to one of the addresses the tx spent from
+	if !tx.IsCoinbase() {
+		inputAddrs := []string{}
+		for _, txin := range tx.MsgTx().TxIn {
+			prevTxOut, err := prevTxOutOf(db, txin.PreviousOutPoint)
+			if IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return -1, err
+			}
+			inputAddrs = append(inputAddrs, AddressKeysForScript(prevTxOut.PkScript)...)
+		}
+		sort.Strings(inputAddrs)
+
+		for txoutIdx, txout := range txouts {
+			for _, addr := range AddressKeysForScript(txout.PkScript) {
+				i := sort.SearchStrings(inputAddrs, addr)
+				if i < len(inputAddrs) && inputAddrs[i] == addr {
+					return txoutIdx, nil
+				}
+			}
+		}
+	}
+
+	// the only output with a value that isn't round
+	changeIdx := -1
+	for txoutIdx, txout := range txouts {
+		if txout.Value%roundValue != 0 {
+			if changeIdx >= 0 {
+				return -1, nil
+			}
+			changeIdx = txoutIdx
+		}
+	}
+	return changeIdx, nil
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
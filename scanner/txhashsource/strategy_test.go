@@ -0,0 +1,169 @@
+package txhashsource
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/internal/testdat"
+)
+
+type testTxOut struct {
+	value int64
+	addr  byte // the P2PKH address whose hash is this byte repeated
+}
+
+func testAddress(T *testing.T, b byte) *btcutil.AddressPubKeyHash {
+	addr, err := btcutil.NewAddressPubKeyHash(bytes.Repeat([]byte{b}, 20), &chaincfg.MainNetParams)
+	if err != nil {
+		T.Fatal(err)
+	}
+	return addr
+}
+
+func newTestAddressTx(T *testing.T, prevOuts []wire.OutPoint, txouts ...testTxOut) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for i := range prevOuts {
+		tx.AddTxIn(wire.NewTxIn(&prevOuts[i], []byte{0x51}))
+	}
+	for _, txout := range txouts {
+		script, err := txscript.PayToAddrScript(testAddress(T, txout.addr))
+		if err != nil {
+			T.Fatal(err)
+		}
+		tx.AddTxOut(wire.NewTxOut(txout.value, script))
+	}
+	return tx
+}
+
+func TestNextTxStrategies(T *testing.T) {
+	outpoint := func(tx *wire.MsgTx, index uint32) wire.OutPoint {
+		return wire.OutPoint{Hash: tx.TxHash(), Index: index}
+	}
+
+	fund1 := newTestAddressTx(T, []wire.OutPoint{{Hash: chainhash.Hash{1}}}, testTxOut{100000, 0xa1})
+	fund2 := newTestAddressTx(T, []wire.OutPoint{{Hash: chainhash.Hash{2}}}, testTxOut{300000, 0xb1})
+	fund3 := newTestAddressTx(T, []wire.OutPoint{{Hash: chainhash.Hash{3}}}, testTxOut{50000, 0xc1})
+
+	// spends both funding txs, paying a round amount to someone else and the change back to 0xb1
+	multi := newTestAddressTx(T, []wire.OutPoint{outpoint(fund1, 0), outpoint(fund2, 0)}, testTxOut{250000, 0xd1}, testTxOut{149321, 0xb1})
+
+	// the payee splits the payment, and the only value that isn't round looks like change
+	payee := newTestAddressTx(T, []wire.OutPoint{outpoint(multi, 0)}, testTxOut{200000, 0xe1}, testTxOut{49500, 0xe2})
+	payeeChange := newTestAddressTx(T, []wire.OutPoint{outpoint(payee, 1)}, testTxOut{49000, 0xe3})
+
+	// two txs in the uploader's 1-satoshi pattern, each passing the change on
+	dust1 := newTestAddressTx(T, []wire.OutPoint{outpoint(multi, 1)}, testTxOut{1, 0x01}, testTxOut{1, 0x02}, testTxOut{149000, 0xb1})
+	dust2 := newTestAddressTx(T, []wire.OutPoint{outpoint(dust1, 2)}, testTxOut{1, 0x03}, testTxOut{1, 0x04}, testTxOut{148000, 0xb1})
+
+	// combines another input with the uploader's change
+	after := newTestAddressTx(T, []wire.OutPoint{outpoint(fund3, 0), outpoint(dust2, 2)}, testTxOut{150000, 0xf1}, testTxOut{47000, 0xf2})
+
+	bl := wire.NewMsgBlock(&chaincfg.MainNetParams.GenesisBlock.Header)
+	for _, tx := range []*wire.MsgTx{fund1, fund2, fund3, multi, payee, payeeChange, dust1, dust2, after} {
+		bl.AddTransaction(tx)
+	}
+
+	dir := testdat.WriteDATDir(T, []*wire.MsgBlock{bl})
+	defer os.RemoveAll(dir)
+
+	db, err := NewBlockDB(filepath.Join(dir, "test.db"), dir, nil)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.IndexDATFileTransactions(0, 0, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+	err = db.IndexDATFileSpentTxOuts(0, 0, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	sameAddress, err := NewNextTxStrategy(db, "same-address:"+testAddress(T, 0xb1).EncodeAddress(), multi.TxHash())
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	// without an address, same-address follows the start tx's largest output
+	defaultSameAddress, err := NewNextTxStrategy(db, "same-address", multi.TxHash())
+	if err != nil {
+		T.Fatal(err)
+	} else if addr := defaultSameAddress.(*SameAddressStrategy).Address; addr != testAddress(T, 0xd1).EncodeAddress() {
+		T.Errorf("expected same-address to follow the largest output's address, got %v", addr)
+	}
+
+	maxValue := &MaxValueStrategy{DB: db}
+	changeOutput := &ChangeOutputStrategy{DB: db}
+	dustPattern := &DustPatternStrategy{DB: db}
+	largestInput := &LargestInputStrategy{DB: db}
+
+	cases := []struct {
+		name     string
+		strategy NextTxStrategy
+		forward  bool
+		from     *wire.MsgTx
+		expected *wire.MsgTx // nil if the chain should stop
+	}{
+		{"max-value", maxValue, true, multi, payee},
+		{"max-value", maxValue, true, payee, nil}, // the largest output is unspent
+		{"max-value", maxValue, false, dust1, multi},
+		{"max-value", maxValue, false, multi, nil}, // several inputs
+
+		{"change-output", changeOutput, true, multi, dust1},       // pays back to an input's address
+		{"change-output", changeOutput, true, payee, payeeChange}, // the only value that isn't round
+		{"change-output", changeOutput, false, dust1, multi},
+		{"change-output", changeOutput, false, after, dust2}, // the input spending dust2's change
+		{"change-output", changeOutput, false, multi, nil},   // neither funding tx has change
+
+		{"same-address", sameAddress, true, fund2, multi},
+		{"same-address", sameAddress, true, multi, dust1},
+		{"same-address", sameAddress, true, fund1, nil},
+		{"same-address", sameAddress, false, after, dust2},
+		{"same-address", sameAddress, false, payee, nil},
+
+		{"dust-pattern", dustPattern, true, dust1, dust2},
+		{"dust-pattern", dustPattern, true, dust2, nil}, // after isn't in the pattern
+		{"dust-pattern", dustPattern, false, dust2, dust1},
+		{"dust-pattern", dustPattern, false, dust1, nil}, // nor is multi
+
+		{"largest-input", largestInput, true, multi, payee},
+		{"largest-input", largestInput, false, multi, fund2},
+		{"largest-input", largestInput, false, after, dust2},
+		{"largest-input", largestInput, false, fund1, nil},
+	}
+
+	for i, c := range cases {
+		tx, err := db.GetTx(c.from.TxHash())
+		if err != nil {
+			T.Fatal(err)
+		}
+
+		var next chainhash.Hash
+		var found bool
+		if c.forward {
+			next, found, err = c.strategy.Forward(tx)
+		} else {
+			next, found, err = c.strategy.Backward(tx)
+		}
+		if err != nil {
+			T.Fatalf("case %v (%v): %v", i, c.name, err)
+		}
+
+		if c.expected == nil && found {
+			T.Errorf("case %v (%v): expected the chain to stop, got %v", i, c.name, next)
+		} else if c.expected != nil && (!found || next != c.expected.TxHash()) {
+			T.Errorf("case %v (%v): expected %v, got %v (found: %v)", i, c.name, c.expected.TxHash(), next, found)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package txhashsource
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -8,75 +9,84 @@ import (
 	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
 )
 
-func NewChain(db *BlockDB, startHash chainhash.Hash, limit uint) TxHashSource {
-	ch := make(chan chainhash.Hash)
-	go func() {
-		defer close(ch)
+func NewChain(db *BlockDB, startHash chainhash.Hash, limit uint, strategy NextTxStrategy) *TxHashSource {
+	return newTxHashSource(func(ctx context.Context, yield func(chainhash.Hash) error) error {
+		backwards := NewBackwardChain(db, startHash, limit, strategy)
+		forwards := NewForwardChain(db, startHash, limit, strategy)
 
-		chBackwards := NewBackwardChain(db, startHash, limit)
-		chForwards := NewForwardChain(db, startHash, limit)
+		for {
+			hash, exists, err := backwards.NextHash(ctx)
+			if err != nil {
+				return err
+			} else if !exists {
+				break
+			}
 
-		for hash := range chBackwards {
-			ch <- hash
+			err = yield(hash)
+			if err != nil {
+				return err
+			}
 		}
 
-		<-chForwards // skip first element from forward source because both backwards + forwards contain startHash
-		for hash := range chForwards {
-			ch <- hash
+		// skip first element from forward source because both backwards + forwards contain startHash
+		_, _, err := forwards.NextHash(ctx)
+		if err != nil {
+			return err
 		}
-	}()
 
-	return TxHashSource(ch)
-}
+		for {
+			hash, exists, err := forwards.NextHash(ctx)
+			if err != nil {
+				return err
+			} else if !exists {
+				return nil
+			}
 
-func NewForwardChain(db *BlockDB, startHash chainhash.Hash, limit uint) TxHashSource {
-	ch := make(chan chainhash.Hash)
-	go func() {
-		defer close(ch)
+			err = yield(hash)
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
 
+func NewForwardChain(db *BlockDB, startHash chainhash.Hash, limit uint, strategy NextTxStrategy) *TxHashSource {
+	return newTxHashSource(func(ctx context.Context, yield func(chainhash.Hash) error) error {
 		currentTxHash := startHash
 		var i uint
 		for {
 			if limit > 0 && i >= limit {
-				break
+				return nil
 			}
 
 			tx, err := db.GetTx(currentTxHash)
-			if err != nil {
-				// @@TODO
-				panic(err)
+			if IsNotFound(err) {
+				fmt.Printf("stopping forward chain at %v (not found in the local index)\n", currentTxHash)
+				return nil
+			} else if err != nil {
+				return err
 			}
 
-			// if !tx.HasSuspiciousOutputValues() {
-			// 	fmt.Println("no suspicious output values, stopping")
-			// 	break
-			// }
-			ch <- currentTxHash
+			err = yield(currentTxHash)
+			if err != nil {
+				return err
+			}
 
-			key := SpentTxOutKey{TxHash: *tx.Hash(), TxOutIndex: uint32(tx.FindMaxValueTxOut())}
-			spentTxOut, err := db.GetSpentTxOut(key)
+			nextTxHash, found, err := strategy.Forward(tx)
 			if err != nil {
-				fmt.Println("err", err)
-				// @@TODO
-				// panic(err)
-				break
+				return err
+			} else if !found {
+				return nil
 			}
 
-			currentTxHash = spentTxOut.InputTxHash
+			currentTxHash = nextTxHash
 			i++
 		}
-	}()
-
-	return TxHashSource(ch)
+	})
 }
 
-func NewBackwardChain(db *BlockDB, startHash chainhash.Hash, limit uint) TxHashSource {
-	ch := make(chan chainhash.Hash)
-	go func() {
-		defer close(ch)
-
-		emptyHash := chainhash.Hash{}
-
+func NewBackwardChain(db *BlockDB, startHash chainhash.Hash, limit uint, strategy NextTxStrategy) *TxHashSource {
+	return newTxHashSource(func(ctx context.Context, yield func(chainhash.Hash) error) error {
 		foundHashesReverse := []chainhash.Hash{}
 		currentTxHash := startHash
 		var i uint
@@ -85,41 +95,39 @@ func NewBackwardChain(db *BlockDB, startHash chainhash.Hash, limit uint) TxHashS
 				break
 			}
 
-			if currentTxHash == emptyHash {
-				// this is the coinbase, so we can't follow further backwards
-				break
+			// the whole chain has to be crawled before the first hash can be yielded, so check for
+			// cancellation here too
+			if ctx.Err() != nil {
+				return ctx.Err()
 			}
 
 			tx, err := db.GetTx(currentTxHash)
-			if err != nil {
-				// @@TODO
-				panic(err)
+			if IsNotFound(err) {
+				fmt.Printf("stopping backward chain at %v (not found in the local index)\n", currentTxHash)
+				break
+			} else if err != nil {
+				return err
 			}
 
-			// if tx.HasSuspiciousOutputValues() {
 			foundHashesReverse = append(foundHashesReverse, currentTxHash)
-			if len(tx.MsgTx().TxIn) == 1 {
-				currentTxHash = tx.MsgTx().TxIn[0].PreviousOutPoint.Hash
-			} else {
+
+			prevTxHash, found, err := strategy.Backward(tx)
+			if err != nil {
+				return err
+			} else if !found {
 				break
 			}
-			// } else {
-			// 	break
-			// }
 
+			currentTxHash = prevTxHash
 			i++
 		}
 
-		numHashes := len(foundHashesReverse)
-		foundHashes := make([]chainhash.Hash, numHashes)
-		for i := 0; i < numHashes; i++ {
-			foundHashes[numHashes-i-1] = foundHashesReverse[i]
-		}
-
-		for _, hash := range foundHashes {
-			ch <- hash
+		for i := len(foundHashesReverse) - 1; i >= 0; i-- {
+			err := yield(foundHashesReverse[i])
+			if err != nil {
+				return err
+			}
 		}
-	}()
-
-	return TxHashSource(ch)
+		return nil
+	})
 }
@@ -1,6 +1,7 @@
 package txhashsource
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
@@ -9,16 +10,15 @@ import (
 
 	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
 	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
-	"github.com/spooktheducks/local-blockchain-parser/scanner"
 )
 
 func TestChainTxHashSource(T *testing.T) {
 	datFileDir := os.Getenv("DAT_FILE_DIR")
 	if datFileDir == "" {
-		panic("must specify DAT_FILE_DIR enviroment variable (example: DAT_FILE_DIR=/path/to/dat/files go test)")
+		T.Skip("must specify DAT_FILE_DIR enviroment variable (example: DAT_FILE_DIR=/path/to/dat/files go test)")
 	}
 
-	db, err := NewBlockDB("../blockchain.db", datFileDir)
+	db, err := NewBlockDB("../blockchain.db", datFileDir, &BlockchainInfoAPI{})
 	if err != nil {
 		panic(err)
 	}
@@ -29,12 +29,14 @@ func TestChainTxHashSource(T *testing.T) {
 		panic(err)
 	}
 
-	src := scanner.NewChainTxHashSource(db, startHash)
+	src := NewChain(db, startHash, 0, &MaxValueStrategy{DB: db})
 
 	received := []chainhash.Hash{}
 	for {
-		hash, exists := src.NextHash()
-		if !exists {
+		hash, exists, err := src.NextHash(context.Background())
+		if err != nil {
+			T.Fatal(err)
+		} else if !exists {
 			break
 		}
 
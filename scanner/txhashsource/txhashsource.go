@@ -1,14 +1,69 @@
 package txhashsource
 
 import (
+	"context"
+
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	"github.com/spooktheducks/local-blockchain-parser/scanner"
 )
 
-type TxHashSource <-chan chainhash.Hash
+// TxHashSource turns a function that produces hashes into a scanner.ITxHashSource.  The function runs on its
+// own goroutine, starting with the first call to NextHash, and passes each hash to yield.  yield returns an
+// error once the context passed to NextHash is cancelled, at which point the function should return it.  Any
+// other error returned by the function is passed on to the scanner.
+type TxHashSource struct {
+	produce func(ctx context.Context, yield func(chainhash.Hash) error) error
+	ch      chan hashOrError
+}
+
+// ensure that TxHashSource conforms to ITxHashSource
+var _ scanner.ITxHashSource = &TxHashSource{}
+
+type hashOrError struct {
+	hash chainhash.Hash
+	err  error
+}
+
+func newTxHashSource(produce func(ctx context.Context, yield func(chainhash.Hash) error) error) *TxHashSource {
+	return &TxHashSource{produce: produce}
+}
+
+func (hs *TxHashSource) NextHash(ctx context.Context) (chainhash.Hash, bool, error) {
+	if hs.ch == nil {
+		ch := make(chan hashOrError)
+		hs.ch = ch
+
+		go func() {
+			defer close(ch)
+
+			err := hs.produce(ctx, func(hash chainhash.Hash) error {
+				select {
+				case ch <- hashOrError{hash: hash}:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			if err != nil && err != ctx.Err() {
+				select {
+				case ch <- hashOrError{err: err}:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+
+	select {
+	case item, ok := <-hs.ch:
+		if !ok {
+			return chainhash.Hash{}, false, nil
+		} else if item.err != nil {
+			return chainhash.Hash{}, false, item.err
+		}
+		return item.hash, true, nil
 
-func (hs TxHashSource) NextHash() (chainhash.Hash, bool) {
-	if hash, ok := <-hs; ok {
-		return hash, true
+	case <-ctx.Done():
+		return chainhash.Hash{}, false, ctx.Err()
 	}
-	return chainhash.Hash{}, false
 }
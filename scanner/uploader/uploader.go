@@ -0,0 +1,233 @@
+package uploader
+
+import (
+	"fmt"
+	"hash/crc32"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+	"github.com/spooktheducks/local-blockchain-parser/scanner/txhashsource"
+)
+
+// Upload is a file uploaded with the Satoshi uploader, which stores the file's length and CRC32 followed by
+// the file in the fake addresses of a tx's 1-satoshi outputs, and sends the rest of its coins on to the next
+// tx when the file doesn't fit in one.
+type Upload struct {
+	TxHashes []chainhash.Hash
+
+	// the length declared in the header (for chunked uploads, the sum of the chunks' lengths)
+	Length uint64
+
+	// set if every tx carries its own header, as in the Cablegate upload, instead of only the first one
+	Chunked bool
+
+	// false if the chain ended before the declared length, or the data doesn't match the CRC32
+	ChecksumOK bool
+	Err        string
+
+	Data []byte
+
+	// detected from the data's file signature ("" and "bin" if it isn't recognized)
+	Filetype  string
+	Extension string
+}
+
+// Reconstructor finds the txs that start Satoshi uploads and follows their chains forward (along the spend of
+// each tx's largest output) to put the uploaded files back together.  It needs the transaction and
+// spent-txout indices.
+type Reconstructor struct {
+	DB *BlockDB
+
+	// used to detect the type of recovered files (utils.DefaultFileSignatures if nil)
+	Signatures utils.FileSignatures
+
+	// headers declaring more than this many bytes are taken to be random data (defaults to DefaultMaxLength)
+	MaxLength uint32
+}
+
+// DefaultMaxLength is larger than any upload found so far (Cablegate is about 2.5 MB).
+const DefaultMaxLength = 100 << 20
+
+func (u *Upload) StartTxHash() chainhash.Hash {
+	return u.TxHashes[0]
+}
+
+func (u *Upload) Description() string {
+	kind := "upload"
+	if u.Chunked {
+		kind = "chunked upload"
+	}
+	status := u.Filetype
+	if !u.ChecksumOK {
+		status = u.Err
+	} else if status == "" {
+		status = "unknown file type"
+	}
+	return fmt.Sprintf("%v of %v bytes starting at %v (%v txs): %v", kind, u.Length, u.StartTxHash(), len(u.TxHashes), status)
+}
+
+// Reconstruct returns the upload that starts at tx, or nil if tx doesn't start with an uploader header.  An
+// upload whose header promises more data than the chain holds, or whose CRC32 doesn't match, is returned
+// with ChecksumOK unset.
+func (r *Reconstructor) Reconstruct(tx *Tx) (*Upload, error) {
+	data, err := tx.ConcatNonOPDataFromTxOuts()
+	if err != nil {
+		return nil, err
+	}
+
+	length, checksum, ok := utils.ParseSatoshiHeader(data)
+	if !ok || length > r.maxLength() {
+		return nil, nil
+	}
+
+	var upload *Upload
+	if utils.SatoshiHeaderLen+int(length) <= len(data) {
+		// the whole file is in this tx, so either it's a single-tx upload or the first of a chunked one
+		if crc32.ChecksumIEEE(data[utils.SatoshiHeaderLen:utils.SatoshiHeaderLen+int(length)]) != checksum {
+			return nil, nil
+		}
+		upload, err = r.reconstructChunked(tx)
+	} else {
+		// random data often looks like a header, so an upload spanning several txs has to at least have the
+		// uploader's 1-satoshi outputs
+		if !tx.HasSuspiciousOutputValues() {
+			return nil, nil
+		}
+		upload, err = r.reconstructSpanning(tx, length, checksum)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.ChecksumOK {
+		upload.Filetype, upload.Extension = r.detectFiletype(upload.Data)
+	}
+	return upload, nil
+}
+
+// reconstructChunked concatenates the files in tx and each following tx that holds a whole file of its own.
+func (r *Reconstructor) reconstructChunked(tx *Tx) (*Upload, error) {
+	upload := &Upload{ChecksumOK: true}
+	for {
+		data, err := tx.ConcatNonOPDataFromTxOuts()
+		if err != nil {
+			return nil, err
+		}
+		chunk, err := utils.GetSatoshiEncodedData(data)
+		if err != nil {
+			break
+		}
+
+		upload.TxHashes = append(upload.TxHashes, *tx.Hash())
+		upload.Data = append(upload.Data, chunk...)
+		upload.Length += uint64(len(chunk))
+
+		tx, err = r.nextTx(tx)
+		if err != nil {
+			return nil, err
+		} else if tx == nil {
+			break
+		}
+	}
+
+	upload.Chunked = len(upload.TxHashes) > 1
+	return upload, nil
+}
+
+// reconstructSpanning collects the data in tx and the txs after it until there's as much as the header
+// declares.  The largest output of each tx is the uploader's change, so it's left out.
+func (r *Reconstructor) reconstructSpanning(tx *Tx, length, checksum uint32) (*Upload, error) {
+	upload := &Upload{Length: uint64(length)}
+	data := []byte{}
+	for {
+		txData := uploadDataFromTx(tx)
+		if len(txData) == 0 {
+			break
+		}
+		upload.TxHashes = append(upload.TxHashes, *tx.Hash())
+		data = append(data, txData...)
+		if len(data) >= utils.SatoshiHeaderLen+int(length) {
+			break
+		}
+
+		var err error
+		tx, err = r.nextTx(tx)
+		if err != nil {
+			return nil, err
+		} else if tx == nil {
+			break
+		}
+	}
+
+	if len(data) < utils.SatoshiHeaderLen+int(length) {
+		upload.Err = fmt.Sprintf("the chain ended after %v of %v bytes", len(data)-utils.SatoshiHeaderLen, length)
+		return upload, nil
+	}
+
+	upload.Data = data[utils.SatoshiHeaderLen : utils.SatoshiHeaderLen+int(length)]
+	if crc32.ChecksumIEEE(upload.Data) != checksum {
+		upload.Err = "crc32 mismatch"
+		upload.Data = nil
+		return upload, nil
+	}
+	upload.ChecksumOK = true
+	return upload, nil
+}
+
+// uploadDataFromTx returns the data in every output of tx but the largest.
+func uploadDataFromTx(tx *Tx) []byte {
+	skipIdx := -1
+	if len(tx.MsgTx().TxOut) > 1 {
+		skipIdx = tx.FindMaxValueTxOut()
+	}
+
+	data := []byte{}
+	for i := range tx.MsgTx().TxOut {
+		if i == skipIdx {
+			continue
+		}
+		bs, err := tx.GetNonOPDataFromTxOut(i)
+		if err != nil {
+			continue
+		}
+		data = append(data, bs...)
+	}
+	return data
+}
+
+// nextTx returns the tx that spends tx's largest output, or nil if it's unspent (or the spend isn't indexed).
+func (r *Reconstructor) nextTx(tx *Tx) (*Tx, error) {
+	nextHash, ok, err := (&txhashsource.MaxValueStrategy{DB: r.DB}).Forward(tx)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	next, err := r.DB.GetTx(nextHash)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	return next, err
+}
+
+func (r *Reconstructor) detectFiletype(data []byte) (string, string) {
+	signatures := r.Signatures
+	if signatures == nil {
+		signatures = utils.DefaultFileSignatures()
+	}
+
+	for _, found := range signatures.Search(data) {
+		if found.Offset == 0 && !found.Reversed && !found.Footer && found.Extension != "" {
+			return found.Filetype, found.Extension
+		}
+	}
+	return "", "bin"
+}
+
+func (r *Reconstructor) maxLength() uint32 {
+	if r.MaxLength == 0 {
+		return DefaultMaxLength
+	}
+	return r.MaxLength
+}
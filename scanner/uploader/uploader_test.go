@@ -0,0 +1,116 @@
+package uploader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	. "github.com/spooktheducks/local-blockchain-parser/blockdb"
+	"github.com/spooktheducks/local-blockchain-parser/cmds/utils"
+	"github.com/spooktheducks/local-blockchain-parser/internal/testdat"
+)
+
+// satoshiEncode prefixes data with the uploader's header and pads it to a whole number of addresses.
+func satoshiEncode(data []byte) []byte {
+	encoded := make([]byte, utils.SatoshiHeaderLen)
+	binary.LittleEndian.PutUint32(encoded[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint32(encoded[4:8], crc32.ChecksumIEEE(data))
+	encoded = append(encoded, data...)
+	if len(encoded)%20 != 0 {
+		encoded = append(encoded, make([]byte, 20-len(encoded)%20)...)
+	}
+	return encoded
+}
+
+// newUploadTx spends prevOut and stores data in 1-satoshi P2PKH outputs, followed by a change output.
+func newUploadTx(T *testing.T, prevOut wire.OutPoint, data []byte) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&prevOut, []byte{0x51}))
+	for i := 0; i < len(data); i += 20 {
+		script, err := txscript.NewScriptBuilder().AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).
+			AddData(data[i : i+20]).AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG).Script()
+		if err != nil {
+			T.Fatal(err)
+		}
+		tx.AddTxOut(wire.NewTxOut(1, script))
+	}
+	tx.AddTxOut(wire.NewTxOut(5000000, []byte{txscript.OP_TRUE}))
+	return tx
+}
+
+func TestReconstruct(T *testing.T) {
+	// a file spanning two txs, with a single header
+	pdf := []byte("%PDF-1.4 a document that doesn't fit in one tx %%EOF")
+	encoded := satoshiEncode(pdf)
+	spanning1 := newUploadTx(T, wire.OutPoint{Index: 0xffffffff}, encoded[:40])
+	spanning2 := newUploadTx(T, wire.OutPoint{Hash: spanning1.TxHash(), Index: 2}, encoded[40:])
+
+	// a file split into two chunks, each with its own header
+	chunked1 := newUploadTx(T, wire.OutPoint{Index: 0xfffffffe}, satoshiEncode([]byte{0x37, 0x7a, 0xbc, 0xaf, 0x27, 0x1c, 0x00}))
+	chunked2 := newUploadTx(T, wire.OutPoint{Hash: chunked1.TxHash(), Index: 1}, satoshiEncode([]byte("the second chunk")))
+
+	bl := wire.NewMsgBlock(&chaincfg.MainNetParams.GenesisBlock.Header)
+	for _, tx := range []*wire.MsgTx{spanning1, spanning2, chunked1, chunked2} {
+		bl.AddTransaction(tx)
+	}
+
+	dir := testdat.WriteDATDir(T, []*wire.MsgBlock{bl})
+	defer os.RemoveAll(dir)
+
+	db, err := NewBlockDB(filepath.Join(dir, "test.db"), dir, nil)
+	if err != nil {
+		T.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.IndexDATFileTransactions(0, 0, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+	err = db.IndexDATFileSpentTxOuts(0, 0, false)
+	if err != nil {
+		T.Fatal(err)
+	}
+
+	signatures, err := utils.ParseFileSignatures(strings.NewReader("pdf header=\"%PDF\" footer=\"%%EOF\" max=1m ext=pdf\n7z header=377abcaf271c max=1m ext=7z\n"))
+	if err != nil {
+		T.Fatal(err)
+	}
+	r := &Reconstructor{DB: db, Signatures: signatures}
+
+	reconstruct := func(msgTx *wire.MsgTx) *Upload {
+		tx, err := db.GetTx(msgTx.TxHash())
+		if err != nil {
+			T.Fatal(err)
+		}
+		upload, err := r.Reconstruct(tx)
+		if err != nil {
+			T.Fatal(err)
+		}
+		return upload
+	}
+
+	upload := reconstruct(spanning1)
+	if upload == nil || !upload.ChecksumOK || upload.Chunked || len(upload.TxHashes) != 2 || !bytes.Equal(upload.Data, pdf) || upload.Extension != "pdf" {
+		T.Fatalf("unexpected upload: %+v", upload)
+	}
+
+	// the second tx of the spanning upload doesn't start with a header
+	if upload := reconstruct(spanning2); upload != nil && upload.ChecksumOK {
+		T.Fatalf("unexpected upload: %v", upload.Description())
+	}
+
+	upload = reconstruct(chunked1)
+	expected := append([]byte{0x37, 0x7a, 0xbc, 0xaf, 0x27, 0x1c, 0x00}, "the second chunk"...)
+	if upload == nil || !upload.ChecksumOK || !upload.Chunked || len(upload.TxHashes) != 2 || !bytes.Equal(upload.Data, expected) || upload.Extension != "7z" {
+		T.Fatalf("unexpected upload: %+v", upload)
+	}
+}